@@ -0,0 +1,268 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Aruminium/goecat/pkg/diag"
+	"github.com/Aruminium/goecat/pkg/ethercat/sii"
+	"github.com/Aruminium/goecat/pkg/topology"
+)
+
+var slavesCommand = command{
+	name:    "slaves",
+	summary: "list the slaves with their state, identity and name",
+	setup: func(flags *flag.FlagSet) runner {
+		verbose := flags.Bool("v", false, "show the mailboxes and protocols as well")
+		return func(ctx context.Context, s *session, args []string) error {
+			if err := arguments(args, 0, 0); err != nil {
+				return err
+			}
+			slaves, err := s.slaves(ctx, true)
+			if err != nil {
+				return err
+			}
+
+			w := tabwriter.NewWriter(s.out, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "POS\tSTATION\tALIAS\tSTATE\tVENDOR\tPRODUCT\tREVISION\tNAME")
+			for _, slave := range slaves {
+				id := slave.SII.Identity
+				fmt.Fprintf(w, "%d\t0x%04x\t%d\t%v\t0x%08x\t0x%08x\t0x%08x\t%s\n",
+					slave.Position, slave.Station, slave.Alias, slave.State, id.VendorID, id.ProductCode, id.RevisionNo, slave.Name())
+				if *verbose {
+					fmt.Fprintf(w, "\tserial 0x%08x, %s\n", id.SerialNo, mailboxes(slave.SII))
+				}
+			}
+			return w.Flush()
+		}
+	},
+}
+
+var statesCommand = command{
+	name:    "states",
+	args:    "[STATE]",
+	summary: "show the AL states, or request STATE (INIT, PREOP, BOOT, SAFEOP or OP)",
+	setup: func(flags *flag.FlagSet) runner {
+		return func(ctx context.Context, s *session, args []string) error {
+			if err := arguments(args, 0, 1); err != nil {
+				return err
+			}
+			slaves, err := s.slaves(ctx, false)
+			if err != nil {
+				return err
+			}
+
+			if len(args) == 1 {
+				state, err := parseState(args[0])
+				if err != nil {
+					return err
+				}
+				for _, slave := range slaves {
+					if err := s.requestState(ctx, slave, state); err != nil {
+						return err
+					}
+				}
+				if slaves, err = s.slaves(ctx, false); err != nil {
+					return err
+				}
+			}
+
+			for _, slave := range slaves {
+				fmt.Fprintf(s.out, "%d  0x%04x  %v", slave.Position, slave.Station, slave.State)
+				if slave.StatusCode != 0 {
+					fmt.Fprintf(s.out, "  %v", slave.StatusCode)
+				}
+				fmt.Fprintln(s.out)
+			}
+			return nil
+		}
+	},
+}
+
+var topologyCommand = command{
+	name:    "topology",
+	summary: "show how the slaves are wired, as a tree or as a Graphviz graph",
+	setup: func(flags *flag.FlagSet) runner {
+		dot := flags.Bool("dot", false, "print a Graphviz graph instead of a tree")
+		ports := flags.Bool("ports", false, "print the state of every port instead of a tree")
+		return func(ctx context.Context, s *session, args []string) error {
+			if err := arguments(args, 0, 0); err != nil {
+				return err
+			}
+			// The tree needs every slave, so --position is ignored.
+			all := *s
+			all.position = -1
+			slaves, err := all.slaves(ctx, true)
+			if err != nil {
+				return err
+			}
+			tree, err := topology.Build(slaves)
+
+			switch {
+			case *ports:
+				return printPorts(s.out, tree)
+			case *dot:
+				fmt.Fprint(s.out, tree.DOT())
+			default:
+				fmt.Fprint(s.out, tree.Text())
+			}
+			return err
+		}
+	},
+}
+
+var errorsCommand = command{
+	name:    "errors",
+	summary: "show the error counters of every port and where errors entered the segment",
+	setup: func(flags *flag.FlagSet) runner {
+		interval := flags.Duration("interval", 0, "sample repeatedly and show only the increase, 0 for one reading")
+		count := flags.Int("count", 0, "number of intervals with --interval, 0 until the timeout")
+		reset := flags.Bool("reset", false, "clear the error counters")
+		return func(ctx context.Context, s *session, args []string) error {
+			if err := arguments(args, 0, 0); err != nil {
+				return err
+			}
+			slaves, err := s.slaves(ctx, false)
+			if err != nil {
+				return err
+			}
+			monitor := diag.NewMonitor(s.x, slaves)
+			if *reset {
+				return monitor.Reset(ctx)
+			}
+
+			// Errors are attributed to cables with the tree of all slaves.
+			all := *s
+			all.position = -1
+			segment, err := all.slaves(ctx, false)
+			if err != nil {
+				return err
+			}
+			tree, err := topology.Build(segment)
+			if err != nil {
+				// Without a consistent tree the errors are reported per port only.
+				tree = nil
+			}
+
+			sample, err := monitor.Sample(ctx)
+			if err != nil {
+				return err
+			}
+			if *interval <= 0 {
+				if err := printCounters(s.out, sample); err != nil {
+					return err
+				}
+				printFindings(s.out, diag.Locate(sample, tree))
+				return nil
+			}
+
+			for n := 0; *count == 0 || n < *count; n++ {
+				select {
+				case <-ctx.Done():
+					// The timeout ends an unbounded run.
+					if *count == 0 {
+						return nil
+					}
+					return ctx.Err()
+				case <-time.After(*interval):
+				}
+				if sample, err = monitor.Sample(ctx); err != nil {
+					return err
+				}
+				for _, finding := range diag.Locate(sample, tree) {
+					fmt.Fprintf(s.out, "%s  %v\n", sample.Time.Format(time.TimeOnly), finding)
+				}
+			}
+			return nil
+		}
+	},
+}
+
+// printCounters prints the error counters of every slave with one column per port.
+func printCounters(out io.Writer, sample diag.Sample) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "POS\tSTATION\tINVALID\tRX\tFORWARDED\tLOST LINK\tECAT\tPDI")
+	for _, slave := range sample.Slaves {
+		c := slave.Counters
+		fmt.Fprintf(w, "%d\t0x%04x\t%s\t%s\t%s\t%s\t%d\t%d\n", slave.Position, slave.Station,
+			perPort(c.InvalidFrame), perPort(c.RXError), perPort(c.ForwardedRXError), perPort(c.LostLink), c.ProcessingUnit, c.PDI)
+	}
+	return w.Flush()
+}
+
+// printFindings prints one line per finding, or that no errors were counted.
+func printFindings(out io.Writer, findings []diag.Finding) {
+	if len(findings) == 0 {
+		fmt.Fprintln(out, "no errors")
+		return
+	}
+	for _, finding := range findings {
+		fmt.Fprintln(out, finding)
+	}
+}
+
+// perPort formats a counter of every port as "port0/port1/port2/port3".
+func perPort(counters [topology.Ports]uint8) string {
+	values := make([]string, len(counters))
+	for i, value := range counters {
+		values[i] = fmt.Sprint(value)
+	}
+	return strings.Join(values, "/")
+}
+
+// printPorts prints the link, communication and loop state of every port of every slave.
+func printPorts(out io.Writer, tree *topology.Tree) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "POS\tSTATION\tPORT 0\tPORT 1\tPORT 2\tPORT 3")
+	for _, n := range tree.Nodes {
+		fmt.Fprintf(w, "%d\t0x%04x", n.Slave.Position, n.Slave.Station)
+		for _, port := range n.Ports {
+			state := []string{"no link"}
+			if port.Link {
+				state[0] = "link"
+			}
+			if port.Communication {
+				state = append(state, "comm")
+			}
+			if port.Closed {
+				state = append(state, "closed")
+			} else {
+				state = append(state, "open")
+			}
+			fmt.Fprintf(w, "\t%s", strings.Join(state, ","))
+		}
+		fmt.Fprintln(w)
+	}
+	return w.Flush()
+}
+
+// mailboxes describes the standard mailboxes and the mailbox protocols of a slave.
+func mailboxes(image sii.Image) string {
+	if image.StdRx.Size == 0 {
+		return "no mailbox"
+	}
+
+	var protocols []string
+	for _, p := range []struct {
+		bit  uint16
+		name string
+	}{
+		{sii.ProtocolAoE, "AoE"},
+		{sii.ProtocolEoE, "EoE"},
+		{sii.ProtocolCoE, "CoE"},
+		{sii.ProtocolFoE, "FoE"},
+		{sii.ProtocolSoE, "SoE"},
+		{sii.ProtocolVoE, "VoE"},
+	} {
+		if image.MailboxProtocol&p.bit != 0 {
+			protocols = append(protocols, p.name)
+		}
+	}
+	return fmt.Sprintf("mailbox out 0x%04x/%d in 0x%04x/%d, protocols %s",
+		image.StdRx.Offset, image.StdRx.Size, image.StdTx.Offset, image.StdTx.Size, strings.Join(protocols, " "))
+}
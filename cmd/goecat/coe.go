@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/Aruminium/goecat/pkg/ethercat/coe"
+	"github.com/Aruminium/goecat/pkg/ethercat/sii"
+)
+
+// coeDetailsSDOInfo is the bit of General.CoEDetails that marks support for SDO information.
+const coeDetailsSDOInfo = 0x02
+
+// PDO assignment objects of the process data SyncManagers: 0x1C10 + SyncManager number.
+const (
+	pdoAssignment uint16 = 0x1C10
+	firstPDOSM           = 2
+	lastPDOSM            = 3
+)
+
+var sdoUploadCommand = command{
+	name:    "sdo upload",
+	args:    "INDEX SUBINDEX",
+	summary: "read an entry of the object dictionary of a slave",
+	setup: func(flags *flag.FlagSet) runner {
+		typeName := flags.String("type", "", "data type of the entry, such as UDINT; read with SDO information if empty")
+		return func(ctx context.Context, s *session, args []string) error {
+			if err := arguments(args, 2, 2); err != nil {
+				return err
+			}
+			index, subIndex, err := parseEntry(args[0], args[1])
+			if err != nil {
+				return err
+			}
+			client, info, err := s.coe(ctx)
+			if err != nil {
+				return err
+			}
+
+			t := coe.OctetString
+			if *typeName != "" || info {
+				if t, err = entryType(ctx, client, index, subIndex, *typeName); err != nil {
+					return err
+				}
+			}
+			value, err := client.Upload(ctx, index, subIndex)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(s.out, t.Format(value))
+			return nil
+		}
+	},
+}
+
+var sdoDownloadCommand = command{
+	name:    "sdo download",
+	args:    "INDEX SUBINDEX VALUE",
+	summary: "write an entry of the object dictionary of a slave",
+	setup: func(flags *flag.FlagSet) runner {
+		typeName := flags.String("type", "", "data type of the entry, such as UDINT; read with SDO information if empty")
+		return func(ctx context.Context, s *session, args []string) error {
+			if err := arguments(args, 3, 3); err != nil {
+				return err
+			}
+			index, subIndex, err := parseEntry(args[0], args[1])
+			if err != nil {
+				return err
+			}
+			client, info, err := s.coe(ctx)
+			if err != nil {
+				return err
+			}
+			if *typeName == "" && !info {
+				return errors.New("the slave does not support SDO information, use --type")
+			}
+
+			t, err := entryType(ctx, client, index, subIndex, *typeName)
+			if err != nil {
+				return err
+			}
+			value, err := t.Parse(args[2])
+			if err != nil {
+				return err
+			}
+			return client.Download(ctx, index, subIndex, value)
+		}
+	},
+}
+
+var sdoListCommand = command{
+	name:    "sdo list",
+	summary: "list the object dictionary of a slave with SDO information",
+	setup: func(flags *flag.FlagSet) runner {
+		return func(ctx context.Context, s *session, args []string) error {
+			if err := arguments(args, 0, 0); err != nil {
+				return err
+			}
+			client, info, err := s.coe(ctx)
+			if err != nil {
+				return err
+			}
+			if !info {
+				return errors.New("the slave does not support SDO information")
+			}
+			indices, err := client.ObjectList(ctx, coe.ListAll)
+			if err != nil {
+				return err
+			}
+
+			for _, index := range indices {
+				o, err := client.ObjectDescription(ctx, index)
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(s.out, "SDO 0x%04x, %q %v\n", o.Index, o.Name, o.ObjectCode)
+
+				for sub := 0; sub <= int(o.MaxSubIndex); sub++ {
+					e, err := client.EntryDescription(ctx, index, uint8(sub))
+					var abort coe.AbortCode
+					if errors.As(err, &abort) {
+						continue // Gaps in the subindices
+					}
+					if err != nil {
+						return err
+					}
+					fmt.Fprintf(s.out, "  0x%04x:%02x, %v, %v, %d bit, %q\n", e.Index, e.SubIndex, e.Access, e.DataType, e.BitLength, e.Name)
+				}
+			}
+			return nil
+		}
+	},
+}
+
+var pdosCommand = command{
+	name:    "pdos",
+	summary: "show the PDO assignment and mapping of a slave, from CoE if supported and the SII otherwise",
+	setup: func(flags *flag.FlagSet) runner {
+		fromSII := flags.Bool("sii", false, "show the PDOs of the SII even if the slave supports CoE")
+		return func(ctx context.Context, s *session, args []string) error {
+			if err := arguments(args, 0, 0); err != nil {
+				return err
+			}
+			slave, err := s.slave(ctx, true)
+			if err != nil {
+				return err
+			}
+
+			if *fromSII || slave.SII.MailboxProtocol&sii.ProtocolCoE == 0 {
+				printSIIPDOs(s.out, slave.SII, "RxPDO", slave.SII.RxPDOs)
+				printSIIPDOs(s.out, slave.SII, "TxPDO", slave.SII.TxPDOs)
+				return nil
+			}
+			conn, err := s.mailbox(ctx, slave)
+			if err != nil {
+				return err
+			}
+			return printCoEPDOs(ctx, s.out, coe.NewClient(conn))
+		}
+	},
+}
+
+// coe scans the segment and returns a CoE client for the selected slave, and whether the slave
+// supports SDO information according to its SII.
+func (s *session) coe(ctx context.Context) (*coe.Client, bool, error) {
+	slave, err := s.slave(ctx, true)
+	if err != nil {
+		return nil, false, err
+	}
+	conn, err := s.mailbox(ctx, slave)
+	if err != nil {
+		return nil, false, err
+	}
+	info := slave.SII.General != nil && slave.SII.General.CoEDetails&coeDetailsSDOInfo != 0
+	return coe.NewClient(conn), info, nil
+}
+
+// printCoEPDOs prints the PDOs assigned to the process data SyncManagers with their mapping.
+func printCoEPDOs(ctx context.Context, out io.Writer, client *coe.Client) error {
+	for sm := firstPDOSM; sm <= lastPDOSM; sm++ {
+		assigned, err := uploadList(ctx, client, pdoAssignment+uint16(sm), 2)
+		if err != nil {
+			return err
+		}
+		for _, pdo := range assigned {
+			fmt.Fprintf(out, "SM%d: %s 0x%04x\n", sm, pdoDirection(uint16(pdo)), pdo)
+
+			mapping, err := uploadList(ctx, client, uint16(pdo), 4)
+			if err != nil {
+				return err
+			}
+			for _, m := range mapping {
+				fmt.Fprintf(out, "  PDO entry 0x%04x:%02x, %2d bit\n", m>>16, (m>>8)&0xff, m&0xff)
+			}
+		}
+	}
+	return nil
+}
+
+// uploadList reads an object whose subindex 0 holds the number of the following subindices,
+// each of them size bytes long, as PDO assignment and mapping objects do.
+func uploadList(ctx context.Context, client *coe.Client, index uint16, size int) ([]uint32, error) {
+	count, err := client.Upload(ctx, index, 0)
+	if err != nil {
+		return nil, fmt.Errorf("0x%04x:00: %w", index, err)
+	}
+	if len(count) == 0 {
+		return nil, fmt.Errorf("0x%04x:00 is empty", index)
+	}
+
+	result := make([]uint32, 0, count[0])
+	for sub := 1; sub <= int(count[0]); sub++ {
+		value, err := client.Upload(ctx, index, uint8(sub))
+		if err != nil {
+			return nil, fmt.Errorf("0x%04x:%02x: %w", index, sub, err)
+		}
+		if len(value) < size {
+			return nil, fmt.Errorf("0x%04x:%02x has %d bytes, expected %d", index, sub, len(value), size)
+		}
+		if size == 2 {
+			result = append(result, uint32(binary.LittleEndian.Uint16(value)))
+		} else {
+			result = append(result, binary.LittleEndian.Uint32(value))
+		}
+	}
+	return result, nil
+}
+
+// pdoDirection names the PDO kind from its index.
+func pdoDirection(index uint16) string {
+	if index >= 0x1A00 && index < 0x1C00 {
+		return "TxPDO"
+	}
+	return "RxPDO"
+}
+
+// entryType returns the data type given with --type, or the one the slave describes with SDO information.
+func entryType(ctx context.Context, client *coe.Client, index uint16, subIndex uint8, name string) (coe.DataType, error) {
+	if name != "" {
+		return coe.ParseDataType(name)
+	}
+	e, err := client.EntryDescription(ctx, index, subIndex)
+	if err != nil {
+		return 0, err
+	}
+	return e.DataType, nil
+}
+
+// parseEntry parses an object index and a subindex.
+func parseEntry(index string, subIndex string) (uint16, uint8, error) {
+	i, err := parseUint(index, 16, "index")
+	if err != nil {
+		return 0, 0, err
+	}
+	sub, err := parseUint(subIndex, 8, "subindex")
+	if err != nil {
+		return 0, 0, err
+	}
+	return uint16(i), uint8(sub), nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+	"path/filepath"
+
+	"github.com/Aruminium/goecat/pkg/ethercat/foe"
+)
+
+var foeReadCommand = command{
+	name:    "foe read",
+	args:    "NAME",
+	summary: "read a file from a slave with FoE",
+	setup: func(flags *flag.FlagSet) runner {
+		output := flags.String("o", "", "file to write the content to instead of the standard output")
+		password := flags.Uint("password", 0, "FoE password")
+		return func(ctx context.Context, s *session, args []string) error {
+			if err := arguments(args, 1, 1); err != nil {
+				return err
+			}
+			slave, err := s.slave(ctx, false)
+			if err != nil {
+				return err
+			}
+			conn, err := s.mailbox(ctx, slave)
+			if err != nil {
+				return err
+			}
+			data, err := foe.NewClient(conn).Read(ctx, args[0], uint32(*password))
+			if err != nil {
+				return err
+			}
+
+			if *output != "" {
+				return os.WriteFile(*output, data, 0o644)
+			}
+			_, err = s.out.Write(data)
+			return err
+		}
+	},
+}
+
+var foeWriteCommand = command{
+	name:    "foe write",
+	args:    "FILE [NAME]",
+	summary: "write a file to a slave with FoE, named after FILE unless NAME is given",
+	setup: func(flags *flag.FlagSet) runner {
+		password := flags.Uint("password", 0, "FoE password")
+		return func(ctx context.Context, s *session, args []string) error {
+			if err := arguments(args, 1, 2); err != nil {
+				return err
+			}
+			data, err := os.ReadFile(args[0])
+			if err != nil {
+				return err
+			}
+			name := filepath.Base(args[0])
+			if len(args) == 2 {
+				name = args[1]
+			}
+
+			slave, err := s.slave(ctx, false)
+			if err != nil {
+				return err
+			}
+			conn, err := s.mailbox(ctx, slave)
+			if err != nil {
+				return err
+			}
+			return foe.NewClient(conn).Write(ctx, name, uint32(*password), data)
+		}
+	},
+}
@@ -0,0 +1,189 @@
+// Command goecat inspects and configures the slaves of an EtherCAT segment from the command line.
+//
+// Usage:
+//
+//	goecat COMMAND [SUBCOMMAND] [FLAGS] [ARGUMENTS]
+//
+// Every command accepts --interface (-i) to select the network interface, --transport raw|udp,
+// --position (-p) to select a slave by its position in the segment and --timeout. Run
+// "goecat help" for the list of commands.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Aruminium/goecat/pkg/link"
+	"github.com/Aruminium/goecat/pkg/transceiver"
+)
+
+// errUsage is returned when the command line is invalid; the usage has been printed already.
+var errUsage = errors.New("invalid usage")
+
+// opener opens the link to the segment on a network interface.
+type opener func(iface string, transport link.Transport) (link.Link, link.Encapsulation, error)
+
+// runner executes a command on the segment with the arguments left after the flags.
+type runner func(ctx context.Context, s *session, args []string) error
+
+// command is a command or a subcommand such as "sdo upload".
+type command struct {
+	name    string
+	args    string // Synopsis of the arguments
+	summary string
+	// setup registers the flags of the command and returns the function executing it.
+	setup func(flags *flag.FlagSet) runner
+}
+
+// commands lists the commands in the order "goecat help" shows them.
+var commands = []command{
+	slavesCommand,
+	statesCommand,
+	regReadCommand,
+	regWriteCommand,
+	siiReadCommand,
+	siiWriteCommand,
+	siiAliasCommand,
+	siiDumpCommand,
+	sdoUploadCommand,
+	sdoDownloadCommand,
+	sdoListCommand,
+	pdosCommand,
+	foeReadCommand,
+	foeWriteCommand,
+	xmlCommand,
+	topologyCommand,
+	errorsCommand,
+	metricsCommand,
+}
+
+func main() {
+	if err := run(context.Background(), os.Args[1:], os.Stdout, os.Stderr, openPcap); err != nil {
+		if !errors.Is(err, errUsage) {
+			fmt.Fprintf(os.Stderr, "goecat: %v\n", err)
+		}
+		os.Exit(1)
+	}
+}
+
+// run parses the command line and executes the command.
+//
+// Parameters:
+//   - ctx (context.Context): Context bounding the command
+//   - args ([]string): Command line without the program name
+//   - stdout (io.Writer): Output of the command
+//   - stderr (io.Writer): Usage and flag errors
+//   - open (opener): Opens the link to the segment
+//
+// Returns:
+//   - error: errUsage if the command line is invalid, or the error of the command
+func run(ctx context.Context, args []string, stdout io.Writer, stderr io.Writer, open opener) error {
+	cmd, rest := find(args)
+	if cmd == nil {
+		usage(stderr)
+		if len(args) > 0 && args[0] == "help" {
+			return nil
+		}
+		return errUsage
+	}
+
+	flags := flag.NewFlagSet("goecat "+cmd.name, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	var iface, transport string
+	var position int
+	var timeout time.Duration
+	flags.StringVar(&iface, "interface", "", "network interface connected to the segment")
+	flags.StringVar(&iface, "i", "", "shorthand for --interface")
+	flags.StringVar(&transport, "transport", "raw", "frame transport: raw or udp")
+	flags.IntVar(&position, "position", -1, "position of the slave, all slaves if negative")
+	flags.IntVar(&position, "p", -1, "shorthand for --position")
+	flags.DurationVar(&timeout, "timeout", 10*time.Second, "time limit of the command, none if 0")
+	exec := cmd.setup(flags)
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: goecat %s [FLAGS] %s\n\n%s\n\n", cmd.name, cmd.args, cmd.summary)
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(rest); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return errUsage
+	}
+
+	if iface == "" {
+		fmt.Fprintln(stderr, "goecat: --interface is required")
+		flags.Usage()
+		return errUsage
+	}
+	t, err := parseTransport(transport)
+	if err != nil {
+		return err
+	}
+
+	l, encap, err := open(iface, t)
+	if err != nil {
+		return err
+	}
+	// Reads are retried, except for mailbox reads, which empty the mailbox (see mailbox.Conn.Receive).
+	x := transceiver.New(l, transceiver.Options{
+		Encapsulation: encap,
+		Retry:         transceiver.FixedRetry{Max: 2, ReadOnly: true},
+	})
+	defer x.Close()
+
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	return exec(ctx, &session{out: stdout, x: x, position: position}, flags.Args())
+}
+
+// find returns the command named by the first one or two arguments and the remaining arguments.
+func find(args []string) (*command, []string) {
+	if len(args) >= 2 {
+		for i := range commands {
+			if commands[i].name == args[0]+" "+args[1] {
+				return &commands[i], args[2:]
+			}
+		}
+	}
+	if len(args) >= 1 {
+		for i := range commands {
+			if commands[i].name == args[0] {
+				return &commands[i], args[1:]
+			}
+		}
+	}
+	return nil, args
+}
+
+// usage prints the list of commands.
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: goecat COMMAND [SUBCOMMAND] [FLAGS] [ARGUMENTS]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-14s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, `Run "goecat COMMAND -h" for the flags and arguments of a command.`)
+}
+
+// parseTransport parses the value of --transport.
+func parseTransport(name string) (link.Transport, error) {
+	switch strings.ToLower(name) {
+	case "raw":
+		return link.Raw, nil
+	case "udp":
+		return link.UDP, nil
+	default:
+		return 0, fmt.Errorf("unknown transport %q, expected raw or udp", name)
+	}
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/Aruminium/goecat/pkg/esi"
+	"github.com/Aruminium/goecat/pkg/ethercat/register"
+	"github.com/Aruminium/goecat/pkg/ethercat/sii"
+	"github.com/Aruminium/goecat/pkg/link"
+	"github.com/Aruminium/goecat/pkg/simulator"
+)
+
+var encap = link.Encapsulation{Transport: link.Raw, SrcMAC: net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, 0x55}}
+
+// newSegment returns a segment of a mailbox slave with SDO information followed by a slave
+// without mailbox.
+func newSegment() *simulator.Ring {
+	info := sii.Info{
+		Identity:        sii.Identity{VendorID: 0x0000079a, ProductCode: 0x00defede, RevisionNo: 2},
+		StdRx:           simulator.DefaultRxMailbox,
+		StdTx:           simulator.DefaultTxMailbox,
+		MailboxProtocol: sii.ProtocolCoE | sii.ProtocolFoE,
+	}
+	eeprom := info.Encode(
+		sii.Strings{"Terminals", "EasyCAT", "LED", "EASYCAT-1"}.Category(),
+		sii.General{GroupIdx: 1, NameIdx: 2, OrderIdx: 4, CoEDetails: 0x03}.Category(),
+		sii.PDOsCategory(sii.CategoryRxPDO, sii.PDO{Index: 0x1600, SyncManager: 2, NameIdx: 3, Entries: []sii.PDOEntry{
+			{Index: 0x7000, SubIndex: 1, NameIdx: 3, DataType: 0x05, BitLength: 8},
+		}}),
+	)
+	mailbox := simulator.NewMailboxSlave(simulator.MailboxConfig{
+		Config: simulator.Config{EEPROM: eeprom},
+		Dictionary: simulator.ObjectDictionary{
+			0x2000: simulator.Var("Setpoint", simulator.ReadWrite, simulator.U32(0)),
+		},
+	})
+	return simulator.NewRing(mailbox.ESC, simulator.NewESC(simulator.Config{EEPROM: sii.Info{}.Encode()}))
+}
+
+// goecat runs a command line against a segment and returns its output.
+func goecat(t *testing.T, ring *simulator.Ring, args ...string) (string, error) {
+	open := func(iface string, transport link.Transport) (link.Link, link.Encapsulation, error) {
+		return ring.Attach(), encap, nil
+	}
+	var stdout bytes.Buffer
+	err := run(context.Background(), args, &stdout, io.Discard, open)
+	return stdout.String(), err
+}
+
+func TestSlaves(t *testing.T) {
+	// given
+	ring := newSegment()
+
+	// when
+	out, err := goecat(t, ring, "slaves", "-i", "sim")
+
+	// then
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 3 || !strings.Contains(lines[1], "INIT") || !strings.HasSuffix(lines[1], "EasyCAT") {
+		t.Errorf("Expected a header and two slaves, the first named EasyCAT, but got\n%s", out)
+	}
+}
+
+func TestStates(t *testing.T) {
+	// given
+	ring := newSegment()
+
+	// when
+	_, err := goecat(t, ring, "states", "-i", "sim", "-p", "0", "PREOP")
+	out, _ := goecat(t, ring, "states", "-i", "sim")
+
+	// then
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := "0  0x1001  PRE-OP\n1  0x1002  INIT\n"
+	if out != expected {
+		t.Errorf("Expected\n%s\nbut got\n%s", expected, out)
+	}
+}
+
+func TestRegRead(t *testing.T) {
+	// given
+	ring := newSegment()
+
+	// when
+	out, err := goecat(t, ring, "reg", "read", "-i", "sim", "-p", "1", "0x0130", "2")
+
+	// then
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := "0000  01 00\n0x0130 AL Status = INIT\n"
+	if out != expected {
+		t.Errorf("Expected\n%s\nbut got\n%s", expected, out)
+	}
+}
+
+func TestSIIAlias(t *testing.T) {
+	// given
+	ring := newSegment()
+
+	// when
+	_, err := goecat(t, ring, "sii", "alias", "-i", "sim", "-p", "1", "100")
+	out, _ := goecat(t, ring, "slaves", "-i", "sim")
+
+	// then
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if lines := strings.Split(out, "\n"); len(lines) < 3 || !strings.Contains(lines[2], "  100  ") {
+		t.Errorf("Expected slave 1 with alias 100, but got\n%s", out)
+	}
+}
+
+func TestSDODownloadUpload(t *testing.T) {
+	// given
+	ring := newSegment()
+
+	// when
+	_, downloadErr := goecat(t, ring, "sdo", "download", "-i", "sim", "-p", "0", "0x2000", "0", "4660")
+	value, uploadErr := goecat(t, ring, "sdo", "upload", "-i", "sim", "-p", "0", "0x2000", "0")
+	list, listErr := goecat(t, ring, "sdo", "list", "-i", "sim", "-p", "0")
+
+	// then
+	if downloadErr != nil || uploadErr != nil || listErr != nil {
+		t.Fatalf("Unexpected errors: %v, %v, %v", downloadErr, uploadErr, listErr)
+	}
+	if value != "0x00001234 4660\n" {
+		t.Errorf("Expected the written value, but got %q", value)
+	}
+	if !strings.Contains(list, "SDO 0x2000, \"Setpoint\" VAR\n  0x2000:00, rw, UDINT, 32 bit, \"Setpoint\"\n") {
+		t.Errorf("Expected the setpoint in the list, but got\n%s", list)
+	}
+}
+
+func TestSDOWithoutMailbox(t *testing.T) {
+	// given
+	ring := newSegment()
+
+	// when
+	_, err := goecat(t, ring, "sdo", "upload", "-i", "sim", "-p", "1", "0x1018", "1")
+
+	// then
+	if err == nil || !strings.Contains(err.Error(), "no mailbox") {
+		t.Errorf("Expected a missing mailbox error, but got %v", err)
+	}
+}
+
+func TestXML(t *testing.T) {
+	// given
+	ring := newSegment()
+
+	// when
+	out, err := goecat(t, ring, "xml", "-i", "sim", "-p", "0")
+
+	// then
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	info, err := esi.Decode(strings.NewReader(out))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	device := info.Devices[0]
+	if info.Vendor.ID != 0x079a || device.Type.ProductCode != 0x00defede || device.Name != "EasyCAT" || device.Type.Name != "EASYCAT-1" {
+		t.Errorf("Expected the identity and names of the SII, but got\n%s", out)
+	}
+	if len(device.RxPdos) != 1 || device.RxPdos[0].Entries[0].DataType != "USINT" || device.Mailbox == nil || device.Mailbox.CoE == nil {
+		t.Errorf("Expected the PDOs and mailbox of the SII, but got\n%s", out)
+	}
+}
+
+func TestUsage(t *testing.T) {
+	// given
+	ring := newSegment()
+
+	// when
+	_, unknownErr := goecat(t, ring, "frobnicate")
+	_, interfaceErr := goecat(t, ring, "slaves")
+	_, helpErr := goecat(t, ring, "help")
+
+	// then
+	if !errors.Is(unknownErr, errUsage) || !errors.Is(interfaceErr, errUsage) || helpErr != nil {
+		t.Errorf("Expected %v, %v and nil, but got %v, %v and %v", errUsage, errUsage, unknownErr, interfaceErr, helpErr)
+	}
+}
+
+func TestTopology(t *testing.T) {
+	// given
+	ring := newSegment()
+
+	// when
+	out, err := goecat(t, ring, "topology", "-i", "sim")
+
+	// then
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := "master\n└── 0 0x1001 EasyCAT\n    └── [1] 1 0x1002\n"
+	if out != expected {
+		t.Errorf("Expected\n%s\nbut got\n%s", expected, out)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	// given
+	ring := newSegment()
+	ring.Slaves()[1].Write(register.RXErrorCounter, []byte{2, 1})
+
+	// when
+	out, err := goecat(t, ring, "errors", "-i", "sim")
+	_, resetErr := goecat(t, ring, "errors", "-i", "sim", "--reset")
+	cleared, _ := goecat(t, ring, "errors", "-i", "sim")
+
+	// then
+	if err != nil || resetErr != nil {
+		t.Fatalf("Unexpected errors: %v, %v", err, resetErr)
+	}
+	if !strings.HasSuffix(out, "3 link errors on slave 1 port 0, cable from slave 0 port 1\n") {
+		t.Errorf("Expected the errors on the cable to slave 1, but got\n%s", out)
+	}
+	if !strings.HasSuffix(cleared, "no errors\n") {
+		t.Errorf("Expected no errors after the reset, but got\n%s", cleared)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	// given
+	ring := newSegment()
+
+	// when
+	out, err := goecat(t, ring, "metrics", "-i", "sim", "--listen", "127.0.0.1:0", "--interval", "10ms", "--timeout", "100ms")
+
+	// then
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(out, "serving 2 slaves at http://127.0.0.1:") {
+		t.Errorf("Expected the address of the endpoint, but got %q", out)
+	}
+}
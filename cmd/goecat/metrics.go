@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/Aruminium/goecat/pkg/metrics"
+)
+
+var metricsCommand = command{
+	name:    "metrics",
+	summary: "serve the health of the slaves at /metrics for Prometheus until the timeout",
+	setup: func(flags *flag.FlagSet) runner {
+		listen := flags.String("listen", ":9100", "address to serve the metrics on")
+		interval := flags.Duration("interval", time.Second, "time between polls of the slaves")
+		return func(ctx context.Context, s *session, args []string) error {
+			if err := arguments(args, 0, 0); err != nil {
+				return err
+			}
+			slaves, err := s.slaves(ctx, true)
+			if err != nil {
+				return err
+			}
+
+			exporter := metrics.New(metrics.Options{Stats: s.x.Stats})
+			mux := http.NewServeMux()
+			mux.Handle("/metrics", exporter)
+			listener, err := net.Listen("tcp", *listen)
+			if err != nil {
+				return err
+			}
+			server := &http.Server{Handler: mux}
+			go server.Serve(listener)
+			defer server.Close()
+			fmt.Fprintf(s.out, "serving %d slaves at http://%s/metrics\n", len(slaves), listener.Addr())
+
+			err = metrics.NewPoller(exporter, s.x, slaves).Run(ctx, *interval)
+			if errors.Is(err, context.DeadlineExceeded) {
+				return nil
+			}
+			return err
+		}
+	},
+}
@@ -0,0 +1,11 @@
+package main
+
+import (
+	"github.com/Aruminium/goecat/pkg/link"
+	"github.com/Aruminium/goecat/tools/packet"
+)
+
+// openPcap opens a network interface with pcap.
+func openPcap(iface string, transport link.Transport) (link.Link, link.Encapsulation, error) {
+	return packet.Open(iface, transport)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/Aruminium/goecat/pkg/dump"
+	"github.com/Aruminium/goecat/pkg/ethercat/coe"
+	"github.com/Aruminium/goecat/pkg/ethercat/datagram"
+	"github.com/Aruminium/goecat/pkg/ethercat/payload"
+	"github.com/Aruminium/goecat/pkg/transceiver"
+)
+
+var regReadCommand = command{
+	name:    "reg read",
+	args:    "ADDRESS [LENGTH]",
+	summary: "read registers of a slave and decode the known ones",
+	setup: func(flags *flag.FlagSet) runner {
+		return func(ctx context.Context, s *session, args []string) error {
+			if err := arguments(args, 1, 2); err != nil {
+				return err
+			}
+			address, err := parseUint(args[0], 16, "address")
+			if err != nil {
+				return err
+			}
+			length := uint64(1)
+			if len(args) == 2 {
+				if length, err = parseUint(args[1], 16, "length"); err != nil {
+					return err
+				}
+			}
+
+			slave, err := s.slave(ctx, false)
+			if err != nil {
+				return err
+			}
+			d, err := s.x.ExchangeExpect(ctx, datagram.FPRD(slave.Station, uint16(address), uint16(length)), transceiver.ExpectWKC(1))
+			if err != nil {
+				return err
+			}
+			fmt.Fprint(s.out, dump.Registers(uint16(address), d.Data.Bytes()))
+			return nil
+		}
+	},
+}
+
+var regWriteCommand = command{
+	name:    "reg write",
+	args:    "ADDRESS VALUE",
+	summary: "write registers of a slave",
+	setup: func(flags *flag.FlagSet) runner {
+		typeName := flags.String("type", "", "data type of VALUE, such as UINT; hexadecimal bytes in transmission order if empty")
+		return func(ctx context.Context, s *session, args []string) error {
+			if err := arguments(args, 2, 2); err != nil {
+				return err
+			}
+			address, err := parseUint(args[0], 16, "address")
+			if err != nil {
+				return err
+			}
+			t := coe.OctetString
+			if *typeName != "" {
+				if t, err = coe.ParseDataType(*typeName); err != nil {
+					return err
+				}
+			}
+			value, err := t.Parse(args[1])
+			if err != nil {
+				return err
+			}
+
+			slave, err := s.slave(ctx, false)
+			if err != nil {
+				return err
+			}
+			_, err = s.x.ExchangeExpect(ctx, datagram.FPWR(slave.Station, uint16(address), payload.BasicPayload{Data: value}), transceiver.ExpectWKC(1))
+			return err
+		}
+	},
+}
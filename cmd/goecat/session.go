@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Aruminium/goecat/pkg/ethercat/al"
+	"github.com/Aruminium/goecat/pkg/ethercat/datagram"
+	"github.com/Aruminium/goecat/pkg/ethercat/mailbox"
+	"github.com/Aruminium/goecat/pkg/ethercat/payload"
+	"github.com/Aruminium/goecat/pkg/ethercat/payload/syncmanager"
+	"github.com/Aruminium/goecat/pkg/ethercat/register"
+	"github.com/Aruminium/goecat/pkg/ethercat/sii"
+	"github.com/Aruminium/goecat/pkg/scan"
+	"github.com/Aruminium/goecat/pkg/transceiver"
+)
+
+// statePollInterval is how often AL Status is polled while waiting for a requested state.
+const statePollInterval = 10 * time.Millisecond
+
+// session holds the segment a command works on.
+type session struct {
+	out      io.Writer
+	x        *transceiver.Transceiver
+	position int // Selected slave, all slaves if negative
+}
+
+// slaves scans the segment and returns the selected slaves. With readSII, the EEPROM of every
+// selected slave is read as well.
+func (s *session) slaves(ctx context.Context, readSII bool) ([]scan.Slave, error) {
+	slaves, err := scan.Scan(ctx, s.x, scan.Options{SkipSII: true})
+	if err != nil {
+		return nil, err
+	}
+	if s.position >= 0 {
+		if s.position >= len(slaves) {
+			return nil, fmt.Errorf("no slave at position %d, the segment has %d slaves", s.position, len(slaves))
+		}
+		slaves = slaves[s.position : s.position+1]
+	}
+
+	if readSII {
+		for i := range slaves {
+			if err := s.readSII(ctx, &slaves[i]); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return slaves, nil
+}
+
+// slave scans the segment and returns the one selected slave. Without --position, the segment
+// has to consist of a single slave.
+func (s *session) slave(ctx context.Context, readSII bool) (scan.Slave, error) {
+	slaves, err := s.slaves(ctx, readSII)
+	if err != nil {
+		return scan.Slave{}, err
+	}
+	if len(slaves) != 1 {
+		return scan.Slave{}, fmt.Errorf("the segment has %d slaves, select one with --position", len(slaves))
+	}
+	return slaves[0], nil
+}
+
+// readSII reads and decodes the EEPROM of a slave.
+func (s *session) readSII(ctx context.Context, slave *scan.Slave) error {
+	image, err := sii.NewEEPROM(s.x, slave.Station).ReadImage(ctx)
+	if err != nil {
+		return fmt.Errorf("slave %d: %w", slave.Position, err)
+	}
+	if slave.SII, err = sii.ParseImage(image); err != nil {
+		return fmt.Errorf("slave %d: %w", slave.Position, err)
+	}
+	return nil
+}
+
+// mailbox returns a mailbox connection to a slave. A slave in INIT gets its mailbox
+// SyncManagers configured from the SII and is brought to PRE-OP.
+func (s *session) mailbox(ctx context.Context, slave scan.Slave) (*mailbox.Conn, error) {
+	info, err := sii.NewEEPROM(s.x, slave.Station).ReadInfo(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("slave %d: %w", slave.Position, err)
+	}
+	if info.StdRx.Size == 0 || info.StdTx.Size == 0 {
+		return nil, fmt.Errorf("slave %d: %w", slave.Position, mailbox.ErrNoMailbox)
+	}
+
+	if slave.State.Base() == al.Init {
+		if err := s.requestState(ctx, slave, al.PreOp); err != nil {
+			return nil, err
+		}
+	}
+	return mailbox.NewConn(s.x, slave.Station, info.StdRx, info.StdTx), nil
+}
+
+// configureMailbox writes the mailbox SyncManagers of a slave from its SII, as the slave
+// requires before it leaves INIT: the bootstrap mailbox for BOOT, the standard mailbox
+// otherwise. Slaves without mailbox are left alone.
+func (s *session) configureMailbox(ctx context.Context, slave scan.Slave, boot bool) error {
+	info, err := sii.NewEEPROM(s.x, slave.Station).ReadInfo(ctx)
+	if err != nil {
+		return fmt.Errorf("slave %d: %w", slave.Position, err)
+	}
+	rx, tx := info.StdRx, info.StdTx
+	if boot {
+		rx, tx = info.BootRx, info.BootTx
+	}
+	if rx.Size == 0 || tx.Size == 0 {
+		return nil
+	}
+
+	sms := []datagram.Datagram{
+		datagram.FPWR(slave.Station, register.SM(0), &syncmanager.SyncManager{
+			Start: rx.Offset, Length: rx.Size,
+			CtrlStatus: syncmanager.CtrlStatus{Access: 0x1, OpMode: 0x2},
+			Enable:     syncmanager.Enable{IsEnable: true},
+		}),
+		datagram.FPWR(slave.Station, register.SM(1), &syncmanager.SyncManager{
+			Start: tx.Offset, Length: tx.Size,
+			CtrlStatus: syncmanager.CtrlStatus{OpMode: 0x2},
+			Enable:     syncmanager.Enable{IsEnable: true},
+		}),
+	}
+	for _, d := range sms {
+		if _, err := s.x.ExchangeExpect(ctx, d, transceiver.ExpectWKC(1)); err != nil {
+			return fmt.Errorf("slave %d: %w", slave.Position, err)
+		}
+	}
+	return nil
+}
+
+// requestState writes a state to AL Control and waits until AL Status shows it. A pending
+// error indication is acknowledged with the request, and the mailbox of a slave leaving INIT
+// is configured first.
+func (s *session) requestState(ctx context.Context, slave scan.Slave, state al.State) error {
+	if slave.State.Base() == al.Init && state != al.Init {
+		if err := s.configureMailbox(ctx, slave, state == al.Bootstrap); err != nil {
+			return err
+		}
+	}
+
+	request := state
+	if slave.State.HasError() {
+		request |= al.Error
+	}
+	control := binary.LittleEndian.AppendUint16(nil, uint16(request))
+	if _, err := s.x.ExchangeExpect(ctx, datagram.FPWR(slave.Station, register.ALControl, payload.BasicPayload{Data: control}), transceiver.ExpectWKC(1)); err != nil {
+		return fmt.Errorf("slave %d: %w", slave.Position, err)
+	}
+
+	for {
+		if err := scan.Refresh(ctx, s.x, &slave); err != nil {
+			return err
+		}
+		switch {
+		case slave.State.HasError():
+			return fmt.Errorf("slave %d: %v refused, now in %v: %v", slave.Position, state, slave.State, slave.StatusCode)
+		case slave.State.Base() == state:
+			return nil
+		}
+
+		t := time.NewTimer(statePollInterval)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return fmt.Errorf("slave %d: %v not reached, still in %v: %w", slave.Position, state, slave.State, ctx.Err())
+		case <-t.C:
+		}
+	}
+}
+
+// parseState parses a state given as "INIT", "PREOP", "PRE-OP", "BOOT", "SAFEOP", "SAFE-OP" or "OP".
+func parseState(name string) (al.State, error) {
+	switch strings.ReplaceAll(strings.ToUpper(name), "-", "") {
+	case "INIT":
+		return al.Init, nil
+	case "PREOP":
+		return al.PreOp, nil
+	case "BOOT", "BOOTSTRAP":
+		return al.Bootstrap, nil
+	case "SAFEOP":
+		return al.SafeOp, nil
+	case "OP":
+		return al.Op, nil
+	default:
+		return 0, fmt.Errorf("unknown state %q", name)
+	}
+}
+
+// parseUint parses a decimal or 0x-prefixed number that fits into bits.
+func parseUint(text string, bits int, what string) (uint64, error) {
+	v, err := strconv.ParseUint(text, 0, bits)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q", what, text)
+	}
+	return v, nil
+}
+
+// arguments checks the number of positional arguments.
+func arguments(args []string, least int, most int) error {
+	if len(args) < least || len(args) > most {
+		return errors.New("wrong number of arguments, see -h")
+	}
+	return nil
+}
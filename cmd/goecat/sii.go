@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/Aruminium/goecat/pkg/ethercat/coe"
+	"github.com/Aruminium/goecat/pkg/ethercat/sii"
+)
+
+var siiReadCommand = command{
+	name:    "sii read",
+	summary: "read the raw SII EEPROM image of a slave",
+	setup: func(flags *flag.FlagSet) runner {
+		output := flags.String("o", "", "file to write the image to instead of the standard output")
+		return func(ctx context.Context, s *session, args []string) error {
+			if err := arguments(args, 0, 0); err != nil {
+				return err
+			}
+			slave, err := s.slave(ctx, false)
+			if err != nil {
+				return err
+			}
+			image, err := sii.NewEEPROM(s.x, slave.Station).ReadImage(ctx)
+			if err != nil {
+				return err
+			}
+
+			if *output != "" {
+				return os.WriteFile(*output, image, 0o644)
+			}
+			_, err = s.out.Write(image)
+			return err
+		}
+	},
+}
+
+var siiWriteCommand = command{
+	name:    "sii write",
+	args:    "FILE",
+	summary: "write an SII EEPROM image to a slave; raise --timeout for large images",
+	setup: func(flags *flag.FlagSet) runner {
+		force := flags.Bool("force", false, "write the image even if it does not decode")
+		return func(ctx context.Context, s *session, args []string) error {
+			if err := arguments(args, 1, 1); err != nil {
+				return err
+			}
+			image, err := os.ReadFile(args[0])
+			if err != nil {
+				return err
+			}
+			if _, err := sii.ParseImage(image); err != nil && !*force {
+				return fmt.Errorf("%s is not a valid SII image (use --force to write it anyway): %w", args[0], err)
+			}
+
+			slave, err := s.slave(ctx, false)
+			if err != nil {
+				return err
+			}
+			eeprom := sii.NewEEPROM(s.x, slave.Station)
+			if err := eeprom.Write(ctx, 0, image); err != nil {
+				return err
+			}
+			return eeprom.Reload(ctx)
+		}
+	},
+}
+
+var siiAliasCommand = command{
+	name:    "sii alias",
+	args:    "ALIAS",
+	summary: "write the configured station alias of a slave into its SII EEPROM",
+	setup: func(flags *flag.FlagSet) runner {
+		return func(ctx context.Context, s *session, args []string) error {
+			if err := arguments(args, 1, 1); err != nil {
+				return err
+			}
+			alias, err := parseUint(args[0], 16, "alias")
+			if err != nil {
+				return err
+			}
+			slave, err := s.slave(ctx, false)
+			if err != nil {
+				return err
+			}
+			return sii.NewEEPROM(s.x, slave.Station).WriteAlias(ctx, uint16(alias))
+		}
+	},
+}
+
+var siiDumpCommand = command{
+	name:    "sii dump",
+	summary: "decode the SII EEPROM of a slave",
+	setup: func(flags *flag.FlagSet) runner {
+		return func(ctx context.Context, s *session, args []string) error {
+			if err := arguments(args, 0, 0); err != nil {
+				return err
+			}
+			slave, err := s.slave(ctx, true)
+			if err != nil {
+				return err
+			}
+			return dumpImage(s.out, slave.SII)
+		}
+	},
+}
+
+// dumpImage prints the fixed information and the categories of an EEPROM image.
+func dumpImage(out io.Writer, image sii.Image) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Alias:\t%d\n", image.Alias)
+	fmt.Fprintf(w, "Identity:\t%v\n", image.Identity)
+	fmt.Fprintf(w, "Boot mailbox:\tout 0x%04x/%d in 0x%04x/%d\n", image.BootRx.Offset, image.BootRx.Size, image.BootTx.Offset, image.BootTx.Size)
+	fmt.Fprintf(w, "Mailbox:\t%s\n", mailboxes(image))
+	if g := image.General; g != nil {
+		fmt.Fprintf(w, "Name:\t%s\n", image.Strings.Get(g.NameIdx))
+		fmt.Fprintf(w, "Order:\t%s\n", image.Strings.Get(g.OrderIdx))
+		fmt.Fprintf(w, "Group:\t%s\n", image.Strings.Get(g.GroupIdx))
+		fmt.Fprintf(w, "Details:\tCoE 0x%02x FoE 0x%02x EoE 0x%02x flags 0x%02x\n", g.CoEDetails, g.FoEDetails, g.EoEDetails, g.Flags)
+		fmt.Fprintf(w, "E-Bus current:\t%d mA\n", g.CurrentOnEBus)
+	}
+	for i, fmmu := range image.FMMUs {
+		fmt.Fprintf(w, "FMMU%d:\t%v\n", i, fmmu)
+	}
+	for i, sm := range image.SyncManagers {
+		fmt.Fprintf(w, "SM%d:\tstart 0x%04x len %d control 0x%02x enable %d %v\n", i, sm.Start, sm.Length, sm.Control, sm.Enable, sm.Type)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	printSIIPDOs(out, image, "RxPDO", image.RxPDOs)
+	printSIIPDOs(out, image, "TxPDO", image.TxPDOs)
+
+	for _, c := range image.Categories {
+		switch c.Type {
+		case sii.CategoryStrings, sii.CategoryGeneral, sii.CategoryFMMU, sii.CategorySyncM, sii.CategoryTxPDO, sii.CategoryRxPDO:
+		default:
+			fmt.Fprintf(out, "Category %d: %d bytes\n", c.Type, len(c.Data))
+		}
+	}
+	return nil
+}
+
+// printSIIPDOs prints PDOs from a PDO category of an EEPROM image.
+func printSIIPDOs(out io.Writer, image sii.Image, direction string, pdos []sii.PDO) {
+	for _, pdo := range pdos {
+		fmt.Fprintf(out, "SM%d: %s 0x%04x %q\n", pdo.SyncManager, direction, pdo.Index, image.Strings.Get(pdo.NameIdx))
+		for _, e := range pdo.Entries {
+			fmt.Fprintf(out, "  PDO entry 0x%04x:%02x, %2d bit, %v %q\n",
+				e.Index, e.SubIndex, e.BitLength, coe.DataType(e.DataType), image.Strings.Get(e.NameIdx))
+		}
+	}
+}
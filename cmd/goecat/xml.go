@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"flag"
+	"fmt"
+
+	"github.com/Aruminium/goecat/pkg/esi"
+	"github.com/Aruminium/goecat/pkg/ethercat/coe"
+	"github.com/Aruminium/goecat/pkg/ethercat/sii"
+)
+
+var xmlCommand = command{
+	name:    "xml",
+	summary: "generate an ESI-like device description from the SII of a slave",
+	setup: func(flags *flag.FlagSet) runner {
+		return func(ctx context.Context, s *session, args []string) error {
+			if err := arguments(args, 0, 0); err != nil {
+				return err
+			}
+			slave, err := s.slave(ctx, true)
+			if err != nil {
+				return err
+			}
+
+			data, err := xml.MarshalIndent(describe(slave.SII), "", "  ")
+			if err != nil {
+				return err
+			}
+			_, err = fmt.Fprintf(s.out, "%s%s\n", xml.Header, data)
+			return err
+		}
+	},
+}
+
+// describe builds a device description from an EEPROM image.
+func describe(image sii.Image) esi.EtherCATInfo {
+	device := esi.Device{
+		Type: esi.DeviceType{
+			ProductCode: esi.HexInt(image.Identity.ProductCode),
+			RevisionNo:  esi.HexInt(image.Identity.RevisionNo),
+		},
+		Name: image.Name(),
+	}
+	if g := image.General; g != nil {
+		device.Type.Name = image.Strings.Get(g.OrderIdx)
+		device.GroupType = image.Strings.Get(g.GroupIdx)
+	}
+
+	for _, fmmu := range image.FMMUs {
+		device.Fmmus = append(device.Fmmus, fmmu.String())
+	}
+	for _, sm := range image.SyncManagers {
+		device.Sms = append(device.Sms, esi.Sm{
+			DefaultSize:  int(sm.Length),
+			StartAddress: esi.HexInt(sm.Start),
+			ControlByte:  esi.HexInt(sm.Control),
+			Enable:       int(sm.Enable),
+			Type:         sm.Type.String(),
+		})
+	}
+	device.RxPdos = describePDOs(image, image.RxPDOs)
+	device.TxPdos = describePDOs(image, image.TxPDOs)
+
+	if image.StdRx.Size != 0 {
+		device.Mailbox = &esi.Mailbox{}
+		supported := func(protocol uint16) *struct{} {
+			if image.MailboxProtocol&protocol == 0 {
+				return nil
+			}
+			return &struct{}{}
+		}
+		device.Mailbox.CoE = supported(sii.ProtocolCoE)
+		device.Mailbox.FoE = supported(sii.ProtocolFoE)
+		device.Mailbox.EoE = supported(sii.ProtocolEoE)
+		device.Mailbox.SoE = supported(sii.ProtocolSoE)
+	}
+
+	return esi.EtherCATInfo{
+		Vendor:  esi.Vendor{ID: esi.HexInt(image.Identity.VendorID)},
+		Devices: []esi.Device{device},
+	}
+}
+
+// describePDOs converts the PDOs of a PDO category.
+func describePDOs(image sii.Image, pdos []sii.PDO) []esi.Pdo {
+	result := make([]esi.Pdo, 0, len(pdos))
+	for _, pdo := range pdos {
+		p := esi.Pdo{Index: esi.HexInt(pdo.Index), Name: image.Strings.Get(pdo.NameIdx)}
+		if pdo.SyncManager != 0xff {
+			sm := int(pdo.SyncManager)
+			p.Sm = &sm
+		}
+		for _, e := range pdo.Entries {
+			entry := esi.PdoEntry{
+				Index:    esi.HexInt(e.Index),
+				SubIndex: esi.HexInt(e.SubIndex),
+				BitLen:   int(e.BitLength),
+				Name:     image.Strings.Get(e.NameIdx),
+			}
+			if e.Index != 0 {
+				entry.DataType = coe.DataType(e.DataType).String()
+			}
+			p.Entries = append(p.Entries, entry)
+		}
+		result = append(result, p)
+	}
+	return result
+}
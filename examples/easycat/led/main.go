@@ -1,32 +1,24 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"time"
 
-	"github.com/Aruminium/goecat/pkg/ethercat/command"
-	"github.com/Aruminium/goecat/pkg/ethercat/datagram"
-	"github.com/Aruminium/goecat/pkg/ethercat/payload"
+	"github.com/Aruminium/goecat/pkg/cycle"
+	"github.com/Aruminium/goecat/pkg/ethercat/al"
+	"github.com/Aruminium/goecat/pkg/link"
+	"github.com/Aruminium/goecat/pkg/master"
 	"github.com/Aruminium/goecat/tools/packet"
-	"github.com/google/gopacket"
-	"github.com/google/gopacket/pcap"
 )
 
 var (
-	device       string                    = "en7"
-	snapshot_len int32                     = 1024
-	promiscuous  bool                      = false
-	timeout      time.Duration             = 30 * time.Second
-	options      gopacket.SerializeOptions = gopacket.SerializeOptions{
-		ComputeChecksums: true,
-		FixLengths:       true,
-	}
+	device    string        = "en7"
+	timeout   time.Duration = 30 * time.Second
+	cycleTime time.Duration = 3 * time.Millisecond
 
-	index       uint8   = 0 // ECAT Index
-	led         uint8   = 0 // EasyCAT LED
-	intervalSec float64 = 0.003
-	intervalSum float64 = 0.00
+	led uint8 = 0 // EasyCAT LED
 )
 
 const (
@@ -34,78 +26,51 @@ const (
 )
 
 func main() {
-	handle, err := pcap.OpenLive(device, snapshot_len, promiscuous, timeout)
+	l, encap, err := packet.Open(device, link.UDP)
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer handle.Close()
-
-	pac, err := packet.NewEtherCATPacket(device)
+	// 周期処理はOSスレッドに固定し、各周期の最後の200µsはビジーウェイトする
+	scheduler, err := cycle.New(cycle.Options{Period: cycleTime, Spin: 200 * time.Microsecond})
 	if err != nil {
 		log.Fatal(err)
 	}
+	m := master.New(l, master.Config{Encapsulation: encap, Scheduler: scheduler})
+	defer m.Close()
+	defer func() { fmt.Println(scheduler.Stats()) }()
 
-	// LEDの値を規定時間経過で+1する
-	// LEDの値が0x00 ~ 0x0fになるまで処理を行う
-	for {
-		ecatDatagram1 := datagram.Datagram{
-			Command: command.LWR,
-			Index:   uint8(index),
-			Address: uint32(0x00000000),
-			LRCM:    datagram.NewLrcm(true, false, 32),
-			IRQ:     uint16(0x0000),
-			Data: payload.BasicPayload{Data: []byte{
-				led, 0, 0, 0, 0, 0, 0, 0,
-				0, 0, 0, 0, 0, 0, 0, 0,
-				0, 0, 0, 0, 0, 0, 0, 0,
-				0, 0, 0, 0, 0, 0, 0, 0}},
-			WKC: uint16(0x0000),
-		}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
 
-		index++
-		ecatDatagram2 := datagram.Datagram{
-			Command: command.LRD,
-			Index:   uint8(index),
-			Address: uint32(0x00000000),
-			LRCM:    datagram.NewLrcm(true, false, 32),
-			IRQ:     uint16(0x0000),
-			Data: payload.BasicPayload{Data: []byte{
-				0, 0, 0, 0, 0, 0, 0, 0,
-				0, 0, 0, 0, 0, 0, 0, 0,
-				0, 0, 0, 0, 0, 0, 0, 0,
-				0, 0, 0, 0, 0, 0, 0, 0}},
-			WKC: uint16(0),
-		}
+	if _, err := m.Scan(ctx); err != nil {
+		log.Fatal(err)
+	}
+	if err := m.ConfigureSlaves(ctx); err != nil {
+		log.Fatal(err)
+	}
+	if err := m.Start(ctx); err != nil {
+		log.Fatal(err)
+	}
+	defer m.Stop()
+	if err := m.SetState(ctx, al.Op); err != nil {
+		log.Fatal(err)
+	}
 
-		index++
-		ecatDatagram3 := datagram.Datagram{
-			Command: command.BRD,
-			Index:   uint8(index),
-			Address: uint32(0x00000000),
-			LRCM:    datagram.NewLrcm(false, false, 1),
-			IRQ:     uint16(0x0000),
-			Data:    payload.BasicPayload{Data: []byte{0}},
-			WKC:     uint16(0),
+	// LEDの値を1秒経過で+1する
+	// LEDの値は0x00 ~ 0x0fを繰り返す
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		if err := m.SetOutputs(0, []byte{led}); err != nil {
+			log.Fatal(err)
 		}
 
-		pac.Ecat.AppendDatagram(ecatDatagram1)
-		pac.Ecat.AppendDatagram(ecatDatagram2)
-		pac.Ecat.AppendDatagram(ecatDatagram3)
-
-		_, err = pac.Send(handle, options)
-		if err != nil {
-			fmt.Printf("[-] Error while sending: %s\n", err.Error())
+		select {
+		case <-ctx.Done():
 			return
+		case <-ticker.C:
 		}
-
-		time.Sleep(time.Duration(intervalSec * float64(time.Second)))
-		// 次のloopに向けたセットアップ処理
-		intervalSum += intervalSec
-		index++
-		if intervalSum >= 1.0 {
-			intervalSum = 0.0
-			led = (led + 1) % 0x10
-			fmt.Printf("1秒経過 => Next LED Value: %d\n", led)
-		}
+		led = (led + 1) % (LED_MAX + 1)
+		fmt.Printf("1秒経過 => Next LED Value: %d\n", led)
 	}
 }
@@ -1,218 +1,67 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"time"
 
-	"github.com/Aruminium/goecat/pkg/ethercat/command"
-	"github.com/Aruminium/goecat/pkg/ethercat/datagram"
-	"github.com/Aruminium/goecat/pkg/ethercat/payload"
-	"github.com/Aruminium/goecat/pkg/ethercat/payload/fmmu"
-	"github.com/Aruminium/goecat/pkg/ethercat/payload/syncmanager"
+	"github.com/Aruminium/goecat/pkg/ethercat/al"
+	"github.com/Aruminium/goecat/pkg/link"
+	"github.com/Aruminium/goecat/pkg/master"
+	"github.com/Aruminium/goecat/pkg/scan"
+	"github.com/Aruminium/goecat/pkg/watchdog"
 	"github.com/Aruminium/goecat/tools/packet"
-	"github.com/google/gopacket"
-	"github.com/google/gopacket/pcap"
 )
 
 var (
-	device       string                    = "en7"
-	snapshot_len int32                     = 1024
-	promiscuous  bool                      = false
-	timeout      time.Duration             = 30 * time.Second
-	options      gopacket.SerializeOptions = gopacket.SerializeOptions{
-		ComputeChecksums: true,
-		FixLengths:       true,
-	}
-	handle *pcap.Handle
-	err    error
-
-	d        *datagram.Datagram
-	pac      packet.EtherCATPacket
-	sm       *syncmanager.SyncManager
-	fm       *fmmu.FMMU
-	index    uint8   = 0
-	duration float64 = 0.003
+	device    string        = "en7"
+	timeout   time.Duration = 30 * time.Second
+	cycleTime time.Duration = 3 * time.Millisecond
 )
 
 func main() {
-	handle, err = pcap.OpenLive(device, snapshot_len, promiscuous, timeout)
+	l, encap, err := packet.Open(device, link.UDP)
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer handle.Close()
+	// 10 周期分プロセスデータが届かなければ SM ウォッチドッグで出力を止める
+	m := master.New(l, master.Config{Encapsulation: encap, CycleTime: cycleTime, Slaves: []master.SlaveConfig{
+		{Position: 0, Watchdog: &watchdog.Config{ProcessData: 10 * cycleTime}},
+	}})
+	defer m.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
 
-	pac, err = packet.NewEtherCATPacket(device)
+	slaves, err := m.Scan(ctx)
 	if err != nil {
 		log.Fatal(err)
 	}
-
-	clear()
-	sync()
-}
-
-// 同期状態解除する
-func clear() {
-	d = &datagram.Datagram{
-		Command: command.BRD,
-		Index:   uint8(index),
-		Address: uint32(0x00000000),
-		LRCM:    datagram.NewLrcm(false, false, 1),
-		IRQ:     uint16(0x0000),
-		Data:    payload.BasicPayload{Data: []byte{0x00}},
-		WKC:     uint16(0x0000),
-	}
-	handler(d)
-
-	d = &datagram.Datagram{
-		Command: command.BWR,
-		Index:   uint8(index),
-		Address: uint32(0x00000800),
-		LRCM:    datagram.NewLrcm(false, false, 32),
-		IRQ:     uint16(0x0000),
-		Data: payload.BasicPayload{Data: []byte{
-			0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
-			0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
-			0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
-			0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
-		}},
-		WKC: uint16(0x0000),
-	}
-	handler(d)
-}
-
-func sync() {
-	// SM
-	sm = &syncmanager.SyncManager{
-		Start:  0x1000,
-		Length: 0x0020,
-		CtrlStatus: syncmanager.CtrlStatus{
-			InVisibleBufferState:     0,
-			VisibleBufferBufferState: 0,
-			CanReadIRQ:               false,
-			CanWriteIRQ:              false,
-			IsTriggerWatchdog:        true,
-			IsPdiIRQ:                 true,
-			IsEcatIRQ:                false,
-			Access:                   0x1,
-			OpMode:                   0,
-		},
-		Enable: syncmanager.Enable{
-			IsRepeatAcknowledge: false,
-			IsDeactivate:        false,
-			IsLatchChangePDI:    false,
-			IsLatchChangeECAT:   false,
-			IsRepeatRequest:     false,
-			IsEnable:            true,
-		},
-	}
-	d = &datagram.Datagram{
-		Command: command.APWR,
-		Index:   uint8(index),
-		Address: uint32(0x00000800),
-		LRCM:    datagram.NewLrcm(false, false, 8),
-		IRQ:     uint16(0x0000),
-		Data:    sm,
-		WKC:     uint16(0x0000),
-	}
-	handler(d)
-
-	sm = &syncmanager.SyncManager{
-		Start:  0x1100,
-		Length: 0x0020,
-		CtrlStatus: syncmanager.CtrlStatus{
-			InVisibleBufferState:     0,
-			VisibleBufferBufferState: 0,
-			CanReadIRQ:               false,
-			CanWriteIRQ:              false,
-			IsTriggerWatchdog:        true,
-			IsPdiIRQ:                 true,
-			IsEcatIRQ:                false,
-			Access:                   0x0,
-			OpMode:                   0,
-		},
-		Enable: syncmanager.Enable{
-			IsRepeatAcknowledge: false,
-			IsDeactivate:        false,
-			IsLatchChangePDI:    false,
-			IsLatchChangeECAT:   false,
-			IsRepeatRequest:     false,
-			IsEnable:            true,
-		},
-	}
-	d = &datagram.Datagram{
-		Command: command.APWR,
-		Index:   uint8(index),
-		Address: uint32(0x00000808),
-		LRCM:    datagram.NewLrcm(false, false, 8),
-		IRQ:     uint16(0x0000),
-		Data:    sm,
-		WKC:     uint16(0x0000),
-	}
-	handler(d)
-
-	fm = &fmmu.FMMU{
-		LogStart:     0,
-		LogLength:    0x0020,
-		LogStartBit:  0,
-		LogEndBit:    0x07,
-		PhysStart:    0x1100,
-		PhysStartBit: 0,
-		AbleUseRead:  false,
-		AbleUseWrite: true,
-		IsActivate:   true,
-	}
-	d = &datagram.Datagram{
-		Command: command.APWR,
-		Index:   uint8(index),
-		Address: uint32(0x00000610),
-		LRCM:    datagram.NewLrcm(false, false, 16),
-		IRQ:     uint16(0x0000),
-		Data:    fm,
-		WKC:     uint16(0x0000),
+	// SII の SM と PDO から SM と FMMU を設定する
+	if err := m.ConfigureSlaves(ctx); err != nil {
+		log.Fatal(err)
 	}
-	handler(d)
-
-	fm = &fmmu.FMMU{
-		LogStart:     0,
-		LogLength:    0x0020,
-		LogStartBit:  0,
-		LogEndBit:    0x07,
-		PhysStart:    0x1000,
-		PhysStartBit: 0,
-		AbleUseRead:  true,
-		AbleUseWrite: true,
-		IsActivate:   true,
+	// OP に遷移する前にプロセスデータの送受信を始める
+	if err := m.Start(ctx); err != nil {
+		log.Fatal(err)
 	}
-	d = &datagram.Datagram{
-		Command: command.APWR,
-		Index:   uint8(index),
-		Address: uint32(0x00000600),
-		LRCM:    datagram.NewLrcm(false, false, 16),
-		IRQ:     uint16(0x0000),
-		Data:    fm,
-		WKC:     uint16(0x0000),
+	defer m.Stop()
+	if err := m.SetState(ctx, al.Op); err != nil {
+		log.Fatal(err)
 	}
-	handler(d)
 
-	d = &datagram.Datagram{
-		Command: command.BWR,
-		Index:   uint8(index),
-		Address: uint32(0x00000120),
-		LRCM:    datagram.NewLrcm(false, false, 1),
-		IRQ:     uint16(0x0000),
-		Data:    payload.BasicPayload{Data: []byte{0x08}},
-		WKC:     uint16(0x0000),
+	for _, s := range m.Slaves() {
+		fmt.Printf("%d %s: %v, outputs %+v, inputs %+v\n", s.Position, s.Name(), s.State, s.Outputs, s.Inputs)
 	}
-	handler(d)
-}
+	fmt.Printf("%d slaves in OP\n", len(slaves))
 
-func handler(d *datagram.Datagram) {
-	pac.Ecat.AppendDatagram(*d)
-	_, err = pac.Send(handle, options)
-	if err != nil {
-		fmt.Printf("[-] Error while sending: %s\n", err.Error())
+	// ウォッチドッグの満了を報告する
+	scanned := make([]scan.Slave, len(slaves))
+	for i, s := range slaves {
+		scanned[i] = s.Slave
 	}
-	time.Sleep(time.Duration(duration * float64(time.Second)))
-	index++
+	watchdog.NewMonitor(m.Transceiver(), scanned).Run(ctx, 100*time.Millisecond, func(e watchdog.Event) {
+		log.Print(e)
+	})
 }
@@ -2,6 +2,10 @@ module github.com/Aruminium/goecat
 
 go 1.21.1
 
-require github.com/google/gopacket v1.1.19
+require (
+	github.com/google/gopacket v1.1.19
+	golang.org/x/sys v0.0.0-20190412213103-97732733099d
+	gopkg.in/yaml.v3 v3.0.1
+)
 
-require golang.org/x/sys v0.0.0-20190412213103-97732733099d // indirect
+require golang.org/x/net v0.0.0-20190620200207-3b0461eec859 // indirect
@@ -0,0 +1,76 @@
+// Package afpacket provides a Linux link.Link on an AF_PACKET socket with memory-mapped rings.
+//
+// Frames are exchanged through an RX ring and a TX ring shared with the kernel, so sending and
+// receiving needs neither cgo nor a system call per received frame. The rings use TPACKET_V3 by
+// default; TPACKET_V2 hands over every received frame immediately and has the lower latency. A BPF
+// program attached to the socket lets only EtherCAT frames into the RX ring, either with EtherType
+// 0x88A4 or inside IPv4/UDP with port 34980, and drops the frames the socket sent itself.
+//
+// Opening a Link needs CAP_NET_RAW. It works on any interface, including one end of a veth pair,
+// which makes it testable in a network namespace of an unprivileged user:
+//
+//	unshare -rn go test ./pkg/afpacket
+package afpacket
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrUnsupported is returned by Open on systems other than Linux.
+var ErrUnsupported = errors.New("afpacket: AF_PACKET is only supported on Linux")
+
+// Version selects the layout of the rings.
+type Version int
+
+const (
+	// V3 uses TPACKET_V3. The kernel hands over received frames in blocks, once a block is full or
+	// BlockTimeout has passed, which saves work at high frame rates but delays single frames.
+	V3 Version = iota
+	// V2 uses TPACKET_V2. The kernel hands over every received frame as soon as it arrives,
+	// which suits a master waiting for its cyclic frame to come back.
+	V2
+)
+
+// Options configures the rings of a Link. Zero values use the defaults.
+type Options struct {
+	// Version of the rings. Default V3.
+	Version Version
+	// BlockSize is the size of a ring block in bytes, a multiple of the page size. Default 64 KiB.
+	BlockSize int
+	// Blocks is the number of blocks of the RX ring. Default 8.
+	Blocks int
+	// Frames is the number of frames of the TX ring. Default 64.
+	Frames int
+	// BlockTimeout is the time after which the kernel hands over a partly filled V3 RX block,
+	// in whole milliseconds. It bounds the receive latency when fewer frames arrive than fit in a block.
+	// Default 1ms, which the kernel may round up to a timer tick.
+	BlockTimeout time.Duration
+	// BypassQdisc sends frames straight to the driver, skipping the queueing discipline of the interface.
+	BypassQdisc bool
+}
+
+const (
+	defaultBlockSize    = 1 << 16
+	defaultBlocks       = 8
+	defaultFrames       = 64
+	defaultBlockTimeout = time.Millisecond
+	frameSize           = 2048 // Size of a ring frame, enough for a full Ethernet frame and its header
+)
+
+// withDefaults returns opts with the zero values replaced by the defaults.
+func (opts Options) withDefaults() Options {
+	if opts.BlockSize == 0 {
+		opts.BlockSize = defaultBlockSize
+	}
+	if opts.Blocks == 0 {
+		opts.Blocks = defaultBlocks
+	}
+	if opts.Frames == 0 {
+		opts.Frames = defaultFrames
+	}
+	if opts.BlockTimeout == 0 {
+		opts.BlockTimeout = defaultBlockTimeout
+	}
+	return opts
+}
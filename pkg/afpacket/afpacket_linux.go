@@ -0,0 +1,336 @@
+package afpacket
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"github.com/Aruminium/goecat/pkg/link"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	pollTimeout    = 10         // Milliseconds Receive waits before it checks whether the Link was closed
+	txDataOffsetV2 = 32         // Offset of the frame in a TX ring frame, TPACKET_ALIGN(sizeof(struct tpacket2_hdr))
+	txDataOffsetV3 = 48         // Offset of the frame in a TX ring frame, TPACKET_ALIGN(sizeof(struct tpacket3_hdr))
+	skfAdPktType   = 0xfffff004 // SKF_AD_OFF + SKF_AD_PKTTYPE, the ancillary BPF field holding the packet type
+	bpfAccept      = 0x40000
+	bpfDrop        = 0
+)
+
+// filter accepts incoming frames with EtherType 0x88A4 or IPv4/UDP destination port 34980.
+// Frames sent by the socket itself are dropped.
+var filter = []unix.SockFilter{
+	{Code: unix.BPF_LD | unix.BPF_W | unix.BPF_ABS, K: skfAdPktType},
+	{Code: unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K, Jt: 11, K: unix.PACKET_OUTGOING},
+	{Code: unix.BPF_LD | unix.BPF_H | unix.BPF_ABS, K: 12}, // EtherType
+	{Code: unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K, Jt: 8, K: uint32(link.EthernetTypeEtherCAT)},
+	{Code: unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K, Jf: 8, K: unix.ETH_P_IP},
+	{Code: unix.BPF_LD | unix.BPF_B | unix.BPF_ABS, K: 23}, // IPv4 protocol
+	{Code: unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K, Jf: 6, K: unix.IPPROTO_UDP},
+	{Code: unix.BPF_LD | unix.BPF_H | unix.BPF_ABS, K: 20}, // IPv4 flags and fragment offset
+	{Code: unix.BPF_JMP | unix.BPF_JSET | unix.BPF_K, Jt: 4, K: 0x1fff},
+	{Code: unix.BPF_LDX | unix.BPF_B | unix.BPF_MSH, K: 14}, // IPv4 header length
+	{Code: unix.BPF_LD | unix.BPF_H | unix.BPF_IND, K: 16},  // UDP destination port
+	{Code: unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K, Jf: 1, K: uint32(link.UDPPortEtherCAT)},
+	{Code: unix.BPF_RET | unix.BPF_K, K: bpfAccept},
+	{Code: unix.BPF_RET | unix.BPF_K, K: bpfDrop},
+}
+
+// blockHeader is the start of a TPACKET_V3 RX block, struct tpacket_block_desc with struct tpacket_hdr_v1.
+type blockHeader struct {
+	version      uint32
+	offsetToPriv uint32
+	status       uint32
+	packets      uint32
+	offsetToData uint32
+	length       uint32
+}
+
+// Link is a link.Link on an AF_PACKET socket with a memory-mapped RX ring and TX ring.
+type Link struct {
+	fd        int
+	version   Version
+	ring      []byte // RX ring followed by the TX ring
+	rx        []byte
+	tx        []byte
+	blockSize int
+	slots     int // RX blocks with V3, RX frames with V2
+	frames    int // TX frames
+
+	closed atomic.Bool
+
+	rxMu      sync.Mutex
+	block     int  // RX block or frame read next
+	taken     bool // The block was handed over by the kernel
+	remaining int  // Packets of the block not read yet
+	offset    int  // Offset of the next packet in the block
+
+	txMu  sync.Mutex
+	frame int // TX frame written next
+}
+
+// Open opens an AF_PACKET socket on a network interface and maps its rings.
+//
+// Parameters:
+//   - iface (string): Network interface connected to the segment
+//   - opts (Options): Sizes of the rings, zero values use the defaults
+//
+// Returns:
+//   - *Link: New link on the interface
+//   - error: Error if the options are invalid or the socket cannot be set up
+func Open(iface string, opts Options) (*Link, error) {
+	ifi, err := net.InterfaceByName(iface)
+	if err != nil {
+		return nil, err
+	}
+	opts = opts.withDefaults()
+	if opts.BlockSize < frameSize || opts.BlockSize%os.Getpagesize() != 0 {
+		return nil, fmt.Errorf("afpacket: block size must be a multiple of the page size %d, got %d", os.Getpagesize(), opts.BlockSize)
+	}
+	if opts.Blocks < 0 || opts.Frames < 0 || opts.BlockTimeout < time.Millisecond || opts.Version < V3 || opts.Version > V2 {
+		return nil, fmt.Errorf("afpacket: invalid ring options %+v", opts)
+	}
+	framesPerBlock := opts.BlockSize / frameSize
+	txBlocks := (opts.Frames + framesPerBlock - 1) / framesPerBlock
+
+	fd, err := unix.Socket(unix.AF_PACKET, unix.SOCK_RAW|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return nil, fmt.Errorf("afpacket: socket: %w", err)
+	}
+	l := &Link{fd: fd, version: opts.Version, blockSize: opts.BlockSize, slots: opts.Blocks, frames: txBlocks * framesPerBlock}
+	if opts.Version == V2 {
+		l.slots = opts.Blocks * framesPerBlock
+	}
+	if err := l.setup(ifi.Index, opts, txBlocks); err != nil {
+		if l.ring != nil {
+			_ = unix.Munmap(l.ring)
+		}
+		unix.Close(fd)
+		return nil, err
+	}
+	return l, nil
+}
+
+// setup attaches the filter, maps the rings and binds the socket to the interface.
+// The socket is bound last, so no frame reaches the ring before the filter is in place.
+func (l *Link) setup(ifindex int, opts Options, txBlocks int) error {
+	prog := unix.SockFprog{Len: uint16(len(filter)), Filter: &filter[0]}
+	if err := unix.SetsockoptSockFprog(l.fd, unix.SOL_SOCKET, unix.SO_ATTACH_FILTER, &prog); err != nil {
+		return fmt.Errorf("afpacket: attach filter: %w", err)
+	}
+	version := unix.TPACKET_V3
+	if opts.Version == V2 {
+		version = unix.TPACKET_V2
+	}
+	if err := unix.SetsockoptInt(l.fd, unix.SOL_PACKET, unix.PACKET_VERSION, version); err != nil {
+		return fmt.Errorf("afpacket: set ring version: %w", err)
+	}
+	if opts.BypassQdisc {
+		if err := unix.SetsockoptInt(l.fd, unix.SOL_PACKET, unix.PACKET_QDISC_BYPASS, 1); err != nil {
+			return fmt.Errorf("afpacket: bypass qdisc: %w", err)
+		}
+	}
+
+	framesPerBlock := opts.BlockSize / frameSize
+	rx := unix.TpacketReq3{
+		Block_size: uint32(opts.BlockSize),
+		Block_nr:   uint32(opts.Blocks),
+		Frame_size: frameSize,
+		Frame_nr:   uint32(opts.Blocks * framesPerBlock),
+	}
+	tx := unix.TpacketReq3{
+		Block_size: uint32(opts.BlockSize),
+		Block_nr:   uint32(txBlocks),
+		Frame_size: frameSize,
+		Frame_nr:   uint32(l.frames),
+	}
+	if opts.Version == V2 {
+		if err := unix.SetsockoptTpacketReq(l.fd, unix.SOL_PACKET, unix.PACKET_RX_RING, request(rx)); err != nil {
+			return fmt.Errorf("afpacket: set up RX ring: %w", err)
+		}
+		if err := unix.SetsockoptTpacketReq(l.fd, unix.SOL_PACKET, unix.PACKET_TX_RING, request(tx)); err != nil {
+			return fmt.Errorf("afpacket: set up TX ring: %w", err)
+		}
+	} else {
+		rx.Retire_blk_tov = uint32(opts.BlockTimeout / time.Millisecond)
+		if err := unix.SetsockoptTpacketReq3(l.fd, unix.SOL_PACKET, unix.PACKET_RX_RING, &rx); err != nil {
+			return fmt.Errorf("afpacket: set up RX ring: %w", err)
+		}
+		if err := unix.SetsockoptTpacketReq3(l.fd, unix.SOL_PACKET, unix.PACKET_TX_RING, &tx); err != nil {
+			return fmt.Errorf("afpacket: set up TX ring: %w", err)
+		}
+	}
+
+	rxSize := opts.Blocks * opts.BlockSize
+	ring, err := unix.Mmap(l.fd, 0, rxSize+txBlocks*opts.BlockSize, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED)
+	if err != nil {
+		return fmt.Errorf("afpacket: map rings: %w", err)
+	}
+	l.ring, l.rx, l.tx = ring, ring[:rxSize], ring[rxSize:]
+
+	addr := unix.SockaddrLinklayer{Protocol: htons(unix.ETH_P_ALL), Ifindex: ifindex}
+	if err := unix.Bind(l.fd, &addr); err != nil {
+		return fmt.Errorf("afpacket: bind: %w", err)
+	}
+	return nil
+}
+
+// Send writes frame into the next TX ring frame and has the kernel transmit it.
+func (l *Link) Send(frame []byte) error {
+	l.txMu.Lock()
+	defer l.txMu.Unlock()
+
+	if l.closed.Load() {
+		return link.ErrClosed
+	}
+	offset := txDataOffsetV3
+	if l.version == V2 {
+		offset = txDataOffsetV2
+	}
+	if len(frame) > frameSize-offset {
+		return fmt.Errorf("afpacket: frame of %d bytes exceeds the ring frame", len(frame))
+	}
+	slot := l.tx[l.frame*frameSize : (l.frame+1)*frameSize]
+	var status *uint32
+	if l.version == V2 {
+		hdr := (*unix.Tpacket2Hdr)(unsafe.Pointer(&slot[0]))
+		hdr.Len, status = uint32(len(frame)), &hdr.Status
+	} else {
+		hdr := (*unix.Tpacket3Hdr)(unsafe.Pointer(&slot[0]))
+		hdr.Len, hdr.Next_offset, status = uint32(len(frame)), 0, &hdr.Status
+	}
+	if s := atomic.LoadUint32(status); s != unix.TP_STATUS_AVAILABLE && s&unix.TP_STATUS_WRONG_FORMAT == 0 {
+		return fmt.Errorf("afpacket: TX frame %d is still in use, status %#x", l.frame, s)
+	}
+	copy(slot[offset:], frame)
+	atomic.StoreUint32(status, unix.TP_STATUS_SEND_REQUEST)
+	l.frame = (l.frame + 1) % l.frames
+
+	for {
+		// Without MSG_DONTWAIT the kernel returns once the frame has been handed to the driver.
+		// unix.Sendto cannot be called without a destination address.
+		_, _, errno := unix.Syscall6(unix.SYS_SENDTO, uintptr(l.fd), 0, 0, 0, 0, 0)
+		if errno == unix.EINTR {
+			continue
+		}
+		if errno != 0 {
+			return fmt.Errorf("afpacket: send: %w", errno)
+		}
+		return nil
+	}
+}
+
+// Receive returns a copy of the next frame of the RX ring, waiting for the kernel to hand it over.
+func (l *Link) Receive() ([]byte, error) {
+	l.rxMu.Lock()
+	defer l.rxMu.Unlock()
+
+	for {
+		if l.closed.Load() {
+			return nil, link.ErrClosed
+		}
+		var frame []byte
+		if l.version == V2 {
+			frame = l.receiveV2()
+		} else {
+			frame = l.receiveV3()
+		}
+		if frame != nil {
+			return frame, nil
+		}
+		if err := l.poll(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// receiveV2 copies the next frame out of the TPACKET_V2 RX ring and returns the slot to the kernel.
+//
+// Returns:
+//   - []byte: Frame, nil if the kernel has not handed over the next slot yet
+func (l *Link) receiveV2() []byte {
+	slot := l.rx[l.block*frameSize : (l.block+1)*frameSize]
+	hdr := (*unix.Tpacket2Hdr)(unsafe.Pointer(&slot[0]))
+	if atomic.LoadUint32(&hdr.Status)&unix.TP_STATUS_USER == 0 {
+		return nil
+	}
+	frame := append([]byte(nil), slot[hdr.Mac:int(hdr.Mac)+int(hdr.Snaplen)]...)
+	atomic.StoreUint32(&hdr.Status, unix.TP_STATUS_KERNEL)
+	l.block = (l.block + 1) % l.slots
+	return frame
+}
+
+// receiveV3 copies the next frame out of the TPACKET_V3 RX ring. A block is returned to the kernel
+// once all of its frames have been read.
+//
+// Returns:
+//   - []byte: Frame, nil if the kernel has not handed over the next block yet
+func (l *Link) receiveV3() []byte {
+	for {
+		block := l.rx[l.block*l.blockSize : (l.block+1)*l.blockSize]
+		hdr := (*blockHeader)(unsafe.Pointer(&block[0]))
+		if l.taken && l.remaining > 0 {
+			packet := (*unix.Tpacket3Hdr)(unsafe.Pointer(&block[l.offset]))
+			start := l.offset + int(packet.Mac)
+			frame := append([]byte(nil), block[start:start+int(packet.Snaplen)]...)
+			l.offset += int(packet.Next_offset)
+			l.remaining--
+			return frame
+		}
+		if l.taken {
+			atomic.StoreUint32(&hdr.status, unix.TP_STATUS_KERNEL)
+			l.taken = false
+			l.block = (l.block + 1) % l.slots
+			continue
+		}
+		if atomic.LoadUint32(&hdr.status)&unix.TP_STATUS_USER == 0 {
+			return nil
+		}
+		l.taken, l.remaining, l.offset = true, int(hdr.packets), int(hdr.offsetToData)
+	}
+}
+
+// poll waits until the socket is readable or pollTimeout has passed.
+func (l *Link) poll() error {
+	fds := []unix.PollFd{{Fd: int32(l.fd), Events: unix.POLLIN | unix.POLLERR}}
+	if _, err := unix.Poll(fds, pollTimeout); err != nil && err != unix.EINTR {
+		if l.closed.Load() {
+			return link.ErrClosed
+		}
+		return fmt.Errorf("afpacket: poll: %w", err)
+	}
+	return nil
+}
+
+// Close unmaps the rings and closes the socket once pending Send and Receive calls have returned.
+func (l *Link) Close() error {
+	if !l.closed.CompareAndSwap(false, true) {
+		return nil
+	}
+	l.rxMu.Lock()
+	defer l.rxMu.Unlock()
+	l.txMu.Lock()
+	defer l.txMu.Unlock()
+
+	err := unix.Munmap(l.ring)
+	if cerr := unix.Close(l.fd); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// request returns the TPACKET_V2 ring request with the sizes of req.
+func request(req unix.TpacketReq3) *unix.TpacketReq {
+	return &unix.TpacketReq{Block_size: req.Block_size, Block_nr: req.Block_nr, Frame_size: req.Frame_size, Frame_nr: req.Frame_nr}
+}
+
+// htons converts v to network byte order.
+func htons(v uint16) uint16 {
+	return binary.NativeEndian.Uint16(binary.BigEndian.AppendUint16(nil, v))
+}
@@ -0,0 +1,25 @@
+//go:build !linux
+
+package afpacket
+
+import "github.com/Aruminium/goecat/pkg/link"
+
+// Link is a link.Link on an AF_PACKET socket, which is only available on Linux.
+type Link struct{}
+
+// Open returns ErrUnsupported, AF_PACKET is only available on Linux.
+func Open(iface string, opts Options) (*Link, error) {
+	return nil, ErrUnsupported
+}
+
+func (l *Link) Send(frame []byte) error {
+	return link.ErrClosed
+}
+
+func (l *Link) Receive() ([]byte, error) {
+	return nil, link.ErrClosed
+}
+
+func (l *Link) Close() error {
+	return nil
+}
@@ -0,0 +1,191 @@
+//go:build linux
+
+package afpacket_test
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Aruminium/goecat/pkg/afpacket"
+	"github.com/Aruminium/goecat/pkg/ethercat"
+	"github.com/Aruminium/goecat/pkg/ethercat/datagram"
+	"github.com/Aruminium/goecat/pkg/link"
+)
+
+// versions are the ring versions every test runs with.
+var versions = []struct {
+	name    string
+	version afpacket.Version
+}{
+	{"TPACKET_V3", afpacket.V3},
+	{"TPACKET_V2", afpacket.V2},
+}
+
+// pairs numbers the veth pairs of the tests.
+var pairs atomic.Int32
+
+// veth creates a veth pair and returns the names of its ends.
+// The test is skipped without the permission to create it, run it with unshare -rn in that case.
+func veth(t testing.TB) (string, string) {
+	n := pairs.Add(1)
+	a, b := fmt.Sprintf("ecat%d.%da", os.Getpid()%10000, n), fmt.Sprintf("ecat%d.%db", os.Getpid()%10000, n)
+	for _, args := range [][]string{
+		{"link", "add", a, "type", "veth", "peer", "name", b},
+		{"link", "set", a, "up"},
+		{"link", "set", b, "up"},
+	} {
+		if out, err := exec.Command("ip", args...).CombinedOutput(); err != nil {
+			t.Skipf("Cannot set up a veth pair: %v %s", err, out)
+		}
+		t.Cleanup(func() { _ = exec.Command("ip", "link", "del", a).Run() })
+	}
+	return a, b
+}
+
+// open opens a Link on both ends of a veth pair.
+func open(t testing.TB, version afpacket.Version) (*afpacket.Link, *afpacket.Link) {
+	a, b := veth(t)
+	la, err := afpacket.Open(a, afpacket.Options{Version: version})
+	if errors.Is(err, os.ErrPermission) {
+		t.Skipf("Cannot open an AF_PACKET socket: %v", err)
+	}
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	t.Cleanup(func() { la.Close() })
+	lb, err := afpacket.Open(b, afpacket.Options{Version: version})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	t.Cleanup(func() { lb.Close() })
+	return la, lb
+}
+
+// frame encapsulates an EtherCAT frame with a BRD.
+func frame(transport link.Transport) []byte {
+	ecat := ethercat.NewEtherCAT()
+	ecat.AppendDatagram(datagram.BRD(0x0130, 2))
+	encap := link.Encapsulation{
+		Transport: transport,
+		SrcMAC:    net.HardwareAddr{0x02, 0, 0, 0, 0, 1},
+		SrcIP:     net.IPv4(192, 168, 0, 1),
+		DstIP:     net.IPv4bcast,
+	}
+	ethernet, _ := encap.Encapsulate(ecat.Bytes())
+	return ethernet
+}
+
+func TestLink(t *testing.T) {
+	for _, tt := range versions {
+		t.Run(tt.name, func(t *testing.T) {
+			// given
+			a, b := open(t, tt.version)
+			raw, udp := frame(link.Raw), frame(link.UDP)
+			other := append([]byte{}, raw...)
+			other[12], other[13] = 0x08, 0x06
+
+			// when
+			for _, f := range [][]byte{other, raw, udp} {
+				if err := a.Send(f); err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+			}
+			received := make([][]byte, 2)
+			for i := range received {
+				received[i], _ = b.Receive()
+			}
+
+			// then
+			if !reflect.DeepEqual(received, [][]byte{raw, udp}) {
+				t.Errorf("Expected only the EtherCAT frames, but got % x", received)
+			}
+		})
+	}
+}
+
+func TestLinkIgnoresOwnFrames(t *testing.T) {
+	for _, tt := range versions {
+		t.Run(tt.name, func(t *testing.T) {
+			// given
+			a, b := open(t, tt.version)
+			sent, returned := frame(link.Raw), frame(link.UDP)
+
+			// when
+			_ = a.Send(sent)
+			forwarded, _ := b.Receive()
+			_ = b.Send(returned)
+			received, _ := a.Receive()
+
+			// then
+			if !reflect.DeepEqual(forwarded, sent) || !reflect.DeepEqual(received, returned) {
+				t.Errorf("Expected % x to come back, but got % x", returned, received)
+			}
+		})
+	}
+}
+
+func TestLinkClose(t *testing.T) {
+	for _, tt := range versions {
+		t.Run(tt.name, func(t *testing.T) {
+			// given
+			a, _ := open(t, tt.version)
+			done := make(chan error, 1)
+			go func() {
+				_, err := a.Receive()
+				done <- err
+			}()
+
+			// when
+			a.Close()
+
+			// then
+			select {
+			case err := <-done:
+				if err != link.ErrClosed {
+					t.Errorf("Expected %v, but got %v", link.ErrClosed, err)
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("Receive did not return after Close")
+			}
+			if err := a.Send(frame(link.Raw)); err != link.ErrClosed {
+				t.Errorf("Expected %v, but got %v", link.ErrClosed, err)
+			}
+		})
+	}
+}
+
+func BenchmarkRoundTrip(b *testing.B) {
+	for _, tt := range versions {
+		b.Run(tt.name, func(b *testing.B) {
+			master, slave := open(b, tt.version)
+			ethernet := frame(link.Raw)
+			go func() {
+				for {
+					f, err := slave.Receive()
+					if err != nil {
+						return
+					}
+					_ = slave.Send(f)
+				}
+			}()
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := master.Send(ethernet); err != nil {
+					b.Fatal(err)
+				}
+				if _, err := master.Receive(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
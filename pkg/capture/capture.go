@@ -0,0 +1,178 @@
+// Package capture records the frames of a link into a pcapng file and reads captures back,
+// so traffic recorded in the field can be replayed through the decoder.
+//
+// A capture written by this package has two interfaces: frames sent by the master are
+// recorded on the first and frames received by the master on the second. For captures from
+// other tools the direction is derived from the source MAC address, in which the first slave
+// sets the locally administered bit of every frame it returns.
+package capture
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	"github.com/Aruminium/goecat/pkg/link"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+)
+
+// Direction tells whether a frame was sent or received by the master.
+type Direction uint8
+
+const (
+	Outbound Direction = iota // Sent by the master
+	Inbound                   // Returned from the segment
+)
+
+// String returns "out" or "in".
+func (d Direction) String() string {
+	if d == Inbound {
+		return "in"
+	}
+	return "out"
+}
+
+// Interface comments that mark the direction of the interfaces in a capture.
+const (
+	outboundComment = "goecat: frames sent by the master"
+	inboundComment  = "goecat: frames received by the master"
+)
+
+// Record is a captured Ethernet frame.
+type Record struct {
+	Time      time.Time
+	Direction Direction
+	Data      []byte
+}
+
+// Writer writes records into a pcapng file. It is safe for concurrent use.
+type Writer struct {
+	mu sync.Mutex
+	w  *pcapgo.NgWriter
+}
+
+// NewWriter writes the pcapng section header and the interfaces for both directions.
+//
+// Parameters:
+//   - w (io.Writer): Destination of the capture
+//   - name (string): Name of the captured interface, such as "eth0"
+//
+// Returns:
+//   - *Writer: New writer
+//   - error: Error if the headers cannot be written
+func NewWriter(w io.Writer, name string) (*Writer, error) {
+	outbound := pcapgo.DefaultNgInterface
+	outbound.Name, outbound.Comment, outbound.LinkType = name, outboundComment, layers.LinkTypeEthernet
+	inbound := outbound
+	inbound.Comment = inboundComment
+
+	options := pcapgo.DefaultNgWriterOptions
+	options.SectionInfo.Application = "goecat"
+	ng, err := pcapgo.NewNgWriterInterface(w, outbound, options)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := ng.AddInterface(inbound); err != nil {
+		return nil, err
+	}
+	return &Writer{w: ng}, nil
+}
+
+// Write appends a record to the capture.
+//
+// Parameters:
+//   - r (Record): Frame to record
+//
+// Returns:
+//   - error: Error if the record cannot be written
+func (w *Writer) Write(r Record) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	ci := gopacket.CaptureInfo{
+		Timestamp:      r.Time,
+		CaptureLength:  len(r.Data),
+		Length:         len(r.Data),
+		InterfaceIndex: int(r.Direction),
+	}
+	return w.w.WritePacket(ci, r.Data)
+}
+
+// Flush writes buffered records to the destination.
+func (w *Writer) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.w.Flush()
+}
+
+// Recorder is a link.Link that records every frame sent and received on another link.
+// Errors while recording do not fail the link; they are reported by Err.
+type Recorder struct {
+	l link.Link
+	w *Writer
+
+	mu  sync.Mutex
+	err error
+}
+
+// NewRecorder records the frames of l with w.
+//
+// Parameters:
+//   - l (link.Link): Link to record
+//   - w (*Writer): Destination of the records
+//
+// Returns:
+//   - *Recorder: Recording link
+func NewRecorder(l link.Link, w *Writer) *Recorder {
+	return &Recorder{l: l, w: w}
+}
+
+// Send sends a frame and records it as outbound.
+func (r *Recorder) Send(frame []byte) error {
+	now := time.Now()
+	if err := r.l.Send(frame); err != nil {
+		return err
+	}
+	r.record(Record{Time: now, Direction: Outbound, Data: frame})
+	return nil
+}
+
+// Receive receives a frame and records it as inbound.
+func (r *Recorder) Receive() ([]byte, error) {
+	frame, err := r.l.Receive()
+	if err != nil {
+		return nil, err
+	}
+	r.record(Record{Time: time.Now(), Direction: Inbound, Data: frame})
+	return frame, nil
+}
+
+// Close closes the recorded link and flushes the capture.
+func (r *Recorder) Close() error {
+	err := r.l.Close()
+	if flushErr := r.w.Flush(); err == nil {
+		err = flushErr
+	}
+	return err
+}
+
+// Err returns the first error that occurred while recording.
+func (r *Recorder) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.err
+}
+
+func (r *Recorder) record(rec Record) {
+	if err := r.w.Write(rec); err != nil {
+		r.mu.Lock()
+		if r.err == nil {
+			r.err = err
+		}
+		r.mu.Unlock()
+	}
+}
@@ -0,0 +1,95 @@
+package capture_test
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Aruminium/goecat/pkg/capture"
+	"github.com/Aruminium/goecat/pkg/ethercat"
+	"github.com/Aruminium/goecat/pkg/ethercat/command"
+	"github.com/Aruminium/goecat/pkg/ethercat/datagram"
+	"github.com/Aruminium/goecat/pkg/ethercat/register"
+	"github.com/Aruminium/goecat/pkg/link"
+	"github.com/Aruminium/goecat/pkg/simulator"
+	"github.com/Aruminium/goecat/pkg/transceiver"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+)
+
+var encap = link.Encapsulation{Transport: link.Raw, SrcMAC: net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, 0x55}}
+
+func TestRecordAndReplay(t *testing.T) {
+	// given
+	var file bytes.Buffer
+	w, err := capture.NewWriter(&file, "veth0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	ring := simulator.NewRing(simulator.NewESC(simulator.Config{}), simulator.NewESC(simulator.Config{}))
+	recorder := capture.NewRecorder(ring.Attach(), w)
+	tr := transceiver.New(recorder, transceiver.Options{Encapsulation: encap})
+	ctx := context.Background()
+
+	// when
+	tr.Exchange(ctx, datagram.BRD(register.Type, 1))
+	tr.Exchange(ctx, datagram.APRD(1, register.DLStatus, 2))
+	tr.Close()
+	r, err := capture.NewReader(&file)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	history, err := capture.Replay(r)
+
+	// then
+	if err != nil || recorder.Err() != nil {
+		t.Fatalf("Unexpected error: %v %v", err, recorder.Err())
+	}
+	if len(history.Transactions) != 2 || len(history.Unmatched) != 0 || history.Skipped != 0 {
+		t.Fatalf("Expected 2 transactions, but got %+v", history)
+	}
+	brd, aprd := history.Transactions[0], history.Transactions[1]
+	if !brd.Returned || brd.Response.WKC != 2 || brd.Request.Command != command.BRD {
+		t.Errorf("Expected BRD to return with WKC 2, but got %+v", brd)
+	}
+	if !aprd.Returned || aprd.Response.WKC != 1 || aprd.RoundTrip() < 0 {
+		t.Errorf("Expected APRD to return with WKC 1, but got %+v", aprd)
+	}
+}
+
+func TestReplayPcapDerivesDirection(t *testing.T) {
+	// given
+	var file bytes.Buffer
+	w := pcapgo.NewWriter(&file)
+	w.WriteFileHeader(65536, layers.LinkTypeEthernet)
+
+	ecat := ethercat.NewEtherCAT()
+	ecat.AppendDatagram(datagram.BRD(register.Type, 1))
+	sent, _ := encap.Encapsulate(ecat.Bytes())
+	returned := append([]byte{}, sent...)
+	returned[6] |= 0x02
+
+	start := time.Unix(1700000000, 0)
+	for i, frame := range [][]byte{sent, returned, []byte("not ethercat")} {
+		ci := gopacket.CaptureInfo{Timestamp: start.Add(time.Duration(i) * time.Millisecond), CaptureLength: len(frame), Length: len(frame)}
+		w.WritePacket(ci, frame)
+	}
+
+	// when
+	r, err := capture.NewReader(&file)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	history, err := capture.Replay(r)
+
+	// then
+	if err != nil || len(history.Transactions) != 1 || history.Skipped != 1 {
+		t.Fatalf("Expected 1 transaction and 1 skipped frame, but got %+v (%v)", history, err)
+	}
+	if tx := history.Transactions[0]; !tx.Returned || tx.RoundTrip() != time.Millisecond {
+		t.Errorf("Expected the frame to return after 1ms, but got %+v", tx)
+	}
+}
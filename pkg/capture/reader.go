@@ -0,0 +1,109 @@
+package capture
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+)
+
+// pcapngMagic is the block type of the pcapng section header, which starts every pcapng file.
+var pcapngMagic = []byte{0x0a, 0x0d, 0x0d, 0x0a}
+
+// ErrLinkType is returned for captures that do not contain Ethernet frames.
+var ErrLinkType = errors.New("capture does not contain Ethernet frames")
+
+// Reader reads the records of a pcap or pcapng capture.
+type Reader struct {
+	source     gopacket.PacketDataSource
+	directions []Direction // Direction of each pcapng interface, nil to derive it from the frame
+}
+
+// NewReader opens a pcap or pcapng capture.
+//
+// Parameters:
+//   - r (io.Reader): Capture file
+//
+// Returns:
+//   - *Reader: New reader
+//   - error: Error if the file is not a capture of Ethernet frames
+func NewReader(r io.Reader) (*Reader, error) {
+	buffered := bufio.NewReader(r)
+	magic, err := buffered.Peek(len(pcapngMagic))
+	if err != nil {
+		return nil, fmt.Errorf("capture: %w", err)
+	}
+
+	if !bytes.Equal(magic, pcapngMagic) {
+		pcap, err := pcapgo.NewReader(buffered)
+		if err != nil {
+			return nil, fmt.Errorf("capture: %w", err)
+		}
+		if pcap.LinkType() != layers.LinkTypeEthernet {
+			return nil, ErrLinkType
+		}
+		return &Reader{source: pcap}, nil
+	}
+
+	ng, err := pcapgo.NewNgReader(buffered, pcapgo.DefaultNgReaderOptions)
+	if err != nil {
+		return nil, fmt.Errorf("capture: %w", err)
+	}
+	if ng.LinkType() != layers.LinkTypeEthernet {
+		return nil, ErrLinkType
+	}
+
+	reader := &Reader{source: ng}
+	for i := 0; i < ng.NInterfaces(); i++ {
+		intf, _ := ng.Interface(i)
+		switch intf.Comment {
+		case outboundComment:
+			reader.directions = append(reader.directions, Outbound)
+		case inboundComment:
+			reader.directions = append(reader.directions, Inbound)
+		default:
+			// Not written by this package, so the interfaces say nothing about the direction.
+			reader.directions = nil
+			return reader, nil
+		}
+	}
+	return reader, nil
+}
+
+// Next returns the next record of the capture.
+//
+// Returns:
+//   - Record: Next record
+//   - error: io.EOF at the end of the capture
+func (r *Reader) Next() (Record, error) {
+	data, ci, err := r.source.ReadPacketData()
+	if err != nil {
+		return Record{}, err
+	}
+
+	direction := Direct(data)
+	if ci.InterfaceIndex < len(r.directions) {
+		direction = r.directions[ci.InterfaceIndex]
+	}
+	return Record{Time: ci.Timestamp, Direction: direction, Data: data}, nil
+}
+
+// Direct derives the direction of an Ethernet frame from its source MAC address:
+// the first slave sets the locally administered bit in every frame it returns.
+//
+// Parameters:
+//   - ethernet ([]byte): Ethernet frame
+//
+// Returns:
+//   - Direction: Inbound if the locally administered bit is set, Outbound otherwise
+func Direct(ethernet []byte) Direction {
+	if len(ethernet) > 6 && ethernet[6]&0x02 != 0 {
+		return Inbound
+	}
+	return Outbound
+}
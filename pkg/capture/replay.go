@@ -0,0 +1,88 @@
+package capture
+
+import (
+	"errors"
+	"io"
+	"time"
+
+	"github.com/Aruminium/goecat/pkg/ethercat"
+	"github.com/Aruminium/goecat/pkg/ethercat/datagram"
+	"github.com/Aruminium/goecat/pkg/link"
+)
+
+// Transaction is a datagram as the master sent it and, if it came back, as it was returned.
+type Transaction struct {
+	Sent     time.Time
+	Request  datagram.Datagram
+	Returned bool // False if the frame was lost
+	Received time.Time
+	Response datagram.Datagram
+}
+
+// RoundTrip returns the time between sending and receiving, 0 if the datagram did not return.
+func (t Transaction) RoundTrip() time.Duration {
+	if !t.Returned {
+		return 0
+	}
+	return t.Received.Sub(t.Sent)
+}
+
+// History is the datagram level history rebuilt from a capture.
+type History struct {
+	Transactions []Transaction // In the order the datagrams were sent
+	Unmatched    []Transaction // Returned datagrams without a sent counterpart, Request is zero
+	Skipped      int           // Frames that do not carry EtherCAT or cannot be decoded
+}
+
+// Replay decodes the frames of a capture and matches every returned datagram with the sent
+// datagram of the same index and command.
+//
+// Parameters:
+//   - r (*Reader): Capture to replay
+//
+// Returns:
+//   - History: Datagrams of the capture
+//   - error: Error if the capture cannot be read
+func Replay(r *Reader) (History, error) {
+	var h History
+	pending := make(map[uint8]int) // Datagram index to the position of its transaction
+
+	for {
+		rec, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			return h, nil
+		}
+		if err != nil {
+			return h, err
+		}
+
+		ecat, err := link.Decapsulate(rec.Data)
+		if err != nil {
+			h.Skipped++
+			continue
+		}
+		frame, err := ethercat.Parse(ecat)
+		if err != nil {
+			h.Skipped++
+			continue
+		}
+
+		for _, d := range frame.Datagrams() {
+			if rec.Direction == Outbound {
+				pending[d.Index] = len(h.Transactions)
+				h.Transactions = append(h.Transactions, Transaction{Sent: rec.Time, Request: d})
+				continue
+			}
+
+			i, ok := pending[d.Index]
+			if !ok || h.Transactions[i].Request.Command != d.Command {
+				h.Unmatched = append(h.Unmatched, Transaction{Returned: true, Received: rec.Time, Response: d})
+				continue
+			}
+			delete(pending, d.Index)
+			h.Transactions[i].Returned = true
+			h.Transactions[i].Received = rec.Time
+			h.Transactions[i].Response = d
+		}
+	}
+}
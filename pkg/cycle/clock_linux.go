@@ -0,0 +1,46 @@
+package cycle
+
+import (
+	"fmt"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// schedFIFO is the SCHED_FIFO scheduling policy.
+const schedFIFO = 1
+
+// monotonic returns CLOCK_MONOTONIC in nanoseconds.
+func monotonic() int64 {
+	var ts unix.Timespec
+	_ = unix.ClockGettime(unix.CLOCK_MONOTONIC, &ts)
+	return ts.Nano()
+}
+
+// sleepUntil sleeps until CLOCK_MONOTONIC reaches deadline, in nanoseconds.
+func sleepUntil(deadline int64) {
+	ts := unix.NsecToTimespec(deadline)
+	for unix.ClockNanosleep(unix.CLOCK_MONOTONIC, unix.TIMER_ABSTIME, &ts, nil) == unix.EINTR {
+	}
+}
+
+// configureThread pins the calling thread to cpus and sets its SCHED_FIFO priority.
+func configureThread(cpus []int, priority int) error {
+	if len(cpus) > 0 {
+		var set unix.CPUSet
+		set.Zero()
+		for _, cpu := range cpus {
+			set.Set(cpu)
+		}
+		if err := unix.SchedSetaffinity(0, &set); err != nil {
+			return fmt.Errorf("cycle: pin to CPUs %v: %w", cpus, err)
+		}
+	}
+	if priority > 0 {
+		param := struct{ priority int32 }{int32(priority)}
+		if _, _, errno := unix.Syscall(unix.SYS_SCHED_SETSCHEDULER, 0, schedFIFO, uintptr(unsafe.Pointer(&param))); errno != 0 {
+			return fmt.Errorf("cycle: set SCHED_FIFO priority %d: %w", priority, errno)
+		}
+	}
+	return nil
+}
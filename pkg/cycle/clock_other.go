@@ -0,0 +1,29 @@
+//go:build !linux
+
+package cycle
+
+import (
+	"errors"
+	"time"
+)
+
+// start is the origin of monotonic.
+var start = time.Now()
+
+// monotonic returns the monotonic time since start in nanoseconds.
+func monotonic() int64 {
+	return int64(time.Since(start))
+}
+
+// sleepUntil sleeps until monotonic reaches deadline, in nanoseconds.
+func sleepUntil(deadline int64) {
+	time.Sleep(time.Duration(deadline - monotonic()))
+}
+
+// configureThread refuses CPUs and priorities, which are only supported on Linux.
+func configureThread(cpus []int, priority int) error {
+	if len(cpus) > 0 || priority > 0 {
+		return errors.New("cycle: CPUs and Priority are only supported on Linux")
+	}
+	return nil
+}
@@ -0,0 +1,218 @@
+// Package cycle runs a function periodically with low jitter, for the cyclic exchange of a master.
+//
+// A Scheduler locks its goroutine to an OS thread and can pin that thread to CPUs and run it with
+// SCHED_FIFO priority. It sleeps until absolute deadlines, so the time taken by a cycle does not
+// shift the following ones, and can busy-wait the last part of every period to cut the wake-up
+// latency of the kernel. Stats shows how late the cycles were woken.
+//
+// Pinning, priority and absolute sleeping are only available on Linux; elsewhere the Scheduler
+// falls back to time.Sleep and refuses CPUs and Priority.
+package cycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// Options configures a Scheduler.
+type Options struct {
+	Period time.Duration // Time between two deadlines
+	// CPUs the thread of the Scheduler is pinned to, all CPUs if empty.
+	CPUs []int
+	// Priority is the SCHED_FIFO priority of the thread from 1 to 99, 0 keeps the normal scheduler.
+	// Raising the priority needs CAP_SYS_NICE or a matching RLIMIT_RTPRIO.
+	Priority int
+	// Spin is the part of every period that is busy-waited instead of slept, 0 sleeps until the deadline.
+	// Spinning trades a CPU for less wake-up latency and is best combined with CPUs.
+	Spin time.Duration
+}
+
+// Stats describes how late the cycles of a Scheduler were started.
+// Latency is the time from a deadline to the start of its cycle.
+type Stats struct {
+	Cycles   uint64        // Cycles run
+	Overruns uint64        // Deadlines skipped because a cycle took longer than the period
+	Min      time.Duration // Smallest latency
+	Max      time.Duration // Largest latency
+	Mean     time.Duration // Mean latency
+	StdDev   time.Duration // Standard deviation of the latency
+}
+
+// Jitter returns the spread of the latency.
+//
+// Returns:
+//   - time.Duration: Max minus Min
+func (s Stats) Jitter() time.Duration {
+	return s.Max - s.Min
+}
+
+func (s Stats) String() string {
+	return fmt.Sprintf("%d cycles, %d overruns, latency min %v mean %v max %v stddev %v, jitter %v",
+		s.Cycles, s.Overruns, s.Min, s.Mean, s.Max, s.StdDev, s.Jitter())
+}
+
+// ErrRunning is returned by Start while the Scheduler is running.
+var ErrRunning = errors.New("cycle: scheduler is already running")
+
+// Scheduler calls a function at every deadline of a period.
+type Scheduler struct {
+	opts Options
+
+	mu      sync.Mutex
+	running bool
+	done    chan struct{}
+	stats   Stats
+	sum     float64 // Sum of the latencies in nanoseconds
+	squares float64 // Sum of the squared latencies
+}
+
+// New creates a Scheduler.
+//
+// Parameters:
+//   - opts (Options): Period, CPUs, priority and spinning
+//
+// Returns:
+//   - *Scheduler: New Scheduler
+//   - error: Error if the period is not positive, the priority is out of range or Spin exceeds the period
+func New(opts Options) (*Scheduler, error) {
+	if opts.Period <= 0 {
+		return nil, fmt.Errorf("cycle: period must be positive, got %v", opts.Period)
+	}
+	if opts.Priority < 0 || opts.Priority > 99 {
+		return nil, fmt.Errorf("cycle: priority must be in the range [0, 99], got %d", opts.Priority)
+	}
+	if opts.Spin < 0 || opts.Spin > opts.Period {
+		return nil, fmt.Errorf("cycle: spin must be in the range [0, %v], got %v", opts.Period, opts.Spin)
+	}
+	return &Scheduler{opts: opts}, nil
+}
+
+// Period returns the period of the Scheduler.
+func (s *Scheduler) Period() time.Duration {
+	return s.opts.Period
+}
+
+// Start starts a goroutine that is locked to its OS thread, applies CPUs and Priority to the thread
+// and calls fn at every deadline until ctx is done. The first deadline is one period after Start,
+// and the statistics start over.
+// If fn takes longer than a period, the deadlines that have passed are skipped and counted as overruns.
+//
+// The thread is not handed back to the Go runtime when the goroutine ends, so its settings do not leak
+// into other goroutines.
+//
+// Parameters:
+//   - ctx (context.Context): Context stopping the cycles
+//   - fn (func()): Function called every period
+//
+// Returns:
+//   - error: ErrRunning, or the error of pinning the thread or raising its priority
+func (s *Scheduler) Start(ctx context.Context, fn func()) error {
+	s.mu.Lock()
+	if s.running {
+		s.mu.Unlock()
+		return ErrRunning
+	}
+	s.running = true
+	s.done = make(chan struct{})
+	s.stats, s.sum, s.squares = Stats{}, 0, 0
+	done := s.done
+	s.mu.Unlock()
+
+	setup := make(chan error, 1)
+	go func() {
+		defer func() {
+			s.mu.Lock()
+			s.running = false
+			s.mu.Unlock()
+			close(done)
+		}()
+		runtime.LockOSThread()
+
+		if err := configureThread(s.opts.CPUs, s.opts.Priority); err != nil {
+			setup <- err
+			return
+		}
+		setup <- nil
+		s.run(ctx, fn)
+	}()
+	return <-setup
+}
+
+// Wait waits until the goroutine started by the last Start has stopped.
+func (s *Scheduler) Wait() {
+	s.mu.Lock()
+	done := s.done
+	s.mu.Unlock()
+	if done != nil {
+		<-done
+	}
+}
+
+// Stats returns a snapshot of the latency statistics.
+func (s *Scheduler) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.stats
+}
+
+// run calls fn at every deadline until ctx is done.
+func (s *Scheduler) run(ctx context.Context, fn func()) {
+	period := int64(s.opts.Period)
+	spin := int64(s.opts.Spin)
+	deadline := monotonic() + period
+	for ctx.Err() == nil {
+		if spin < period {
+			sleepUntil(deadline - spin)
+		}
+		now := monotonic()
+		for now < deadline {
+			now = monotonic()
+		}
+		s.observe(time.Duration(now - deadline))
+
+		fn()
+
+		deadline += period
+		if now = monotonic(); now > deadline {
+			missed := (now - deadline + period - 1) / period
+			deadline += missed * period
+			s.overrun(uint64(missed))
+		}
+	}
+}
+
+// observe adds the latency of a cycle to the statistics.
+func (s *Scheduler) observe(latency time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st := &s.stats
+	if st.Cycles == 0 || latency < st.Min {
+		st.Min = latency
+	}
+	if latency > st.Max {
+		st.Max = latency
+	}
+	st.Cycles++
+	s.sum += float64(latency)
+	s.squares += float64(latency) * float64(latency)
+
+	n := float64(st.Cycles)
+	mean := s.sum / n
+	st.Mean = time.Duration(mean)
+	st.StdDev = time.Duration(math.Sqrt(math.Max(s.squares/n-mean*mean, 0)))
+}
+
+// overrun counts skipped deadlines.
+func (s *Scheduler) overrun(missed uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.stats.Overruns += missed
+}
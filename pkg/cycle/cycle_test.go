@@ -0,0 +1,94 @@
+package cycle_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Aruminium/goecat/pkg/cycle"
+)
+
+// runCycles runs s until fn has been called n times and returns the statistics.
+func runCycles(t *testing.T, s *cycle.Scheduler, n int, fn func(i int)) cycle.Stats {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	i := 0
+	err := s.Start(ctx, func() {
+		if fn != nil {
+			fn(i)
+		}
+		if i++; i == n {
+			cancel()
+		}
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	s.Wait()
+	return s.Stats()
+}
+
+func TestScheduler(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		spin time.Duration
+	}{
+		{"sleep", 0},
+		{"sleep then spin", 200 * time.Microsecond},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			// given
+			s, err := cycle.New(cycle.Options{Period: time.Millisecond, Spin: tt.spin})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			// when
+			start := time.Now()
+			stats := runCycles(t, s, 20, nil)
+			elapsed := time.Since(start)
+
+			// then
+			if stats.Cycles != 20 || stats.Min < 0 || stats.Min > stats.Mean || stats.Mean > stats.Max {
+				t.Errorf("Unexpected stats %v", stats)
+			}
+			if elapsed < 20*time.Millisecond {
+				t.Errorf("Expected 20 periods to take at least 20ms, but took %v", elapsed)
+			}
+		})
+	}
+}
+
+func TestSchedulerOverrun(t *testing.T) {
+	// given
+	s, _ := cycle.New(cycle.Options{Period: time.Millisecond})
+
+	// when
+	stats := runCycles(t, s, 5, func(i int) {
+		if i == 1 {
+			time.Sleep(3500 * time.Microsecond)
+		}
+	})
+
+	// then
+	if stats.Cycles != 5 || stats.Overruns < 3 {
+		t.Errorf("Expected at least 3 overruns in 5 cycles, but got %v", stats)
+	}
+}
+
+func TestNewInvalidOptions(t *testing.T) {
+	for _, opts := range []cycle.Options{
+		{},
+		{Period: time.Millisecond, Priority: 100},
+		{Period: time.Millisecond, Spin: 2 * time.Millisecond},
+	} {
+		// when
+		_, err := cycle.New(opts)
+
+		// then
+		if err == nil {
+			t.Errorf("Expected an error for %+v", opts)
+		}
+	}
+}
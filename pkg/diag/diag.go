@@ -0,0 +1,234 @@
+// Package diag collects the error counters of the ESCs (0x0300-0x0313) to locate degrading
+// cables and slaves before a line fails.
+//
+// An ESC counts invalid frames and RX errors per port when it receives a corrupted frame,
+// and marks the frame so that the following ESCs count it as a forwarded RX error as well.
+// Errors that are counted on a port without being forwarded are therefore where the
+// corruption entered the segment: the cable connected to the port, the port itself or the
+// port on the other end of the cable. Locate points at them.
+//
+// The counters saturate at 255 and are cleared by writing to them. A Monitor samples them
+// periodically and reports the increase since the previous sample.
+package diag
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Aruminium/goecat/pkg/ethercat/datagram"
+	"github.com/Aruminium/goecat/pkg/ethercat/payload"
+	"github.com/Aruminium/goecat/pkg/ethercat/register"
+	"github.com/Aruminium/goecat/pkg/scan"
+	"github.com/Aruminium/goecat/pkg/topology"
+	"github.com/Aruminium/goecat/pkg/transceiver"
+)
+
+// countersLength is the size of the register area from RX Error Counter to Lost Link Counter.
+const countersLength = register.LostLinkCounter + topology.Ports - register.RXErrorCounter
+
+// Counters holds the error counters of one ESC.
+type Counters struct {
+	InvalidFrame     [topology.Ports]uint8 // Invalid frame counter per port (0x0300 + 2n)
+	RXError          [topology.Ports]uint8 // RX error counter per port (0x0301 + 2n)
+	ForwardedRXError [topology.Ports]uint8 // Forwarded RX error counter per port (0x0308 + n)
+	ProcessingUnit   uint8                 // ECAT processing unit error counter (0x030C)
+	PDI              uint8                 // PDI error counter (0x030D)
+	LostLink         [topology.Ports]uint8 // Lost link counter per port (0x0310 + n)
+}
+
+// ParseCounters decodes the error counter registers.
+//
+// Parameters:
+//   - data ([]byte): Registers 0x0300 to 0x0313
+//
+// Returns:
+//   - Counters: Decoded counters
+//   - error: Error if data is too short
+func ParseCounters(data []byte) (Counters, error) {
+	if len(data) < int(countersLength) {
+		return Counters{}, fmt.Errorf("diag: %d bytes of error counters, expected %d", len(data), countersLength)
+	}
+
+	var c Counters
+	for port := 0; port < topology.Ports; port++ {
+		c.InvalidFrame[port] = data[2*port]
+		c.RXError[port] = data[2*port+1]
+		c.ForwardedRXError[port] = data[register.ForwardedRXErrorCounter-register.RXErrorCounter+uint16(port)]
+		c.LostLink[port] = data[register.LostLinkCounter-register.RXErrorCounter+uint16(port)]
+	}
+	c.ProcessingUnit = data[register.ECATProcessingUnitErrors-register.RXErrorCounter]
+	c.PDI = data[register.PDIErrorCounter-register.RXErrorCounter]
+	return c, nil
+}
+
+// Sub returns the increase of every counter from previous to c. A counter lower than before
+// has been cleared in between, so its increase is its current value.
+//
+// Parameters:
+//   - previous (Counters): Earlier reading of the same ESC
+//
+// Returns:
+//   - Counters: Increase of every counter
+func (c Counters) Sub(previous Counters) Counters {
+	delta := func(now uint8, before uint8) uint8 {
+		if now < before {
+			return now
+		}
+		return now - before
+	}
+
+	var d Counters
+	for port := 0; port < topology.Ports; port++ {
+		d.InvalidFrame[port] = delta(c.InvalidFrame[port], previous.InvalidFrame[port])
+		d.RXError[port] = delta(c.RXError[port], previous.RXError[port])
+		d.ForwardedRXError[port] = delta(c.ForwardedRXError[port], previous.ForwardedRXError[port])
+		d.LostLink[port] = delta(c.LostLink[port], previous.LostLink[port])
+	}
+	d.ProcessingUnit = delta(c.ProcessingUnit, previous.ProcessingUnit)
+	d.PDI = delta(c.PDI, previous.PDI)
+	return d
+}
+
+// IsZero reports whether all counters are zero.
+func (c Counters) IsZero() bool {
+	return c == Counters{}
+}
+
+// Read reads the error counters of a slave.
+//
+// Parameters:
+//   - ctx (context.Context): Context bounding the exchange
+//   - x (transceiver.Exchanger): Transceiver of the segment
+//   - station (uint16): Configured station address of the slave
+//
+// Returns:
+//   - Counters: Error counters
+//   - error: Error if the slave does not answer
+func Read(ctx context.Context, x transceiver.Exchanger, station uint16) (Counters, error) {
+	d, err := x.ExchangeExpect(ctx, datagram.FPRD(station, register.RXErrorCounter, countersLength), transceiver.ExpectWKC(1))
+	if err != nil {
+		return Counters{}, err
+	}
+	return ParseCounters(d.Data.Bytes())
+}
+
+// Reset clears the error counters of a slave.
+//
+// Parameters:
+//   - ctx (context.Context): Context bounding the exchange
+//   - x (transceiver.Exchanger): Transceiver of the segment
+//   - station (uint16): Configured station address of the slave
+//
+// Returns:
+//   - error: Error if the slave does not answer
+func Reset(ctx context.Context, x transceiver.Exchanger, station uint16) error {
+	_, err := x.ExchangeExpect(ctx, datagram.FPWR(station, register.RXErrorCounter, payload.BasicPayload{Data: make([]byte, countersLength)}), transceiver.ExpectWKC(1))
+	return err
+}
+
+// SlaveCounters is the reading of one slave in a Sample.
+type SlaveCounters struct {
+	Position uint16
+	Station  uint16
+	Counters Counters // Current values
+	Delta    Counters // Increase since the previous sample
+}
+
+// Sample is a reading of all slaves of a Monitor.
+type Sample struct {
+	Time     time.Time
+	Interval time.Duration // Time since the previous sample, 0 for the first one
+	Slaves   []SlaveCounters
+}
+
+// Monitor samples the error counters of the slaves of a segment and tracks their increase.
+// It is not safe for concurrent use.
+type Monitor struct {
+	x      transceiver.Exchanger
+	slaves []scan.Slave
+	last   *Sample
+}
+
+// NewMonitor creates a Monitor for scanned slaves.
+//
+// Parameters:
+//   - x (transceiver.Exchanger): Transceiver of the segment
+//   - slaves ([]scan.Slave): Slaves to monitor, addressed by their station addresses
+//
+// Returns:
+//   - *Monitor: New monitor; the first Sample reports the counters since power-up or the last reset
+func NewMonitor(x transceiver.Exchanger, slaves []scan.Slave) *Monitor {
+	return &Monitor{x: x, slaves: slaves}
+}
+
+// Sample reads the counters of every slave.
+//
+// Parameters:
+//   - ctx (context.Context): Context bounding the exchanges
+//
+// Returns:
+//   - Sample: Counters of every slave with their increase since the previous sample
+//   - error: Error if a slave does not answer
+func (m *Monitor) Sample(ctx context.Context) (Sample, error) {
+	sample := Sample{Time: time.Now(), Slaves: make([]SlaveCounters, len(m.slaves))}
+	for i, s := range m.slaves {
+		c, err := Read(ctx, m.x, s.Station)
+		if err != nil {
+			return Sample{}, fmt.Errorf("diag: slave %d: %w", s.Position, err)
+		}
+		sample.Slaves[i] = SlaveCounters{Position: s.Position, Station: s.Station, Counters: c, Delta: c}
+		if m.last != nil {
+			sample.Slaves[i].Delta = c.Sub(m.last.Slaves[i].Counters)
+		}
+	}
+	if m.last != nil {
+		sample.Interval = sample.Time.Sub(m.last.Time)
+	}
+	m.last = &sample
+	return sample, nil
+}
+
+// Reset clears the counters of every slave; the next sample reports the increase since the reset.
+//
+// Parameters:
+//   - ctx (context.Context): Context bounding the exchanges
+//
+// Returns:
+//   - error: Error if a slave does not answer
+func (m *Monitor) Reset(ctx context.Context) error {
+	for _, s := range m.slaves {
+		if err := Reset(ctx, m.x, s.Station); err != nil {
+			return fmt.Errorf("diag: slave %d: %w", s.Position, err)
+		}
+	}
+	m.last = &Sample{Time: time.Now(), Slaves: make([]SlaveCounters, len(m.slaves))}
+	return nil
+}
+
+// Run samples the counters every interval and passes each sample to report until ctx is done.
+//
+// Parameters:
+//   - ctx (context.Context): Context stopping the monitor
+//   - interval (time.Duration): Time between samples
+//   - report (func(Sample)): Called with every sample
+//
+// Returns:
+//   - error: ctx.Err() when ctx is done, or the error of a failed sample
+func (m *Monitor) Run(ctx context.Context, interval time.Duration, report func(Sample)) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		sample, err := m.Sample(ctx)
+		if err != nil {
+			return err
+		}
+		report(sample)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
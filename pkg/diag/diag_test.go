@@ -0,0 +1,135 @@
+package diag_test
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/Aruminium/goecat/pkg/diag"
+	"github.com/Aruminium/goecat/pkg/ethercat/register"
+	"github.com/Aruminium/goecat/pkg/ethercat/sii"
+	"github.com/Aruminium/goecat/pkg/link"
+	"github.com/Aruminium/goecat/pkg/scan"
+	"github.com/Aruminium/goecat/pkg/simulator"
+	"github.com/Aruminium/goecat/pkg/topology"
+	"github.com/Aruminium/goecat/pkg/transceiver"
+)
+
+var encap = link.Encapsulation{Transport: link.Raw, SrcMAC: net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, 0x55}}
+
+// newMonitor returns a monitor of a line of two slaves and the scanned slaves.
+func newMonitor(t *testing.T, escs ...*simulator.ESC) (*diag.Monitor, []scan.Slave) {
+	tr := transceiver.New(simulator.NewRing(escs...).Attach(), transceiver.Options{Encapsulation: encap})
+	t.Cleanup(func() { tr.Close() })
+	slaves, err := scan.Scan(context.Background(), tr, scan.Options{SkipSII: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return diag.NewMonitor(tr, slaves), slaves
+}
+
+func TestParseCounters(t *testing.T) {
+	// given
+	data := []byte{1, 2, 3, 4, 0, 0, 0, 0, 5, 6, 0, 0, 7, 8, 0, 0, 9, 0, 0, 10}
+
+	// when
+	c, err := diag.ParseCounters(data)
+
+	// then
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := diag.Counters{
+		InvalidFrame:     [topology.Ports]uint8{1, 3, 0, 0},
+		RXError:          [topology.Ports]uint8{2, 4, 0, 0},
+		ForwardedRXError: [topology.Ports]uint8{5, 6, 0, 0},
+		ProcessingUnit:   7,
+		PDI:              8,
+		LostLink:         [topology.Ports]uint8{9, 0, 0, 10},
+	}
+	if !reflect.DeepEqual(c, expected) {
+		t.Errorf("Expected %+v, but got %+v", expected, c)
+	}
+}
+
+func TestSub(t *testing.T) {
+	// given
+	previous := diag.Counters{InvalidFrame: [topology.Ports]uint8{5, 0, 0, 0}, PDI: 3}
+	now := diag.Counters{InvalidFrame: [topology.Ports]uint8{7, 0, 0, 0}, PDI: 1}
+
+	// when
+	delta := now.Sub(previous)
+
+	// then
+	// PDI went down, so it was cleared and increased by 1 since.
+	expected := diag.Counters{InvalidFrame: [topology.Ports]uint8{2, 0, 0, 0}, PDI: 1}
+	if delta != expected {
+		t.Errorf("Expected %+v, but got %+v", expected, delta)
+	}
+}
+
+func TestMonitor(t *testing.T) {
+	// given
+	first, second := simulator.NewESC(simulator.Config{EEPROM: sii.Info{}.Encode()}), simulator.NewESC(simulator.Config{EEPROM: sii.Info{}.Encode()})
+	monitor, _ := newMonitor(t, first, second)
+	second.Write(register.RXErrorCounter, []byte{1})
+	ctx := context.Background()
+
+	// when
+	initial, initialErr := monitor.Sample(ctx)
+	second.Write(register.RXErrorCounter, []byte{4, 2})
+	later, laterErr := monitor.Sample(ctx)
+	resetErr := monitor.Reset(ctx)
+	cleared, clearedErr := monitor.Sample(ctx)
+
+	// then
+	if initialErr != nil || laterErr != nil || resetErr != nil || clearedErr != nil {
+		t.Fatalf("Unexpected errors: %v, %v, %v, %v", initialErr, laterErr, resetErr, clearedErr)
+	}
+	if initial.Slaves[1].Delta.InvalidFrame[0] != 1 || !initial.Slaves[0].Delta.IsZero() {
+		t.Errorf("Expected the counters since power-up in the first sample, but got %+v", initial.Slaves)
+	}
+	expected := diag.Counters{InvalidFrame: [topology.Ports]uint8{3, 0, 0, 0}, RXError: [topology.Ports]uint8{2, 0, 0, 0}}
+	if later.Slaves[1].Delta != expected || later.Interval <= 0 {
+		t.Errorf("Expected %+v after %v, but got %+v", expected, later.Interval, later.Slaves[1].Delta)
+	}
+	if !cleared.Slaves[1].Counters.IsZero() || !cleared.Slaves[1].Delta.IsZero() {
+		t.Errorf("Expected cleared counters after the reset, but got %+v", cleared.Slaves[1])
+	}
+}
+
+func TestLocate(t *testing.T) {
+	// given
+	first, second := simulator.NewESC(simulator.Config{EEPROM: sii.Info{}.Encode()}), simulator.NewESC(simulator.Config{EEPROM: sii.Info{}.Encode()})
+	monitor, slaves := newMonitor(t, first, second)
+	tree, err := topology.Build(slaves)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// The frames arrive corrupted at port 0 of the second slave and are forwarded back
+	// through port 1 of the first slave, which only counts them as forwarded.
+	second.Write(register.RXErrorCounter, []byte{5})
+	first.Write(register.RXErrorCounter, []byte{0, 0, 5})
+	first.Write(register.ForwardedRXErrorCounter, []byte{0, 5})
+	first.Write(register.PDIErrorCounter, []byte{1})
+
+	// when
+	sample, err := monitor.Sample(context.Background())
+	findings := diag.Locate(sample, tree)
+
+	// then
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []diag.Finding{
+		{Kind: diag.PDIErrors, Position: 0, Port: -1, Peer: diag.NoPeer, PeerPort: -1, Count: 1},
+		{Kind: diag.LinkErrors, Position: 1, Port: 0, Peer: 0, PeerPort: 1, Count: 5},
+	}
+	if !reflect.DeepEqual(findings, expected) {
+		t.Errorf("Expected %+v, but got %+v", expected, findings)
+	}
+	if text := findings[1].String(); text != "5 link errors on slave 1 port 0, cable from slave 0 port 1" {
+		t.Errorf("Unexpected description %q", text)
+	}
+}
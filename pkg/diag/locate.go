@@ -0,0 +1,113 @@
+package diag
+
+import (
+	"fmt"
+
+	"github.com/Aruminium/goecat/pkg/topology"
+)
+
+// Kind is what a Finding counted.
+type Kind uint8
+
+const (
+	LinkErrors     Kind = iota // Invalid frames and RX errors that were not forwarded by a previous ESC
+	LostLinks                  // Link lost on the port
+	ProcessingUnit             // ECAT processing unit errors of the slave
+	PDIErrors                  // PDI errors of the slave
+)
+
+func (k Kind) String() string {
+	switch k {
+	case LinkErrors:
+		return "link errors"
+	case LostLinks:
+		return "lost links"
+	case ProcessingUnit:
+		return "processing unit errors"
+	case PDIErrors:
+		return "PDI errors"
+	default:
+		return fmt.Sprintf("Kind(%d)", uint8(k))
+	}
+}
+
+// NoPeer is the Peer of a Finding that concerns the slave itself or a port without a neighbour.
+const NoPeer = -2
+
+// Finding is a place in the segment whose counters increased.
+type Finding struct {
+	Kind     Kind
+	Position uint16
+	Port     int // Port of the slave, -1 for ProcessingUnit and PDIErrors
+	Peer     int // Position of the slave on the other end of the cable, topology.Master or NoPeer
+	PeerPort int // Port of the peer, -1 for the master or NoPeer
+	Count    int // Increase of the counters
+}
+
+// String describes the finding, such as "12 link errors on slave 2 port 0, cable from slave 1 port 1".
+func (f Finding) String() string {
+	if f.Port < 0 {
+		return fmt.Sprintf("%d %v on slave %d", f.Count, f.Kind, f.Position)
+	}
+
+	text := fmt.Sprintf("%d %v on slave %d port %d", f.Count, f.Kind, f.Position, f.Port)
+	switch f.Peer {
+	case NoPeer:
+		return text
+	case topology.Master:
+		return text + ", cable from the master"
+	default:
+		return text + fmt.Sprintf(", cable from slave %d port %d", f.Peer, f.PeerPort)
+	}
+}
+
+// Locate turns the increase of the counters in a sample into findings, attributing port errors
+// to the cable connected to the port.
+//
+// Parameters:
+//   - sample (Sample): Sample of all slaves of the tree
+//   - tree (*topology.Tree): Wiring of the segment, nil if unknown
+//
+// Returns:
+//   - []Finding: Findings in the order of the slaves and their ports
+func Locate(sample Sample, tree *topology.Tree) []Finding {
+	var result []Finding
+	for _, s := range sample.Slaves {
+		d := s.Delta
+		for port := 0; port < topology.Ports; port++ {
+			errors := int(d.InvalidFrame[port]) + int(d.RXError[port]) - int(d.ForwardedRXError[port])
+			if errors > 0 {
+				result = append(result, finding(tree, LinkErrors, s.Position, port, errors))
+			}
+			if d.LostLink[port] > 0 {
+				result = append(result, finding(tree, LostLinks, s.Position, port, int(d.LostLink[port])))
+			}
+		}
+		if d.ProcessingUnit > 0 {
+			result = append(result, Finding{Kind: ProcessingUnit, Position: s.Position, Port: -1, Peer: NoPeer, PeerPort: -1, Count: int(d.ProcessingUnit)})
+		}
+		if d.PDI > 0 {
+			result = append(result, Finding{Kind: PDIErrors, Position: s.Position, Port: -1, Peer: NoPeer, PeerPort: -1, Count: int(d.PDI)})
+		}
+	}
+	return result
+}
+
+// finding creates a port finding with the neighbour from the tree.
+func finding(tree *topology.Tree, kind Kind, position uint16, port int, count int) Finding {
+	f := Finding{Kind: kind, Position: position, Port: port, Peer: NoPeer, PeerPort: -1, Count: count}
+	if tree == nil || int(position) >= len(tree.Nodes) {
+		return f
+	}
+
+	n := tree.Nodes[position]
+	switch {
+	case port == n.EntryPort && n.Parent == topology.Master:
+		f.Peer = topology.Master
+	case port == n.EntryPort:
+		f.Peer, f.PeerPort = n.Parent, n.ParentPort
+	case n.Children[port] >= 0:
+		f.Peer, f.PeerPort = n.Children[port], tree.Nodes[n.Children[port]].EntryPort
+	}
+	return f
+}
@@ -0,0 +1,315 @@
+// Package dump renders EtherCAT frames for humans. Every datagram is printed with its command,
+// index, address, length, flags and working counter, followed by its data and the decoded
+// value of every known register the datagram covers:
+//
+//	FPWR #3 station=0x1001 ado=0x0120 len=2 wkc=1
+//	  0000  04 00
+//	  0x0120 AL Control = SAFE-OP
+//
+// Diff renders a datagram as it was sent next to the datagram that returned, so the changes
+// made by the slaves stand out, optionally highlighted with ANSI colors.
+package dump
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Aruminium/goecat/pkg/ethercat"
+	"github.com/Aruminium/goecat/pkg/ethercat/command"
+	"github.com/Aruminium/goecat/pkg/ethercat/datagram"
+	"github.com/Aruminium/goecat/pkg/link"
+)
+
+// bytesPerLine is the number of data bytes rendered on one line.
+const bytesPerLine = 16
+
+// ANSI escape codes used by Diff.
+const (
+	red   = "\x1b[31m"
+	green = "\x1b[32m"
+	reset = "\x1b[0m"
+)
+
+// Datagram renders one datagram.
+//
+// Parameters:
+//   - d (datagram.Datagram): Datagram to render
+//
+// Returns:
+//   - string: Rendered datagram, one or more lines each ending with a newline
+func Datagram(d datagram.Datagram) string {
+	var b strings.Builder
+
+	b.WriteString(joinFields(header(d)))
+	b.WriteByte('\n')
+
+	data := bytesOf(d)
+	for offset := 0; offset < len(data); offset += bytesPerLine {
+		b.WriteString("  ")
+		b.WriteString(hexLine(data, offset, nil, ""))
+		b.WriteByte('\n')
+	}
+
+	for _, r := range registers(d, data) {
+		fmt.Fprintf(&b, "  0x%04x %s = %s\n", r.address, r.name, r.value)
+	}
+	return b.String()
+}
+
+// Registers renders data read from the registers of one slave without the datagram header.
+//
+// Parameters:
+//   - address (uint16): Address of the first byte of data
+//   - data ([]byte): Register contents
+//
+// Returns:
+//   - string: Data and decoded registers, each line ending with a newline
+func Registers(address uint16, data []byte) string {
+	var b strings.Builder
+	for offset := 0; offset < len(data); offset += bytesPerLine {
+		b.WriteString(hexLine(data, offset, nil, ""))
+		b.WriteByte('\n')
+	}
+	for _, r := range registers(datagram.FPRD(0, address, uint16(len(data))), data) {
+		fmt.Fprintf(&b, "0x%04x %s = %s\n", r.address, r.name, r.value)
+	}
+	return b.String()
+}
+
+// Frame renders every datagram of an EtherCAT frame.
+//
+// Parameters:
+//   - f (*ethercat.EtherCAT): Frame to render
+//
+// Returns:
+//   - string: Rendered datagrams
+func Frame(f *ethercat.EtherCAT) string {
+	var b strings.Builder
+	for _, d := range f.Datagrams() {
+		b.WriteString(Datagram(d))
+	}
+	return b.String()
+}
+
+// Ethernet renders the EtherCAT frame carried by an Ethernet frame, either directly or in UDP.
+//
+// Parameters:
+//   - data ([]byte): Ethernet frame
+//
+// Returns:
+//   - string: Rendered datagrams
+//   - error: Error if the frame does not carry a valid EtherCAT frame
+func Ethernet(data []byte) (string, error) {
+	ecat, err := link.Decapsulate(data)
+	if err != nil {
+		return "", err
+	}
+	f, err := ethercat.Parse(ecat)
+	if err != nil {
+		return "", err
+	}
+	return Frame(f), nil
+}
+
+// Diff renders a datagram as it was sent and as it returned. Header fields and decoded registers
+// that changed are shown as "old->new", the data is rendered twice with the request marked "-"
+// and the response marked "+".
+//
+// With color, changed bytes and values are highlighted with ANSI escape codes; without color,
+// changed bytes are pointed at by a line of carets below the response.
+//
+// Parameters:
+//   - request (datagram.Datagram): Datagram as it was sent
+//   - response (datagram.Datagram): Datagram as it returned
+//   - color (bool): Whether to highlight changes with ANSI escape codes
+//
+// Returns:
+//   - string: Rendered difference
+func Diff(request datagram.Datagram, response datagram.Datagram, color bool) string {
+	var b strings.Builder
+
+	before, after := header(request), header(response)
+	fields := make([]field, len(before))
+	for i := range before {
+		fields[i] = before[i]
+		fields[i].quiet = before[i].quiet && after[i].quiet
+		if before[i].value != after[i].value {
+			fields[i].value = change(before[i].value, after[i].value, color)
+		}
+	}
+	b.WriteString(joinFields(fields))
+	b.WriteByte('\n')
+
+	sent, returned := bytesOf(request), bytesOf(response)
+	changed := func(i int) bool {
+		return i >= len(sent) || i >= len(returned) || sent[i] != returned[i]
+	}
+	sentColor, returnedColor := "", ""
+	if color {
+		sentColor, returnedColor = red, green
+	}
+	for offset := 0; offset < max(len(sent), len(returned)); offset += bytesPerLine {
+		if offset < len(sent) {
+			b.WriteString("- ")
+			b.WriteString(hexLine(sent, offset, changed, sentColor))
+			b.WriteByte('\n')
+		}
+		if offset < len(returned) {
+			b.WriteString("+ ")
+			b.WriteString(hexLine(returned, offset, changed, returnedColor))
+			b.WriteByte('\n')
+		}
+		if !color && offset < len(returned) {
+			if carets := caretLine(returned, offset, changed); carets != "" {
+				b.WriteString("  ")
+				b.WriteString(carets)
+				b.WriteByte('\n')
+			}
+		}
+	}
+
+	responses := make(map[uint16]string)
+	for _, r := range registers(response, returned) {
+		responses[r.address] = r.value
+	}
+	for _, r := range registers(request, sent) {
+		value := r.value
+		if got, ok := responses[r.address]; ok && got != r.value {
+			value = change(r.value, got, color)
+		}
+		fmt.Fprintf(&b, "  0x%04x %s = %s\n", r.address, r.name, value)
+	}
+	return b.String()
+}
+
+// FrameDiff renders the datagrams of a sent frame next to the datagrams of the returned frame.
+// Datagrams are paired by their position; datagrams without a counterpart are rendered alone.
+//
+// Parameters:
+//   - request (*ethercat.EtherCAT): Frame as it was sent
+//   - response (*ethercat.EtherCAT): Frame as it returned
+//   - color (bool): Whether to highlight changes with ANSI escape codes
+//
+// Returns:
+//   - string: Rendered difference
+func FrameDiff(request *ethercat.EtherCAT, response *ethercat.EtherCAT, color bool) string {
+	var b strings.Builder
+
+	sent, returned := request.Datagrams(), response.Datagrams()
+	for i := 0; i < max(len(sent), len(returned)); i++ {
+		switch {
+		case i >= len(returned):
+			b.WriteString(Datagram(sent[i]))
+		case i >= len(sent):
+			b.WriteString(Datagram(returned[i]))
+		default:
+			b.WriteString(Diff(sent[i], returned[i], color))
+		}
+	}
+	return b.String()
+}
+
+// field is one item of the header line of a datagram.
+type field struct {
+	key   string // Empty for the command and index, which are rendered without a key
+	value string
+	quiet bool // Omitted from the line, such as an IRQ of zero
+}
+
+// header returns the header fields of a datagram. The fields are the same for every datagram
+// of a command, so the fields of a request and its response can be compared one by one.
+func header(d datagram.Datagram) []field {
+	fields := []field{
+		{value: d.Command.String()},
+		{value: fmt.Sprintf("#%d", d.Index)},
+	}
+
+	switch d.Addressing() {
+	case command.AutoIncrement:
+		fields = append(fields,
+			field{key: "pos", value: fmt.Sprintf("%d", d.Position())},
+			field{key: "ado", value: fmt.Sprintf("0x%04x", d.ADO())})
+	case command.Configured:
+		fields = append(fields,
+			field{key: "station", value: fmt.Sprintf("0x%04x", d.Station())},
+			field{key: "ado", value: fmt.Sprintf("0x%04x", d.ADO())})
+	case command.Logical:
+		fields = append(fields, field{key: "logical", value: fmt.Sprintf("0x%08x", d.LogicalAddress())})
+	default:
+		fields = append(fields,
+			field{key: "adp", value: fmt.Sprintf("0x%04x", d.ADP())},
+			field{key: "ado", value: fmt.Sprintf("0x%04x", d.ADO())})
+	}
+
+	return append(fields,
+		field{key: "len", value: fmt.Sprintf("%d", d.LRCM.Len)},
+		field{key: "irq", value: fmt.Sprintf("0x%04x", d.IRQ), quiet: d.IRQ == 0},
+		field{key: "wkc", value: fmt.Sprintf("%d", d.WKC)},
+		field{value: "circulating", quiet: !d.LRCM.C},
+		field{value: "more", quiet: !d.LRCM.M},
+	)
+}
+
+func joinFields(fields []field) string {
+	parts := make([]string, 0, len(fields))
+	for _, f := range fields {
+		if f.quiet {
+			continue
+		}
+		if f.key == "" {
+			parts = append(parts, f.value)
+		} else {
+			parts = append(parts, f.key+"="+f.value)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// hexLine renders up to bytesPerLine bytes of data starting at offset, prefixed with the offset.
+// Bytes for which changed reports true are wrapped in color, if color is not empty.
+func hexLine(data []byte, offset int, changed func(int) bool, color string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%04x ", offset)
+	for i := offset; i < min(offset+bytesPerLine, len(data)); i++ {
+		b.WriteByte(' ')
+		if color != "" && changed(i) {
+			fmt.Fprintf(&b, "%s%02x%s", color, data[i], reset)
+		} else {
+			fmt.Fprintf(&b, "%02x", data[i])
+		}
+	}
+	return b.String()
+}
+
+// caretLine returns a line pointing at the changed bytes of the hexLine at offset,
+// or an empty string if none of its bytes changed.
+func caretLine(data []byte, offset int, changed func(int) bool) string {
+	line := []byte(strings.Repeat(" ", len("0000 ")))
+	marked := false
+	for i := offset; i < min(offset+bytesPerLine, len(data)); i++ {
+		if changed(i) {
+			line = append(line, " ^^"...)
+			marked = true
+		} else {
+			line = append(line, "   "...)
+		}
+	}
+	if !marked {
+		return ""
+	}
+	return strings.TrimRight(string(line), " ")
+}
+
+func change(before string, after string, color bool) string {
+	if color {
+		return red + before + reset + "->" + green + after + reset
+	}
+	return before + "->" + after
+}
+
+func bytesOf(d datagram.Datagram) []byte {
+	if d.Data == nil {
+		return nil
+	}
+	return d.Data.Bytes()
+}
@@ -0,0 +1,144 @@
+package dump_test
+
+import (
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Aruminium/goecat/pkg/dump"
+	"github.com/Aruminium/goecat/pkg/ethercat"
+	"github.com/Aruminium/goecat/pkg/ethercat/datagram"
+	"github.com/Aruminium/goecat/pkg/ethercat/payload"
+	"github.com/Aruminium/goecat/pkg/ethercat/register"
+	"github.com/Aruminium/goecat/pkg/link"
+)
+
+func TestDatagramALControl(t *testing.T) {
+	// given
+	d := datagram.FPWR(0x1001, register.ALControl, payload.BasicPayload{Data: []byte{0x04, 0x00}})
+	d.Index, d.WKC = 3, 1
+
+	// when
+	got := dump.Datagram(d)
+
+	// then
+	expected := "FPWR #3 station=0x1001 ado=0x0120 len=2 wkc=1\n" +
+		"  0000  04 00\n" +
+		"  0x0120 AL Control = SAFE-OP\n"
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected\n%s\nbut got\n%s", expected, got)
+	}
+}
+
+func TestDatagramSyncManager(t *testing.T) {
+	// given
+	sm := []byte{0x00, 0x10, 0x80, 0x00, 0x26, 0x00, 0x01, 0x00}
+	d := datagram.APWR(1, register.SM(0), payload.BasicPayload{Data: sm})
+
+	// when
+	got := dump.Datagram(d)
+
+	// then
+	expected := "APWR #0 pos=1 ado=0x0800 len=8 wkc=0\n" +
+		"  0000  00 10 80 00 26 00 01 00\n" +
+		"  0x0800 SM0 = start 0x1000 len 128 mailbox write, empty, enabled\n"
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected\n%s\nbut got\n%s", expected, got)
+	}
+}
+
+func TestDatagramPartialFMMU(t *testing.T) {
+	// given
+	d := datagram.FPWR(0x1001, register.FMMU(1), payload.BasicPayload{Data: []byte{0x00, 0x00, 0x01, 0x00, 0x02, 0x00}})
+
+	// when
+	got := dump.Datagram(d)
+
+	// then
+	expected := "FPWR #0 station=0x1001 ado=0x0610 len=6 wkc=0\n" +
+		"  0000  00 00 01 00 02 00\n" +
+		"  0x0610 FMMU1 Logical Start = 0x00010000\n" +
+		"  0x0614 FMMU1 Length = 0x0002\n"
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected\n%s\nbut got\n%s", expected, got)
+	}
+}
+
+func TestDatagramLogical(t *testing.T) {
+	// given
+	d := datagram.LRW(0x00010000, payload.BasicPayload{Data: []byte{0x01}})
+	d.LRCM.M = true
+
+	// when
+	got := dump.Datagram(d)
+
+	// then
+	expected := "LRW #0 logical=0x00010000 len=1 wkc=0 more\n" +
+		"  0000  01\n"
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected\n%s\nbut got\n%s", expected, got)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	// given
+	request := datagram.BRD(register.ALStatus, 2)
+	response := request
+	response.Address = datagram.NewConfiguredAddress(3, register.ALStatus)
+	response.Data = payload.BasicPayload{Data: []byte{0x04, 0x00}}
+	response.WKC = 3
+
+	// when
+	got := dump.Diff(request, response, false)
+
+	// then
+	expected := "BRD #0 adp=0x0000->0x0003 ado=0x0130 len=2 wkc=0->3\n" +
+		"- 0000  00 00\n" +
+		"+ 0000  04 00\n" +
+		"        ^^\n" +
+		"  0x0130 AL Status = 0x00->SAFE-OP\n"
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected\n%s\nbut got\n%s", expected, got)
+	}
+}
+
+func TestDiffColor(t *testing.T) {
+	// given
+	request := datagram.BRD(register.ALStatus, 2)
+	response := request
+	response.Data = payload.BasicPayload{Data: []byte{0x04, 0x00}}
+
+	// when
+	got := dump.Diff(request, response, true)
+
+	// then
+	if !strings.Contains(got, "+ 0000  \x1b[32m04\x1b[0m 00\n") {
+		t.Errorf("Expected the changed byte to be highlighted, but got\n%s", got)
+	}
+	if strings.Contains(got, "^^") {
+		t.Errorf("Expected no carets with color, but got\n%s", got)
+	}
+}
+
+func TestEthernet(t *testing.T) {
+	// given
+	ecat := ethercat.NewEtherCAT()
+	ecat.AppendDatagram(datagram.BRD(register.Type, 1))
+	ecat.AppendDatagram(datagram.FPRD(0x1001, register.StationAddress, 2))
+	data, _ := link.Encapsulation{Transport: link.Raw, SrcMAC: net.HardwareAddr{0, 1, 2, 3, 4, 5}}.Encapsulate(ecat.Bytes())
+
+	// when
+	got, err := dump.Ethernet(data)
+
+	// then
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if expected := dump.Frame(ecat); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected\n%s\nbut got\n%s", expected, got)
+	}
+	if !strings.Contains(got, "  0x0010 Station Address = 0x0000\n") {
+		t.Errorf("Expected the station address to be decoded, but got\n%s", got)
+	}
+}
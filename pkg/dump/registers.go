@@ -0,0 +1,285 @@
+package dump
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"github.com/Aruminium/goecat/pkg/ethercat/al"
+	"github.com/Aruminium/goecat/pkg/ethercat/command"
+	"github.com/Aruminium/goecat/pkg/ethercat/datagram"
+	"github.com/Aruminium/goecat/pkg/ethercat/register"
+)
+
+// decoded is a register covered by a datagram together with its rendered value.
+type decoded struct {
+	address uint16
+	name    string
+	value   string
+}
+
+// layout is the size of a register and how its value is rendered.
+// A register without a format is rendered as a little endian hexadecimal number.
+type layout struct {
+	size   int
+	format func(value []byte) string
+}
+
+// layouts holds the registers that are longer than one byte or have a known meaning.
+var layouts = map[uint16]layout{
+	register.Build:       {size: 2},
+	register.ESCFeatures: {size: 2},
+
+	register.StationAddress: {size: 2},
+	register.StationAlias:   {size: 2},
+
+	register.DLControl: {size: 4},
+	register.DLStatus:  {size: 2, format: dlStatus},
+
+	register.ALControl:    {size: 2, format: alState},
+	register.ALStatus:     {size: 2, format: alState},
+	register.ALStatusCode: {size: 2, format: alStatusCode},
+
+	register.ECATEventMask:    {size: 2},
+	register.ECATEventRequest: {size: 2},
+
+	register.RXErrorCounter:          {size: 8, format: rxErrors},
+	register.ForwardedRXErrorCounter: {size: 4, format: perPort},
+	register.LostLinkCounter:         {size: 4, format: perPort},
+
+	register.WatchdogDivider:           {size: 2},
+	register.WatchdogTimePDI:           {size: 2},
+	register.WatchdogTimeProcessData:   {size: 2},
+	register.WatchdogStatusProcessData: {size: 2},
+
+	register.SIIControl: {size: 2},
+	register.SIIAddress: {size: 4},
+	register.SIIData:    {size: 8},
+
+	register.DCReceiveTime0:     {size: 4},
+	register.DCSystemTime:       {size: 8},
+	register.DCSystemTimeOffset: {size: 8},
+	register.DCSystemTimeDelay:  {size: 4},
+	register.DCSystemTimeDiff:   {size: 4},
+	register.DCSync0CycleTime:   {size: 4},
+}
+
+// FMMU and SyncManager channels are decoded as a whole if the datagram covers the channel,
+// and field by field otherwise.
+var (
+	fmmuChannel = layout{size: int(register.FMMULength), format: fmmu}
+	fmmuFields  = map[uint16]layout{
+		0x0: {size: 4},
+		0x4: {size: 2},
+		0x8: {size: 2},
+		0xB: {size: 1, format: fmmuType},
+		0xC: {size: 1, format: activate},
+	}
+	smChannel = layout{size: int(register.SMLength), format: sm}
+	smFields  = map[uint16]layout{
+		0x0: {size: 2},
+		0x2: {size: 2},
+		0x4: {size: 1, format: smControl},
+		0x5: {size: 1, format: smStatus},
+		0x6: {size: 1, format: activate},
+	}
+)
+
+// registers decodes the known registers covered by a datagram that addresses the register area.
+// A register is decoded only if the datagram covers all of its bytes.
+func registers(d datagram.Datagram, data []byte) []decoded {
+	switch d.Addressing() {
+	case command.AutoIncrement, command.Configured, command.Broadcast:
+	default:
+		return nil
+	}
+
+	var result []decoded
+	for offset := 0; offset < len(data); {
+		address := d.ADO() + uint16(offset)
+		if !register.IsRegister(address) {
+			break
+		}
+
+		name, l := lookup(address, len(data)-offset)
+		if name == "" || offset+l.size > len(data) {
+			offset++
+			continue
+		}
+
+		value := data[offset : offset+l.size]
+		result = append(result, decoded{address: address, name: name, value: format(l, value)})
+		offset += l.size
+	}
+	return result
+}
+
+// lookup returns the name and layout of the register starting at address. The first field of
+// an FMMU or SyncManager channel is returned instead of the channel if fewer than its size
+// remain to be decoded.
+func lookup(address uint16, remaining int) (string, layout) {
+	name := register.Name(address)
+
+	var channel layout
+	var fields map[uint16]layout
+	var offset uint16
+	var first string // Name of the field at offset 0
+	switch {
+	case address >= register.FMMU0 && address < register.SM0:
+		channel, fields, first = fmmuChannel, fmmuFields, "Logical Start"
+		offset = (address - register.FMMU0) % register.FMMULength
+	case address >= register.SM0 && address < register.DCReceiveTime0:
+		channel, fields, first = smChannel, smFields, "Start"
+		offset = (address - register.SM0) % register.SMLength
+	default:
+		l, ok := layouts[address]
+		if !ok {
+			l = layout{size: 1}
+		}
+		return name, l
+	}
+
+	if offset == 0 {
+		if remaining >= channel.size {
+			return name, channel
+		}
+		name += " " + first
+	}
+	l, ok := fields[offset]
+	if !ok {
+		l = layout{size: 1}
+	}
+	return name, l
+}
+
+func format(l layout, value []byte) string {
+	if l.format != nil {
+		return l.format(value)
+	}
+	return number(value)
+}
+
+// number renders value as a little endian hexadecimal number.
+func number(value []byte) string {
+	var b strings.Builder
+	b.WriteString("0x")
+	for i := len(value) - 1; i >= 0; i-- {
+		fmt.Fprintf(&b, "%02x", value[i])
+	}
+	return b.String()
+}
+
+func alState(value []byte) string {
+	return al.State(binary.LittleEndian.Uint16(value)).String()
+}
+
+func alStatusCode(value []byte) string {
+	return al.StatusCode(binary.LittleEndian.Uint16(value)).String()
+}
+
+// dlStatus lists the ports with a physical link, the ports with established communication
+// and the closed ports.
+func dlStatus(value []byte) string {
+	status := binary.LittleEndian.Uint16(value)
+
+	var link, comm, closed []string
+	for port := 0; port < 4; port++ {
+		if status&(1<<(4+port)) != 0 {
+			link = append(link, fmt.Sprint(port))
+		}
+		if status&(1<<(8+2*port)) != 0 {
+			closed = append(closed, fmt.Sprint(port))
+		}
+		if status&(1<<(9+2*port)) != 0 {
+			comm = append(comm, fmt.Sprint(port))
+		}
+	}
+
+	return fmt.Sprintf("link=[%s] comm=[%s] closed=[%s]",
+		strings.Join(link, " "), strings.Join(comm, " "), strings.Join(closed, " "))
+}
+
+// rxErrors renders the invalid frame and RX error counters of every port.
+func rxErrors(value []byte) string {
+	ports := make([]string, len(value)/2)
+	for port := range ports {
+		ports[port] = fmt.Sprintf("port%d %d/%d", port, value[2*port], value[2*port+1])
+	}
+	return strings.Join(ports, ", ") + " (invalid frame/RX error)"
+}
+
+// perPort renders one byte counter per port.
+func perPort(value []byte) string {
+	ports := make([]string, len(value))
+	for port := range ports {
+		ports[port] = fmt.Sprintf("port%d %d", port, value[port])
+	}
+	return strings.Join(ports, ", ")
+}
+
+// fmmu renders a whole FMMU channel.
+func fmmu(value []byte) string {
+	return fmt.Sprintf("logical 0x%08x len %d bits %d-%d -> physical 0x%04x.%d %s, %s",
+		binary.LittleEndian.Uint32(value[0:4]),
+		binary.LittleEndian.Uint16(value[4:6]),
+		value[6], value[7],
+		binary.LittleEndian.Uint16(value[8:10]), value[10],
+		fmmuType(value[11:12]), activate(value[12:13]))
+}
+
+func fmmuType(value []byte) string {
+	switch value[0] & 0x03 {
+	case 0x01:
+		return "read"
+	case 0x02:
+		return "write"
+	case 0x03:
+		return "read/write"
+	default:
+		return "unused"
+	}
+}
+
+// sm renders a whole SyncManager channel.
+func sm(value []byte) string {
+	result := fmt.Sprintf("start 0x%04x len %d %s",
+		binary.LittleEndian.Uint16(value[0:2]),
+		binary.LittleEndian.Uint16(value[2:4]),
+		smControl(value[4:5]))
+	if value[4]&0x03 == 0x02 {
+		result += ", " + smStatus(value[5:6])
+	}
+	return result + ", " + activate(value[6:7])
+}
+
+// smControl renders the operation mode and the direction as seen from the EtherCAT side.
+func smControl(value []byte) string {
+	mode := "buffered"
+	if value[0]&0x03 == 0x02 {
+		mode = "mailbox"
+	}
+
+	switch (value[0] >> 2) & 0x03 {
+	case 0x00:
+		return mode + " read"
+	case 0x01:
+		return mode + " write"
+	default:
+		return mode + " " + number(value)
+	}
+}
+
+// smStatus renders the mailbox full flag.
+func smStatus(value []byte) string {
+	if value[0]&0x08 != 0 {
+		return "full"
+	}
+	return "empty"
+}
+
+func activate(value []byte) string {
+	if value[0]&0x01 != 0 {
+		return "enabled"
+	}
+	return "disabled"
+}
@@ -0,0 +1,92 @@
+package esi
+
+import "sort"
+
+// Entry is one subindex of an object, resolved from the object and its data type.
+type Entry struct {
+	Index    uint16
+	SubIndex uint8
+	Name     string
+	BitSize  int
+	Access   string // "ro", "rw" or "wo"; "ro" if the file does not say
+	Default  []byte // Default value, nil if the file has none
+}
+
+// Entries resolves the objects of the dictionary into subindices.
+// A variable has a single entry with subindex 0. The entries of a record or an array follow
+// its data type, with arrays expanded into their elements; default values are taken from
+// the subitems of the object in order.
+//
+// Returns:
+//   - []Entry: Entries sorted by index and subindex
+func (d *Dictionary) Entries() []Entry {
+	types := make(map[string]DataType, len(d.DataTypes))
+	for _, t := range d.DataTypes {
+		types[t.Name] = t
+	}
+
+	var entries []Entry
+	for _, o := range d.Objects {
+		entries = append(entries, o.entries(types)...)
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].Index != entries[j].Index {
+			return entries[i].Index < entries[j].Index
+		}
+		return entries[i].SubIndex < entries[j].SubIndex
+	})
+	return entries
+}
+
+func (o Object) entries(types map[string]DataType) []Entry {
+	t, ok := types[o.Type]
+	if !ok || len(t.SubItems) == 0 {
+		e := Entry{Index: uint16(o.Index), Name: o.Name, BitSize: o.BitSize, Access: access(o.Flags)}
+		if o.Info != nil && o.Info.DefaultData != nil {
+			e.Default = o.Info.DefaultData
+		}
+		return []Entry{e}
+	}
+
+	var entries []Entry
+	for _, sub := range t.SubItems {
+		st, array := types[sub.Type]
+		if sub.SubIdx != nil || !array || st.ArrayInfo == nil {
+			subIndex := uint8(len(entries))
+			if sub.SubIdx != nil {
+				subIndex = uint8(*sub.SubIdx)
+			}
+			entries = append(entries, Entry{Index: uint16(o.Index), SubIndex: subIndex, Name: sub.Name, BitSize: sub.BitSize, Access: access(sub.Flags, o.Flags)})
+			continue
+		}
+
+		// Elements of an array are numbered from its lower bound.
+		size := sub.BitSize
+		if st.ArrayInfo.Elements > 0 {
+			size = sub.BitSize / st.ArrayInfo.Elements
+		}
+		for i := 0; i < st.ArrayInfo.Elements; i++ {
+			entries = append(entries, Entry{Index: uint16(o.Index), SubIndex: uint8(st.ArrayInfo.LBound + i), Name: sub.Name, BitSize: size, Access: access(sub.Flags, o.Flags)})
+		}
+	}
+
+	if o.Info != nil {
+		for i, sub := range o.Info.SubItems {
+			if i < len(entries) && sub.Info.DefaultData != nil {
+				entries[i].Default = sub.Info.DefaultData
+			}
+		}
+	}
+	return entries
+}
+
+// access returns the first access right given, "ro" if none is.
+func access(flags ...Flags) string {
+	for _, f := range flags {
+		if f.Access != "" {
+			return f.Access
+		}
+	}
+	return "ro"
+}
@@ -0,0 +1,200 @@
+// Package esi reads EtherCAT Slave Information (ESI) files, the XML device descriptions
+// vendors ship with their slaves.
+//
+// Only the parts the library uses are modelled: vendor, device identity, SyncManagers, PDOs,
+// mailbox protocols and the CoE object dictionary.
+package esi
+
+import (
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// HexInt is a number written as "#x1A00" (hexadecimal) or "6656" (decimal) in an ESI file.
+type HexInt uint32
+
+// UnmarshalText parses a hexadecimal or decimal number.
+func (h *HexInt) UnmarshalText(text []byte) error {
+	s := strings.TrimSpace(string(text))
+	base := 10
+	if strings.HasPrefix(s, "#x") || strings.HasPrefix(s, "#X") {
+		s, base = s[2:], 16
+	}
+
+	v, err := strconv.ParseUint(s, base, 32)
+	if err != nil {
+		return fmt.Errorf("esi: invalid number %q: %w", string(text), err)
+	}
+	*h = HexInt(v)
+	return nil
+}
+
+// MarshalText writes the number in the "#x" notation.
+func (h HexInt) MarshalText() ([]byte, error) {
+	return []byte(fmt.Sprintf("#x%04x", uint32(h))), nil
+}
+
+// HexBinary is binary data written as hexadecimal digits, in transmission (little endian) order.
+type HexBinary []byte
+
+// UnmarshalText decodes the hexadecimal digits.
+func (b *HexBinary) UnmarshalText(text []byte) error {
+	data, err := hex.DecodeString(strings.TrimSpace(string(text)))
+	if err != nil {
+		return fmt.Errorf("esi: invalid binary %q: %w", string(text), err)
+	}
+	*b = data
+	return nil
+}
+
+// MarshalText encodes the data as hexadecimal digits.
+func (b HexBinary) MarshalText() ([]byte, error) {
+	return []byte(strings.ToUpper(hex.EncodeToString(b))), nil
+}
+
+// EtherCATInfo is the root element of an ESI file.
+type EtherCATInfo struct {
+	XMLName xml.Name `xml:"EtherCATInfo"`
+	Vendor  Vendor   `xml:"Vendor"`
+	Devices []Device `xml:"Descriptions>Devices>Device"`
+}
+
+// Vendor identifies the vendor of the devices.
+type Vendor struct {
+	ID   HexInt `xml:"Id"`
+	Name string `xml:"Name"`
+}
+
+// Device describes one slave type.
+type Device struct {
+	Type       DeviceType  `xml:"Type"`
+	Name       string      `xml:"Name"`
+	GroupType  string      `xml:"GroupType,omitempty"`
+	Fmmus      []string    `xml:"Fmmu"` // "Outputs", "Inputs" or "MBoxState"
+	Sms        []Sm        `xml:"Sm"`
+	RxPdos     []Pdo       `xml:"RxPdo"`
+	TxPdos     []Pdo       `xml:"TxPdo"`
+	Mailbox    *Mailbox    `xml:"Mailbox"`
+	Dictionary *Dictionary `xml:"Profile>Dictionary"`
+}
+
+// DeviceType holds the identity of a device.
+type DeviceType struct {
+	ProductCode HexInt `xml:"ProductCode,attr"`
+	RevisionNo  HexInt `xml:"RevisionNo,attr"`
+	Name        string `xml:",chardata"`
+}
+
+// Sm is the default configuration of a SyncManager.
+type Sm struct {
+	DefaultSize  int    `xml:"DefaultSize,attr,omitempty"`
+	StartAddress HexInt `xml:"StartAddress,attr"`
+	ControlByte  HexInt `xml:"ControlByte,attr"`
+	Enable       int    `xml:"Enable,attr"`
+	Type         string `xml:",chardata"` // "MBoxOut", "MBoxIn", "Outputs" or "Inputs"
+}
+
+// Pdo is an RxPDO or TxPDO with its default mapping.
+type Pdo struct {
+	Fixed   bool       `xml:"Fixed,attr,omitempty"`
+	Sm      *int       `xml:"Sm,attr"` // SyncManager the PDO is assigned to by default, nil if none
+	Index   HexInt     `xml:"Index"`
+	Name    string     `xml:"Name"`
+	Entries []PdoEntry `xml:"Entry"`
+}
+
+// PdoEntry is an object mapped into a PDO. An entry with index 0 is a gap.
+type PdoEntry struct {
+	Index    HexInt `xml:"Index"`
+	SubIndex HexInt `xml:"SubIndex,omitempty"`
+	BitLen   int    `xml:"BitLen"`
+	Name     string `xml:"Name,omitempty"`
+	DataType string `xml:"DataType,omitempty"`
+}
+
+// Mailbox lists the mailbox protocols of a device; a non-nil field means the protocol is supported.
+type Mailbox struct {
+	CoE *struct{} `xml:"CoE"`
+	FoE *struct{} `xml:"FoE"`
+	EoE *struct{} `xml:"EoE"`
+	SoE *struct{} `xml:"SoE"`
+}
+
+// Dictionary is the CoE object dictionary of a device.
+type Dictionary struct {
+	DataTypes []DataType `xml:"DataTypes>DataType"`
+	Objects   []Object   `xml:"Objects>Object"`
+}
+
+// DataType describes a base, array or record data type.
+type DataType struct {
+	Name      string        `xml:"Name"`
+	BitSize   int           `xml:"BitSize"`
+	BaseType  string        `xml:"BaseType"`
+	ArrayInfo *ArrayInfo    `xml:"ArrayInfo"`
+	SubItems  []DataTypeSub `xml:"SubItem"`
+}
+
+// ArrayInfo gives the bounds of an array data type.
+type ArrayInfo struct {
+	LBound   int `xml:"LBound"`
+	Elements int `xml:"Elements"`
+}
+
+// DataTypeSub is a subitem of a record data type.
+type DataTypeSub struct {
+	SubIdx  *HexInt `xml:"SubIdx"` // Missing for a subitem holding the elements of an array
+	Name    string  `xml:"Name"`
+	Type    string  `xml:"Type"`
+	BitSize int     `xml:"BitSize"`
+	BitOffs int     `xml:"BitOffs"`
+	Flags   Flags   `xml:"Flags"`
+}
+
+// Object is an object of the dictionary.
+type Object struct {
+	Index   HexInt      `xml:"Index"`
+	Name    string      `xml:"Name"`
+	Type    string      `xml:"Type"`
+	BitSize int         `xml:"BitSize"`
+	Info    *ObjectInfo `xml:"Info"`
+	Flags   Flags       `xml:"Flags"`
+}
+
+// ObjectInfo holds the default value of an object or of its subitems.
+type ObjectInfo struct {
+	DefaultData HexBinary `xml:"DefaultData"`
+	SubItems    []SubItem `xml:"SubItem"`
+}
+
+// SubItem holds the default value of a subitem, in the order of the subindices.
+type SubItem struct {
+	Name string     `xml:"Name"`
+	Info ObjectInfo `xml:"Info"`
+}
+
+// Flags holds the access rights of an object or subitem.
+type Flags struct {
+	Access     string `xml:"Access"` // "ro", "rw" or "wo"
+	PdoMapping string `xml:"PdoMapping"`
+}
+
+// Decode reads an ESI file.
+//
+// Parameters:
+//   - r (io.Reader): ESI XML document
+//
+// Returns:
+//   - *EtherCATInfo: Decoded document
+//   - error: Error if the document is not a valid ESI file
+func Decode(r io.Reader) (*EtherCATInfo, error) {
+	var info EtherCATInfo
+	if err := xml.NewDecoder(r).Decode(&info); err != nil {
+		return nil, fmt.Errorf("esi: %w", err)
+	}
+	return &info, nil
+}
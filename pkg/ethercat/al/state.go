@@ -0,0 +1,108 @@
+// Package al defines the EtherCAT Application Layer (AL) states and status codes.
+package al
+
+import "fmt"
+
+// State is the AL state of a slave as found in AL Control (0x0120) and AL Status (0x0130).
+type State uint16
+
+const (
+	Init      State = 0x01 // INIT
+	PreOp     State = 0x02 // PRE-OPERATIONAL
+	Bootstrap State = 0x03 // BOOTSTRAP
+	SafeOp    State = 0x04 // SAFE-OPERATIONAL
+	Op        State = 0x08 // OPERATIONAL
+
+	Error State = 0x10 // Error indication (AL Status) or error acknowledge (AL Control)
+	Mask  State = 0x0f // Bits holding the state itself
+)
+
+// String returns the mnemonic of the state, such as "SAFE-OP" or "OP+ERR".
+func (s State) String() string {
+	var name string
+	switch s & Mask {
+	case Init:
+		name = "INIT"
+	case PreOp:
+		name = "PRE-OP"
+	case Bootstrap:
+		name = "BOOT"
+	case SafeOp:
+		name = "SAFE-OP"
+	case Op:
+		name = "OP"
+	default:
+		name = fmt.Sprintf("0x%02x", uint16(s&Mask))
+	}
+
+	if s&Error != 0 {
+		name += "+ERR"
+	}
+	return name
+}
+
+// Base returns the state without the error flag.
+func (s State) Base() State {
+	return s & Mask
+}
+
+// HasError reports whether the error flag is set.
+func (s State) HasError() bool {
+	return s&Error != 0
+}
+
+// StatusCode is the AL status code (0x0134) describing why a state change failed.
+type StatusCode uint16
+
+const (
+	NoError                      StatusCode = 0x0000
+	UnspecifiedError             StatusCode = 0x0001
+	InvalidRequestedStateChange  StatusCode = 0x0011
+	UnknownRequestedState        StatusCode = 0x0012
+	BootstrapNotSupported        StatusCode = 0x0013
+	InvalidMailboxConfiguration  StatusCode = 0x0016
+	InvalidSyncManagerConfig     StatusCode = 0x0017
+	NoValidInputs                StatusCode = 0x0018
+	NoValidOutputs               StatusCode = 0x0019
+	SyncManagerWatchdog          StatusCode = 0x001B
+	InvalidOutputConfiguration   StatusCode = 0x001D
+	InvalidInputConfiguration    StatusCode = 0x001E
+	InvalidWatchdogConfiguration StatusCode = 0x001F
+)
+
+// String returns a description of the status code followed by its value, such as
+// "invalid mailbox configuration (0x0016)".
+func (c StatusCode) String() string {
+	var name string
+	switch c {
+	case NoError:
+		name = "no error"
+	case UnspecifiedError:
+		name = "unspecified error"
+	case InvalidRequestedStateChange:
+		name = "invalid requested state change"
+	case UnknownRequestedState:
+		name = "unknown requested state"
+	case BootstrapNotSupported:
+		name = "bootstrap not supported"
+	case InvalidMailboxConfiguration:
+		name = "invalid mailbox configuration"
+	case InvalidSyncManagerConfig:
+		name = "invalid sync manager configuration"
+	case NoValidInputs:
+		name = "no valid inputs available"
+	case NoValidOutputs:
+		name = "no valid outputs"
+	case SyncManagerWatchdog:
+		name = "sync manager watchdog"
+	case InvalidOutputConfiguration:
+		name = "invalid output configuration"
+	case InvalidInputConfiguration:
+		name = "invalid input configuration"
+	case InvalidWatchdogConfiguration:
+		name = "invalid watchdog configuration"
+	default:
+		return fmt.Sprintf("0x%04x", uint16(c))
+	}
+	return fmt.Sprintf("%s (0x%04x)", name, uint16(c))
+}
@@ -0,0 +1,107 @@
+package coe
+
+import "fmt"
+
+// AbortCode is the reason of an aborted SDO transfer.
+type AbortCode uint32
+
+const (
+	AbortToggleBit           AbortCode = 0x05030000 // Toggle bit not changed
+	AbortTimeout             AbortCode = 0x05040000 // SDO protocol timeout
+	AbortUnknownCommand      AbortCode = 0x05040001 // Client/server command specifier not valid or unknown
+	AbortOutOfMemory         AbortCode = 0x05040005 // Out of memory
+	AbortUnsupportedAccess   AbortCode = 0x06010000 // Unsupported access to an object
+	AbortWriteOnly           AbortCode = 0x06010001 // Attempt to read a write only object
+	AbortReadOnly            AbortCode = 0x06010002 // Attempt to write a read only object
+	AbortSubIndexNotWritable AbortCode = 0x06010003 // Subindex cannot be written, SI0 must be 0 for write access
+	AbortCompleteAccess      AbortCode = 0x06010004 // Complete access not supported for variable length objects
+	AbortObjectTooLong       AbortCode = 0x06010005 // Object length exceeds mailbox size
+	AbortMappedToRxPDO       AbortCode = 0x06010006 // Object mapped to RxPDO, SDO download blocked
+	AbortNoObject            AbortCode = 0x06020000 // Object does not exist in the object dictionary
+	AbortNotMappable         AbortCode = 0x06040041 // Object cannot be mapped into the PDO
+	AbortPDOTooLong          AbortCode = 0x06040042 // Number and length of mapped objects exceed the PDO length
+	AbortParameterIncompat   AbortCode = 0x06040043 // General parameter incompatibility
+	AbortDeviceIncompat      AbortCode = 0x06040047 // General internal incompatibility in the device
+	AbortHardware            AbortCode = 0x06060000 // Access failed due to a hardware error
+	AbortLengthMismatch      AbortCode = 0x06070010 // Data type does not match, length of service parameter does not match
+	AbortLengthTooHigh       AbortCode = 0x06070012 // Data type does not match, length of service parameter too high
+	AbortLengthTooLow        AbortCode = 0x06070013 // Data type does not match, length of service parameter too low
+	AbortNoSubIndex          AbortCode = 0x06090011 // Subindex does not exist
+	AbortValueRange          AbortCode = 0x06090030 // Value range of parameter exceeded
+	AbortValueTooHigh        AbortCode = 0x06090031 // Value of parameter written too high
+	AbortValueTooLow         AbortCode = 0x06090032 // Value of parameter written too low
+	AbortMaxBelowMin         AbortCode = 0x06090036 // Maximum value is less than minimum value
+	AbortGeneral             AbortCode = 0x08000000 // General error
+	AbortTransferStore       AbortCode = 0x08000020 // Data cannot be transferred or stored to the application
+	AbortTransferStoreLocal  AbortCode = 0x08000021 // Data cannot be transferred or stored because of local control
+	AbortTransferStoreState  AbortCode = 0x08000022 // Data cannot be transferred or stored in the present device state
+	AbortNoObjectDictionary  AbortCode = 0x08000023 // Object dictionary dynamic generation fails or no object dictionary is present
+)
+
+// Error returns a description of the abort code.
+func (c AbortCode) Error() string {
+	switch c {
+	case AbortToggleBit:
+		return "coe: toggle bit not changed"
+	case AbortTimeout:
+		return "coe: SDO protocol timeout"
+	case AbortUnknownCommand:
+		return "coe: command specifier not valid or unknown"
+	case AbortOutOfMemory:
+		return "coe: out of memory"
+	case AbortUnsupportedAccess:
+		return "coe: unsupported access to an object"
+	case AbortWriteOnly:
+		return "coe: attempt to read a write only object"
+	case AbortReadOnly:
+		return "coe: attempt to write a read only object"
+	case AbortSubIndexNotWritable:
+		return "coe: subindex cannot be written"
+	case AbortCompleteAccess:
+		return "coe: complete access not supported"
+	case AbortObjectTooLong:
+		return "coe: object length exceeds mailbox size"
+	case AbortMappedToRxPDO:
+		return "coe: object mapped to RxPDO"
+	case AbortNoObject:
+		return "coe: object does not exist"
+	case AbortNotMappable:
+		return "coe: object cannot be mapped into the PDO"
+	case AbortPDOTooLong:
+		return "coe: mapped objects exceed the PDO length"
+	case AbortParameterIncompat:
+		return "coe: general parameter incompatibility"
+	case AbortDeviceIncompat:
+		return "coe: general internal incompatibility in the device"
+	case AbortHardware:
+		return "coe: access failed due to a hardware error"
+	case AbortLengthMismatch:
+		return "coe: length of service parameter does not match"
+	case AbortLengthTooHigh:
+		return "coe: length of service parameter too high"
+	case AbortLengthTooLow:
+		return "coe: length of service parameter too low"
+	case AbortNoSubIndex:
+		return "coe: subindex does not exist"
+	case AbortValueRange:
+		return "coe: value range of parameter exceeded"
+	case AbortValueTooHigh:
+		return "coe: value of parameter written too high"
+	case AbortValueTooLow:
+		return "coe: value of parameter written too low"
+	case AbortMaxBelowMin:
+		return "coe: maximum value is less than minimum value"
+	case AbortGeneral:
+		return "coe: general error"
+	case AbortTransferStore:
+		return "coe: data cannot be transferred or stored"
+	case AbortTransferStoreLocal:
+		return "coe: data cannot be transferred or stored because of local control"
+	case AbortTransferStoreState:
+		return "coe: data cannot be transferred or stored in the present device state"
+	case AbortNoObjectDictionary:
+		return "coe: no object dictionary present"
+	default:
+		return fmt.Sprintf("coe: abort code 0x%08x", uint32(c))
+	}
+}
@@ -0,0 +1,260 @@
+package coe
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"sync"
+
+	"github.com/Aruminium/goecat/pkg/ethercat/mailbox"
+)
+
+// ErrUnexpectedResponse is returned when a slave answers with a message that does not belong to the transfer.
+var ErrUnexpectedResponse = errors.New("coe: unexpected response")
+
+// Client transfers SDOs to and from the object dictionary of one slave.
+// Transfers are serialized, so a Client can be shared.
+type Client struct {
+	// Emergency is called with emergency messages received while waiting for a response.
+	// They are dropped if it is nil.
+	Emergency func(e Emergency)
+
+	conn *mailbox.Conn
+	mu   sync.Mutex
+}
+
+// NewClient creates an SDO client on a mailbox connection.
+//
+// Parameters:
+//   - conn (*mailbox.Conn): Mailbox connection to the slave
+//
+// Returns:
+//   - *Client: New client
+func NewClient(conn *mailbox.Conn) *Client {
+	return &Client{conn: conn}
+}
+
+// Upload reads a subindex of an object.
+//
+// Parameters:
+//   - ctx (context.Context): Context bounding the transfer
+//   - index (uint16): Object index
+//   - subIndex (uint8): Subindex
+//
+// Returns:
+//   - []byte: Value of the subindex
+//   - error: AbortCode if the slave aborted the transfer, or any mailbox error
+func (c *Client) Upload(ctx context.Context, index uint16, subIndex uint8) ([]byte, error) {
+	return c.upload(ctx, index, subIndex, 0)
+}
+
+// UploadComplete reads all subindices of an object with complete access.
+// Subindex 0 is transferred as 16 bits, followed by the other subindices.
+//
+// Parameters:
+//   - ctx (context.Context): Context bounding the transfer
+//   - index (uint16): Object index
+//
+// Returns:
+//   - []byte: Value of the object
+//   - error: AbortCode if the slave aborted the transfer, or any mailbox error
+func (c *Client) UploadComplete(ctx context.Context, index uint16) ([]byte, error) {
+	return c.upload(ctx, index, 0, CompleteAccess)
+}
+
+// Download writes a subindex of an object.
+//
+// Parameters:
+//   - ctx (context.Context): Context bounding the transfer
+//   - index (uint16): Object index
+//   - subIndex (uint8): Subindex
+//   - data ([]byte): Value to write
+//
+// Returns:
+//   - error: AbortCode if the slave aborted the transfer, or any mailbox error
+func (c *Client) Download(ctx context.Context, index uint16, subIndex uint8, data []byte) error {
+	return c.download(ctx, index, subIndex, 0, data)
+}
+
+// DownloadComplete writes all subindices of an object with complete access.
+// Subindex 0 is transferred as 16 bits, followed by the other subindices.
+//
+// Parameters:
+//   - ctx (context.Context): Context bounding the transfer
+//   - index (uint16): Object index
+//   - data ([]byte): Value of the object
+//
+// Returns:
+//   - error: AbortCode if the slave aborted the transfer, or any mailbox error
+func (c *Client) DownloadComplete(ctx context.Context, index uint16, data []byte) error {
+	return c.download(ctx, index, 0, CompleteAccess, data)
+}
+
+func (c *Client) upload(ctx context.Context, index uint16, subIndex uint8, flags uint8) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	body, err := c.request(ctx, SDO{Command: InitiateUploadRequest | flags, Index: index, SubIndex: subIndex}.Bytes(ServiceSDORequest), ServiceSDOResponse)
+	if err != nil {
+		return nil, err
+	}
+	res, err := initiateResponse(body, InitiateUploadResponse, index, subIndex)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.Command&Expedited != 0 {
+		value := make([]byte, 4)
+		binary.LittleEndian.PutUint32(value, res.Value)
+		return value[:res.ExpeditedSize()], nil
+	}
+
+	size := int(res.Value)
+	data := append([]byte{}, res.Data[:min(size, len(res.Data))]...)
+	for toggle := uint8(0); len(data) < size; toggle ^= Toggle {
+		body, err := c.request(ctx, Segment{Command: UploadSegmentRequest | toggle}.Bytes(ServiceSDORequest), ServiceSDOResponse)
+		if err != nil {
+			return nil, err
+		}
+		seg, err := segmentResponse(body, UploadSegmentResponse, toggle)
+		if err != nil {
+			return nil, err
+		}
+
+		data = append(data, seg.Data...)
+		if seg.Command&LastSegment != 0 {
+			break
+		}
+	}
+	if len(data) != size {
+		return nil, AbortLengthMismatch
+	}
+	return data, nil
+}
+
+func (c *Client) download(ctx context.Context, index uint16, subIndex uint8, flags uint8, data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	req := SDO{Command: InitiateDownloadRequest | SizeIndicated | flags, Index: index, SubIndex: subIndex}
+	rest := data
+	// Empty data goes out as a normal transfer of size 0, as the expedited size field cannot express it.
+	if len(data) > 0 && len(data) <= 4 && flags&CompleteAccess == 0 {
+		value := make([]byte, 4)
+		copy(value, data)
+		req.Command |= Expedited | uint8(4-len(data))<<2
+		req.Value = binary.LittleEndian.Uint32(value)
+		rest = nil
+	} else {
+		capacity := int(c.conn.SendSize()) - mailbox.HeaderLength - HeaderLength - SDOLength
+		if capacity <= 0 {
+			return mailbox.ErrTooLarge
+		}
+		req.Value = uint32(len(data))
+		req.Data = data[:min(capacity, len(data))]
+		rest = data[len(req.Data):]
+	}
+
+	body, err := c.request(ctx, req.Bytes(ServiceSDORequest), ServiceSDOResponse)
+	if err != nil {
+		return err
+	}
+	if _, err := initiateResponse(body, InitiateDownloadResponse, index, subIndex); err != nil {
+		return err
+	}
+
+	capacity := int(c.conn.SendSize()) - mailbox.HeaderLength - HeaderLength - SegmentHeaderLength
+	for toggle := uint8(0); len(rest) > 0; toggle ^= Toggle {
+		seg := Segment{Command: DownloadSegmentRequest | toggle, Data: rest[:min(capacity, len(rest))]}
+		rest = rest[len(seg.Data):]
+		if len(rest) == 0 {
+			seg.Command |= LastSegment
+		}
+
+		body, err := c.request(ctx, seg.Bytes(ServiceSDORequest), ServiceSDOResponse)
+		if err != nil {
+			return err
+		}
+		if _, err := segmentResponse(body, DownloadSegmentResponse, toggle); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// request sends a CoE message and returns the body of the next message of the response service.
+// Emergencies that arrive in between are passed to the Emergency callback.
+func (c *Client) request(ctx context.Context, data []byte, response Service) ([]byte, error) {
+	if err := c.conn.Send(ctx, mailbox.New(mailbox.CoE, 0, data)); err != nil {
+		return nil, err
+	}
+	return c.receive(ctx, response)
+}
+
+// receive returns the body of the next CoE message of a service.
+// Emergencies that arrive in between are passed to the Emergency callback.
+func (c *Client) receive(ctx context.Context, service Service) ([]byte, error) {
+	for {
+		m, err := c.conn.Receive(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if err := m.Err(); err != nil {
+			return nil, err
+		}
+		if m.Type != mailbox.CoE {
+			continue
+		}
+
+		h, body, err := Split(m.Data)
+		if err != nil {
+			return nil, err
+		}
+		switch h.Service {
+		case ServiceEmergency:
+			if e, err := ParseEmergency(body); err == nil && c.Emergency != nil {
+				c.Emergency(e)
+			}
+		case service:
+			return body, nil
+		}
+	}
+}
+
+// initiateResponse decodes the response to an initiate request.
+func initiateResponse(body []byte, specifier uint8, index uint16, subIndex uint8) (SDO, error) {
+	res, err := ParseSDO(body)
+	if err != nil {
+		return SDO{}, err
+	}
+	if res.Command&SpecifierMask == AbortTransfer {
+		return SDO{}, AbortCode(res.Value)
+	}
+	if res.Command&SpecifierMask != specifier || res.Index != index || res.SubIndex != subIndex {
+		return SDO{}, ErrUnexpectedResponse
+	}
+	return res, nil
+}
+
+// segmentResponse decodes the response to a segment request.
+func segmentResponse(body []byte, specifier uint8, toggle uint8) (Segment, error) {
+	if len(body) > 0 && body[0]&SpecifierMask == AbortTransfer {
+		abort, err := ParseSDO(body)
+		if err != nil {
+			return Segment{}, err
+		}
+		return Segment{}, AbortCode(abort.Value)
+	}
+
+	seg, err := ParseSegment(body)
+	if err != nil {
+		return Segment{}, err
+	}
+	if seg.Command&SpecifierMask != specifier {
+		return Segment{}, ErrUnexpectedResponse
+	}
+	if seg.Command&Toggle != toggle {
+		return Segment{}, AbortToggleBit
+	}
+	return seg, nil
+}
@@ -0,0 +1,237 @@
+// Package coe implements CANopen over EtherCAT: SDO transfers to and from the object dictionary
+// of a slave, and emergency messages.
+package coe
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+const (
+	// HeaderLength is the length of the CoE header.
+	HeaderLength = 2
+	// SDOLength is the length of an SDO initiate message after the CoE header.
+	SDOLength = 8
+	// SegmentHeaderLength is the length of the command byte of an SDO segment.
+	SegmentHeaderLength = 1
+	// MinSegmentData is the length segment data is padded to.
+	MinSegmentData = 7
+)
+
+// ErrShortMessage is returned when a CoE message is shorter than its header.
+var ErrShortMessage = errors.New("coe: message too short")
+
+// Service is the CoE service in the CoE header.
+type Service uint8
+
+const (
+	ServiceEmergency      Service = 0x01
+	ServiceSDORequest     Service = 0x02
+	ServiceSDOResponse    Service = 0x03
+	ServiceTxPDO          Service = 0x04
+	ServiceRxPDO          Service = 0x05
+	ServiceTxPDORemote    Service = 0x06
+	ServiceRxPDORemote    Service = 0x07
+	ServiceSDOInformation Service = 0x08
+)
+
+// String returns the name of the service.
+func (s Service) String() string {
+	switch s {
+	case ServiceEmergency:
+		return "Emergency"
+	case ServiceSDORequest:
+		return "SDO Request"
+	case ServiceSDOResponse:
+		return "SDO Response"
+	case ServiceTxPDO:
+		return "TxPDO"
+	case ServiceRxPDO:
+		return "RxPDO"
+	case ServiceTxPDORemote:
+		return "TxPDO Remote Request"
+	case ServiceRxPDORemote:
+		return "RxPDO Remote Request"
+	case ServiceSDOInformation:
+		return "SDO Information"
+	default:
+		return fmt.Sprintf("Service(%d)", uint8(s))
+	}
+}
+
+// Header is the CoE header.
+type Header struct {
+	Number  uint16 // PDO number for PDO services, 0 otherwise
+	Service Service
+}
+
+// Bytes returns the encoded header.
+//
+// Returns:
+//   - []byte: Encoded header
+func (h Header) Bytes() []byte {
+	result := make([]byte, HeaderLength)
+	binary.LittleEndian.PutUint16(result, h.Number&0x01ff|uint16(h.Service)<<12)
+	return result
+}
+
+// Split decodes the CoE header of the data of a CoE mailbox.
+//
+// Parameters:
+//   - data ([]byte): Data of a CoE mailbox
+//
+// Returns:
+//   - Header: CoE header
+//   - []byte: Data after the header
+//   - error: ErrShortMessage if data is shorter than the header
+func Split(data []byte) (Header, []byte, error) {
+	if len(data) < HeaderLength {
+		return Header{}, nil, ErrShortMessage
+	}
+
+	v := binary.LittleEndian.Uint16(data)
+	return Header{Number: v & 0x01ff, Service: Service(v >> 12)}, data[HeaderLength:], nil
+}
+
+// SDO command specifiers, bits 5 to 7 of the command byte.
+const (
+	SpecifierMask uint8 = 0xe0
+
+	DownloadSegmentRequest  uint8 = 0x00
+	InitiateDownloadRequest uint8 = 0x20
+	InitiateUploadRequest   uint8 = 0x40
+	UploadSegmentRequest    uint8 = 0x60
+	AbortTransfer           uint8 = 0x80
+
+	UploadSegmentResponse    uint8 = 0x00
+	DownloadSegmentResponse  uint8 = 0x20
+	InitiateUploadResponse   uint8 = 0x40
+	InitiateDownloadResponse uint8 = 0x60
+)
+
+// Flags of the SDO command byte.
+const (
+	SizeIndicated  uint8 = 0x01 // Initiate: Value holds the size
+	Expedited      uint8 = 0x02 // Initiate: Value holds the data
+	CompleteAccess uint8 = 0x10 // Initiate: all subindices of the object are transferred
+	LastSegment    uint8 = 0x01 // Segment: no more segments follow
+	Toggle         uint8 = 0x10 // Segment: alternates with every segment
+)
+
+// SDO is an SDO initiate or abort message.
+type SDO struct {
+	Command  uint8  // Command specifier and flags
+	Index    uint16 // Object index
+	SubIndex uint8  // Subindex, the first subindex for complete access
+	Value    uint32 // Expedited data, size of a normal transfer or abort code
+	Data     []byte // Data of a normal transfer
+}
+
+// ExpeditedSize returns the number of valid bytes in Value of an expedited transfer.
+func (s SDO) ExpeditedSize() int {
+	if s.Command&SizeIndicated == 0 {
+		return 4
+	}
+	return 4 - int(s.Command>>2&0x03)
+}
+
+// Bytes returns the CoE header of service followed by the message.
+//
+// Parameters:
+//   - service (Service): ServiceSDORequest or ServiceSDOResponse
+//
+// Returns:
+//   - []byte: Data of a CoE mailbox
+func (s SDO) Bytes(service Service) []byte {
+	result := Header{Service: service}.Bytes()
+	body := make([]byte, SDOLength)
+	body[0] = s.Command
+	binary.LittleEndian.PutUint16(body[1:3], s.Index)
+	body[3] = s.SubIndex
+	binary.LittleEndian.PutUint32(body[4:8], s.Value)
+	return append(append(result, body...), s.Data...)
+}
+
+// ParseSDO decodes an SDO initiate or abort message.
+//
+// Parameters:
+//   - body ([]byte): Data after the CoE header
+//
+// Returns:
+//   - SDO: Decoded message; Data is a subslice of body
+//   - error: ErrShortMessage if body is too short
+func ParseSDO(body []byte) (SDO, error) {
+	if len(body) < SDOLength {
+		return SDO{}, ErrShortMessage
+	}
+
+	return SDO{
+		Command:  body[0],
+		Index:    binary.LittleEndian.Uint16(body[1:3]),
+		SubIndex: body[3],
+		Value:    binary.LittleEndian.Uint32(body[4:8]),
+		Data:     body[SDOLength:],
+	}, nil
+}
+
+// Segment is an SDO segment message.
+type Segment struct {
+	Command uint8  // Command specifier and flags
+	Data    []byte // Segment data without padding
+}
+
+// Bytes returns the CoE header of service followed by the segment, with data shorter than
+// MinSegmentData padded and the number of padding bytes set in the command.
+//
+// Parameters:
+//   - service (Service): ServiceSDORequest or ServiceSDOResponse
+//
+// Returns:
+//   - []byte: Data of a CoE mailbox
+func (s Segment) Bytes(service Service) []byte {
+	command := s.Command &^ 0x0e
+	data := s.Data
+	if len(data) < MinSegmentData {
+		command |= uint8(MinSegmentData-len(data)) << 1
+		data = append(append([]byte{}, data...), make([]byte, MinSegmentData-len(data))...)
+	}
+	return append(append(Header{Service: service}.Bytes(), command), data...)
+}
+
+// ParseSegment decodes an SDO segment message and strips its padding.
+//
+// Parameters:
+//   - body ([]byte): Data after the CoE header
+//
+// Returns:
+//   - Segment: Decoded segment; Data is a subslice of body
+//   - error: ErrShortMessage if body is too short
+func ParseSegment(body []byte) (Segment, error) {
+	if len(body) < SegmentHeaderLength {
+		return Segment{}, ErrShortMessage
+	}
+
+	data := body[SegmentHeaderLength:]
+	if len(data) <= MinSegmentData {
+		unused := int(body[0] >> 1 & 0x07)
+		if unused > len(data) {
+			return Segment{}, ErrShortMessage
+		}
+		data = data[:len(data)-unused]
+	}
+	return Segment{Command: body[0], Data: data}, nil
+}
+
+// Abort returns the message that aborts a transfer of an object.
+//
+// Parameters:
+//   - index (uint16): Object index
+//   - subIndex (uint8): Subindex
+//   - code (AbortCode): Reason of the abort
+//
+// Returns:
+//   - SDO: Abort message
+func Abort(index uint16, subIndex uint8, code AbortCode) SDO {
+	return SDO{Command: AbortTransfer, Index: index, SubIndex: subIndex, Value: uint32(code)}
+}
@@ -0,0 +1,110 @@
+package coe_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Aruminium/goecat/pkg/ethercat/coe"
+)
+
+func TestSDOBytes(t *testing.T) {
+	// given
+	sdo := coe.SDO{Command: coe.InitiateDownloadRequest | coe.Expedited | coe.SizeIndicated | 2<<2, Index: 0x6040, SubIndex: 0, Value: 0x000f}
+
+	// when
+	data := sdo.Bytes(coe.ServiceSDORequest)
+	h, body, _ := coe.Split(data)
+	parsed, err := coe.ParseSDO(body)
+
+	// then
+	expected := []byte{0x00, 0x20, 0x2b, 0x40, 0x60, 0x00, 0x0f, 0x00, 0x00, 0x00}
+	if !reflect.DeepEqual(data, expected) {
+		t.Errorf("Expected % x, but got % x", expected, data)
+	}
+	if h.Service != coe.ServiceSDORequest {
+		t.Errorf("Expected %v, but got %v", coe.ServiceSDORequest, h.Service)
+	}
+	if err != nil || parsed.ExpeditedSize() != 2 || parsed.Index != 0x6040 {
+		t.Errorf("Expected a 2 byte expedited download of 0x6040, but got %+v (%v)", parsed, err)
+	}
+}
+
+func TestSegmentPadding(t *testing.T) {
+	// given
+	seg := coe.Segment{Command: coe.UploadSegmentResponse | coe.Toggle | coe.LastSegment, Data: []byte{0xaa, 0xbb}}
+
+	// when
+	data := seg.Bytes(coe.ServiceSDOResponse)
+	_, body, _ := coe.Split(data)
+	parsed, err := coe.ParseSegment(body)
+
+	// then
+	if len(body) != coe.SegmentHeaderLength+coe.MinSegmentData || body[0] != 0x1b {
+		t.Errorf("Expected a padded segment with command 0x1b, but got % x", body)
+	}
+	if err != nil || !reflect.DeepEqual(parsed.Data, seg.Data) {
+		t.Errorf("Expected % x, but got % x (%v)", seg.Data, parsed.Data, err)
+	}
+}
+
+func TestEmergency(t *testing.T) {
+	// given
+	e := coe.Emergency{ErrorCode: 0x8130, ErrorRegister: 0x11, Data: [5]byte{1, 2, 3, 4, 5}}
+
+	// when
+	h, body, _ := coe.Split(e.Bytes())
+	parsed, err := coe.ParseEmergency(body)
+
+	// then
+	if h.Service != coe.ServiceEmergency || err != nil || parsed != e {
+		t.Errorf("Expected %v, but got %v (%v)", e, parsed, err)
+	}
+}
+
+func TestDataTypeFormatAndParse(t *testing.T) {
+	// given
+	cases := []struct {
+		t     coe.DataType
+		text  string
+		value []byte
+		shown string
+	}{
+		{coe.Unsigned16, "0x1234", []byte{0x34, 0x12}, "0x1234 4660"},
+		{coe.Integer8, "-2", []byte{0xfe}, "-2"},
+		{coe.Integer24, "-1", []byte{0xff, 0xff, 0xff}, "-1"},
+		{coe.VisibleString, "EL1008", []byte("EL1008"), `"EL1008"`},
+		{coe.Real32, "1.5", []byte{0x00, 0x00, 0xc0, 0x3f}, "1.5"},
+	}
+
+	for _, c := range cases {
+		// when
+		value, err := c.t.Parse(c.text)
+		shown := c.t.Format(c.value)
+
+		// then
+		if err != nil || !reflect.DeepEqual(value, c.value) {
+			t.Errorf("%v: expected % x, but got % x (%v)", c.t, c.value, value, err)
+		}
+		if shown != c.shown {
+			t.Errorf("%v: expected %q, but got %q", c.t, c.shown, shown)
+		}
+	}
+}
+
+func TestParseDataType(t *testing.T) {
+	// when
+	byName, nameErr := coe.ParseDataType("udint")
+	byNumber, numberErr := coe.ParseDataType("0x0006")
+	_, unknownErr := coe.ParseDataType("QUAD")
+
+	// then
+	if nameErr != nil || byName != coe.Unsigned32 {
+		t.Errorf("Expected %v, but got %v (%v)", coe.Unsigned32, byName, nameErr)
+	}
+	if numberErr != nil || byNumber != coe.Unsigned16 {
+		t.Errorf("Expected %v, but got %v (%v)", coe.Unsigned16, byNumber, numberErr)
+	}
+	if unknownErr == nil {
+		t.Errorf("Expected an error for an unknown data type")
+	}
+}
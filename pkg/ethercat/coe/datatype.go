@@ -0,0 +1,210 @@
+package coe
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// DataType is the index of a basic data type in the object dictionary, as used in entry
+// descriptions and in the PDO entries of the SII.
+type DataType uint16
+
+const (
+	Boolean       DataType = 0x0001
+	Integer8      DataType = 0x0002
+	Integer16     DataType = 0x0003
+	Integer32     DataType = 0x0004
+	Unsigned8     DataType = 0x0005
+	Unsigned16    DataType = 0x0006
+	Unsigned32    DataType = 0x0007
+	Real32        DataType = 0x0008
+	VisibleString DataType = 0x0009
+	OctetString   DataType = 0x000A
+	UnicodeString DataType = 0x000B
+	Integer24     DataType = 0x0010
+	Real64        DataType = 0x0011
+	Integer64     DataType = 0x0015
+	Unsigned24    DataType = 0x0016
+	Unsigned64    DataType = 0x001B
+	Bit1          DataType = 0x0030
+	Bit2          DataType = 0x0031
+	Bit3          DataType = 0x0032
+	Bit4          DataType = 0x0033
+	Bit5          DataType = 0x0034
+	Bit6          DataType = 0x0035
+	Bit7          DataType = 0x0036
+	Bit8          DataType = 0x0037
+)
+
+var dataTypeNames = map[DataType]string{
+	Boolean:       "BOOL",
+	Integer8:      "SINT",
+	Integer16:     "INT",
+	Integer32:     "DINT",
+	Unsigned8:     "USINT",
+	Unsigned16:    "UINT",
+	Unsigned32:    "UDINT",
+	Real32:        "REAL",
+	VisibleString: "STRING",
+	OctetString:   "OCTET_STRING",
+	UnicodeString: "UNICODE_STRING",
+	Integer24:     "INT24",
+	Real64:        "LREAL",
+	Integer64:     "LINT",
+	Unsigned24:    "UINT24",
+	Unsigned64:    "ULINT",
+	Bit1:          "BIT1",
+	Bit2:          "BIT2",
+	Bit3:          "BIT3",
+	Bit4:          "BIT4",
+	Bit5:          "BIT5",
+	Bit6:          "BIT6",
+	Bit7:          "BIT7",
+	Bit8:          "BIT8",
+}
+
+// String returns the name of the data type as used in ESI files, such as "UDINT".
+func (t DataType) String() string {
+	if name, ok := dataTypeNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("DT%04X", uint16(t))
+}
+
+// ParseDataType looks up a data type by its ESI name, such as "UDINT", or by a number.
+//
+// Parameters:
+//   - name (string): Name of the data type, case insensitive
+//
+// Returns:
+//   - DataType: Data type
+//   - error: Error if the name is unknown
+func ParseDataType(name string) (DataType, error) {
+	for t, n := range dataTypeNames {
+		if strings.EqualFold(n, name) {
+			return t, nil
+		}
+	}
+	if v, err := strconv.ParseUint(name, 0, 16); err == nil {
+		return DataType(v), nil
+	}
+	return 0, fmt.Errorf("coe: unknown data type %q", name)
+}
+
+// Format renders a value of the data type. Values of other sizes than the type are rendered
+// as hexadecimal bytes.
+//
+// Parameters:
+//   - value ([]byte): Value as transferred by SDO
+//
+// Returns:
+//   - string: Rendered value
+func (t DataType) Format(value []byte) string {
+	switch {
+	case t == VisibleString:
+		return strconv.Quote(string(value))
+	case t == Real32 && len(value) == 4:
+		return strconv.FormatFloat(float64(math.Float32frombits(binary.LittleEndian.Uint32(value))), 'g', -1, 32)
+	case t == Real64 && len(value) == 8:
+		return strconv.FormatFloat(math.Float64frombits(binary.LittleEndian.Uint64(value)), 'g', -1, 64)
+	case t.signed() && len(value) == t.size():
+		return strconv.FormatInt(signExtend(value), 10)
+	case t.unsigned() && len(value) == t.size():
+		v := unsignedValue(value)
+		return fmt.Sprintf("0x%0*x %d", 2*len(value), v, v)
+	default:
+		return hex.EncodeToString(value)
+	}
+}
+
+// Parse encodes text as a value of the data type. Integers accept the prefixes of
+// strconv.ParseInt, octet strings are written as hexadecimal digits.
+//
+// Parameters:
+//   - text (string): Value to encode
+//
+// Returns:
+//   - []byte: Value as transferred by SDO
+//   - error: Error if text is not a valid value of the data type
+func (t DataType) Parse(text string) ([]byte, error) {
+	switch {
+	case t == VisibleString:
+		return []byte(text), nil
+	case t == OctetString:
+		return hex.DecodeString(text)
+	case t == Real32:
+		v, err := strconv.ParseFloat(text, 32)
+		if err != nil {
+			return nil, err
+		}
+		return binary.LittleEndian.AppendUint32(nil, math.Float32bits(float32(v))), nil
+	case t == Real64:
+		v, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return nil, err
+		}
+		return binary.LittleEndian.AppendUint64(nil, math.Float64bits(v)), nil
+	case t.signed():
+		v, err := strconv.ParseInt(text, 0, 8*t.size())
+		if err != nil {
+			return nil, err
+		}
+		return binary.LittleEndian.AppendUint64(nil, uint64(v))[:t.size()], nil
+	case t.unsigned():
+		v, err := strconv.ParseUint(text, 0, 8*t.size())
+		if err != nil {
+			return nil, err
+		}
+		return binary.LittleEndian.AppendUint64(nil, v)[:t.size()], nil
+	default:
+		return nil, fmt.Errorf("coe: cannot parse values of %v", t)
+	}
+}
+
+// size returns the size in bytes of an integer type, 0 for other types.
+func (t DataType) size() int {
+	switch t {
+	case Boolean, Integer8, Unsigned8, Bit1, Bit2, Bit3, Bit4, Bit5, Bit6, Bit7, Bit8:
+		return 1
+	case Integer16, Unsigned16:
+		return 2
+	case Integer24, Unsigned24:
+		return 3
+	case Integer32, Unsigned32:
+		return 4
+	case Integer64, Unsigned64:
+		return 8
+	default:
+		return 0
+	}
+}
+
+func (t DataType) signed() bool {
+	switch t {
+	case Integer8, Integer16, Integer24, Integer32, Integer64:
+		return true
+	default:
+		return false
+	}
+}
+
+func (t DataType) unsigned() bool {
+	return t.size() > 0 && !t.signed()
+}
+
+func unsignedValue(value []byte) uint64 {
+	var v uint64
+	for i := len(value) - 1; i >= 0; i-- {
+		v = v<<8 | uint64(value[i])
+	}
+	return v
+}
+
+func signExtend(value []byte) int64 {
+	shift := 64 - 8*len(value)
+	return int64(unsignedValue(value)<<shift) >> shift
+}
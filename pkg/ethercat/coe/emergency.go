@@ -0,0 +1,54 @@
+package coe
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// EmergencyLength is the length of an emergency message after the CoE header.
+const EmergencyLength = 8
+
+// Emergency is an emergency message a slave sends on its own when an error occurs.
+type Emergency struct {
+	ErrorCode     uint16  // CANopen error code
+	ErrorRegister uint8   // Value of object 0x1001
+	Data          [5]byte // Manufacturer specific error information
+}
+
+// String returns the error code, register and data in hexadecimal.
+func (e Emergency) String() string {
+	return fmt.Sprintf("emergency 0x%04x register 0x%02x data % x", e.ErrorCode, e.ErrorRegister, e.Data[:])
+}
+
+// Bytes returns the CoE header followed by the emergency message.
+//
+// Returns:
+//   - []byte: Data of a CoE mailbox
+func (e Emergency) Bytes() []byte {
+	body := make([]byte, EmergencyLength)
+	binary.LittleEndian.PutUint16(body[0:2], e.ErrorCode)
+	body[2] = e.ErrorRegister
+	copy(body[3:], e.Data[:])
+	return append(Header{Service: ServiceEmergency}.Bytes(), body...)
+}
+
+// ParseEmergency decodes an emergency message.
+//
+// Parameters:
+//   - body ([]byte): Data after the CoE header
+//
+// Returns:
+//   - Emergency: Decoded message
+//   - error: ErrShortMessage if body is too short
+func ParseEmergency(body []byte) (Emergency, error) {
+	if len(body) < EmergencyLength {
+		return Emergency{}, ErrShortMessage
+	}
+
+	e := Emergency{
+		ErrorCode:     binary.LittleEndian.Uint16(body[0:2]),
+		ErrorRegister: body[2],
+	}
+	copy(e.Data[:], body[3:8])
+	return e, nil
+}
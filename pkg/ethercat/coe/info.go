@@ -0,0 +1,324 @@
+package coe
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+)
+
+// InfoHeaderLength is the length of the SDO information header after the CoE header.
+const InfoHeaderLength = 4
+
+// InfoOpCode is the operation of an SDO information message.
+type InfoOpCode uint8
+
+const (
+	GetODListRequest  InfoOpCode = 0x01 // Request the list of object indices
+	GetODListResponse InfoOpCode = 0x02
+	GetODRequest      InfoOpCode = 0x03 // Request the description of an object
+	GetODResponse     InfoOpCode = 0x04
+	GetEDRequest      InfoOpCode = 0x05 // Request the description of an entry
+	GetEDResponse     InfoOpCode = 0x06
+	InfoErrorRequest  InfoOpCode = 0x07 // Sent by the slave with an abort code
+)
+
+// infoIncomplete marks a fragment that is followed by more fragments.
+const infoIncomplete = 0x80
+
+// List types of GetODListRequest.
+const (
+	ListLengths    uint16 = 0x00 // Number of objects of every list type
+	ListAll        uint16 = 0x01 // All objects
+	ListRxPDOMap   uint16 = 0x02 // Objects mappable into an RxPDO
+	ListTxPDOMap   uint16 = 0x03 // Objects mappable into a TxPDO
+	ListBackup     uint16 = 0x04 // Objects to be stored for device replacement
+	ListStartupSet uint16 = 0x05 // Objects used as startup parameters
+)
+
+// Info is an SDO information message, possibly one fragment of a longer response.
+type Info struct {
+	OpCode        InfoOpCode
+	Incomplete    bool   // More fragments follow
+	FragmentsLeft uint16 // Number of fragments that follow
+	Data          []byte
+}
+
+// Bytes encodes the message with its CoE header.
+//
+// Returns:
+//   - []byte: CoE header, SDO information header and data
+func (i Info) Bytes() []byte {
+	result := Header{Service: ServiceSDOInformation}.Bytes()
+	opCode := uint8(i.OpCode)
+	if i.Incomplete {
+		opCode |= infoIncomplete
+	}
+	result = append(result, opCode, 0)
+	result = binary.LittleEndian.AppendUint16(result, i.FragmentsLeft)
+	return append(result, i.Data...)
+}
+
+// ParseInfo decodes an SDO information message after the CoE header.
+//
+// Parameters:
+//   - body ([]byte): Message after the CoE header
+//
+// Returns:
+//   - Info: Decoded message; Data refers to body
+//   - error: Error if body is shorter than the SDO information header
+func ParseInfo(body []byte) (Info, error) {
+	if len(body) < InfoHeaderLength {
+		return Info{}, ErrShortMessage
+	}
+	return Info{
+		OpCode:        InfoOpCode(body[0] &^ infoIncomplete),
+		Incomplete:    body[0]&infoIncomplete != 0,
+		FragmentsLeft: binary.LittleEndian.Uint16(body[2:]),
+		Data:          body[InfoHeaderLength:],
+	}, nil
+}
+
+// ObjectCode is the kind of an object.
+type ObjectCode uint8
+
+const (
+	ObjectVar    ObjectCode = 0x07
+	ObjectArray  ObjectCode = 0x08
+	ObjectRecord ObjectCode = 0x09
+)
+
+// String returns "VAR", "ARRAY" or "RECORD".
+func (o ObjectCode) String() string {
+	switch o {
+	case ObjectVar:
+		return "VAR"
+	case ObjectArray:
+		return "ARRAY"
+	case ObjectRecord:
+		return "RECORD"
+	default:
+		return fmt.Sprintf("ObjectCode(%d)", uint8(o))
+	}
+}
+
+// ObjectDescription is the description of an object returned by GetODResponse.
+type ObjectDescription struct {
+	Index       uint16
+	DataType    DataType
+	MaxSubIndex uint8
+	ObjectCode  ObjectCode
+	Name        string
+}
+
+// Bytes encodes the description as the data of GetODResponse.
+func (o ObjectDescription) Bytes() []byte {
+	result := binary.LittleEndian.AppendUint16(nil, o.Index)
+	result = binary.LittleEndian.AppendUint16(result, uint16(o.DataType))
+	result = append(result, o.MaxSubIndex, uint8(o.ObjectCode))
+	return append(result, o.Name...)
+}
+
+// ParseObjectDescription decodes the data of GetODResponse.
+//
+// Parameters:
+//   - data ([]byte): Data after the SDO information header
+//
+// Returns:
+//   - ObjectDescription: Decoded description
+//   - error: Error if data is too short
+func ParseObjectDescription(data []byte) (ObjectDescription, error) {
+	if len(data) < 6 {
+		return ObjectDescription{}, ErrShortMessage
+	}
+	return ObjectDescription{
+		Index:       binary.LittleEndian.Uint16(data[0:]),
+		DataType:    DataType(binary.LittleEndian.Uint16(data[2:])),
+		MaxSubIndex: data[4],
+		ObjectCode:  ObjectCode(data[5]),
+		Name:        string(data[6:]),
+	}, nil
+}
+
+// ObjectAccess holds the access rights of an entry in every state.
+type ObjectAccess uint16
+
+const (
+	ReadPreOp   ObjectAccess = 0x0001
+	ReadSafeOp  ObjectAccess = 0x0002
+	ReadOp      ObjectAccess = 0x0004
+	WritePreOp  ObjectAccess = 0x0008
+	WriteSafeOp ObjectAccess = 0x0010
+	WriteOp     ObjectAccess = 0x0020
+	RxPDOMap    ObjectAccess = 0x0040 // Mappable into an RxPDO
+	TxPDOMap    ObjectAccess = 0x0080 // Mappable into a TxPDO
+
+	ReadAll  = ReadPreOp | ReadSafeOp | ReadOp
+	WriteAll = WritePreOp | WriteSafeOp | WriteOp
+)
+
+// String returns "rw", "ro", "wo" or "--" from the access rights in PRE-OP.
+func (a ObjectAccess) String() string {
+	switch {
+	case a&ReadPreOp != 0 && a&WritePreOp != 0:
+		return "rw"
+	case a&ReadPreOp != 0:
+		return "ro"
+	case a&WritePreOp != 0:
+		return "wo"
+	default:
+		return "--"
+	}
+}
+
+// EntryDescription is the description of an entry returned by GetEDResponse.
+type EntryDescription struct {
+	Index     uint16
+	SubIndex  uint8
+	ValueInfo uint8 // Always 0: no unit, default, minimum or maximum values are requested
+	DataType  DataType
+	BitLength uint16
+	Access    ObjectAccess
+	Name      string
+}
+
+// Bytes encodes the description as the data of GetEDResponse.
+func (e EntryDescription) Bytes() []byte {
+	result := binary.LittleEndian.AppendUint16(nil, e.Index)
+	result = append(result, e.SubIndex, e.ValueInfo)
+	result = binary.LittleEndian.AppendUint16(result, uint16(e.DataType))
+	result = binary.LittleEndian.AppendUint16(result, e.BitLength)
+	result = binary.LittleEndian.AppendUint16(result, uint16(e.Access))
+	return append(result, e.Name...)
+}
+
+// ParseEntryDescription decodes the data of GetEDResponse requested without value information.
+//
+// Parameters:
+//   - data ([]byte): Data after the SDO information header
+//
+// Returns:
+//   - EntryDescription: Decoded description
+//   - error: Error if data is too short
+func ParseEntryDescription(data []byte) (EntryDescription, error) {
+	if len(data) < 10 {
+		return EntryDescription{}, ErrShortMessage
+	}
+	return EntryDescription{
+		Index:     binary.LittleEndian.Uint16(data[0:]),
+		SubIndex:  data[2],
+		ValueInfo: data[3],
+		DataType:  DataType(binary.LittleEndian.Uint16(data[4:])),
+		BitLength: binary.LittleEndian.Uint16(data[6:]),
+		Access:    ObjectAccess(binary.LittleEndian.Uint16(data[8:])),
+		Name:      string(data[10:]),
+	}, nil
+}
+
+// ObjectList reads the indices of the objects of a list type with the SDO information service.
+//
+// Parameters:
+//   - ctx (context.Context): Context bounding the transfer
+//   - listType (uint16): ListAll or another list type
+//
+// Returns:
+//   - []uint16: Object indices
+//   - error: AbortCode if the slave reported an error, or any mailbox error
+func (c *Client) ObjectList(ctx context.Context, listType uint16) ([]uint16, error) {
+	data, err := c.info(ctx, Info{OpCode: GetODListRequest, Data: binary.LittleEndian.AppendUint16(nil, listType)}, GetODListResponse)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 2 || binary.LittleEndian.Uint16(data) != listType {
+		return nil, ErrUnexpectedResponse
+	}
+
+	data = data[2:]
+	indices := make([]uint16, 0, len(data)/2)
+	for ; len(data) >= 2; data = data[2:] {
+		indices = append(indices, binary.LittleEndian.Uint16(data))
+	}
+	return indices, nil
+}
+
+// ObjectDescription reads the description of an object with the SDO information service.
+//
+// Parameters:
+//   - ctx (context.Context): Context bounding the transfer
+//   - index (uint16): Object index
+//
+// Returns:
+//   - ObjectDescription: Description of the object
+//   - error: AbortCode if the slave reported an error, or any mailbox error
+func (c *Client) ObjectDescription(ctx context.Context, index uint16) (ObjectDescription, error) {
+	data, err := c.info(ctx, Info{OpCode: GetODRequest, Data: binary.LittleEndian.AppendUint16(nil, index)}, GetODResponse)
+	if err != nil {
+		return ObjectDescription{}, err
+	}
+	o, err := ParseObjectDescription(data)
+	if err != nil {
+		return ObjectDescription{}, err
+	}
+	if o.Index != index {
+		return ObjectDescription{}, ErrUnexpectedResponse
+	}
+	return o, nil
+}
+
+// EntryDescription reads the description of an entry with the SDO information service.
+//
+// Parameters:
+//   - ctx (context.Context): Context bounding the transfer
+//   - index (uint16): Object index
+//   - subIndex (uint8): Subindex
+//
+// Returns:
+//   - EntryDescription: Description of the entry
+//   - error: AbortCode if the slave reported an error, or any mailbox error
+func (c *Client) EntryDescription(ctx context.Context, index uint16, subIndex uint8) (EntryDescription, error) {
+	req := append(binary.LittleEndian.AppendUint16(nil, index), subIndex, 0)
+	data, err := c.info(ctx, Info{OpCode: GetEDRequest, Data: req}, GetEDResponse)
+	if err != nil {
+		return EntryDescription{}, err
+	}
+	e, err := ParseEntryDescription(data)
+	if err != nil {
+		return EntryDescription{}, err
+	}
+	if e.Index != index || e.SubIndex != subIndex {
+		return EntryDescription{}, ErrUnexpectedResponse
+	}
+	return e, nil
+}
+
+// info sends an SDO information request and returns the data of all fragments of the response.
+func (c *Client) info(ctx context.Context, req Info, response InfoOpCode) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	body, err := c.request(ctx, req.Bytes(), ServiceSDOInformation)
+	if err != nil {
+		return nil, err
+	}
+
+	var data []byte
+	for {
+		res, err := ParseInfo(body)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case res.OpCode == InfoErrorRequest && len(res.Data) >= 4:
+			return nil, AbortCode(binary.LittleEndian.Uint32(res.Data))
+		case res.OpCode != response:
+			return nil, ErrUnexpectedResponse
+		}
+
+		data = append(data, res.Data...)
+		if !res.Incomplete {
+			return data, nil
+		}
+		if body, err = c.receive(ctx, ServiceSDOInformation); err != nil {
+			return nil, err
+		}
+	}
+}
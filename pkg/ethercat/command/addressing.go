@@ -0,0 +1,53 @@
+package command
+
+// Addressing represents how the Address field of a datagram is interpreted.
+type Addressing uint8
+
+const (
+	NoAddressing  Addressing = iota // NOP: the address is ignored
+	AutoIncrement                   // APxx/ARMW: ADP is a position, ADO is a register offset
+	Configured                      // FPxx/FRMW: ADP is a configured station address, ADO is a register offset
+	Broadcast                       // Bxx: ADP is incremented by every slave, ADO is a register offset
+	Logical                         // Lxx: the whole field is a 32-bit logical address
+)
+
+// Addressing returns the addressing mode used by the command.
+//
+// Returns:
+//   - Addressing: Addressing mode of the command
+func (t Type) Addressing() Addressing {
+	switch t {
+	case APRD, APWR, APRW, ARMW:
+		return AutoIncrement
+	case FPRD, FPWR, FPRW, FRMW:
+		return Configured
+	case BRD, BWR, BRW:
+		return Broadcast
+	case LRD, LWR, LRW:
+		return Logical
+	default:
+		return NoAddressing
+	}
+}
+
+// IsRead reports whether the command reads data from the slaves.
+// ARMW and FRMW are reported as both read and write commands.
+func (t Type) IsRead() bool {
+	switch t {
+	case APRD, APRW, FPRD, FPRW, BRD, BRW, LRD, LRW, ARMW, FRMW:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsWrite reports whether the command writes data to the slaves.
+// ARMW and FRMW are reported as both read and write commands.
+func (t Type) IsWrite() bool {
+	switch t {
+	case APWR, APRW, FPWR, FPRW, BWR, BRW, LWR, LRW, ARMW, FRMW:
+		return true
+	default:
+		return false
+	}
+}
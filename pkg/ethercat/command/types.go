@@ -1,5 +1,7 @@
 package command
 
+import "fmt"
+
 // EcatCommand represents EtherCAT command types for Read/Write operations.
 //
 // For ReadWrite operations, the Read operation is performed before the Write operation.
@@ -22,3 +24,42 @@ const (
 	ARMW Type = 13 // Auto Increment Read Multiple Write
 	FRMW Type = 14 // Configured Read Multiple Write
 )
+
+// String returns the mnemonic of the command, such as "FPWR".
+// Unknown commands are rendered as their numeric value.
+func (t Type) String() string {
+	switch t {
+	case NOP:
+		return "NOP"
+	case APRD:
+		return "APRD"
+	case APWR:
+		return "APWR"
+	case APRW:
+		return "APRW"
+	case FPRD:
+		return "FPRD"
+	case FPWR:
+		return "FPWR"
+	case FPRW:
+		return "FPRW"
+	case BRD:
+		return "BRD"
+	case BWR:
+		return "BWR"
+	case BRW:
+		return "BRW"
+	case LRD:
+		return "LRD"
+	case LWR:
+		return "LWR"
+	case LRW:
+		return "LRW"
+	case ARMW:
+		return "ARMW"
+	case FRMW:
+		return "FRMW"
+	default:
+		return fmt.Sprintf("CMD(0x%02x)", uint8(t))
+	}
+}
@@ -0,0 +1,90 @@
+package datagram
+
+import (
+	"math/bits"
+
+	"github.com/Aruminium/goecat/pkg/ethercat/command"
+)
+
+// The Address field is stored with ADP in the upper 16 bits and ADO in the lower 16 bits,
+// which is the order both words appear on the wire. A 32-bit logical address is sent as a
+// single little endian word instead, so its halves are swapped when stored in Address.
+
+// NewAutoIncrementAddress creates an Address for APxx/ARMW commands.
+//
+// The master addresses the n-th slave with ADP = -n, because every slave increments ADP
+// and the slave that receives zero is the addressed one.
+//
+// Parameters:
+//   - position (uint16): Position of the slave in the segment (0 is the first slave)
+//   - offset (uint16): Register offset (ADO)
+//
+// Returns:
+//   - uint32: Address value for the datagram
+func NewAutoIncrementAddress(position uint16, offset uint16) uint32 {
+	return uint32(-position)<<16 | uint32(offset)
+}
+
+// NewConfiguredAddress creates an Address for FPxx/FRMW commands.
+//
+// Parameters:
+//   - station (uint16): Configured station address (ADP)
+//   - offset (uint16): Register offset (ADO)
+//
+// Returns:
+//   - uint32: Address value for the datagram
+func NewConfiguredAddress(station uint16, offset uint16) uint32 {
+	return uint32(station)<<16 | uint32(offset)
+}
+
+// NewBroadcastAddress creates an Address for Bxx commands.
+//
+// Parameters:
+//   - offset (uint16): Register offset (ADO)
+//
+// Returns:
+//   - uint32: Address value for the datagram
+func NewBroadcastAddress(offset uint16) uint32 {
+	return uint32(offset)
+}
+
+// NewLogicalAddress creates an Address for Lxx commands.
+//
+// Parameters:
+//   - logical (uint32): 32-bit logical address
+//
+// Returns:
+//   - uint32: Address value for the datagram
+func NewLogicalAddress(logical uint32) uint32 {
+	return bits.RotateLeft32(logical, 16)
+}
+
+// ADP returns the address position/station word of the datagram.
+func (e Datagram) ADP() uint16 {
+	return uint16(e.Address >> 16)
+}
+
+// ADO returns the register offset word of the datagram.
+func (e Datagram) ADO() uint16 {
+	return uint16(e.Address)
+}
+
+// Position returns the slave position addressed by an auto increment datagram.
+func (e Datagram) Position() uint16 {
+	return -e.ADP()
+}
+
+// Station returns the configured station address addressed by an FPxx/FRMW datagram.
+func (e Datagram) Station() uint16 {
+	return e.ADP()
+}
+
+// LogicalAddress returns the 32-bit logical address of an Lxx datagram.
+func (e Datagram) LogicalAddress() uint32 {
+	return bits.RotateLeft32(e.Address, 16)
+}
+
+// Addressing returns the addressing mode of the datagram derived from its command.
+func (e Datagram) Addressing() command.Addressing {
+	return e.Command.Addressing()
+}
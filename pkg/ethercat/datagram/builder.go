@@ -0,0 +1,206 @@
+package datagram
+
+import (
+	"github.com/Aruminium/goecat/pkg/ethercat/command"
+	"github.com/Aruminium/goecat/pkg/ethercat/payload"
+)
+
+// newDatagram creates a datagram whose LRCM length is taken from data.
+// Index, IRQ and WKC are zero and M is cleared; EtherCAT.AppendDatagram sets M when more datagrams follow.
+func newDatagram(cmd command.Type, address uint32, data payload.MarshalerByte) Datagram {
+	return Datagram{
+		Command: cmd,
+		Address: address,
+		LRCM:    NewLrcm(false, false, uint16(len(data.Bytes()))),
+		Data:    data,
+	}
+}
+
+// readBuffer returns a zero-filled payload that the slaves fill in.
+func readBuffer(length uint16) payload.BasicPayload {
+	return payload.BasicPayload{Data: make([]byte, length)}
+}
+
+// NOP creates a No Operation datagram carrying length bytes that are ignored by the slaves.
+func NOP(length uint16) Datagram {
+	return newDatagram(command.NOP, 0, readBuffer(length))
+}
+
+// APRD creates an Auto Increment Read datagram.
+//
+// Parameters:
+//   - position (uint16): Position of the slave in the segment
+//   - register (uint16): Register offset to read from
+//   - length (uint16): Number of bytes to read
+//
+// Returns:
+//   - Datagram: APRD datagram with a zero-filled read buffer
+func APRD(position uint16, register uint16, length uint16) Datagram {
+	return newDatagram(command.APRD, NewAutoIncrementAddress(position, register), readBuffer(length))
+}
+
+// APWR creates an Auto Increment Write datagram.
+//
+// Parameters:
+//   - position (uint16): Position of the slave in the segment
+//   - register (uint16): Register offset to write to
+//   - data (payload.MarshalerByte): Data to write
+//
+// Returns:
+//   - Datagram: APWR datagram
+func APWR(position uint16, register uint16, data payload.MarshalerByte) Datagram {
+	return newDatagram(command.APWR, NewAutoIncrementAddress(position, register), data)
+}
+
+// APRW creates an Auto Increment Read Write datagram.
+//
+// Parameters:
+//   - position (uint16): Position of the slave in the segment
+//   - register (uint16): Register offset to exchange
+//   - data (payload.MarshalerByte): Data to write, replaced by the read data in the response
+//
+// Returns:
+//   - Datagram: APRW datagram
+func APRW(position uint16, register uint16, data payload.MarshalerByte) Datagram {
+	return newDatagram(command.APRW, NewAutoIncrementAddress(position, register), data)
+}
+
+// FPRD creates a Configured Address Read datagram.
+//
+// Parameters:
+//   - station (uint16): Configured station address of the slave
+//   - register (uint16): Register offset to read from
+//   - length (uint16): Number of bytes to read
+//
+// Returns:
+//   - Datagram: FPRD datagram with a zero-filled read buffer
+func FPRD(station uint16, register uint16, length uint16) Datagram {
+	return newDatagram(command.FPRD, NewConfiguredAddress(station, register), readBuffer(length))
+}
+
+// FPWR creates a Configured Address Write datagram.
+//
+// Parameters:
+//   - station (uint16): Configured station address of the slave
+//   - register (uint16): Register offset to write to
+//   - data (payload.MarshalerByte): Data to write
+//
+// Returns:
+//   - Datagram: FPWR datagram
+func FPWR(station uint16, register uint16, data payload.MarshalerByte) Datagram {
+	return newDatagram(command.FPWR, NewConfiguredAddress(station, register), data)
+}
+
+// FPRW creates a Configured Address Read Write datagram.
+//
+// Parameters:
+//   - station (uint16): Configured station address of the slave
+//   - register (uint16): Register offset to exchange
+//   - data (payload.MarshalerByte): Data to write, replaced by the read data in the response
+//
+// Returns:
+//   - Datagram: FPRW datagram
+func FPRW(station uint16, register uint16, data payload.MarshalerByte) Datagram {
+	return newDatagram(command.FPRW, NewConfiguredAddress(station, register), data)
+}
+
+// BRD creates a Broadcast Read datagram.
+// The data of all slaves is combined with a logical OR.
+//
+// Parameters:
+//   - register (uint16): Register offset to read from
+//   - length (uint16): Number of bytes to read
+//
+// Returns:
+//   - Datagram: BRD datagram with a zero-filled read buffer
+func BRD(register uint16, length uint16) Datagram {
+	return newDatagram(command.BRD, NewBroadcastAddress(register), readBuffer(length))
+}
+
+// BWR creates a Broadcast Write datagram.
+//
+// Parameters:
+//   - register (uint16): Register offset to write to
+//   - data (payload.MarshalerByte): Data to write to every slave
+//
+// Returns:
+//   - Datagram: BWR datagram
+func BWR(register uint16, data payload.MarshalerByte) Datagram {
+	return newDatagram(command.BWR, NewBroadcastAddress(register), data)
+}
+
+// BRW creates a Broadcast Read Write datagram.
+//
+// Parameters:
+//   - register (uint16): Register offset to exchange
+//   - data (payload.MarshalerByte): Data to write to every slave
+//
+// Returns:
+//   - Datagram: BRW datagram
+func BRW(register uint16, data payload.MarshalerByte) Datagram {
+	return newDatagram(command.BRW, NewBroadcastAddress(register), data)
+}
+
+// LRD creates a Logical Memory Read datagram.
+//
+// Parameters:
+//   - logical (uint32): Logical address to read from
+//   - length (uint16): Number of bytes to read
+//
+// Returns:
+//   - Datagram: LRD datagram with a zero-filled read buffer
+func LRD(logical uint32, length uint16) Datagram {
+	return newDatagram(command.LRD, NewLogicalAddress(logical), readBuffer(length))
+}
+
+// LWR creates a Logical Memory Write datagram.
+//
+// Parameters:
+//   - logical (uint32): Logical address to write to
+//   - data (payload.MarshalerByte): Data to write
+//
+// Returns:
+//   - Datagram: LWR datagram
+func LWR(logical uint32, data payload.MarshalerByte) Datagram {
+	return newDatagram(command.LWR, NewLogicalAddress(logical), data)
+}
+
+// LRW creates a Logical Memory Read Write datagram.
+//
+// Parameters:
+//   - logical (uint32): Logical address to exchange
+//   - data (payload.MarshalerByte): Data to write, replaced by the read data in the response
+//
+// Returns:
+//   - Datagram: LRW datagram
+func LRW(logical uint32, data payload.MarshalerByte) Datagram {
+	return newDatagram(command.LRW, NewLogicalAddress(logical), data)
+}
+
+// ARMW creates an Auto Increment Read Multiple Write datagram.
+// The addressed slave is read and the data is written to all following slaves.
+//
+// Parameters:
+//   - position (uint16): Position of the slave to read from
+//   - register (uint16): Register offset to read from and write to
+//   - length (uint16): Number of bytes to transfer
+//
+// Returns:
+//   - Datagram: ARMW datagram with a zero-filled buffer
+func ARMW(position uint16, register uint16, length uint16) Datagram {
+	return newDatagram(command.ARMW, NewAutoIncrementAddress(position, register), readBuffer(length))
+}
+
+// FRMW creates a Configured Read Multiple Write datagram.
+// The addressed slave is read and the data is written to all other slaves.
+//
+// Parameters:
+//   - station (uint16): Configured station address of the slave to read from
+//   - register (uint16): Register offset to read from and write to
+//   - length (uint16): Number of bytes to transfer
+//
+// Returns:
+//   - Datagram: FRMW datagram with a zero-filled buffer
+func FRMW(station uint16, register uint16, length uint16) Datagram {
+	return newDatagram(command.FRMW, NewConfiguredAddress(station, register), readBuffer(length))
+}
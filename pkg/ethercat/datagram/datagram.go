@@ -28,32 +28,33 @@ type Datagram struct {
 // Returns:
 //   - []byte: The byte representation of the EtherCAT datagram.
 func (e Datagram) Bytes() []byte {
-	result := make([]byte, 0)
-
-	result = append(result, uint8(e.Command))
-
-	result = append(result, e.Index)
+	return e.AppendTo(make([]byte, 0, e.Len()))
+}
 
-	addressBytes := make([]byte, 4)
+// AppendTo appends the byte representation of the EtherCAT datagram to dst.
+// It does not allocate when dst has enough capacity and Data implements payload.Appender.
+//
+// Parameters:
+//   - dst ([]byte): Buffer to append to
+//
+// Returns:
+//   - []byte: The extended buffer
+func (e Datagram) AppendTo(dst []byte) []byte {
+	dst = append(dst, uint8(e.Command), e.Index)
 	// Upper 16 bits is LittleEndian
-	binary.LittleEndian.PutUint16(addressBytes, uint16(e.Address>>16))
+	dst = binary.LittleEndian.AppendUint16(dst, uint16(e.Address>>16))
 	// Lower 16bit is LittleEndian
-	binary.LittleEndian.PutUint16(addressBytes[2:], uint16(e.Address))
-	result = append(result, addressBytes...)
-
-	lrcmBytes := make([]byte, 2)
-	binary.LittleEndian.PutUint16(lrcmBytes, e.LRCM.Uint16())
-	result = append(result, lrcmBytes...)
-
-	irqBytes := make([]byte, 2)
-	binary.BigEndian.PutUint16(irqBytes, e.IRQ)
-	result = append(result, irqBytes...)
-
-	result = append(result, e.Data.Bytes()...)
-
-	wkcBytes := make([]byte, 2)
-	binary.LittleEndian.PutUint16(wkcBytes, e.WKC)
-	result = append(result, wkcBytes...)
+	dst = binary.LittleEndian.AppendUint16(dst, uint16(e.Address))
+	dst = binary.LittleEndian.AppendUint16(dst, e.LRCM.Uint16())
+	dst = binary.BigEndian.AppendUint16(dst, e.IRQ)
+	dst = payload.Append(dst, e.Data)
+	return binary.LittleEndian.AppendUint16(dst, e.WKC)
+}
 
-	return result
+// Len returns the length of the byte representation of the EtherCAT datagram.
+//
+// Returns:
+//   - int: Overhead plus the length of Data
+func (e Datagram) Len() int {
+	return Overhead + payload.Len(e.Data)
 }
@@ -1,6 +1,7 @@
 package datagram_test
 
 import (
+	"errors"
 	"reflect"
 	"testing"
 
@@ -50,3 +51,111 @@ func Test2EcatDatagramBytes(t *testing.T) {
 		t.Errorf("Expected Bytes: %v, Got: %v", expectedBytes, resultBytes)
 	}
 }
+
+func TestParseDatagram(t *testing.T) {
+	// given
+	data := []byte{0x02, 0x5f, 0xff, 0xff, 0x00, 0x08, 0x08, 0xc0, 0x00, 0x00, 0x00, 0x18, 0x30, 0x00, 0x26, 0x00,
+		0x01, 0x00, 0x03, 0x00, 0xaa}
+
+	expected := datagram.Datagram{
+		Command: command.APWR,
+		Index:   uint8(0x5f),
+		Address: uint32(0xffff0800),
+		LRCM:    datagram.NewLrcm(true, true, 8),
+		IRQ:     uint16(0x0000),
+		Data:    payload.BasicPayload{Data: []byte{0x00, 0x18, 0x30, 0x00, 0x26, 0x00, 0x01, 0x00}},
+		WKC:     uint16(0x0003),
+	}
+
+	// when
+	result, n, err := datagram.Parse(data)
+
+	// then
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if n != 20 {
+		t.Errorf("Expected consumed bytes: %d, Got: %d", 20, n)
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected Datagram: %+v, Got: %+v", expected, result)
+	}
+	if !reflect.DeepEqual(result.Bytes(), data[:n]) {
+		t.Errorf("Expected Bytes: %v, Got: %v", data[:n], result.Bytes())
+	}
+}
+
+func TestParseShortDatagram(t *testing.T) {
+	// given
+	data := []byte{0x07, 0x00, 0x00, 0x00, 0x00, 0x00, 0x04, 0x00, 0x00, 0x00, 0x00, 0x00}
+
+	// when
+	_, _, err := datagram.Parse(data)
+
+	// then
+	if !errors.Is(err, datagram.ErrShortDatagram) {
+		t.Errorf("Expected error: %v, Got: %v", datagram.ErrShortDatagram, err)
+	}
+}
+
+func TestValidateLengthMismatch(t *testing.T) {
+	// given
+	d := datagram.Datagram{
+		Command: command.BRD,
+		LRCM:    datagram.NewLrcm(false, false, 2),
+		Data:    payload.BasicPayload{Data: []byte{0x00}},
+	}
+
+	// when
+	err := d.Validate()
+
+	// then
+	if !errors.Is(err, datagram.ErrLengthMismatch) {
+		t.Errorf("Expected error: %v, Got: %v", datagram.ErrLengthMismatch, err)
+	}
+}
+
+func TestAddressing(t *testing.T) {
+	// given
+	autoInc := datagram.Datagram{Command: command.APRD, Address: datagram.NewAutoIncrementAddress(1, 0x0008)}
+	configured := datagram.Datagram{Command: command.FPWR, Address: datagram.NewConfiguredAddress(0x1001, 0x0120)}
+	logical := datagram.Datagram{Command: command.LRW, Address: datagram.NewLogicalAddress(0x00010000),
+		LRCM: datagram.NewLrcm(false, false, 0), Data: payload.BasicPayload{Data: []byte{}}}
+
+	// then
+	if autoInc.Address != 0xffff0008 || autoInc.Position() != 1 || autoInc.ADO() != 0x0008 {
+		t.Errorf("Unexpected auto increment address: %#08x", autoInc.Address)
+	}
+	if configured.Station() != 0x1001 || configured.ADO() != 0x0120 {
+		t.Errorf("Unexpected configured address: %#08x", configured.Address)
+	}
+	if logical.Addressing() != command.Logical || logical.LogicalAddress() != 0x00010000 {
+		t.Errorf("Unexpected logical address: %#08x", logical.LogicalAddress())
+	}
+
+	expectedAddressBytes := []byte{0x00, 0x00, 0x01, 0x00} // little endian 0x00010000
+	if result := logical.Bytes()[2:6]; !reflect.DeepEqual(result, expectedAddressBytes) {
+		t.Errorf("Expected address bytes: %v, Got: %v", expectedAddressBytes, result)
+	}
+}
+
+func TestBuilderFillsLength(t *testing.T) {
+	// given
+	d := datagram.FPWR(0x1001, 0x0120, payload.BasicPayload{Data: []byte{0x02, 0x00}})
+
+	expectedBytes := []byte{0x05, 0x00, 0x01, 0x10, 0x20, 0x01, 0x02, 0x00, 0x00, 0x00, 0x02, 0x00, 0x00, 0x00}
+
+	// when
+	resultBytes := d.Bytes()
+
+	// then
+	if err := d.Validate(); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(resultBytes, expectedBytes) {
+		t.Errorf("Expected Bytes: %v, Got: %v", expectedBytes, resultBytes)
+	}
+	if read := datagram.APRD(2, 0x0130, 2); read.LRCM.Len != 2 || read.Position() != 2 {
+		t.Errorf("Unexpected APRD datagram: %+v", read)
+	}
+}
@@ -56,10 +56,10 @@ func (Lrcm Lrcm) Uint16() uint16 {
 
 	cBits := uint16(0)
 	if Lrcm.C {
-		mBits = 0b0100000000000000
+		cBits = 0b0100000000000000
 	}
 
-	rBits := Lrcm.R << 11
+	rBits := (Lrcm.R << 11) & 0b0011100000000000
 
-	return mBits | cBits | rBits | Lrcm.Len
+	return mBits | cBits | rBits | (Lrcm.Len & 0b0000011111111111)
 }
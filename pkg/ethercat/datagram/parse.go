@@ -0,0 +1,79 @@
+package datagram
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/Aruminium/goecat/pkg/ethercat/command"
+	"github.com/Aruminium/goecat/pkg/ethercat/payload"
+)
+
+const (
+	HeaderLength = 10 // Command, Index, Address, LRCM and IRQ
+	WKCLength    = 2  // Working Counter
+	Overhead     = HeaderLength + WKCLength
+	MaxDataLen   = 0x07ff // Largest value of the 11-bit Len field
+)
+
+var (
+	ErrShortDatagram  = errors.New("datagram is shorter than its header and length")
+	ErrLengthMismatch = errors.New("LRCM.Len does not match the length of Data")
+	ErrNoData         = errors.New("datagram has no Data")
+)
+
+// Parse reads one EtherCAT datagram from the beginning of data.
+// The data of the returned datagram is copied, so data may be reused by the caller.
+//
+// Parameters:
+//   - data ([]byte): Bytes starting with an EtherCAT datagram
+//
+// Returns:
+//   - Datagram: Parsed EtherCAT datagram
+//   - int: Number of bytes consumed from data
+//   - error: Error if data is too short for the header or the length in LRCM
+func Parse(data []byte) (Datagram, int, error) {
+	if len(data) < Overhead {
+		return Datagram{}, 0, fmt.Errorf("%w: got %d bytes, need at least %d", ErrShortDatagram, len(data), Overhead)
+	}
+
+	lrcm := NEWLrcmFromUint16(binary.LittleEndian.Uint16(data[6:8]))
+	size := Overhead + int(lrcm.Len)
+	if len(data) < size {
+		return Datagram{}, 0, fmt.Errorf("%w: got %d bytes, need %d", ErrShortDatagram, len(data), size)
+	}
+
+	body := make([]byte, lrcm.Len)
+	copy(body, data[HeaderLength:HeaderLength+int(lrcm.Len)])
+
+	d := Datagram{
+		Command: command.Type(data[0]),
+		Index:   data[1],
+		Address: uint32(binary.LittleEndian.Uint16(data[2:4]))<<16 | uint32(binary.LittleEndian.Uint16(data[4:6])),
+		LRCM:    lrcm,
+		IRQ:     binary.BigEndian.Uint16(data[8:10]),
+		Data:    payload.BasicPayload{Data: body},
+		WKC:     binary.LittleEndian.Uint16(data[size-WKCLength : size]),
+	}
+	return d, size, nil
+}
+
+// Validate checks that the datagram can be encoded consistently.
+// It returns an error if Data is missing or LRCM.Len does not match the length of Data.
+//
+// Returns:
+//   - error: Error describing the inconsistency
+func (e Datagram) Validate() error {
+	if e.Data == nil {
+		return ErrNoData
+	}
+
+	dataLen := payload.Len(e.Data)
+	if dataLen > MaxDataLen {
+		return fmt.Errorf("%w: data is %d bytes, Len can hold at most %d", ErrLengthMismatch, dataLen, MaxDataLen)
+	}
+	if int(e.LRCM.Len) != dataLen {
+		return fmt.Errorf("%w: LRCM.Len is %d, data is %d bytes", ErrLengthMismatch, e.LRCM.Len, dataLen)
+	}
+	return nil
+}
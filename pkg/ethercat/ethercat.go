@@ -2,6 +2,8 @@ package ethercat
 
 import (
 	"encoding/binary"
+	"errors"
+	"fmt"
 
 	"github.com/Aruminium/goecat/pkg/ethercat/datagram"
 	"github.com/Aruminium/goecat/pkg/ethercat/header"
@@ -25,39 +27,114 @@ func NewEtherCAT() *EtherCAT {
 }
 
 // AppendDatagram appends a new EtherCAT datagram to the packet and updates the packet header(Length).
-// It returns an error if the new header length exceeds the valid range.
+// The M (More EtherCAT Data) bit of the previous last datagram is set and that of the appended datagram is cleared.
+// It returns an error if the datagram is inconsistent or the new header length exceeds the valid range.
 //
 // Parameters:
 //   - data (datagram.EcatDatagram): EtherCAT datagram to append
 //
 // Returns:
-//   - error: Error if the new header length exceeds the valid range
+//   - error: Error if the datagram is invalid or the new header length exceeds the valid range
 func (e *EtherCAT) AppendDatagram(data datagram.Datagram) error {
-	newDatagramLen := len(data.Bytes()) + int(e.header.ExtractLength())
+	if err := data.Validate(); err != nil {
+		return err
+	}
+
+	newDatagramLen := datagram.Overhead + int(data.LRCM.Len) + int(e.header.ExtractLength())
 
 	newHeader, err := header.NewEcatHeader(uint16(newDatagramLen))
 	if err != nil {
 		return err
 	}
 
+	if last := len(e.datagrams) - 1; last >= 0 {
+		e.datagrams[last].LRCM.M = true
+	}
+	data.LRCM.M = false
+
 	e.header = newHeader
 	e.datagrams = append(e.datagrams, data)
 	return nil
 }
 
+// Datagrams returns the datagrams in the packet in the order they are sent.
+//
+// Returns:
+//   - []datagram.Datagram: Datagrams in the packet
+func (e EtherCAT) Datagrams() []datagram.Datagram {
+	return e.datagrams
+}
+
 // Bytes returns the byte representation of the EtherCAT packet, including the header and datagrams.
 //
 // Returns:
 //   - []byte: Byte representation of the EtherCAT packet
 func (e EtherCAT) Bytes() []byte {
-	result := make([]byte, 0)
-	headerBytes := make([]byte, 2)
-	binary.LittleEndian.PutUint16(headerBytes, e.header.Uint16())
+	return e.AppendTo(make([]byte, 0, e.Len()))
+}
+
+// AppendTo appends the byte representation of the EtherCAT packet, including the header and datagrams, to dst.
+// It does not allocate when dst has at least Len bytes of spare capacity and the data of every datagram
+// implements payload.Appender, so a buffer can be reused from cycle to cycle.
+//
+// Parameters:
+//   - dst ([]byte): Buffer to append to
+//
+// Returns:
+//   - []byte: The extended buffer
+func (e EtherCAT) AppendTo(dst []byte) []byte {
+	dst = binary.LittleEndian.AppendUint16(dst, e.header.Uint16())
+	for i := range e.datagrams {
+		dst = e.datagrams[i].AppendTo(dst)
+	}
+	return dst
+}
+
+// Len returns the length of the byte representation of the EtherCAT packet.
+//
+// Returns:
+//   - int: Length of the header and the datagrams
+func (e EtherCAT) Len() int {
+	return 2 + int(e.header.ExtractLength())
+}
+
+// Parse reads an EtherCAT packet (header and datagrams) from data.
+// Bytes after the length given in the header, such as Ethernet padding, are ignored.
+//
+// Parameters:
+//   - data ([]byte): Bytes starting with the EtherCAT header
+//
+// Returns:
+//   - *EtherCAT: Parsed EtherCAT packet
+//   - error: Error if the header or a datagram is malformed
+func Parse(data []byte) (*EtherCAT, error) {
+	if len(data) < 2 {
+		return nil, errors.New("EtherCAT packet is shorter than its header")
+	}
+
+	h, err := header.NewEcatHeaderFromUint16(binary.LittleEndian.Uint16(data))
+	if err != nil {
+		return nil, err
+	}
+
+	length := int(h.ExtractLength())
+	if len(data)-2 < length {
+		return nil, fmt.Errorf("EtherCAT packet is %d bytes, header length is %d", len(data)-2, length)
+	}
 
-	result = append(result, headerBytes...)
+	e := &EtherCAT{header: h, datagrams: []datagram.Datagram{}}
+	rest := data[2 : 2+length]
+	for len(rest) > 0 {
+		d, n, err := datagram.Parse(rest)
+		if err != nil {
+			return nil, err
+		}
+		e.datagrams = append(e.datagrams, d)
+		rest = rest[n:]
 
-	for _, d := range e.datagrams {
-		result = append(result, d.Bytes()...)
+		if !d.LRCM.M {
+			break
+		}
 	}
-	return result
+	return e, nil
 }
@@ -43,3 +43,86 @@ func TestEcatBytes(t *testing.T) {
 		t.Errorf("Expected bytes to be %v, but got %v", expectBytes, ecatBytes)
 	}
 }
+
+func TestAppendDatagramSetsMoreBit(t *testing.T) {
+	// given
+	ecat := ethercat.NewEtherCAT()
+
+	// when
+	for _, d := range []datagram.Datagram{datagram.LRD(0, 1), datagram.LRD(0, 1), datagram.BRD(0x0000, 1)} {
+		if err := ecat.AppendDatagram(d); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	// then
+	expected := []bool{true, true, false}
+	for i, d := range ecat.Datagrams() {
+		if d.LRCM.M != expected[i] {
+			t.Errorf("Datagram %d: expected M %v, but got %v", i, expected[i], d.LRCM.M)
+		}
+	}
+}
+
+func TestParseEcat(t *testing.T) {
+	// given
+	ecat := ethercat.NewEtherCAT()
+	ecat.AppendDatagram(datagram.APRD(1, 0x0008, 8))
+	ecat.AppendDatagram(datagram.BRD(0x0000, 1))
+	data := append(ecat.Bytes(), 0x00, 0x00, 0x00) // Ethernet padding
+
+	// when
+	result, err := ethercat.Parse(data)
+
+	// then
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(result.Bytes(), ecat.Bytes()) {
+		t.Errorf("Expected bytes to be %v, but got %v", ecat.Bytes(), result.Bytes())
+	}
+}
+
+// cyclicFrame returns a frame with the datagrams of a typical cycle: process data and the DC system time.
+func cyclicFrame() *ethercat.EtherCAT {
+	ecat := ethercat.NewEtherCAT()
+	ecat.AppendDatagram(datagram.LRW(0, payload.BasicPayload{Data: make([]byte, 64)}))
+	ecat.AppendDatagram(datagram.ARMW(0, 0x0910, 8))
+	return ecat
+}
+
+func TestAppendToDoesNotAllocate(t *testing.T) {
+	// given
+	ecat := cyclicFrame()
+	buffer := make([]byte, 0, ecat.Len())
+
+	// when
+	allocs := testing.AllocsPerRun(100, func() {
+		buffer = ecat.AppendTo(buffer[:0])
+	})
+
+	// then
+	if allocs != 0 {
+		t.Errorf("Expected no allocations, but got %v", allocs)
+	}
+	if !reflect.DeepEqual(buffer, ecat.Bytes()) || len(buffer) != ecat.Len() {
+		t.Errorf("Expected %v, but got %v", ecat.Bytes(), buffer)
+	}
+}
+
+func BenchmarkBytes(b *testing.B) {
+	ecat := cyclicFrame()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = ecat.Bytes()
+	}
+}
+
+func BenchmarkAppendTo(b *testing.B) {
+	ecat := cyclicFrame()
+	buffer := make([]byte, 0, ecat.Len())
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buffer = ecat.AppendTo(buffer[:0])
+	}
+}
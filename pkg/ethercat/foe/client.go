@@ -0,0 +1,151 @@
+package foe
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/Aruminium/goecat/pkg/ethercat/mailbox"
+)
+
+// ErrUnexpectedPacket is returned when a slave answers with a packet that does not belong to the transfer.
+var ErrUnexpectedPacket = errors.New("foe: unexpected packet")
+
+// Client reads and writes files on one slave. Transfers are serialized, so a Client can be shared.
+type Client struct {
+	conn *mailbox.Conn
+	mu   sync.Mutex
+}
+
+// NewClient creates an FoE client on a mailbox connection.
+//
+// Parameters:
+//   - conn (*mailbox.Conn): Mailbox connection to the slave
+//
+// Returns:
+//   - *Client: New client
+func NewClient(conn *mailbox.Conn) *Client {
+	return &Client{conn: conn}
+}
+
+// Read reads a file from the slave.
+//
+// Parameters:
+//   - ctx (context.Context): Context bounding the transfer
+//   - name (string): File name
+//   - password (uint32): Password, 0 if the slave does not require one
+//
+// Returns:
+//   - []byte: File content
+//   - error: *Error if the slave refused the transfer, or any mailbox error
+func (c *Client) Read(ctx context.Context, name string, password uint32) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	segment := int(c.conn.ReceiveSize()) - mailbox.HeaderLength - HeaderLength
+	if err := c.send(ctx, Packet{OpCode: OpRead, Value: password, Data: []byte(name)}); err != nil {
+		return nil, err
+	}
+
+	var data []byte
+	for number := uint32(1); ; {
+		p, err := c.receive(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if p.OpCode == OpBusy {
+			continue
+		}
+		if p.OpCode != OpData || p.Value != number {
+			return nil, ErrUnexpectedPacket
+		}
+
+		data = append(data, p.Data...)
+		if err := c.send(ctx, Packet{OpCode: OpAck, Value: number}); err != nil {
+			return nil, err
+		}
+		// A packet shorter than the segment size ends the file.
+		if len(p.Data) < segment {
+			return data, nil
+		}
+		number++
+	}
+}
+
+// Write writes a file to the slave.
+//
+// Parameters:
+//   - ctx (context.Context): Context bounding the transfer
+//   - name (string): File name
+//   - password (uint32): Password, 0 if the slave does not require one
+//   - data ([]byte): File content
+//
+// Returns:
+//   - error: *Error if the slave refused the transfer, or any mailbox error
+func (c *Client) Write(ctx context.Context, name string, password uint32, data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	segment := int(c.conn.SendSize()) - mailbox.HeaderLength - HeaderLength
+	if segment <= 0 {
+		return mailbox.ErrTooLarge
+	}
+
+	p := Packet{OpCode: OpWrite, Value: password, Data: []byte(name)}
+	for number := uint32(0); ; {
+		if err := c.send(ctx, p); err != nil {
+			return err
+		}
+
+		ack, err := c.receive(ctx)
+		if err != nil {
+			return err
+		}
+		if ack.OpCode == OpBusy {
+			// The slave is not ready yet and expects the packet again.
+			continue
+		}
+		if ack.OpCode != OpAck || ack.Value != number {
+			return ErrUnexpectedPacket
+		}
+		// A packet shorter than the segment size ends the file, so a file that is
+		// a multiple of the segment size ends with an empty packet.
+		if number > 0 && len(p.Data) < segment {
+			return nil
+		}
+
+		number++
+		chunk := data[:min(segment, len(data))]
+		data = data[len(chunk):]
+		p = Packet{OpCode: OpData, Value: number, Data: chunk}
+	}
+}
+
+func (c *Client) send(ctx context.Context, p Packet) error {
+	return c.conn.Send(ctx, mailbox.New(mailbox.FoE, 0, p.Bytes()))
+}
+
+// receive returns the next FoE packet, converting error packets to *Error.
+func (c *Client) receive(ctx context.Context) (Packet, error) {
+	for {
+		m, err := c.conn.Receive(ctx)
+		if err != nil {
+			return Packet{}, err
+		}
+		if err := m.Err(); err != nil {
+			return Packet{}, err
+		}
+		if m.Type != mailbox.FoE {
+			continue
+		}
+
+		p, err := Parse(m.Data)
+		if err != nil {
+			return Packet{}, err
+		}
+		if p.OpCode == OpError {
+			return Packet{}, &Error{Code: ErrorCode(p.Value), Text: string(p.Data)}
+		}
+		return p, nil
+	}
+}
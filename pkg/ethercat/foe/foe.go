@@ -0,0 +1,166 @@
+// Package foe implements File access over EtherCAT, which reads and writes files on a slave,
+// typically to update its firmware.
+package foe
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// HeaderLength is the length of the FoE header.
+const HeaderLength = 6
+
+// ErrShortPacket is returned when an FoE packet is shorter than its header.
+var ErrShortPacket = errors.New("foe: packet too short")
+
+// OpCode is the operation of an FoE packet.
+type OpCode uint8
+
+const (
+	OpRead  OpCode = 0x01 // Read request: Value is the password, Data the file name
+	OpWrite OpCode = 0x02 // Write request: Value is the password, Data the file name
+	OpData  OpCode = 0x03 // Data: Value is the packet number
+	OpAck   OpCode = 0x04 // Acknowledge: Value is the packet number
+	OpError OpCode = 0x05 // Error: Value is the error code, Data the error text
+	OpBusy  OpCode = 0x06 // Busy: Value holds the progress (done in the low word, entire in the high word)
+)
+
+// String returns the name of the operation.
+func (o OpCode) String() string {
+	switch o {
+	case OpRead:
+		return "RRQ"
+	case OpWrite:
+		return "WRQ"
+	case OpData:
+		return "DATA"
+	case OpAck:
+		return "ACK"
+	case OpError:
+		return "ERR"
+	case OpBusy:
+		return "BUSY"
+	default:
+		return fmt.Sprintf("OpCode(%d)", uint8(o))
+	}
+}
+
+// Packet is an FoE packet.
+type Packet struct {
+	OpCode OpCode
+	Value  uint32 // Password, packet number, error code or progress depending on OpCode
+	Data   []byte // File name, file data or error text depending on OpCode
+}
+
+// Bytes returns the encoded packet.
+//
+// Returns:
+//   - []byte: Data of an FoE mailbox
+func (p Packet) Bytes() []byte {
+	result := make([]byte, HeaderLength, HeaderLength+len(p.Data))
+	result[0] = uint8(p.OpCode)
+	binary.LittleEndian.PutUint32(result[2:6], p.Value)
+	return append(result, p.Data...)
+}
+
+// Parse decodes an FoE packet.
+//
+// Parameters:
+//   - data ([]byte): Data of an FoE mailbox
+//
+// Returns:
+//   - Packet: Decoded packet; Data is a subslice of data
+//   - error: ErrShortPacket if data is shorter than the header
+func Parse(data []byte) (Packet, error) {
+	if len(data) < HeaderLength {
+		return Packet{}, ErrShortPacket
+	}
+
+	return Packet{
+		OpCode: OpCode(data[0]),
+		Value:  binary.LittleEndian.Uint32(data[2:6]),
+		Data:   data[HeaderLength:],
+	}, nil
+}
+
+// ErrorCode is the error code of an FoE error packet.
+type ErrorCode uint32
+
+const (
+	ErrNotDefined        ErrorCode = 0x8000
+	ErrNotFound          ErrorCode = 0x8001
+	ErrAccessDenied      ErrorCode = 0x8002
+	ErrDiskFull          ErrorCode = 0x8003
+	ErrIllegal           ErrorCode = 0x8004
+	ErrPacketNumberWrong ErrorCode = 0x8005
+	ErrAlreadyExists     ErrorCode = 0x8006
+	ErrNoUser            ErrorCode = 0x8007
+	ErrBootstrapOnly     ErrorCode = 0x8008
+	ErrNotBootstrap      ErrorCode = 0x8009
+	ErrNoRights          ErrorCode = 0x800a
+	ErrProgramError      ErrorCode = 0x800b
+)
+
+// Error returns a description of the error code.
+func (c ErrorCode) Error() string {
+	switch c {
+	case ErrNotDefined:
+		return "foe: not defined"
+	case ErrNotFound:
+		return "foe: not found"
+	case ErrAccessDenied:
+		return "foe: access denied"
+	case ErrDiskFull:
+		return "foe: disk full"
+	case ErrIllegal:
+		return "foe: illegal"
+	case ErrPacketNumberWrong:
+		return "foe: packet number wrong"
+	case ErrAlreadyExists:
+		return "foe: already exists"
+	case ErrNoUser:
+		return "foe: no user"
+	case ErrBootstrapOnly:
+		return "foe: bootstrap only"
+	case ErrNotBootstrap:
+		return "foe: not bootstrap"
+	case ErrNoRights:
+		return "foe: no rights"
+	case ErrProgramError:
+		return "foe: program error"
+	default:
+		return fmt.Sprintf("foe: error 0x%04x", uint32(c))
+	}
+}
+
+// Error is an error reported by the slave with an FoE error packet.
+type Error struct {
+	Code ErrorCode
+	Text string // Optional text sent along with the code
+}
+
+// Error returns the error code and text.
+func (e *Error) Error() string {
+	if e.Text == "" {
+		return e.Code.Error()
+	}
+	return fmt.Sprintf("%s: %s", e.Code.Error(), e.Text)
+}
+
+// Unwrap returns the error code, so errors.Is can match it.
+func (e *Error) Unwrap() error {
+	return e.Code
+}
+
+// NewError creates the error packet for code.
+//
+// Parameters:
+//   - code (ErrorCode): Error code
+//   - text (string): Optional error text
+//
+// Returns:
+//   - Packet: Error packet
+func NewError(code ErrorCode, text string) Packet {
+	return Packet{OpCode: OpError, Value: uint32(code), Data: []byte(text)}
+}
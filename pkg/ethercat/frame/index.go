@@ -0,0 +1,110 @@
+package frame
+
+// IndexAllocator hands out datagram indices to the Scheduler.
+type IndexAllocator interface {
+	// Allocate returns the next index to use, or false if none is available.
+	Allocate() (uint8, bool)
+}
+
+// counter allocates indices from a wrapping counter without tracking their use.
+type counter struct {
+	next uint8
+}
+
+func (c *counter) Allocate() (uint8, bool) {
+	index := c.next
+	c.next++
+	return index, true
+}
+
+// IndexState is the state of a datagram index in an IndexPool.
+type IndexState uint8
+
+const (
+	Free     IndexState = iota // Never used
+	InFlight                   // Sent and waiting for its return
+	Returned                   // Returned; a further return is a duplicate
+	Expired                    // Timed out; a later return is late
+)
+
+// IndexPool allocates datagram indices and tracks them until they return or expire.
+//
+// Indices are handed out round-robin, skipping those still in flight, so an index is
+// reused as late as possible. After a datagram returns or expires its index keeps that
+// state until it is allocated again, which lets duplicate and late returns be told apart.
+// IndexPool is not safe for concurrent use.
+type IndexPool struct {
+	next   uint8
+	states [256]IndexState
+	used   int
+}
+
+// NewIndexPool creates an IndexPool with all indices free.
+func NewIndexPool() *IndexPool {
+	return &IndexPool{}
+}
+
+// Allocate returns the next index that is not in flight and marks it in flight.
+// It returns false if all 256 indices are in flight.
+//
+// Returns:
+//   - uint8: Allocated index
+//   - bool: Whether an index was available
+func (p *IndexPool) Allocate() (uint8, bool) {
+	if p.used == len(p.states) {
+		return 0, false
+	}
+
+	for p.states[p.next] == InFlight {
+		p.next++
+	}
+	index := p.next
+	p.next++
+
+	p.states[index] = InFlight
+	p.used++
+	return index, true
+}
+
+// Return marks an in-flight index as returned.
+// It returns the state the index had, so callers can detect duplicate or late returns.
+//
+// Parameters:
+//   - index (uint8): Index of the returned datagram
+//
+// Returns:
+//   - IndexState: State of the index before the call
+func (p *IndexPool) Return(index uint8) IndexState {
+	state := p.states[index]
+	if state == InFlight {
+		p.states[index] = Returned
+		p.used--
+	}
+	return state
+}
+
+// Expire marks an in-flight index as expired.
+//
+// Parameters:
+//   - index (uint8): Index of the timed-out datagram
+//
+// Returns:
+//   - IndexState: State of the index before the call
+func (p *IndexPool) Expire(index uint8) IndexState {
+	state := p.states[index]
+	if state == InFlight {
+		p.states[index] = Expired
+		p.used--
+	}
+	return state
+}
+
+// State returns the state of an index without changing it.
+func (p *IndexPool) State(index uint8) IndexState {
+	return p.states[index]
+}
+
+// InFlight returns the number of indices in flight.
+func (p *IndexPool) InFlight() int {
+	return p.used
+}
@@ -0,0 +1,201 @@
+// Package frame packs EtherCAT datagrams into frames that fit into an Ethernet payload.
+package frame
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Aruminium/goecat/pkg/ethercat"
+	"github.com/Aruminium/goecat/pkg/ethercat/datagram"
+)
+
+const (
+	EthernetMTU  = 1500 // Ethernet payload limit
+	RawOverhead  = 0    // EtherType 0x88A4: the EtherCAT header follows the Ethernet header
+	UDPOverhead  = 28   // UDP port 34980: IPv4 header (20) + UDP header (8)
+	HeaderLength = 2    // EtherCAT header
+)
+
+// ErrNoIndex is returned when all datagram indices are in use.
+var ErrNoIndex = errors.New("no datagram index available")
+
+// MaxDatagramsLength returns the number of bytes available for datagrams in one frame.
+//
+// Parameters:
+//   - overhead (int): Encapsulation overhead inside the Ethernet payload (RawOverhead or UDPOverhead)
+//
+// Returns:
+//   - int: Number of bytes available for datagrams
+func MaxDatagramsLength(overhead int) int {
+	return EthernetMTU - overhead - HeaderLength
+}
+
+// Frame is an EtherCAT frame built by the Scheduler.
+type Frame struct {
+	Ecat    *ethercat.EtherCAT // Packed EtherCAT frame
+	Indices []uint8            // Index of every datagram in Ecat, in order
+}
+
+// Scheduler queues datagrams and packs as many of them as fit into each frame.
+//
+// Datagrams are packed in the order they are enqueued. The Scheduler assigns each
+// datagram an index from its IndexAllocator and records the indices per frame, so
+// responses can be matched to the frame and datagram that produced them.
+type Scheduler struct {
+	maxLength int
+	queue     []datagram.Datagram
+	indices   IndexAllocator
+}
+
+// NewScheduler creates a Scheduler for the given encapsulation overhead.
+//
+// Parameters:
+//   - overhead (int): Encapsulation overhead inside the Ethernet payload (RawOverhead or UDPOverhead)
+//
+// Returns:
+//   - *Scheduler: New Scheduler
+func NewScheduler(overhead int) *Scheduler {
+	return NewSchedulerWithIndices(overhead, &counter{})
+}
+
+// NewSchedulerWithIndices creates a Scheduler that takes datagram indices from indices.
+// Packing stops when indices has no index available.
+//
+// Parameters:
+//   - overhead (int): Encapsulation overhead inside the Ethernet payload (RawOverhead or UDPOverhead)
+//   - indices (IndexAllocator): Allocator of datagram indices, such as an IndexPool
+//
+// Returns:
+//   - *Scheduler: New Scheduler
+func NewSchedulerWithIndices(overhead int, indices IndexAllocator) *Scheduler {
+	return &Scheduler{maxLength: MaxDatagramsLength(overhead), indices: indices}
+}
+
+// Enqueue adds datagrams to the end of the queue.
+// It returns an error if a datagram is invalid or can never fit into a single frame;
+// in that case none of the datagrams are enqueued.
+//
+// Parameters:
+//   - datagrams (...datagram.Datagram): Datagrams to send
+//
+// Returns:
+//   - error: Error if a datagram is invalid or too large
+func (s *Scheduler) Enqueue(datagrams ...datagram.Datagram) error {
+	for _, d := range datagrams {
+		if err := d.Validate(); err != nil {
+			return err
+		}
+		if size := datagram.Overhead + int(d.LRCM.Len); size > s.maxLength {
+			return fmt.Errorf("datagram of %d bytes does not fit into a frame of %d bytes", size, s.maxLength)
+		}
+	}
+
+	s.queue = append(s.queue, datagrams...)
+	return nil
+}
+
+// Remove removes the i-th queued datagram, such as one whose sender gave up before it was packed.
+// It does nothing if i is out of range.
+//
+// Parameters:
+//   - i (int): Position of the datagram in the queue
+func (s *Scheduler) Remove(i int) {
+	if i < 0 || i >= len(s.queue) {
+		return
+	}
+	s.queue = append(s.queue[:i:i], s.queue[i+1:]...)
+}
+
+// Len returns the number of queued datagrams.
+func (s *Scheduler) Len() int {
+	return len(s.queue)
+}
+
+// Next packs the queued datagrams into the next frame.
+// It returns false if the queue is empty or no index is available.
+//
+// Returns:
+//   - Frame: Packed frame with the More bits of all but the last datagram set
+//   - bool: Whether a frame was packed
+func (s *Scheduler) Next() (Frame, bool) {
+	if len(s.queue) == 0 {
+		return Frame{}, false
+	}
+
+	f, _ := s.NextWith()
+	return f, len(f.Indices) > 0
+}
+
+// NextWith packs head into a new frame and fills the remaining room with queued datagrams.
+// It is used to piggyback queued datagrams onto a frame whose head must be sent, such as cyclic process data.
+// It returns an error if head itself does not fit into a frame or no index is available for it.
+//
+// Parameters:
+//   - head (...datagram.Datagram): Datagrams placed at the beginning of the frame
+//
+// Returns:
+//   - Frame: Packed frame; the first len(head) indices belong to head
+//   - error: Error if head is invalid or does not fit
+func (s *Scheduler) NextWith(head ...datagram.Datagram) (Frame, error) {
+	f := Frame{Ecat: ethercat.NewEtherCAT()}
+	length := 0
+
+	for _, d := range head {
+		if err := d.Validate(); err != nil {
+			return Frame{}, err
+		}
+		length += datagram.Overhead + int(d.LRCM.Len)
+	}
+	if length > s.maxLength {
+		return Frame{}, fmt.Errorf("datagrams of %d bytes do not fit into a frame of %d bytes", length, s.maxLength)
+	}
+	for _, d := range head {
+		if !s.append(&f, d) {
+			return f, ErrNoIndex
+		}
+	}
+
+	n := 0
+	for _, d := range s.queue {
+		size := datagram.Overhead + int(d.LRCM.Len)
+		if length+size > s.maxLength || !s.append(&f, d) {
+			break
+		}
+
+		length += size
+		n++
+	}
+
+	s.queue = s.queue[n:]
+	return f, nil
+}
+
+// append assigns the next index to d and appends it to f.
+// It returns false if no index is available.
+func (s *Scheduler) append(f *Frame, d datagram.Datagram) bool {
+	index, ok := s.indices.Allocate()
+	if !ok {
+		return false
+	}
+
+	d.Index = index
+	// The datagram has been validated and maxLength is below the header limit.
+	_ = f.Ecat.AppendDatagram(d)
+	f.Indices = append(f.Indices, d.Index)
+	return true
+}
+
+// Flush packs all queued datagrams into as many frames as needed.
+//
+// Returns:
+//   - []Frame: Packed frames in sending order
+func (s *Scheduler) Flush() []Frame {
+	frames := []Frame{}
+	for {
+		f, ok := s.Next()
+		if !ok {
+			return frames
+		}
+		frames = append(frames, f)
+	}
+}
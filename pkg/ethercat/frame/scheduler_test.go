@@ -0,0 +1,129 @@
+package frame_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Aruminium/goecat/pkg/ethercat/command"
+	"github.com/Aruminium/goecat/pkg/ethercat/datagram"
+	"github.com/Aruminium/goecat/pkg/ethercat/frame"
+	"github.com/Aruminium/goecat/pkg/ethercat/payload"
+)
+
+func TestSchedulerSplitsFrames(t *testing.T) {
+	// given
+	// 3 datagrams of 12 + 600 bytes only fit two per raw frame (1498 bytes available)
+	scheduler := frame.NewScheduler(frame.RawOverhead)
+	err := scheduler.Enqueue(datagram.LRD(0, 600), datagram.LRD(600, 600), datagram.LRD(1200, 600))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// when
+	frames := scheduler.Flush()
+
+	// then
+	if len(frames) != 2 {
+		t.Fatalf("Expected 2 frames, but got %d", len(frames))
+	}
+	if !reflect.DeepEqual(frames[0].Indices, []uint8{0, 1}) || !reflect.DeepEqual(frames[1].Indices, []uint8{2}) {
+		t.Errorf("Unexpected indices: %v, %v", frames[0].Indices, frames[1].Indices)
+	}
+
+	first := frames[0].Ecat.Datagrams()
+	if !first[0].LRCM.M || first[1].LRCM.M {
+		t.Errorf("Expected More bits [true false], but got [%v %v]", first[0].LRCM.M, first[1].LRCM.M)
+	}
+	if frames[1].Ecat.Datagrams()[0].LRCM.M {
+		t.Errorf("Expected More bit of the last datagram to be cleared")
+	}
+	if scheduler.Len() != 0 {
+		t.Errorf("Expected empty queue, but got %d datagrams", scheduler.Len())
+	}
+}
+
+func TestSchedulerRejectsOversizedDatagram(t *testing.T) {
+	// given
+	scheduler := frame.NewScheduler(frame.UDPOverhead)
+
+	// when
+	err := scheduler.Enqueue(datagram.LRD(0, 1460))
+
+	// then
+	if err == nil {
+		t.Errorf("Expected an error for a datagram larger than the frame")
+	}
+}
+
+func TestSchedulerPiggybacksQueue(t *testing.T) {
+	// given
+	scheduler := frame.NewScheduler(frame.RawOverhead)
+	scheduler.Enqueue(datagram.APRD(0, 0x0130, 2), datagram.LRD(0, 1450))
+
+	// when
+	f, err := scheduler.NextWith(datagram.LRW(0, payload.BasicPayload{Data: make([]byte, 32)}))
+
+	// then
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	datagrams := f.Ecat.Datagrams()
+	if len(datagrams) != 2 || datagrams[0].Command != command.LRW || datagrams[1].Command != command.APRD {
+		t.Errorf("Expected LRW followed by APRD, but got %d datagrams", len(datagrams))
+	}
+	if scheduler.Len() != 1 {
+		t.Errorf("Expected the LRD to stay queued, but got %d queued datagrams", scheduler.Len())
+	}
+}
+
+func TestSchedulerRemove(t *testing.T) {
+	// given
+	scheduler := frame.NewScheduler(frame.RawOverhead)
+	scheduler.Enqueue(datagram.APRD(0, 0x0130, 2), datagram.FPWR(0x1001, 0x0120, payload.BasicPayload{Data: []byte{0x02, 0x00}}), datagram.LRD(0, 8))
+
+	// when
+	scheduler.Remove(1)
+	scheduler.Remove(5)
+	frames := scheduler.Flush()
+
+	// then
+	if len(frames) != 1 {
+		t.Fatalf("Expected 1 frame, but got %d", len(frames))
+	}
+	var commands []command.Type
+	for _, d := range frames[0].Ecat.Datagrams() {
+		commands = append(commands, d.Command)
+	}
+	if !reflect.DeepEqual(commands, []command.Type{command.APRD, command.LRD}) {
+		t.Errorf("Expected APRD followed by LRD, but got %v", commands)
+	}
+}
+
+func TestIndexPoolWrapsAround(t *testing.T) {
+	// given
+	pool := frame.NewIndexPool()
+	for i := 0; i < 256; i++ {
+		pool.Allocate()
+	}
+	pool.Return(3)
+	pool.Expire(7)
+
+	// when
+	first, ok1 := pool.Allocate()
+	second, ok2 := pool.Allocate()
+	_, ok3 := pool.Allocate()
+
+	// then
+	if !ok1 || !ok2 || first != 3 || second != 7 {
+		t.Errorf("Expected indices 3 and 7 after wraparound, but got %d(%v) and %d(%v)", first, ok1, second, ok2)
+	}
+	if ok3 {
+		t.Errorf("Expected the pool to be exhausted")
+	}
+	if state := pool.Return(3); state != frame.InFlight {
+		t.Errorf("Expected index 3 in flight, but got %v", state)
+	}
+	if state := pool.Return(3); state != frame.Returned {
+		t.Errorf("Expected a duplicate return to report %v, but got %v", frame.Returned, state)
+	}
+}
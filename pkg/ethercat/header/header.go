@@ -1,6 +1,9 @@
 package header
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 // Header represents an EtherCAT frame header.
 //
@@ -43,6 +46,27 @@ func NewEcatHeader(length uint16) (Header, error) {
 	return Header{1, 0, length}, nil
 }
 
+// NewEcatHeaderFromUint16 creates an EtherCAT header from its uint16 representation.
+// It returns an error if the type is not EtherCAT commands (Type = 0x1).
+//
+// Parameters:
+//   - h (uint16): The uint16 value representing the header fields
+//
+// Returns:
+//   - Header: New EtherCAT header
+//   - error: Error if the type is not supported
+func NewEcatHeaderFromUint16(h uint16) (Header, error) {
+	ecatType := (h & 0b1111000000000000) >> 12
+	if ecatType != 1 {
+		return Header{}, fmt.Errorf("unsupported Ecat Header Type: %d", ecatType)
+	}
+
+	res := (h & 0b0000100000000000) >> 11
+	length := h & 0b0000011111111111
+
+	return Header{ecatType, res, length}, nil
+}
+
 // ExtractLength returns the length value from the EtherCAT header.
 //
 // Returns:
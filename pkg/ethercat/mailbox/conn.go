@@ -0,0 +1,193 @@
+package mailbox
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/Aruminium/goecat/pkg/ethercat/datagram"
+	"github.com/Aruminium/goecat/pkg/ethercat/payload"
+	"github.com/Aruminium/goecat/pkg/ethercat/sii"
+	"github.com/Aruminium/goecat/pkg/transceiver"
+)
+
+// DefaultPollInterval is how often a Conn polls a busy or empty mailbox.
+const DefaultPollInterval = time.Millisecond
+
+var (
+	// ErrNoMailbox is returned when the slave has no mailbox configured.
+	ErrNoMailbox = errors.New("slave has no mailbox")
+	// ErrTooLarge is returned when a mailbox does not fit into the receive mailbox of the slave.
+	ErrTooLarge = errors.New("mailbox exceeds the mailbox size")
+)
+
+// Stats counts the mailboxes exchanged over a Conn.
+type Stats struct {
+	Sent          uint64 // Mailboxes written to the slave
+	Received      uint64 // Mailboxes read from the slave, without repeated ones
+	SentBytes     uint64 // Header and data bytes of the sent mailboxes
+	ReceivedBytes uint64 // Header and data bytes of the received mailboxes
+	ErrorReplies  uint64 // Received mailbox error replies
+}
+
+// Conn exchanges mailboxes with one slave over its mailbox SyncManagers.
+// The SyncManagers have to be configured and the slave has to be in PRE-OP or above.
+type Conn struct {
+	PollInterval time.Duration // Interval for polling the mailboxes, DefaultPollInterval if zero
+
+	x       transceiver.Exchanger
+	station uint16
+	rx      sii.Mailbox
+	tx      sii.Mailbox
+
+	mu       sync.Mutex
+	counter  uint8
+	received uint8
+	stats    Stats
+}
+
+// NewConn creates a mailbox connection to a slave.
+//
+// Parameters:
+//   - x (transceiver.Exchanger): Transceiver of the segment
+//   - station (uint16): Configured station address of the slave
+//   - rx (sii.Mailbox): Receive mailbox of the slave (master to slave), usually SM0
+//   - tx (sii.Mailbox): Send mailbox of the slave (slave to master), usually SM1
+//
+// Returns:
+//   - *Conn: New connection
+func NewConn(x transceiver.Exchanger, station uint16, rx sii.Mailbox, tx sii.Mailbox) *Conn {
+	return &Conn{x: x, station: station, rx: rx, tx: tx}
+}
+
+// Station returns the configured station address of the slave.
+func (c *Conn) Station() uint16 {
+	return c.station
+}
+
+// Stats returns a snapshot of the counters.
+func (c *Conn) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.stats
+}
+
+// SendSize returns the size of the receive mailbox of the slave, which limits the mailboxes Send accepts.
+func (c *Conn) SendSize() uint16 {
+	return c.rx.Size
+}
+
+// ReceiveSize returns the size of the send mailbox of the slave, which limits the mailboxes Receive returns.
+func (c *Conn) ReceiveSize() uint16 {
+	return c.tx.Size
+}
+
+// Send writes a mailbox into the receive mailbox of the slave, waiting while it is still full.
+// The counter of m is replaced by the next sequence counter of the connection.
+//
+// Parameters:
+//   - ctx (context.Context): Context bounding the wait
+//   - m (Mailbox): Mailbox to send
+//
+// Returns:
+//   - error: Error if the mailbox does not fit, the exchange fails or ctx is done
+func (c *Conn) Send(ctx context.Context, m Mailbox) error {
+	if c.rx.Size == 0 {
+		return ErrNoMailbox
+	}
+	if HeaderLength+len(m.Data) > int(c.rx.Size) {
+		return ErrTooLarge
+	}
+
+	c.mu.Lock()
+	c.counter = NextCounter(c.counter)
+	m.Counter = c.counter
+	c.mu.Unlock()
+	m.Length = uint16(len(m.Data))
+
+	// The whole buffer is written, because the slave only sees the mailbox when its last byte is written.
+	buffer := make([]byte, c.rx.Size)
+	copy(buffer, m.Bytes())
+	for {
+		d, err := c.x.Exchange(ctx, datagram.FPWR(c.station, c.rx.Offset, payload.BasicPayload{Data: buffer}))
+		if err != nil {
+			return err
+		}
+		if d.WKC == 1 {
+			c.mu.Lock()
+			c.stats.Sent++
+			c.stats.SentBytes += uint64(HeaderLength + len(m.Data))
+			c.mu.Unlock()
+			return nil
+		}
+		if err := c.wait(ctx); err != nil {
+			return err
+		}
+	}
+}
+
+// Receive reads the next mailbox from the send mailbox of the slave, waiting until there is one.
+// A repeated mailbox with the counter of the previous one is dropped.
+// The reads are never retried after a timeout, as a read that reached the slave has emptied the mailbox.
+//
+// Parameters:
+//   - ctx (context.Context): Context bounding the wait
+//
+// Returns:
+//   - Mailbox: Received mailbox; error replies are returned as they are, see Mailbox.Err
+//   - error: Error if the exchange fails, the mailbox cannot be decoded or ctx is done
+func (c *Conn) Receive(ctx context.Context) (Mailbox, error) {
+	if c.tx.Size == 0 {
+		return Mailbox{}, ErrNoMailbox
+	}
+
+	for {
+		d, err := c.x.Exchange(transceiver.WithoutRetry(ctx), datagram.FPRD(c.station, c.tx.Offset, c.tx.Size))
+		if err != nil {
+			return Mailbox{}, err
+		}
+		if d.WKC == 1 {
+			m, err := Parse(d.Data.Bytes())
+			if err != nil {
+				return Mailbox{}, err
+			}
+
+			c.mu.Lock()
+			repeated := m.Counter != 0 && m.Counter == c.received
+			c.received = m.Counter
+			if !repeated {
+				c.stats.Received++
+				c.stats.ReceivedBytes += uint64(HeaderLength + len(m.Data))
+				if m.Err() != nil {
+					c.stats.ErrorReplies++
+				}
+			}
+			c.mu.Unlock()
+			if !repeated {
+				return m, nil
+			}
+		}
+		if err := c.wait(ctx); err != nil {
+			return Mailbox{}, err
+		}
+	}
+}
+
+// wait sleeps for the poll interval or until ctx is done.
+func (c *Conn) wait(ctx context.Context) error {
+	interval := c.PollInterval
+	if interval == 0 {
+		interval = DefaultPollInterval
+	}
+
+	t := time.NewTimer(interval)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,75 @@
+package mailbox
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// errorCommand is the command of a mailbox error reply.
+const errorCommand = 0x0001
+
+// ErrorCode is the detail of a mailbox error reply.
+type ErrorCode uint16
+
+const (
+	ErrSyntax              ErrorCode = 0x0001 // Syntax of the mailbox header is wrong
+	ErrUnsupportedProtocol ErrorCode = 0x0002 // Mailbox protocol is not supported
+	ErrInvalidChannel      ErrorCode = 0x0003 // Channel field contains a wrong value
+	ErrServiceNotSupported ErrorCode = 0x0004 // Service in the mailbox protocol is not supported
+	ErrInvalidHeader       ErrorCode = 0x0005 // Mailbox protocol header is wrong
+	ErrSizeTooShort        ErrorCode = 0x0006 // Received data is too short
+	ErrNoMoreMemory        ErrorCode = 0x0007 // Mailbox protocol cannot be processed for lack of memory
+	ErrInvalidSize         ErrorCode = 0x0008 // Length of the data is inconsistent
+)
+
+// Error returns a description of the error code.
+func (c ErrorCode) Error() string {
+	switch c {
+	case ErrSyntax:
+		return "mailbox: syntax error"
+	case ErrUnsupportedProtocol:
+		return "mailbox: unsupported protocol"
+	case ErrInvalidChannel:
+		return "mailbox: invalid channel"
+	case ErrServiceNotSupported:
+		return "mailbox: service not supported"
+	case ErrInvalidHeader:
+		return "mailbox: invalid header"
+	case ErrSizeTooShort:
+		return "mailbox: size too short"
+	case ErrNoMoreMemory:
+		return "mailbox: no more memory"
+	case ErrInvalidSize:
+		return "mailbox: invalid size"
+	default:
+		return fmt.Sprintf("mailbox: error 0x%04x", uint16(c))
+	}
+}
+
+// NewError creates the mailbox error reply a slave sends for a mailbox it cannot process.
+//
+// Parameters:
+//   - code (ErrorCode): Detail of the error
+//
+// Returns:
+//   - Mailbox: Error reply
+func NewError(code ErrorCode) Mailbox {
+	data := make([]byte, 4)
+	binary.LittleEndian.PutUint16(data[0:2], errorCommand)
+	binary.LittleEndian.PutUint16(data[2:4], uint16(code))
+	return New(Error, 0, data)
+}
+
+// Err returns the error code of a mailbox error reply, or nil for any other mailbox.
+//
+// Returns:
+//   - error: ErrorCode of the reply, nil if m is not an error reply
+func (m Mailbox) Err() error {
+	if m.Type != Error {
+		return nil
+	}
+	if len(m.Data) < 4 || binary.LittleEndian.Uint16(m.Data) != errorCommand {
+		return ErrSyntax
+	}
+	return ErrorCode(binary.LittleEndian.Uint16(m.Data[2:4]))
+}
@@ -0,0 +1,139 @@
+// Package mailbox implements the EtherCAT mailbox: the header that frames CoE, FoE and the
+// other mailbox protocols, and a connection that exchanges mailboxes with a slave through its
+// mailbox SyncManagers.
+package mailbox
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// HeaderLength is the length of the mailbox header.
+const HeaderLength = 6
+
+// ErrShortMailbox is returned when the data is shorter than the mailbox it contains.
+var ErrShortMailbox = errors.New("mailbox too short")
+
+// Type is the mailbox protocol carried in a mailbox.
+type Type uint8
+
+const (
+	Error Type = 0x00 // Mailbox error reply
+	AoE   Type = 0x01 // ADS over EtherCAT
+	EoE   Type = 0x02 // Ethernet over EtherCAT
+	CoE   Type = 0x03 // CANopen over EtherCAT
+	FoE   Type = 0x04 // File access over EtherCAT
+	SoE   Type = 0x05 // Servo profile over EtherCAT
+	VoE   Type = 0x0f // Vendor specific
+)
+
+// String returns the abbreviation of the protocol.
+func (t Type) String() string {
+	switch t {
+	case Error:
+		return "ERR"
+	case AoE:
+		return "AoE"
+	case EoE:
+		return "EoE"
+	case CoE:
+		return "CoE"
+	case FoE:
+		return "FoE"
+	case SoE:
+		return "SoE"
+	case VoE:
+		return "VoE"
+	default:
+		return fmt.Sprintf("Type(0x%x)", uint8(t))
+	}
+}
+
+// Header is the mailbox header.
+type Header struct {
+	Length   uint16 // Length of the data after the header
+	Address  uint16 // Station address of the source (master to slave) or destination
+	Channel  uint8  // Reserved, 0
+	Priority uint8  // 0 (lowest) to 3 (highest)
+	Type     Type   // Mailbox protocol
+	Counter  uint8  // Sequence counter 1 to 7, 0 if the slave does not check it
+}
+
+// Mailbox is a mailbox header with its data.
+type Mailbox struct {
+	Header
+	Data []byte
+}
+
+// New creates a mailbox with the length taken from data.
+//
+// Parameters:
+//   - t (Type): Mailbox protocol
+//   - counter (uint8): Sequence counter
+//   - data ([]byte): Protocol data
+//
+// Returns:
+//   - Mailbox: New mailbox
+func New(t Type, counter uint8, data []byte) Mailbox {
+	return Mailbox{
+		Header: Header{Length: uint16(len(data)), Type: t, Counter: counter & 0x07},
+		Data:   data,
+	}
+}
+
+// Bytes returns the mailbox header followed by the data.
+// It implements payload.MarshalerByte.
+//
+// Returns:
+//   - []byte: Encoded mailbox
+func (m Mailbox) Bytes() []byte {
+	result := make([]byte, HeaderLength, HeaderLength+len(m.Data))
+	binary.LittleEndian.PutUint16(result[0:2], m.Length)
+	binary.LittleEndian.PutUint16(result[2:4], m.Address)
+	result[4] = m.Channel&0x3f | m.Priority<<6
+	result[5] = uint8(m.Type)&0x0f | (m.Counter&0x07)<<4
+	return append(result, m.Data...)
+}
+
+// Parse decodes a mailbox from a mailbox SyncManager buffer. Bytes after the data are ignored.
+//
+// Parameters:
+//   - data ([]byte): Content of the mailbox buffer
+//
+// Returns:
+//   - Mailbox: Decoded mailbox; its data is a copy
+//   - error: ErrShortMailbox if the buffer is shorter than the header and its length
+func Parse(data []byte) (Mailbox, error) {
+	if len(data) < HeaderLength {
+		return Mailbox{}, ErrShortMailbox
+	}
+
+	h := Header{
+		Length:   binary.LittleEndian.Uint16(data[0:2]),
+		Address:  binary.LittleEndian.Uint16(data[2:4]),
+		Channel:  data[4] & 0x3f,
+		Priority: data[4] >> 6,
+		Type:     Type(data[5] & 0x0f),
+		Counter:  (data[5] >> 4) & 0x07,
+	}
+	if len(data) < HeaderLength+int(h.Length) {
+		return Mailbox{}, ErrShortMailbox
+	}
+
+	return Mailbox{Header: h, Data: append([]byte{}, data[HeaderLength:HeaderLength+int(h.Length)]...)}, nil
+}
+
+// NextCounter returns the sequence counter following c. The counter runs from 1 to 7; 0 is reserved.
+//
+// Parameters:
+//   - c (uint8): Current counter
+//
+// Returns:
+//   - uint8: Next counter
+func NextCounter(c uint8) uint8 {
+	if c >= 7 {
+		return 1
+	}
+	return c + 1
+}
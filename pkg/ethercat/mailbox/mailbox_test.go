@@ -0,0 +1,75 @@
+package mailbox_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/Aruminium/goecat/pkg/ethercat/mailbox"
+)
+
+func TestMailboxBytesAndParse(t *testing.T) {
+	// given
+	m := mailbox.New(mailbox.CoE, 3, []byte{0x00, 0x20, 0x40, 0x18, 0x10, 0x01})
+	m.Priority = 1
+
+	// when
+	data := m.Bytes()
+	parsed, err := mailbox.Parse(append(data, 0, 0, 0))
+
+	// then
+	expected := []byte{0x06, 0x00, 0x00, 0x00, 0x40, 0x33, 0x00, 0x20, 0x40, 0x18, 0x10, 0x01}
+	if !reflect.DeepEqual(data, expected) {
+		t.Errorf("Expected % x, but got % x", expected, data)
+	}
+	if err != nil || !reflect.DeepEqual(parsed, m) {
+		t.Errorf("Expected %v, but got %v (%v)", m, parsed, err)
+	}
+}
+
+func TestParseShortMailbox(t *testing.T) {
+	// given
+	data := []byte{0x08, 0x00, 0x00, 0x00, 0x00, 0x03, 0x00, 0x20}
+
+	// when
+	_, err := mailbox.Parse(data)
+
+	// then
+	if !errors.Is(err, mailbox.ErrShortMailbox) {
+		t.Errorf("Expected %v, but got %v", mailbox.ErrShortMailbox, err)
+	}
+}
+
+func TestErrorReply(t *testing.T) {
+	// given
+	m := mailbox.NewError(mailbox.ErrUnsupportedProtocol)
+
+	// when
+	parsed, _ := mailbox.Parse(m.Bytes())
+
+	// then
+	if !errors.Is(parsed.Err(), mailbox.ErrUnsupportedProtocol) {
+		t.Errorf("Expected %v, but got %v", mailbox.ErrUnsupportedProtocol, parsed.Err())
+	}
+	if mailbox.New(mailbox.CoE, 1, nil).Err() != nil {
+		t.Errorf("Expected no error for a CoE mailbox")
+	}
+}
+
+func TestNextCounter(t *testing.T) {
+	// given
+	counter := uint8(0)
+	var counters []uint8
+
+	// when
+	for i := 0; i < 8; i++ {
+		counter = mailbox.NextCounter(counter)
+		counters = append(counters, counter)
+	}
+
+	// then
+	expected := []uint8{1, 2, 3, 4, 5, 6, 7, 1}
+	if !reflect.DeepEqual(counters, expected) {
+		t.Errorf("Expected %v, but got %v", expected, counters)
+	}
+}
@@ -2,6 +2,8 @@ package fmmu
 
 import (
 	"encoding/binary"
+
+	"github.com/Aruminium/goecat/pkg/ethercat/register"
 )
 
 type FMMU struct {
@@ -17,25 +19,22 @@ type FMMU struct {
 }
 
 func (f FMMU) Bytes() []byte {
-	result := make([]byte, 0)
-
-	logStartBits := make([]byte, 4)
-	binary.LittleEndian.PutUint32(logStartBits, f.LogStart)
-	result = append(result, logStartBits...)
-
-	logLengthBits := make([]byte, 2)
-	binary.LittleEndian.PutUint16(logLengthBits, f.LogLength)
-	result = append(result, logLengthBits...)
-
-	result = append(result, f.LogStartBit)
-
-	result = append(result, f.LogEndBit)
-
-	physStartBits := make([]byte, 2)
-	binary.LittleEndian.PutUint16(physStartBits, f.PhysStart)
-	result = append(result, physStartBits...)
+	return f.AppendTo(make([]byte, 0, register.FMMULength))
+}
 
-	result = append(result, f.PhysStartBit)
+// AppendTo appends the 16-byte register representation of the FMMU to dst.
+//
+// Parameters:
+//   - dst ([]byte): Buffer to append to
+//
+// Returns:
+//   - []byte: The extended buffer
+func (f FMMU) AppendTo(dst []byte) []byte {
+	dst = binary.LittleEndian.AppendUint32(dst, f.LogStart)
+	dst = binary.LittleEndian.AppendUint16(dst, f.LogLength)
+	dst = append(dst, f.LogStartBit, f.LogEndBit)
+	dst = binary.LittleEndian.AppendUint16(dst, f.PhysStart)
+	dst = append(dst, f.PhysStartBit)
 
 	typeBits := uint8(0)
 	if f.AbleUseRead {
@@ -44,16 +43,20 @@ func (f FMMU) Bytes() []byte {
 	if f.AbleUseWrite {
 		typeBits |= 0b10
 	}
-	result = append(result, typeBits)
 
 	activateBits := uint8(0)
 	if f.IsActivate {
 		activateBits |= 0b1
 	}
-	result = append(result, activateBits)
 
 	// The length of the DataGram should be 16 bytes, so padding is required.
-	result = append(result, []byte{0, 0, 0}...)
+	return append(dst, typeBits, activateBits, 0, 0, 0)
+}
 
-	return result
+// Len returns the length of the register representation of the FMMU.
+//
+// Returns:
+//   - int: register.FMMULength
+func (f FMMU) Len() int {
+	return int(register.FMMULength)
 }
@@ -28,9 +28,10 @@ func TestFMMUBytes(t *testing.T) {
 		0x00,       // LogStartBit
 		0x07,       // LogEndBit
 		0x00, 0x12, // PhysStart
-		0x00, // PhysStartBit
-		0x01, // Use Type
-		0x01, // Activate
+		0x00,             // PhysStartBit
+		0x01,             // Use Type
+		0x01,             // Activate
+		0x00, 0x00, 0x00, // Reserved
 	}
 	result := fmmu.Bytes()
 
@@ -39,3 +40,18 @@ func TestFMMUBytes(t *testing.T) {
 		t.Errorf("Expected %v, but got %v", expected, result)
 	}
 }
+
+func TestFMMUAppendTo(t *testing.T) {
+	// given
+	f := fmmu.FMMU{LogStart: 0x00010000, LogLength: 2, LogEndBit: 7, PhysStart: 0x1100, AbleUseWrite: true, IsActivate: true}
+	dst := []byte{0xaa}
+
+	// when
+	result := f.AppendTo(dst)
+
+	// then
+	expected := append([]byte{0xaa}, f.Bytes()...)
+	if !reflect.DeepEqual(result, expected) || f.Len() != len(f.Bytes()) {
+		t.Errorf("Expected %v of length %d, but got %v", expected, f.Len(), result)
+	}
+}
@@ -7,6 +7,44 @@ type MarshalerByte interface {
 	Bytes() []byte
 }
 
+// Appender is implemented by payloads that can encode themselves without allocating.
+type Appender interface {
+	// AppendTo appends the byte representation of the implementing type to dst.
+	AppendTo(dst []byte) []byte
+	// Len returns the number of bytes AppendTo appends.
+	Len() int
+}
+
+// Append appends the byte representation of m to dst.
+// Payloads implementing Appender are encoded in place, others through Bytes.
+//
+// Parameters:
+//   - dst ([]byte): Buffer to append to
+//   - m (MarshalerByte): Payload to encode
+//
+// Returns:
+//   - []byte: The extended buffer
+func Append(dst []byte, m MarshalerByte) []byte {
+	if a, ok := m.(Appender); ok {
+		return a.AppendTo(dst)
+	}
+	return append(dst, m.Bytes()...)
+}
+
+// Len returns the length of the byte representation of m without encoding it when m implements Appender.
+//
+// Parameters:
+//   - m (MarshalerByte): Payload to measure
+//
+// Returns:
+//   - int: Number of bytes of the payload
+func Len(m MarshalerByte) int {
+	if a, ok := m.(Appender); ok {
+		return a.Len()
+	}
+	return len(m.Bytes())
+}
+
 // BasicPayload is a simple implementation of the MarshalerByte interface.
 type BasicPayload struct {
 	// Data holds the byte data of the payload.
@@ -18,3 +56,15 @@ type BasicPayload struct {
 func (p BasicPayload) Bytes() []byte {
 	return p.Data
 }
+
+// AppendTo appends Data to dst.
+// It implements the AppendTo method of the Appender interface.
+func (p BasicPayload) AppendTo(dst []byte) []byte {
+	return append(dst, p.Data...)
+}
+
+// Len returns the length of Data.
+// It implements the Len method of the Appender interface.
+func (p BasicPayload) Len() int {
+	return len(p.Data)
+}
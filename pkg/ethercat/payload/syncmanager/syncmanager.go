@@ -1,6 +1,10 @@
 package syncmanager
 
-import "encoding/binary"
+import (
+	"encoding/binary"
+
+	"github.com/Aruminium/goecat/pkg/ethercat/register"
+)
 
 // SyncManager represents a synchronization manager with start, length, control status, and enable fields.
 type SyncManager struct {
@@ -16,25 +20,29 @@ type SyncManager struct {
 // Returns:
 //   - []byte: The byte representation of the SyncManager.
 func (s SyncManager) Bytes() []byte {
-	result := make([]byte, 0)
-
-	startBytes := make([]byte, 2)
-	binary.LittleEndian.PutUint16(startBytes, s.Start)
-	result = append(result, startBytes...)
-
-	lengthBytes := make([]byte, 2)
-	binary.LittleEndian.PutUint16(lengthBytes, s.Length)
-	result = append(result, lengthBytes...)
-
-	ctrlStatusBytes := make([]byte, 2)
-	binary.LittleEndian.PutUint16(ctrlStatusBytes, s.CtrlStatus.ToUint16())
-	result = append(result, ctrlStatusBytes...)
+	return s.AppendTo(make([]byte, 0, register.SMLength))
+}
 
-	enableBytes := make([]byte, 2)
-	binary.LittleEndian.PutUint16(enableBytes, s.Enable.ToUint16())
-	result = append(result, enableBytes...)
+// AppendTo appends the 8-byte register representation of the SyncManager to dst.
+//
+// Parameters:
+//   - dst ([]byte): Buffer to append to
+//
+// Returns:
+//   - []byte: The extended buffer
+func (s SyncManager) AppendTo(dst []byte) []byte {
+	dst = binary.LittleEndian.AppendUint16(dst, s.Start)
+	dst = binary.LittleEndian.AppendUint16(dst, s.Length)
+	dst = binary.LittleEndian.AppendUint16(dst, s.CtrlStatus.ToUint16())
+	return binary.LittleEndian.AppendUint16(dst, s.Enable.ToUint16())
+}
 
-	return result
+// Len returns the length of the register representation of the SyncManager.
+//
+// Returns:
+//   - int: register.SMLength
+func (s SyncManager) Len() int {
+	return int(register.SMLength)
 }
 
 // CtrlStatus represents the control status with various bit fields.
@@ -0,0 +1,191 @@
+// Package register defines the addresses of the EtherCAT Slave Controller (ESC) registers.
+package register
+
+import "fmt"
+
+const (
+	Type           uint16 = 0x0000 // ESC type
+	Revision       uint16 = 0x0001 // ESC revision
+	Build          uint16 = 0x0002 // ESC build (2 bytes)
+	FMMUsSupported uint16 = 0x0004 // Number of supported FMMU channels
+	SMsSupported   uint16 = 0x0005 // Number of supported SyncManager channels
+	RAMSize        uint16 = 0x0006 // Process data RAM size in KByte
+	PortDescriptor uint16 = 0x0007 // Port configuration, 2 bits per port
+	ESCFeatures    uint16 = 0x0008 // ESC features supported (2 bytes)
+
+	StationAddress uint16 = 0x0010 // Configured station address (2 bytes)
+	StationAlias   uint16 = 0x0012 // Configured station alias (2 bytes)
+
+	DLControl uint16 = 0x0100 // ESC DL control (4 bytes)
+	DLStatus  uint16 = 0x0110 // ESC DL status (2 bytes)
+
+	ALControl    uint16 = 0x0120 // AL control (2 bytes)
+	ALStatus     uint16 = 0x0130 // AL status (2 bytes)
+	ALStatusCode uint16 = 0x0134 // AL status code (2 bytes)
+
+	PDIControl       uint16 = 0x0140 // PDI control
+	ESCConfiguration uint16 = 0x0141 // ESC configuration
+
+	ECATEventMask    uint16 = 0x0200 // ECAT event mask (2 bytes)
+	ECATEventRequest uint16 = 0x0210 // ECAT event request (2 bytes)
+
+	RXErrorCounter            uint16 = 0x0300 // RX error counter, 2 bytes per port (0x0300-0x0307)
+	ForwardedRXErrorCounter   uint16 = 0x0308 // Forwarded RX error counter, 1 byte per port (0x0308-0x030B)
+	ECATProcessingUnitErrors  uint16 = 0x030C // ECAT processing unit error counter
+	PDIErrorCounter           uint16 = 0x030D // PDI error counter
+	LostLinkCounter           uint16 = 0x0310 // Lost link counter, 1 byte per port (0x0310-0x0313)
+	WatchdogDivider           uint16 = 0x0400 // Watchdog divider (2 bytes)
+	WatchdogTimePDI           uint16 = 0x0410 // Watchdog time PDI (2 bytes)
+	WatchdogTimeProcessData   uint16 = 0x0420 // Watchdog time process data (2 bytes)
+	WatchdogStatusProcessData uint16 = 0x0440 // Watchdog status process data (2 bytes)
+	WatchdogCounterProcess    uint16 = 0x0442 // Watchdog counter process data
+	WatchdogCounterPDI        uint16 = 0x0443 // Watchdog counter PDI
+
+	SIIConfig  uint16 = 0x0500 // SII EEPROM configuration
+	SIIPDI     uint16 = 0x0501 // SII EEPROM PDI access state
+	SIIControl uint16 = 0x0502 // SII EEPROM control/status (2 bytes)
+	SIIAddress uint16 = 0x0504 // SII EEPROM word address (4 bytes)
+	SIIData    uint16 = 0x0508 // SII EEPROM data (4 or 8 bytes)
+
+	FMMU0      uint16 = 0x0600 // First FMMU channel
+	FMMULength uint16 = 16     // Size of one FMMU channel
+	SM0        uint16 = 0x0800 // First SyncManager channel
+	SMLength   uint16 = 8      // Size of one SyncManager channel
+
+	DCReceiveTime0      uint16 = 0x0900 // Receive time port 0 (4 bytes)
+	DCSystemTime        uint16 = 0x0910 // System time (8 bytes)
+	DCSystemTimeOffset  uint16 = 0x0920 // System time offset (8 bytes)
+	DCSystemTimeDelay   uint16 = 0x0928 // System time delay (4 bytes)
+	DCSystemTimeDiff    uint16 = 0x092C // System time difference (4 bytes)
+	DCCyclicUnitControl uint16 = 0x0980 // Cyclic unit control
+	DCActivation        uint16 = 0x0981 // DC activation
+	DCStartTime         uint16 = 0x0990 // Start time of the cyclic operation (8 bytes)
+	DCSync0CycleTime    uint16 = 0x09A0 // SYNC0 cycle time (4 bytes)
+	DCSync1CycleTime    uint16 = 0x09A4 // SYNC1 cycle time (4 bytes)
+
+	ProcessDataRAM uint16 = 0x1000 // Start of the process data RAM
+)
+
+// FMMU returns the address of the n-th FMMU channel.
+func FMMU(n int) uint16 {
+	return FMMU0 + uint16(n)*FMMULength
+}
+
+// SM returns the address of the n-th SyncManager channel.
+func SM(n int) uint16 {
+	return SM0 + uint16(n)*SMLength
+}
+
+// IsRegister reports whether address lies in the register area rather than the process data RAM.
+func IsRegister(address uint16) bool {
+	return address < ProcessDataRAM
+}
+
+// names maps the registers above to their names as used in the ESC documentation.
+var names = map[uint16]string{
+	Type:           "Type",
+	Revision:       "Revision",
+	Build:          "Build",
+	FMMUsSupported: "FMMUs Supported",
+	SMsSupported:   "SyncManagers Supported",
+	RAMSize:        "RAM Size",
+	PortDescriptor: "Port Descriptor",
+	ESCFeatures:    "ESC Features",
+
+	StationAddress: "Station Address",
+	StationAlias:   "Station Alias",
+
+	DLControl: "DL Control",
+	DLStatus:  "DL Status",
+
+	ALControl:    "AL Control",
+	ALStatus:     "AL Status",
+	ALStatusCode: "AL Status Code",
+
+	PDIControl:       "PDI Control",
+	ESCConfiguration: "ESC Configuration",
+
+	ECATEventMask:    "ECAT Event Mask",
+	ECATEventRequest: "ECAT Event Request",
+
+	RXErrorCounter:            "RX Error Counter",
+	ForwardedRXErrorCounter:   "Forwarded RX Error Counter",
+	ECATProcessingUnitErrors:  "ECAT Processing Unit Error Counter",
+	PDIErrorCounter:           "PDI Error Counter",
+	LostLinkCounter:           "Lost Link Counter",
+	WatchdogDivider:           "Watchdog Divider",
+	WatchdogTimePDI:           "Watchdog Time PDI",
+	WatchdogTimeProcessData:   "Watchdog Time Process Data",
+	WatchdogStatusProcessData: "Watchdog Status Process Data",
+	WatchdogCounterProcess:    "Watchdog Counter Process Data",
+	WatchdogCounterPDI:        "Watchdog Counter PDI",
+
+	SIIConfig:  "SII Configuration",
+	SIIPDI:     "SII PDI Access",
+	SIIControl: "SII Control/Status",
+	SIIAddress: "SII Address",
+	SIIData:    "SII Data",
+
+	DCReceiveTime0:     "DC Receive Time Port 0",
+	DCSystemTime:       "DC System Time",
+	DCSystemTimeOffset: "DC System Time Offset",
+	DCSystemTimeDelay:  "DC System Time Delay",
+	DCSystemTimeDiff:   "DC System Time Difference",
+	DCActivation:       "DC Activation",
+	DCSync0CycleTime:   "DC SYNC0 Cycle Time",
+}
+
+// fmmuFields and smFields name the fields of an FMMU and a SyncManager channel by their offset.
+var (
+	fmmuFields = map[uint16]string{
+		0x0: "Logical Start",
+		0x4: "Length",
+		0x6: "Logical Start Bit",
+		0x7: "Logical Stop Bit",
+		0x8: "Physical Start",
+		0xA: "Physical Start Bit",
+		0xB: "Type",
+		0xC: "Activate",
+	}
+	smFields = map[uint16]string{
+		0x0: "Start",
+		0x2: "Length",
+		0x4: "Control",
+		0x5: "Status",
+		0x6: "Activate",
+		0x7: "PDI Control",
+	}
+)
+
+// Name returns the name of the register starting at address, such as "AL Control" for 0x0120
+// or "SM1 Status" for 0x080D. A channel address of an FMMU or SyncManager is named after the
+// channel alone, such as "FMMU0" for 0x0600.
+//
+// Parameters:
+//   - address (uint16): Register address
+//
+// Returns:
+//   - string: Name of the register, empty if no register starts at address
+func Name(address uint16) string {
+	if name, ok := names[address]; ok {
+		return name
+	}
+
+	switch {
+	case address >= FMMU0 && address < FMMU(16):
+		n, offset := (address-FMMU0)/FMMULength, (address-FMMU0)%FMMULength
+		if offset == 0 {
+			return fmt.Sprintf("FMMU%d", n)
+		}
+		if field, ok := fmmuFields[offset]; ok {
+			return fmt.Sprintf("FMMU%d %s", n, field)
+		}
+	case address >= SM0 && address < SM(32):
+		n, offset := (address-SM0)/SMLength, (address-SM0)%SMLength
+		if offset == 0 {
+			return fmt.Sprintf("SM%d", n)
+		}
+		return fmt.Sprintf("SM%d %s", n, smFields[offset])
+	}
+	return ""
+}
@@ -0,0 +1,396 @@
+package sii
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// ErrShortCategory is returned when the data of a category is shorter than its structure.
+var ErrShortCategory = errors.New("sii: category is too short")
+
+// Strings is the Strings category. Other categories refer to its strings by a 1-based index.
+type Strings []string
+
+// ParseStrings decodes the Strings category.
+//
+// Parameters:
+//   - data ([]byte): Data of the category
+//
+// Returns:
+//   - Strings: Strings in the order of their indices
+//   - error: Error if a string exceeds the category
+func ParseStrings(data []byte) (Strings, error) {
+	if len(data) < 1 {
+		return nil, ErrShortCategory
+	}
+
+	count, offset := int(data[0]), 1
+	result := make(Strings, 0, count)
+	for i := 0; i < count; i++ {
+		if offset >= len(data) || offset+1+int(data[offset]) > len(data) {
+			return nil, fmt.Errorf("%w: string %d exceeds the category", ErrShortCategory, i+1)
+		}
+		length := int(data[offset])
+		result = append(result, string(data[offset+1:offset+1+length]))
+		offset += 1 + length
+	}
+	return result, nil
+}
+
+// Get returns the string with a 1-based index, or an empty string for index 0 or an unknown index.
+func (s Strings) Get(index uint8) string {
+	if index == 0 || int(index) > len(s) {
+		return ""
+	}
+	return s[index-1]
+}
+
+// Category encodes the strings into a Strings category.
+func (s Strings) Category() Category {
+	data := []byte{uint8(len(s))}
+	for _, str := range s {
+		data = append(append(data, uint8(len(str))), str...)
+	}
+	return Category{Type: CategoryStrings, Data: data}
+}
+
+// generalLength is the size of the General category.
+const generalLength = 32
+
+// General is the General category; the string fields are indices into Strings.
+type General struct {
+	GroupIdx      uint8
+	ImageIdx      uint8
+	OrderIdx      uint8
+	NameIdx       uint8
+	CoEDetails    uint8 // Bit 0: SDO, 1: SDO information, 2: PDO assign, 3: PDO configuration, 4: startup upload, 5: complete access
+	FoEDetails    uint8 // Bit 0: FoE supported
+	EoEDetails    uint8 // Bit 0: EoE supported
+	Flags         uint8 // Bit 0: enable SAFEOP, 1: enable not LRW, 2: mailbox data link layer, 3: identity in AL status code
+	CurrentOnEBus int16 // mA, negative if the slave feeds the E-Bus
+	PhysicalPort  uint16
+}
+
+// ParseGeneral decodes the General category.
+//
+// Parameters:
+//   - data ([]byte): Data of the category
+//
+// Returns:
+//   - General: Decoded category
+//   - error: Error if data is too short
+func ParseGeneral(data []byte) (General, error) {
+	if len(data) < 16 {
+		return General{}, ErrShortCategory
+	}
+	return General{
+		GroupIdx:      data[0],
+		ImageIdx:      data[1],
+		OrderIdx:      data[2],
+		NameIdx:       data[3],
+		CoEDetails:    data[5],
+		FoEDetails:    data[6],
+		EoEDetails:    data[7],
+		Flags:         data[11],
+		CurrentOnEBus: int16(binary.LittleEndian.Uint16(data[12:])),
+		PhysicalPort:  binary.LittleEndian.Uint16(data[14:]),
+	}, nil
+}
+
+// Category encodes the General category.
+func (g General) Category() Category {
+	data := make([]byte, generalLength)
+	data[0], data[1], data[2], data[3] = g.GroupIdx, g.ImageIdx, g.OrderIdx, g.NameIdx
+	data[5], data[6], data[7] = g.CoEDetails, g.FoEDetails, g.EoEDetails
+	data[11] = g.Flags
+	binary.LittleEndian.PutUint16(data[12:], uint16(g.CurrentOnEBus))
+	binary.LittleEndian.PutUint16(data[14:], g.PhysicalPort)
+	data[16] = g.GroupIdx
+	return Category{Type: CategoryGeneral, Data: data}
+}
+
+// FMMUUsage is what an FMMU is used for, one per FMMU in the FMMU category.
+type FMMUUsage uint8
+
+const (
+	FMMUUnused      FMMUUsage = 0x00
+	FMMUOutputs     FMMUUsage = 0x01
+	FMMUInputs      FMMUUsage = 0x02
+	FMMUSyncMStatus FMMUUsage = 0x03
+)
+
+// String returns the name of the usage as written in ESI files.
+func (u FMMUUsage) String() string {
+	switch u {
+	case FMMUUnused:
+		return "Unused"
+	case FMMUOutputs:
+		return "Outputs"
+	case FMMUInputs:
+		return "Inputs"
+	case FMMUSyncMStatus:
+		return "MBoxState"
+	default:
+		return fmt.Sprintf("FMMUUsage(%d)", uint8(u))
+	}
+}
+
+// ParseFMMUs decodes the FMMU category. A trailing padding byte of 0xff is dropped.
+//
+// Parameters:
+//   - data ([]byte): Data of the category
+//
+// Returns:
+//   - []FMMUUsage: Usage of every FMMU
+func ParseFMMUs(data []byte) []FMMUUsage {
+	result := make([]FMMUUsage, 0, len(data))
+	for _, b := range data {
+		if b == 0xff {
+			break
+		}
+		result = append(result, FMMUUsage(b))
+	}
+	return result
+}
+
+// SyncManagerType is what a SyncManager is used for.
+type SyncManagerType uint8
+
+const (
+	SMUnused     SyncManagerType = 0x00
+	SMMailboxOut SyncManagerType = 0x01 // Receive mailbox, master to slave
+	SMMailboxIn  SyncManagerType = 0x02 // Send mailbox, slave to master
+	SMOutputs    SyncManagerType = 0x03
+	SMInputs     SyncManagerType = 0x04
+)
+
+// String returns the name of the type as written in ESI files.
+func (t SyncManagerType) String() string {
+	switch t {
+	case SMUnused:
+		return "Unused"
+	case SMMailboxOut:
+		return "MBoxOut"
+	case SMMailboxIn:
+		return "MBoxIn"
+	case SMOutputs:
+		return "Outputs"
+	case SMInputs:
+		return "Inputs"
+	default:
+		return fmt.Sprintf("SyncManagerType(%d)", uint8(t))
+	}
+}
+
+// syncManagerLength is the size of one SyncManager in the SyncM category.
+const syncManagerLength = 8
+
+// SyncManager is the default configuration of a SyncManager from the SyncM category.
+type SyncManager struct {
+	Start   uint16
+	Length  uint16
+	Control uint8
+	Status  uint8
+	Enable  uint8
+	Type    SyncManagerType
+}
+
+// ParseSyncManagers decodes the SyncM category.
+//
+// Parameters:
+//   - data ([]byte): Data of the category
+//
+// Returns:
+//   - []SyncManager: SyncManagers in the order of their numbers
+//   - error: Error if data is not a multiple of the SyncManager size
+func ParseSyncManagers(data []byte) ([]SyncManager, error) {
+	if len(data)%syncManagerLength != 0 {
+		return nil, ErrShortCategory
+	}
+
+	result := make([]SyncManager, 0, len(data)/syncManagerLength)
+	for offset := 0; offset < len(data); offset += syncManagerLength {
+		sm := data[offset : offset+syncManagerLength]
+		result = append(result, SyncManager{
+			Start:   binary.LittleEndian.Uint16(sm[0:]),
+			Length:  binary.LittleEndian.Uint16(sm[2:]),
+			Control: sm[4],
+			Status:  sm[5],
+			Enable:  sm[6],
+			Type:    SyncManagerType(sm[7]),
+		})
+	}
+	return result, nil
+}
+
+// SyncManagersCategory encodes a SyncM category.
+//
+// Parameters:
+//   - sms (...SyncManager): SyncManagers in the order of their numbers
+//
+// Returns:
+//   - Category: SyncM category
+func SyncManagersCategory(sms ...SyncManager) Category {
+	data := make([]byte, 0, len(sms)*syncManagerLength)
+	for _, sm := range sms {
+		data = binary.LittleEndian.AppendUint16(data, sm.Start)
+		data = binary.LittleEndian.AppendUint16(data, sm.Length)
+		data = append(data, sm.Control, sm.Status, sm.Enable, uint8(sm.Type))
+	}
+	return Category{Type: CategorySyncM, Data: data}
+}
+
+// Sizes of the structures of the TxPDO and RxPDO categories.
+const (
+	pdoLength      = 8
+	pdoEntryLength = 8
+)
+
+// PDO is a PDO of the TxPDO or RxPDO category.
+type PDO struct {
+	Index           uint16
+	SyncManager     uint8 // SyncManager the PDO is assigned to by default
+	Synchronization uint8
+	NameIdx         uint8
+	Flags           uint16
+	Entries         []PDOEntry
+}
+
+// PDOEntry is an object mapped into a PDO. An entry with index 0 is a gap.
+type PDOEntry struct {
+	Index     uint16
+	SubIndex  uint8
+	NameIdx   uint8
+	DataType  uint8
+	BitLength uint8
+	Flags     uint16
+}
+
+// ParsePDOs decodes the TxPDO or RxPDO category.
+//
+// Parameters:
+//   - data ([]byte): Data of the category
+//
+// Returns:
+//   - []PDO: PDOs with their entries
+//   - error: Error if a PDO exceeds the category
+func ParsePDOs(data []byte) ([]PDO, error) {
+	var result []PDO
+	for offset := 0; offset+pdoLength <= len(data); {
+		header := data[offset : offset+pdoLength]
+		pdo := PDO{
+			Index:           binary.LittleEndian.Uint16(header[0:]),
+			SyncManager:     header[3],
+			Synchronization: header[4],
+			NameIdx:         header[5],
+			Flags:           binary.LittleEndian.Uint16(header[6:]),
+		}
+		count := int(header[2])
+		offset += pdoLength
+
+		if offset+count*pdoEntryLength > len(data) {
+			return nil, fmt.Errorf("%w: PDO 0x%04x exceeds the category", ErrShortCategory, pdo.Index)
+		}
+		for i := 0; i < count; i++ {
+			entry := data[offset : offset+pdoEntryLength]
+			pdo.Entries = append(pdo.Entries, PDOEntry{
+				Index:     binary.LittleEndian.Uint16(entry[0:]),
+				SubIndex:  entry[2],
+				NameIdx:   entry[3],
+				DataType:  entry[4],
+				BitLength: entry[5],
+				Flags:     binary.LittleEndian.Uint16(entry[6:]),
+			})
+			offset += pdoEntryLength
+		}
+		result = append(result, pdo)
+	}
+	return result, nil
+}
+
+// PDOsCategory encodes a TxPDO or RxPDO category.
+//
+// Parameters:
+//   - t (CategoryType): CategoryTxPDO or CategoryRxPDO
+//   - pdos (...PDO): PDOs with their entries
+//
+// Returns:
+//   - Category: PDO category
+func PDOsCategory(t CategoryType, pdos ...PDO) Category {
+	var data []byte
+	for _, pdo := range pdos {
+		data = binary.LittleEndian.AppendUint16(data, pdo.Index)
+		data = append(data, uint8(len(pdo.Entries)), pdo.SyncManager, pdo.Synchronization, pdo.NameIdx)
+		data = binary.LittleEndian.AppendUint16(data, pdo.Flags)
+		for _, e := range pdo.Entries {
+			data = binary.LittleEndian.AppendUint16(data, e.Index)
+			data = append(data, e.SubIndex, e.NameIdx, e.DataType, e.BitLength)
+			data = binary.LittleEndian.AppendUint16(data, e.Flags)
+		}
+	}
+	return Category{Type: t, Data: data}
+}
+
+// Image is a complete EEPROM image with its categories decoded.
+type Image struct {
+	Info
+	Strings      Strings
+	General      *General // Nil if the image has no General category
+	FMMUs        []FMMUUsage
+	SyncManagers []SyncManager
+	TxPDOs       []PDO
+	RxPDOs       []PDO
+	Categories   []Category // All categories, including those that are not decoded
+}
+
+// ParseImage decodes the fixed information area and the known categories of an EEPROM image.
+//
+// Parameters:
+//   - image ([]byte): EEPROM image
+//
+// Returns:
+//   - Image: Decoded image
+//   - error: Error if the fixed area or a known category is malformed
+func ParseImage(image []byte) (Image, error) {
+	info, err := Decode(image)
+	if err != nil {
+		return Image{}, err
+	}
+	categories, err := Categories(image)
+	if err != nil {
+		return Image{}, err
+	}
+
+	result := Image{Info: info, Categories: categories}
+	for _, c := range categories {
+		switch c.Type {
+		case CategoryStrings:
+			result.Strings, err = ParseStrings(c.Data)
+		case CategoryGeneral:
+			var g General
+			g, err = ParseGeneral(c.Data)
+			result.General = &g
+		case CategoryFMMU:
+			result.FMMUs = ParseFMMUs(c.Data)
+		case CategorySyncM:
+			result.SyncManagers, err = ParseSyncManagers(c.Data)
+		case CategoryTxPDO:
+			result.TxPDOs, err = ParsePDOs(c.Data)
+		case CategoryRxPDO:
+			result.RxPDOs, err = ParsePDOs(c.Data)
+		}
+		if err != nil {
+			return Image{}, err
+		}
+	}
+	return result, nil
+}
+
+// Name returns the device name from the General category, or an empty string.
+func (i Image) Name() string {
+	if i.General == nil {
+		return ""
+	}
+	return i.Strings.Get(i.General.NameIdx)
+}
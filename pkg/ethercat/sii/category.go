@@ -0,0 +1,67 @@
+package sii
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// CategoryType identifies a category after the fixed information area.
+type CategoryType uint16
+
+const (
+	CategoryStrings   CategoryType = 10
+	CategoryDataTypes CategoryType = 20
+	CategoryGeneral   CategoryType = 30
+	CategoryFMMU      CategoryType = 40
+	CategorySyncM     CategoryType = 41
+	CategoryTxPDO     CategoryType = 50
+	CategoryRxPDO     CategoryType = 51
+	CategoryDC        CategoryType = 60
+	CategoryEnd       CategoryType = 0xffff
+)
+
+// Category is a typed block of data after the fixed information area.
+type Category struct {
+	Type CategoryType
+	Data []byte // Padded to an even length when encoded
+}
+
+// append appends the encoded category to image.
+func (c Category) append(image []byte) []byte {
+	data := c.Data
+	if len(data)%2 != 0 {
+		data = append(append([]byte{}, data...), 0)
+	}
+
+	header := make([]byte, 4)
+	binary.LittleEndian.PutUint16(header, uint16(c.Type))
+	binary.LittleEndian.PutUint16(header[2:], uint16(len(data)/2))
+	return append(append(image, header...), data...)
+}
+
+// Categories reads the categories of an EEPROM image up to the End category.
+//
+// Parameters:
+//   - image ([]byte): EEPROM image
+//
+// Returns:
+//   - []Category: Categories without the End category
+//   - error: Error if a category exceeds the image
+func Categories(image []byte) ([]Category, error) {
+	result := []Category{}
+	offset := fixedAreaInWords * 2
+	for offset+4 <= len(image) {
+		t := CategoryType(binary.LittleEndian.Uint16(image[offset:]))
+		size := int(binary.LittleEndian.Uint16(image[offset+2:])) * 2
+		if t == CategoryEnd {
+			return result, nil
+		}
+		offset += 4
+		if offset+size > len(image) {
+			return nil, errors.New("SII category exceeds the image")
+		}
+		result = append(result, Category{Type: t, Data: image[offset : offset+size]})
+		offset += size
+	}
+	return result, nil
+}
@@ -0,0 +1,276 @@
+package sii
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Aruminium/goecat/pkg/ethercat/datagram"
+	"github.com/Aruminium/goecat/pkg/ethercat/payload"
+	"github.com/Aruminium/goecat/pkg/ethercat/register"
+	"github.com/Aruminium/goecat/pkg/transceiver"
+)
+
+// DefaultPollInterval is how often an EEPROM polls the busy flag of SII Control.
+const DefaultPollInterval = time.Millisecond
+
+// MaxImageSize limits the image ReadImage reads when the End category is missing.
+const MaxImageSize = 0x8000
+
+// SII Control/Status bits (0x0502).
+const (
+	controlWriteEnable uint16 = 0x0001
+	controlRead        uint16 = 0x0100
+	controlWrite       uint16 = 0x0200
+	controlReload      uint16 = 0x0400
+	statusErrors       uint16 = 0x7800 // Checksum, device info, command and write enable errors
+	statusBusy         uint16 = 0x8000
+)
+
+var (
+	// ErrNoResponse is returned when the addressed slave does not answer.
+	ErrNoResponse = errors.New("sii: slave did not respond")
+	// ErrCommand is returned when the ESC reports an error for an EEPROM command.
+	ErrCommand = errors.New("sii: EEPROM command failed")
+)
+
+// EEPROM reads and writes the SII EEPROM of one slave through its SII registers (0x0500-0x050F).
+// The EEPROM is assigned to EtherCAT before every command.
+type EEPROM struct {
+	PollInterval time.Duration // Interval for polling the busy flag, DefaultPollInterval if zero
+
+	x       transceiver.Exchanger
+	station uint16
+}
+
+// NewEEPROM creates an EEPROM accessor for a slave.
+//
+// Parameters:
+//   - x (transceiver.Exchanger): Transceiver of the segment
+//   - station (uint16): Configured station address of the slave
+//
+// Returns:
+//   - *EEPROM: New accessor
+func NewEEPROM(x transceiver.Exchanger, station uint16) *EEPROM {
+	return &EEPROM{x: x, station: station}
+}
+
+// Read reads words from the EEPROM, two words per command.
+//
+// Parameters:
+//   - ctx (context.Context): Context bounding the access
+//   - address (uint16): Word address of the first word
+//   - words (int): Number of words to read
+//
+// Returns:
+//   - []byte: The words in EEPROM byte order
+//   - error: Error if the slave does not answer or reports an error
+func (e *EEPROM) Read(ctx context.Context, address uint16, words int) ([]byte, error) {
+	if err := e.assign(ctx); err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, 0, words*2+2)
+	for n := 0; n < words; n += 2 {
+		if err := e.command(ctx, controlRead, address+uint16(n)); err != nil {
+			return nil, err
+		}
+		d, err := e.exchange(ctx, datagram.FPRD(e.station, register.SIIData, 4))
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, d.Data.Bytes()...)
+	}
+	return data[:words*2], nil
+}
+
+// Write writes words into the EEPROM, one word per command.
+//
+// Parameters:
+//   - ctx (context.Context): Context bounding the access
+//   - address (uint16): Word address of the first word
+//   - data ([]byte): Words to write in EEPROM byte order, padded with a zero byte if its length is odd
+//
+// Returns:
+//   - error: Error if the slave does not answer or reports an error
+func (e *EEPROM) Write(ctx context.Context, address uint16, data []byte) error {
+	if err := e.assign(ctx); err != nil {
+		return err
+	}
+	if len(data)%2 != 0 {
+		data = append(append([]byte{}, data...), 0)
+	}
+
+	for n := 0; n < len(data); n += 2 {
+		if _, err := e.exchange(ctx, datagram.FPWR(e.station, register.SIIData, payload.BasicPayload{Data: data[n : n+2]})); err != nil {
+			return err
+		}
+		if err := e.command(ctx, controlWrite|controlWriteEnable, address+uint16(n/2)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Reload makes the ESC reload the registers that are initialized from the EEPROM, such as
+// the station alias.
+//
+// Parameters:
+//   - ctx (context.Context): Context bounding the access
+//
+// Returns:
+//   - error: Error if the slave does not answer or reports an error
+func (e *EEPROM) Reload(ctx context.Context) error {
+	if err := e.assign(ctx); err != nil {
+		return err
+	}
+	return e.command(ctx, controlReload, 0)
+}
+
+// WriteAlias writes the configured station alias (word 4) together with the checksum of the
+// ESC configuration area, and reloads the EEPROM so that the station alias register takes it over.
+//
+// Parameters:
+//   - ctx (context.Context): Context bounding the access
+//   - alias (uint16): Station alias, 0 for none
+//
+// Returns:
+//   - error: Error if the slave does not answer or reports an error
+func (e *EEPROM) WriteAlias(ctx context.Context, alias uint16) error {
+	area, err := e.Read(ctx, 0, int(Checksum)+1)
+	if err != nil {
+		return err
+	}
+	binary.LittleEndian.PutUint16(area[StationAlias*2:], alias)
+	area[Checksum*2] = crc8(area[:Checksum*2])
+
+	if err := e.Write(ctx, StationAlias, area[StationAlias*2:StationAlias*2+2]); err != nil {
+		return err
+	}
+	if err := e.Write(ctx, Checksum, area[Checksum*2:Checksum*2+2]); err != nil {
+		return err
+	}
+	return e.Reload(ctx)
+}
+
+// ReadInfo reads and decodes the fixed information area.
+//
+// Parameters:
+//   - ctx (context.Context): Context bounding the access
+//
+// Returns:
+//   - Info: Fixed information
+//   - error: Error if the access fails or the checksum is wrong
+func (e *EEPROM) ReadInfo(ctx context.Context) (Info, error) {
+	image, err := e.Read(ctx, 0, fixedAreaInWords)
+	if err != nil {
+		return Info{}, err
+	}
+	return Decode(image)
+}
+
+// ReadImage reads the fixed information area and the categories up to the End category.
+//
+// Parameters:
+//   - ctx (context.Context): Context bounding the access
+//
+// Returns:
+//   - []byte: EEPROM image including the End category
+//   - error: Error if the access fails
+func (e *EEPROM) ReadImage(ctx context.Context) ([]byte, error) {
+	image, err := e.Read(ctx, 0, fixedAreaInWords)
+	if err != nil {
+		return nil, err
+	}
+
+	for len(image) < MaxImageSize {
+		header, err := e.Read(ctx, uint16(len(image)/2), 2)
+		if err != nil {
+			return nil, err
+		}
+		image = append(image, header...)
+		if CategoryType(binary.LittleEndian.Uint16(header)) == CategoryEnd {
+			return image, nil
+		}
+
+		size := int(binary.LittleEndian.Uint16(header[2:]))
+		data, err := e.Read(ctx, uint16(len(image)/2), size)
+		if err != nil {
+			return nil, err
+		}
+		image = append(image, data...)
+	}
+	return image, nil
+}
+
+// assign hands the EEPROM to EtherCAT, which takes it away from the PDI.
+func (e *EEPROM) assign(ctx context.Context) error {
+	_, err := e.exchange(ctx, datagram.FPWR(e.station, register.SIIConfig, payload.BasicPayload{Data: []byte{0x00}}))
+	return err
+}
+
+// command starts an EEPROM command at a word address and waits until it is done.
+func (e *EEPROM) command(ctx context.Context, command uint16, address uint16) error {
+	if _, err := e.idle(ctx); err != nil {
+		return err
+	}
+
+	addr := binary.LittleEndian.AppendUint32(nil, uint32(address))
+	if _, err := e.exchange(ctx, datagram.FPWR(e.station, register.SIIAddress, payload.BasicPayload{Data: addr})); err != nil {
+		return err
+	}
+	control := binary.LittleEndian.AppendUint16(nil, command)
+	if _, err := e.exchange(ctx, datagram.FPWR(e.station, register.SIIControl, payload.BasicPayload{Data: control})); err != nil {
+		return err
+	}
+
+	status, err := e.idle(ctx)
+	if err != nil {
+		return err
+	}
+	if status&statusErrors != 0 {
+		return fmt.Errorf("%w: status 0x%04x at word 0x%04x", ErrCommand, status, address)
+	}
+	return nil
+}
+
+// idle polls SII Control/Status until the busy flag is clear and returns the status.
+func (e *EEPROM) idle(ctx context.Context) (uint16, error) {
+	interval := e.PollInterval
+	if interval == 0 {
+		interval = DefaultPollInterval
+	}
+
+	for {
+		d, err := e.exchange(ctx, datagram.FPRD(e.station, register.SIIControl, 2))
+		if err != nil {
+			return 0, err
+		}
+		status := binary.LittleEndian.Uint16(d.Data.Bytes())
+		if status&statusBusy == 0 {
+			return status, nil
+		}
+
+		t := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return 0, ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// exchange exchanges a datagram and fails if the slave did not process it.
+func (e *EEPROM) exchange(ctx context.Context, d datagram.Datagram) (datagram.Datagram, error) {
+	d, err := e.x.Exchange(ctx, d)
+	if err != nil {
+		return d, err
+	}
+	if d.WKC == 0 {
+		return d, fmt.Errorf("%w: station 0x%04x", ErrNoResponse, e.station)
+	}
+	return d, nil
+}
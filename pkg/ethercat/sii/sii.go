@@ -0,0 +1,165 @@
+// Package sii describes the content of the Slave Information Interface (SII) EEPROM.
+//
+// The EEPROM is addressed in 16-bit words. The first 64 words hold fixed information such as the
+// identity and the mailbox configuration; they are followed by categories, each starting with a
+// type word and a size word (in words), terminated by the End category.
+package sii
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Word addresses of the fixed information area.
+const (
+	PDIControl      uint16 = 0x0000
+	StationAlias    uint16 = 0x0004
+	Checksum        uint16 = 0x0007
+	VendorID        uint16 = 0x0008 // 2 words
+	ProductCode     uint16 = 0x000A // 2 words
+	RevisionNo      uint16 = 0x000C // 2 words
+	SerialNo        uint16 = 0x000E // 2 words
+	BootRxMailbox   uint16 = 0x0014 // Offset and size
+	BootTxMailbox   uint16 = 0x0016 // Offset and size
+	StdRxMailbox    uint16 = 0x0018 // Offset and size
+	StdTxMailbox    uint16 = 0x001A // Offset and size
+	MailboxProtocol uint16 = 0x001C
+	Size            uint16 = 0x003E // EEPROM size in KBit - 1
+	Version         uint16 = 0x003F
+	FirstCategory   uint16 = 0x0040
+)
+
+// fixedAreaInWords is the size of the fixed information area.
+const fixedAreaInWords = int(FirstCategory)
+
+// Mailbox protocols in the MailboxProtocol word.
+const (
+	ProtocolAoE uint16 = 0x0001
+	ProtocolEoE uint16 = 0x0002
+	ProtocolCoE uint16 = 0x0004
+	ProtocolFoE uint16 = 0x0008
+	ProtocolSoE uint16 = 0x0010
+	ProtocolVoE uint16 = 0x0020
+)
+
+// Identity is the CoE identity object of a slave, also stored in the SII.
+type Identity struct {
+	VendorID    uint32
+	ProductCode uint32
+	RevisionNo  uint32
+	SerialNo    uint32
+}
+
+func (i Identity) String() string {
+	return fmt.Sprintf("vendor 0x%08x product 0x%08x revision 0x%08x serial 0x%08x", i.VendorID, i.ProductCode, i.RevisionNo, i.SerialNo)
+}
+
+// Mailbox is the offset and size of a mailbox SyncManager.
+type Mailbox struct {
+	Offset uint16
+	Size   uint16
+}
+
+// Info is the fixed information area of the SII.
+type Info struct {
+	Alias           uint16   // Configured station alias
+	Identity        Identity // Vendor, product, revision and serial number
+	BootRx          Mailbox  // Bootstrap receive mailbox (master to slave)
+	BootTx          Mailbox  // Bootstrap send mailbox (slave to master)
+	StdRx           Mailbox  // Standard receive mailbox (master to slave)
+	StdTx           Mailbox  // Standard send mailbox (slave to master)
+	MailboxProtocol uint16   // Supported mailbox protocols
+}
+
+// Encode returns the fixed information area of an EEPROM image, followed by categories and the End category.
+//
+// Parameters:
+//   - categories (...Category): Categories stored after the fixed area
+//
+// Returns:
+//   - []byte: EEPROM image
+func (i Info) Encode(categories ...Category) []byte {
+	image := make([]byte, fixedAreaInWords*2)
+	putWord := func(word uint16, v uint16) { binary.LittleEndian.PutUint16(image[word*2:], v) }
+	putLong := func(word uint16, v uint32) { binary.LittleEndian.PutUint32(image[word*2:], v) }
+	putMailbox := func(word uint16, mbx Mailbox) {
+		putWord(word, mbx.Offset)
+		putWord(word+1, mbx.Size)
+	}
+
+	putWord(StationAlias, i.Alias)
+	putWord(Checksum, uint16(crc8(image[:Checksum*2])))
+	putLong(VendorID, i.Identity.VendorID)
+	putLong(ProductCode, i.Identity.ProductCode)
+	putLong(RevisionNo, i.Identity.RevisionNo)
+	putLong(SerialNo, i.Identity.SerialNo)
+	putMailbox(BootRxMailbox, i.BootRx)
+	putMailbox(BootTxMailbox, i.BootTx)
+	putMailbox(StdRxMailbox, i.StdRx)
+	putMailbox(StdTxMailbox, i.StdTx)
+	putWord(MailboxProtocol, i.MailboxProtocol)
+	putWord(Version, 1)
+
+	for _, c := range categories {
+		image = c.append(image)
+	}
+	image = Category{Type: CategoryEnd}.append(image)
+
+	// The size word holds the EEPROM size in KBit minus one.
+	kbit := (len(image)*8 + 1023) / 1024
+	putWord(Size, uint16(kbit-1))
+	return image
+}
+
+// Decode reads the fixed information area of an EEPROM image.
+//
+// Parameters:
+//   - image ([]byte): EEPROM image, at least the fixed area
+//
+// Returns:
+//   - Info: Fixed information
+//   - error: Error if image is too short or its checksum is wrong
+func Decode(image []byte) (Info, error) {
+	if len(image) < fixedAreaInWords*2 {
+		return Info{}, errors.New("SII image is shorter than the fixed information area")
+	}
+	if sum := crc8(image[:Checksum*2]); uint16(sum) != binary.LittleEndian.Uint16(image[Checksum*2:])&0x00ff {
+		return Info{}, fmt.Errorf("SII checksum mismatch: calculated 0x%02x", sum)
+	}
+
+	word := func(w uint16) uint16 { return binary.LittleEndian.Uint16(image[w*2:]) }
+	long := func(w uint16) uint32 { return binary.LittleEndian.Uint32(image[w*2:]) }
+	mailbox := func(w uint16) Mailbox { return Mailbox{Offset: word(w), Size: word(w + 1)} }
+
+	return Info{
+		Alias: word(StationAlias),
+		Identity: Identity{
+			VendorID:    long(VendorID),
+			ProductCode: long(ProductCode),
+			RevisionNo:  long(RevisionNo),
+			SerialNo:    long(SerialNo),
+		},
+		BootRx:          mailbox(BootRxMailbox),
+		BootTx:          mailbox(BootTxMailbox),
+		StdRx:           mailbox(StdRxMailbox),
+		StdTx:           mailbox(StdTxMailbox),
+		MailboxProtocol: word(MailboxProtocol),
+	}, nil
+}
+
+// crc8 calculates the SII checksum (polynomial x^8+x^2+x+1, initial value 0xFF).
+func crc8(data []byte) uint8 {
+	crc := uint8(0xff)
+	for _, b := range data {
+		crc ^= b
+		for i := 0; i < 8; i++ {
+			if crc&0x80 != 0 {
+				crc = crc<<1 ^ 0x07
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
@@ -0,0 +1,133 @@
+package sii_test
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/Aruminium/goecat/pkg/ethercat/register"
+	"github.com/Aruminium/goecat/pkg/ethercat/sii"
+	"github.com/Aruminium/goecat/pkg/link"
+	"github.com/Aruminium/goecat/pkg/simulator"
+	"github.com/Aruminium/goecat/pkg/transceiver"
+)
+
+const station = 0x1001
+
+var encap = link.Encapsulation{Transport: link.Raw, SrcMAC: net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, 0x55}}
+
+var image = sii.Info{
+	Alias:           3,
+	Identity:        sii.Identity{VendorID: 0x0000079a, ProductCode: 0x00defede},
+	StdRx:           sii.Mailbox{Offset: 0x1000, Size: 128},
+	StdTx:           sii.Mailbox{Offset: 0x1080, Size: 128},
+	MailboxProtocol: sii.ProtocolCoE,
+}.Encode(
+	sii.Strings{"EasyCAT", "Outputs"}.Category(),
+	sii.General{NameIdx: 1, CoEDetails: 0x01, CurrentOnEBus: -100}.Category(),
+	sii.Category{Type: sii.CategoryFMMU, Data: []byte{0x01, 0x02, 0x03, 0xff}},
+	sii.SyncManagersCategory(
+		sii.SyncManager{Start: 0x1000, Length: 128, Control: 0x26, Enable: 0x01, Type: sii.SMMailboxOut},
+		sii.SyncManager{Start: 0x1080, Length: 128, Control: 0x22, Enable: 0x01, Type: sii.SMMailboxIn},
+	),
+	sii.PDOsCategory(sii.CategoryRxPDO, sii.PDO{Index: 0x1600, SyncManager: 2, NameIdx: 2, Entries: []sii.PDOEntry{
+		{Index: 0x7000, SubIndex: 1, DataType: 0x05, BitLength: 8},
+		{Index: 0x0000, BitLength: 8},
+	}}),
+)
+
+// newEEPROM creates a slave with image in its EEPROM and an EEPROM accessor for it.
+func newEEPROM(t *testing.T) (*simulator.ESC, *sii.EEPROM) {
+	slave := simulator.NewESC(simulator.Config{EEPROM: image})
+	tr := transceiver.New(simulator.NewRing(slave).Attach(), transceiver.Options{Encapsulation: encap})
+	t.Cleanup(func() { tr.Close() })
+
+	slave.Write(register.StationAddress, []byte{station & 0xff, station >> 8})
+	return slave, sii.NewEEPROM(tr, station)
+}
+
+func TestParseImage(t *testing.T) {
+	// when
+	got, err := sii.ParseImage(image)
+
+	// then
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got.Name() != "EasyCAT" || got.General.CurrentOnEBus != -100 {
+		t.Errorf("Expected EasyCAT drawing -100 mA, but got %q drawing %d mA", got.Name(), got.General.CurrentOnEBus)
+	}
+	if expected := []sii.FMMUUsage{sii.FMMUOutputs, sii.FMMUInputs, sii.FMMUSyncMStatus}; !reflect.DeepEqual(got.FMMUs, expected) {
+		t.Errorf("Expected %v, but got %v", expected, got.FMMUs)
+	}
+	if len(got.SyncManagers) != 2 || got.SyncManagers[1].Type != sii.SMMailboxIn {
+		t.Errorf("Expected a send mailbox as SM1, but got %v", got.SyncManagers)
+	}
+	expected := []sii.PDO{{Index: 0x1600, SyncManager: 2, NameIdx: 2, Entries: []sii.PDOEntry{
+		{Index: 0x7000, SubIndex: 1, DataType: 0x05, BitLength: 8},
+		{Index: 0x0000, BitLength: 8},
+	}}}
+	if !reflect.DeepEqual(got.RxPDOs, expected) || got.TxPDOs != nil {
+		t.Errorf("Expected RxPDOs %v and no TxPDOs, but got %v and %v", expected, got.RxPDOs, got.TxPDOs)
+	}
+}
+
+func TestEEPROMReadImage(t *testing.T) {
+	// given
+	_, eeprom := newEEPROM(t)
+
+	// when
+	got, err := eeprom.ReadImage(context.Background())
+
+	// then
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(got, image[:len(got)]) || len(got) != len(image) {
+		t.Errorf("Expected the image of %d bytes, but got %d bytes", len(image), len(got))
+	}
+}
+
+func TestEEPROMWrite(t *testing.T) {
+	// given
+	slave, eeprom := newEEPROM(t)
+	ctx := context.Background()
+
+	// when
+	err := eeprom.Write(ctx, sii.StationAlias, []byte{0x34, 0x12})
+	reloadErr := eeprom.Reload(ctx)
+	words, readErr := eeprom.Read(ctx, sii.StationAlias, 1)
+
+	// then
+	if err != nil || reloadErr != nil || readErr != nil {
+		t.Fatalf("Unexpected errors: %v, %v, %v", err, reloadErr, readErr)
+	}
+	if !reflect.DeepEqual(words, []byte{0x34, 0x12}) {
+		t.Errorf("Expected the written word, but got %v", words)
+	}
+	if alias := slave.Read(register.StationAlias, 2); !reflect.DeepEqual(alias, []byte{0x34, 0x12}) {
+		t.Errorf("Expected the alias register to be reloaded, but got %v", alias)
+	}
+}
+
+func TestEEPROMWriteAlias(t *testing.T) {
+	// given
+	slave, eeprom := newEEPROM(t)
+	ctx := context.Background()
+
+	// when
+	err := eeprom.WriteAlias(ctx, 100)
+	info, readErr := eeprom.ReadInfo(ctx)
+
+	// then
+	if err != nil || readErr != nil {
+		t.Fatalf("Unexpected errors: %v, %v", err, readErr)
+	}
+	if info.Alias != 100 {
+		t.Errorf("Expected alias 100 with a valid checksum, but got %d", info.Alias)
+	}
+	if alias := slave.Read(register.StationAlias, 2); !reflect.DeepEqual(alias, []byte{100, 0}) {
+		t.Errorf("Expected the alias register to be reloaded, but got %v", alias)
+	}
+}
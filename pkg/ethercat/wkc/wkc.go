@@ -0,0 +1,210 @@
+// Package wkc calculates the working counter a datagram is expected to return with.
+//
+// Every slave that executes a datagram increments its working counter:
+// a successful read adds 1, a successful write adds 1 and a read-write adds 3
+// (1 for the read and 2 for the write). For logical commands a slave only takes
+// part when one of its active FMMUs maps the addressed range in the direction of
+// the command, so LRW adds 1, 2 or 3 per slave depending on its FMMU directions.
+package wkc
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Aruminium/goecat/pkg/ethercat/command"
+	"github.com/Aruminium/goecat/pkg/ethercat/datagram"
+	"github.com/Aruminium/goecat/pkg/ethercat/payload/fmmu"
+)
+
+// ErrMismatch is wrapped by every working counter mismatch error.
+var ErrMismatch = errors.New("working counter mismatch")
+
+// Slave describes a slave of the segment for working counter calculation.
+type Slave struct {
+	Position uint16      // Position in the segment (0 is the first slave)
+	Station  uint16      // Configured station address
+	FMMUs    []fmmu.FMMU // FMMUs configured on the slave
+}
+
+// Contribution returns how much s increments the working counter of d.
+//
+// Parameters:
+//   - d (datagram.Datagram): Datagram sent to the segment
+//
+// Returns:
+//   - uint16: Working counter increment of the slave
+func (s Slave) Contribution(d datagram.Datagram) uint16 {
+	switch d.Addressing() {
+	case command.AutoIncrement:
+		if d.Command == command.ARMW {
+			return 1 // The addressed slave reads, all others write
+		}
+		if d.Position() != s.Position {
+			return 0
+		}
+		return physical(d.Command)
+	case command.Configured:
+		if d.Command == command.FRMW {
+			return 1
+		}
+		if d.Station() != s.Station {
+			return 0
+		}
+		return physical(d.Command)
+	case command.Broadcast:
+		return physical(d.Command)
+	case command.Logical:
+		return s.logical(d)
+	default:
+		return 0
+	}
+}
+
+// physical returns the increment of a slave executing a physical or broadcast command.
+func physical(cmd command.Type) uint16 {
+	switch {
+	case cmd.IsRead() && cmd.IsWrite():
+		return 3
+	case cmd.IsRead(), cmd.IsWrite():
+		return 1
+	default:
+		return 0
+	}
+}
+
+// logical returns the increment of s for a logical datagram from the directions of its FMMUs.
+func (s Slave) logical(d datagram.Datagram) uint16 {
+	start := uint64(d.LogicalAddress())
+	end := start + uint64(d.LRCM.Len)
+
+	read, write := false, false
+	for _, f := range s.FMMUs {
+		if !f.IsActivate {
+			continue
+		}
+		fStart := uint64(f.LogStart)
+		fEnd := fStart + uint64(f.LogLength)
+		if fStart >= end || start >= fEnd {
+			continue
+		}
+		read = read || f.AbleUseRead
+		write = write || f.AbleUseWrite
+	}
+
+	result := uint16(0)
+	switch d.Command {
+	case command.LRD:
+		if read {
+			result = 1
+		}
+	case command.LWR:
+		if write {
+			result = 1
+		}
+	case command.LRW:
+		if read {
+			result += 1
+		}
+		if write {
+			result += 2
+		}
+	}
+	return result
+}
+
+// Expected returns the working counter d returns with when every slave executes it successfully.
+//
+// Parameters:
+//   - d (datagram.Datagram): Datagram sent to the segment
+//   - slaves ([]Slave): All slaves of the segment
+//
+// Returns:
+//   - uint16: Expected working counter
+func Expected(d datagram.Datagram, slaves []Slave) uint16 {
+	result := uint16(0)
+	for _, s := range slaves {
+		result += s.Contribution(d)
+	}
+	return result
+}
+
+// Expectation is the expected working counter of a datagram together with the slaves that take part in it.
+// It implements transceiver.Expectation.
+type Expectation struct {
+	WKC    uint16  // Expected working counter
+	Slaves []Slave // Slaves that increment the working counter
+	counts []uint16
+}
+
+// Expect builds the Expectation of d for the slaves of a segment.
+//
+// Parameters:
+//   - d (datagram.Datagram): Datagram sent to the segment
+//   - slaves ([]Slave): All slaves of the segment
+//
+// Returns:
+//   - Expectation: Expected working counter and the slaves that take part
+func Expect(d datagram.Datagram, slaves []Slave) Expectation {
+	e := Expectation{}
+	for _, s := range slaves {
+		if c := s.Contribution(d); c > 0 {
+			e.WKC += c
+			e.Slaves = append(e.Slaves, s)
+			e.counts = append(e.counts, c)
+		}
+	}
+	return e
+}
+
+// Check returns a *MismatchError if d returned with a different working counter.
+//
+// Parameters:
+//   - d (datagram.Datagram): Returned datagram
+//
+// Returns:
+//   - error: *MismatchError or nil
+func (e Expectation) Check(d datagram.Datagram) error {
+	if d.WKC == e.WKC {
+		return nil
+	}
+
+	err := &MismatchError{Command: d.Command, Index: d.Index, Expected: e.WKC, Actual: d.WKC}
+	if d.WKC < e.WKC {
+		// A slave that did not take part accounts for at most the missing count.
+		missing := e.WKC - d.WKC
+		for i, s := range e.Slaves {
+			if e.counts[i] <= missing {
+				err.Suspects = append(err.Suspects, s)
+			}
+		}
+	}
+	return err
+}
+
+// MismatchError reports a datagram that returned with an unexpected working counter.
+type MismatchError struct {
+	Command  command.Type // Command of the datagram
+	Index    uint8        // Index of the datagram
+	Expected uint16       // Expected working counter
+	Actual   uint16       // Returned working counter
+	Suspects []Slave      // Slaves that may not have executed the datagram
+}
+
+func (e *MismatchError) Error() string {
+	msg := fmt.Sprintf("%v: %s index %d returned WKC %d, expected %d", ErrMismatch, e.Command, e.Index, e.Actual, e.Expected)
+	if len(e.Suspects) == 0 {
+		return msg
+	}
+
+	suspects := make([]string, len(e.Suspects))
+	for i, s := range e.Suspects {
+		suspects[i] = fmt.Sprintf("position %d (station 0x%04x)", s.Position, s.Station)
+	}
+	return msg + "; suspected slaves: " + strings.Join(suspects, ", ")
+}
+
+// Is reports whether target is ErrMismatch.
+func (e *MismatchError) Is(target error) bool {
+	return target == ErrMismatch
+}
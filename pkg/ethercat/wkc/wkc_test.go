@@ -0,0 +1,67 @@
+package wkc_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Aruminium/goecat/pkg/ethercat/datagram"
+	"github.com/Aruminium/goecat/pkg/ethercat/payload"
+	"github.com/Aruminium/goecat/pkg/ethercat/payload/fmmu"
+	"github.com/Aruminium/goecat/pkg/ethercat/wkc"
+)
+
+// segment has an output-only slave, an input-only slave and a slave with both directions.
+var segment = []wkc.Slave{
+	{Position: 0, Station: 0x1001, FMMUs: []fmmu.FMMU{
+		{LogStart: 0x00, LogLength: 4, AbleUseWrite: true, IsActivate: true},
+	}},
+	{Position: 1, Station: 0x1002, FMMUs: []fmmu.FMMU{
+		{LogStart: 0x04, LogLength: 4, AbleUseRead: true, IsActivate: true},
+	}},
+	{Position: 2, Station: 0x1003, FMMUs: []fmmu.FMMU{
+		{LogStart: 0x08, LogLength: 4, AbleUseWrite: true, IsActivate: true},
+		{LogStart: 0x0c, LogLength: 4, AbleUseRead: true, IsActivate: true},
+	}},
+}
+
+func TestExpected(t *testing.T) {
+	cases := []struct {
+		name     string
+		d        datagram.Datagram
+		expected uint16
+	}{
+		{"LRW", datagram.LRW(0, payload.BasicPayload{Data: make([]byte, 16)}), 2 + 1 + 3},
+		{"LRD", datagram.LRD(0, 16), 2},
+		{"LWR outside", datagram.LWR(0x10, payload.BasicPayload{Data: make([]byte, 4)}), 0},
+		{"BRD", datagram.BRD(0x0130, 2), 3},
+		{"BRW", datagram.BRW(0x0130, payload.BasicPayload{Data: make([]byte, 2)}), 9},
+		{"FPRW", datagram.FPRW(0x1002, 0x0120, payload.BasicPayload{Data: make([]byte, 2)}), 3},
+		{"APRD missing", datagram.APRD(5, 0x0130, 2), 0},
+		{"ARMW", datagram.ARMW(0, 0x0910, 8), 3},
+	}
+
+	for _, c := range cases {
+		if result := wkc.Expected(c.d, segment); result != c.expected {
+			t.Errorf("%s: expected WKC %d, but got %d", c.name, c.expected, result)
+		}
+	}
+}
+
+func TestCheckNamesSuspects(t *testing.T) {
+	// given
+	d := datagram.LRW(0, payload.BasicPayload{Data: make([]byte, 16)})
+	expectation := wkc.Expect(d, segment)
+	d.WKC = expectation.WKC - 1 // the input-only slave dropped out
+
+	// when
+	err := expectation.Check(d)
+
+	// then
+	var mismatch *wkc.MismatchError
+	if !errors.As(err, &mismatch) || !errors.Is(err, wkc.ErrMismatch) {
+		t.Fatalf("Expected a MismatchError, but got %v", err)
+	}
+	if len(mismatch.Suspects) != 1 || mismatch.Suspects[0].Position != 1 {
+		t.Errorf("Expected slave 1 to be suspected, but got %+v", mismatch.Suspects)
+	}
+}
@@ -0,0 +1,121 @@
+// Package layer registers EtherCAT with gopacket, so packets decoded with gopacket.NewPacket
+// carry an EtherCAT layer after Ethernet (EtherType 0x88A4) or after UDP (port 34980).
+//
+// Importing the package registers the layer:
+//
+//	packet := gopacket.NewPacket(data, layers.LayerTypeEthernet, gopacket.Default)
+//	if l := packet.Layer(layer.LayerTypeEtherCAT); l != nil {
+//		for _, d := range l.(*layer.EtherCAT).Frame.Datagrams() {
+//			...
+//		}
+//	}
+package layer
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/Aruminium/goecat/pkg/ethercat"
+	"github.com/Aruminium/goecat/pkg/link"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// LayerTypeEtherCAT is the gopacket layer type of EtherCAT frames.
+var LayerTypeEtherCAT = gopacket.RegisterLayerType(1888, gopacket.LayerTypeMetadata{
+	Name:    "EtherCAT",
+	Decoder: gopacket.DecodeFunc(decodeEtherCAT),
+})
+
+func init() {
+	layers.EthernetTypeMetadata[link.EthernetTypeEtherCAT] = layers.EnumMetadata{
+		DecodeWith: LayerTypeEtherCAT,
+		Name:       "EtherCAT",
+		LayerType:  LayerTypeEtherCAT,
+	}
+	layers.RegisterUDPPortLayerType(layers.UDPPort(link.UDPPortEtherCAT), LayerTypeEtherCAT)
+}
+
+// EthernetTypeEtherCAT is the EtherType of EtherCAT for building layers.Ethernet.
+const EthernetTypeEtherCAT = layers.EthernetType(link.EthernetTypeEtherCAT)
+
+// EtherCAT is the gopacket layer of an EtherCAT frame: the EtherCAT header and its datagrams.
+// Bytes after the length given in the header, such as Ethernet padding, are the layer payload.
+type EtherCAT struct {
+	layers.BaseLayer
+	Frame *ethercat.EtherCAT
+}
+
+// LayerType returns LayerTypeEtherCAT.
+func (e *EtherCAT) LayerType() gopacket.LayerType {
+	return LayerTypeEtherCAT
+}
+
+// CanDecode returns LayerTypeEtherCAT.
+func (e *EtherCAT) CanDecode() gopacket.LayerClass {
+	return LayerTypeEtherCAT
+}
+
+// NextLayerType returns gopacket.LayerTypeZero, because nothing is encapsulated in EtherCAT.
+func (e *EtherCAT) NextLayerType() gopacket.LayerType {
+	return gopacket.LayerTypeZero
+}
+
+// DecodeFromBytes decodes the EtherCAT header and datagrams.
+// It implements gopacket.DecodingLayer.
+//
+// Parameters:
+//   - data ([]byte): Bytes starting with the EtherCAT header
+//   - df (gopacket.DecodeFeedback): Receives truncation
+//
+// Returns:
+//   - error: Error if the frame is malformed
+func (e *EtherCAT) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
+	if len(data) < 2 {
+		df.SetTruncated()
+		return errors.New("EtherCAT frame is shorter than its header")
+	}
+
+	frame, err := ethercat.Parse(data)
+	if err != nil {
+		return err
+	}
+
+	length := 2 + int(binary.LittleEndian.Uint16(data)&0x07ff)
+	e.Frame = frame
+	e.BaseLayer = layers.BaseLayer{Contents: data[:length], Payload: data[length:]}
+	return nil
+}
+
+// SerializeTo writes the EtherCAT header and datagrams.
+// It implements gopacket.SerializableLayer.
+//
+// Parameters:
+//   - b (gopacket.SerializeBuffer): Buffer to prepend the frame to
+//   - opts (gopacket.SerializeOptions): Options; the header length is always taken from the datagrams
+//
+// Returns:
+//   - error: Error if the buffer cannot grow
+func (e *EtherCAT) SerializeTo(b gopacket.SerializeBuffer, opts gopacket.SerializeOptions) error {
+	frame := e.Frame
+	if frame == nil {
+		frame = ethercat.NewEtherCAT()
+	}
+
+	data := frame.Bytes()
+	bytes, err := b.PrependBytes(len(data))
+	if err != nil {
+		return err
+	}
+	copy(bytes, data)
+	return nil
+}
+
+func decodeEtherCAT(data []byte, p gopacket.PacketBuilder) error {
+	e := &EtherCAT{}
+	if err := e.DecodeFromBytes(data, p); err != nil {
+		return err
+	}
+	p.AddLayer(e)
+	return nil
+}
@@ -0,0 +1,102 @@
+package layer_test
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/Aruminium/goecat/pkg/ethercat"
+	"github.com/Aruminium/goecat/pkg/ethercat/datagram"
+	"github.com/Aruminium/goecat/pkg/ethercat/payload"
+	"github.com/Aruminium/goecat/pkg/layer"
+	"github.com/Aruminium/goecat/pkg/link"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+var srcMAC = net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, 0x55}
+
+func newFrame() *ethercat.EtherCAT {
+	ecat := ethercat.NewEtherCAT()
+	ecat.AppendDatagram(datagram.BRD(0x0000, 1))
+	ecat.AppendDatagram(datagram.APWR(0, 0x0120, payload.BasicPayload{Data: []byte{0x02, 0x00}}))
+	return ecat
+}
+
+func TestDecodeRaw(t *testing.T) {
+	// given
+	ecat := newFrame()
+	data, _ := link.Encapsulation{Transport: link.Raw, SrcMAC: srcMAC}.Encapsulate(ecat.Bytes())
+
+	// when
+	packet := gopacket.NewPacket(data, layers.LayerTypeEthernet, gopacket.Default)
+	l := packet.Layer(layer.LayerTypeEtherCAT)
+
+	// then
+	if l == nil {
+		t.Fatalf("Expected an EtherCAT layer, but got %v", packet)
+	}
+	if got := l.(*layer.EtherCAT).Frame.Datagrams(); !reflect.DeepEqual(got, ecat.Datagrams()) {
+		t.Errorf("Expected %v, but got %v", ecat.Datagrams(), got)
+	}
+	if !reflect.DeepEqual(l.LayerContents(), ecat.Bytes()) {
+		t.Errorf("Expected the contents to exclude the Ethernet padding")
+	}
+}
+
+func TestDecodeUDP(t *testing.T) {
+	// given
+	ecat := newFrame()
+	data, _ := link.Encapsulation{Transport: link.UDP, SrcMAC: srcMAC, SrcIP: net.IPv4(192, 168, 0, 1), DstIP: net.IPv4bcast}.Encapsulate(ecat.Bytes())
+
+	// when
+	packet := gopacket.NewPacket(data, layers.LayerTypeEthernet, gopacket.Default)
+	l := packet.Layer(layer.LayerTypeEtherCAT)
+
+	// then
+	if l == nil || packet.Layer(layers.LayerTypeUDP) == nil {
+		t.Fatalf("Expected UDP and EtherCAT layers, but got %v", packet)
+	}
+	if got := l.(*layer.EtherCAT).Frame.Bytes(); !reflect.DeepEqual(got, ecat.Bytes()) {
+		t.Errorf("Expected % x, but got % x", ecat.Bytes(), got)
+	}
+}
+
+func TestSerializeTo(t *testing.T) {
+	// given
+	ecat := newFrame()
+	eth := &layers.Ethernet{SrcMAC: srcMAC, DstMAC: layers.EthernetBroadcast, EthernetType: layer.EthernetTypeEtherCAT}
+	buffer := gopacket.NewSerializeBuffer()
+
+	// when
+	err := gopacket.SerializeLayers(buffer, gopacket.SerializeOptions{FixLengths: true}, eth, &layer.EtherCAT{Frame: ecat})
+	decoded, decodeErr := link.Decapsulate(buffer.Bytes())
+
+	// then
+	if err != nil || decodeErr != nil {
+		t.Fatalf("Unexpected error: %v %v", err, decodeErr)
+	}
+	if !reflect.DeepEqual(decoded[:len(ecat.Bytes())], ecat.Bytes()) {
+		t.Errorf("Expected % x, but got % x", ecat.Bytes(), decoded)
+	}
+}
+
+func TestDecodingLayerParser(t *testing.T) {
+	// given
+	data, _ := link.Encapsulation{Transport: link.Raw, SrcMAC: srcMAC}.Encapsulate(newFrame().Bytes())
+	var eth layers.Ethernet
+	var ecat layer.EtherCAT
+	parser := gopacket.NewDecodingLayerParser(layers.LayerTypeEthernet, &eth, &ecat)
+	decoded := []gopacket.LayerType{}
+
+	// when
+	err := parser.DecodeLayers(data, &decoded)
+
+	// then
+	if err != nil || !reflect.DeepEqual(decoded, []gopacket.LayerType{layers.LayerTypeEthernet, layer.LayerTypeEtherCAT}) {
+		t.Errorf("Expected Ethernet and EtherCAT, but got %v (%v)", decoded, err)
+	}
+	if len(ecat.Frame.Datagrams()) != 2 {
+		t.Errorf("Expected 2 datagrams, but got %d", len(ecat.Frame.Datagrams()))
+	}
+}
@@ -0,0 +1,204 @@
+package link
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/Aruminium/goecat/pkg/ethercat"
+	"github.com/Aruminium/goecat/pkg/ethercat/frame"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+const (
+	EthernetTypeEtherCAT layers.EthernetType = 0x88a4 // EtherType of EtherCAT frames
+	UDPPortEtherCAT      layers.UDPPort      = 34980  // UDP port of EtherCAT frames (0x88A4)
+)
+
+// Transport selects how EtherCAT frames are carried inside Ethernet frames.
+type Transport uint8
+
+const (
+	Raw Transport = iota // Directly after the Ethernet header with EtherType 0x88A4
+	UDP                  // Inside IPv4/UDP with port 34980
+)
+
+// ErrNotEtherCAT is returned by Decapsulate for frames that do not carry EtherCAT.
+var ErrNotEtherCAT = errors.New("frame does not carry EtherCAT")
+
+// Encapsulation wraps EtherCAT frames into Ethernet frames and unwraps them again.
+type Encapsulation struct {
+	Transport Transport
+	SrcMAC    net.HardwareAddr // Source MAC address of the master
+	SrcIP     net.IP           // Source IPv4 address, used by UDP only
+	DstIP     net.IP           // Destination IPv4 address, used by UDP only
+}
+
+const (
+	ethernetHeaderLength = 14 // Destination and source MAC addresses and EtherType
+	ipv4HeaderLength     = 20 // IPv4 header without options
+	minEthernetLength    = 60 // Shorter Ethernet frames are padded, not counting the FCS
+)
+
+var broadcastMAC = net.HardwareAddr{0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+
+// Overhead returns the encapsulation overhead inside the Ethernet payload.
+//
+// Returns:
+//   - int: frame.RawOverhead or frame.UDPOverhead
+func (e Encapsulation) Overhead() int {
+	if e.Transport == UDP {
+		return frame.UDPOverhead
+	}
+	return frame.RawOverhead
+}
+
+// Encapsulate wraps an EtherCAT frame (header and datagrams) into an Ethernet frame.
+//
+// Parameters:
+//   - ecat ([]byte): EtherCAT frame
+//
+// Returns:
+//   - []byte: Ethernet frame
+//   - error: Error if the frame cannot be serialized
+func (e Encapsulation) Encapsulate(ecat []byte) ([]byte, error) {
+	dst, err := e.appendHeaders(make([]byte, 0, e.EncapsulatedLength(len(ecat))))
+	if err != nil {
+		return nil, err
+	}
+	return e.complete(append(dst, ecat...), 0), nil
+}
+
+// AppendTo wraps an EtherCAT frame into an Ethernet frame appended to dst.
+// It does not allocate when dst has enough spare capacity, so a buffer can be reused from cycle to cycle;
+// EncapsulatedLength gives the capacity needed.
+//
+// Parameters:
+//   - dst ([]byte): Buffer to append to
+//   - ecat (*ethercat.EtherCAT): EtherCAT frame
+//
+// Returns:
+//   - []byte: The extended buffer
+//   - error: Error if the frame cannot be serialized
+func (e Encapsulation) AppendTo(dst []byte, ecat *ethercat.EtherCAT) ([]byte, error) {
+	start := len(dst)
+	dst, err := e.appendHeaders(dst)
+	if err != nil {
+		return dst[:start], err
+	}
+	return e.complete(ecat.AppendTo(dst), start), nil
+}
+
+// EncapsulatedLength returns the length of the Ethernet frame carrying an EtherCAT frame of ecatLength bytes,
+// including the padding to the minimum Ethernet frame length.
+//
+// Parameters:
+//   - ecatLength (int): Length of the EtherCAT frame
+//
+// Returns:
+//   - int: Length of the Ethernet frame without the FCS
+func (e Encapsulation) EncapsulatedLength(ecatLength int) int {
+	return max(ethernetHeaderLength+e.Overhead()+ecatLength, minEthernetLength)
+}
+
+// appendHeaders appends the Ethernet header and, for UDP, the IPv4 and UDP headers with their length and
+// checksum fields left zero; complete fills them in once the payload is appended.
+func (e Encapsulation) appendHeaders(dst []byte) ([]byte, error) {
+	if len(e.SrcMAC) != 6 {
+		return dst, fmt.Errorf("invalid src MAC: %v", e.SrcMAC)
+	}
+
+	dst = append(dst, broadcastMAC...)
+	dst = append(dst, e.SrcMAC...)
+	switch e.Transport {
+	case Raw:
+		return binary.BigEndian.AppendUint16(dst, uint16(EthernetTypeEtherCAT)), nil
+	case UDP:
+		src, dst4 := e.SrcIP.To4(), e.DstIP.To4()
+		if src == nil || dst4 == nil {
+			return dst, fmt.Errorf("invalid IPv4 addresses: %v -> %v", e.SrcIP, e.DstIP)
+		}
+		dst = binary.BigEndian.AppendUint16(dst, uint16(layers.EthernetTypeIPv4))
+		// Version 4, IHL 5, no TOS, length, identification, flags and fragment offset, TTL 64, protocol UDP, checksum
+		dst = append(dst, 0x45, 0, 0, 0, 0, 0, 0, 0, 64, byte(layers.IPProtocolUDP), 0, 0)
+		dst = append(dst, src...)
+		dst = append(dst, dst4...)
+		dst = binary.BigEndian.AppendUint16(dst, uint16(UDPPortEtherCAT))
+		dst = binary.BigEndian.AppendUint16(dst, uint16(UDPPortEtherCAT))
+		// Length and checksum
+		return append(dst, 0, 0, 0, 0), nil
+	default:
+		return dst, fmt.Errorf("unknown transport: %d", e.Transport)
+	}
+}
+
+// complete fills in the lengths and checksums of the Ethernet frame starting at start and pads it
+// to the minimum Ethernet frame length.
+func (e Encapsulation) complete(dst []byte, start int) []byte {
+	if e.Transport == UDP {
+		ip := dst[start+ethernetHeaderLength:]
+		udp := ip[ipv4HeaderLength:]
+		binary.BigEndian.PutUint16(ip[2:], uint16(len(ip)))
+		binary.BigEndian.PutUint16(ip[10:], checksum(ip[:ipv4HeaderLength], 0))
+		binary.BigEndian.PutUint16(udp[4:], uint16(len(udp)))
+
+		// Pseudo header: addresses, protocol and UDP length
+		pseudo := sum(ip[12:20], uint32(layers.IPProtocolUDP)+uint32(len(udp)))
+		csum := checksum(udp, pseudo)
+		if csum == 0 {
+			// Zero means no checksum in UDP over IPv4.
+			csum = 0xffff
+		}
+		binary.BigEndian.PutUint16(udp[6:], csum)
+	}
+
+	for len(dst)-start < minEthernetLength {
+		dst = append(dst, 0)
+	}
+	return dst
+}
+
+// sum adds data as big endian 16-bit words to csum.
+func sum(data []byte, csum uint32) uint32 {
+	for i := 0; i+1 < len(data); i += 2 {
+		csum += uint32(data[i])<<8 | uint32(data[i+1])
+	}
+	if len(data)%2 == 1 {
+		csum += uint32(data[len(data)-1]) << 8
+	}
+	return csum
+}
+
+// checksum returns the Internet checksum (RFC 1071) of data added to the partial sum csum.
+// The checksum field inside data must be zero.
+func checksum(data []byte, csum uint32) uint16 {
+	csum = sum(data, csum)
+	for csum > 0xffff {
+		csum = csum>>16 + csum&0xffff
+	}
+	return ^uint16(csum)
+}
+
+// Decapsulate returns the EtherCAT frame carried by an Ethernet frame.
+// Both EtherType 0x88A4 and UDP port 34980 are accepted regardless of the Transport.
+// The returned slice may contain Ethernet padding after the EtherCAT frame.
+//
+// Parameters:
+//   - ethernet ([]byte): Ethernet frame
+//
+// Returns:
+//   - []byte: EtherCAT frame
+//   - error: ErrNotEtherCAT if the frame does not carry EtherCAT
+func Decapsulate(ethernet []byte) ([]byte, error) {
+	packet := gopacket.NewPacket(ethernet, layers.LayerTypeEthernet, gopacket.NoCopy)
+
+	if eth, ok := packet.Layer(layers.LayerTypeEthernet).(*layers.Ethernet); ok && eth.EthernetType == EthernetTypeEtherCAT {
+		return eth.Payload, nil
+	}
+	if udp, ok := packet.Layer(layers.LayerTypeUDP).(*layers.UDP); ok && udp.DstPort == UDPPortEtherCAT {
+		return udp.Payload, nil
+	}
+	return nil, ErrNotEtherCAT
+}
@@ -0,0 +1,124 @@
+package link_test
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/Aruminium/goecat/pkg/ethercat"
+	"github.com/Aruminium/goecat/pkg/ethercat/datagram"
+	"github.com/Aruminium/goecat/pkg/ethercat/payload"
+	"github.com/Aruminium/goecat/pkg/link"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+var srcMAC = net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, 0x55}
+
+func newFrame(length int) *ethercat.EtherCAT {
+	ecat := ethercat.NewEtherCAT()
+	ecat.AppendDatagram(datagram.LRW(0, payload.BasicPayload{Data: make([]byte, length)}))
+	ecat.AppendDatagram(datagram.ARMW(0, 0x0910, 8))
+	return ecat
+}
+
+// serialize encapsulates ecat with gopacket as a reference.
+func serialize(e link.Encapsulation, ecat []byte) []byte {
+	buffer := gopacket.NewSerializeBuffer()
+	options := gopacket.SerializeOptions{ComputeChecksums: true, FixLengths: true}
+	eth := &layers.Ethernet{SrcMAC: e.SrcMAC, DstMAC: net.HardwareAddr{0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, EthernetType: link.EthernetTypeEtherCAT}
+	if e.Transport == link.Raw {
+		gopacket.SerializeLayers(buffer, options, eth, gopacket.Payload(ecat))
+		return buffer.Bytes()
+	}
+	eth.EthernetType = layers.EthernetTypeIPv4
+	ip := &layers.IPv4{Version: 4, TTL: 64, SrcIP: e.SrcIP, DstIP: e.DstIP, Protocol: layers.IPProtocolUDP}
+	udp := &layers.UDP{SrcPort: link.UDPPortEtherCAT, DstPort: link.UDPPortEtherCAT}
+	udp.SetNetworkLayerForChecksum(ip)
+	gopacket.SerializeLayers(buffer, options, eth, ip, udp, gopacket.Payload(ecat))
+	return buffer.Bytes()
+}
+
+func TestAppendTo(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		encap  link.Encapsulation
+		length int
+	}{
+		{"raw", link.Encapsulation{Transport: link.Raw, SrcMAC: srcMAC}, 64},
+		{"raw padded", link.Encapsulation{Transport: link.Raw, SrcMAC: srcMAC}, 1},
+		{"udp", link.Encapsulation{Transport: link.UDP, SrcMAC: srcMAC, SrcIP: net.IPv4(192, 168, 0, 1), DstIP: net.IPv4bcast}, 63},
+		{"udp padded", link.Encapsulation{Transport: link.UDP, SrcMAC: srcMAC, SrcIP: net.IPv4(10, 0, 0, 1), DstIP: net.IPv4(10, 0, 0, 2)}, 0},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			// given
+			ecat := newFrame(tt.length)
+			expected := serialize(tt.encap, ecat.Bytes())
+			prefix := []byte{0xaa}
+
+			// when
+			appended, appendErr := tt.encap.AppendTo(prefix, ecat)
+			encapsulated, encapsulateErr := tt.encap.Encapsulate(ecat.Bytes())
+
+			// then
+			if appendErr != nil || encapsulateErr != nil {
+				t.Fatalf("Unexpected errors: %v, %v", appendErr, encapsulateErr)
+			}
+			if !reflect.DeepEqual(appended, append([]byte{0xaa}, expected...)) {
+				t.Errorf("Expected % x after the prefix, but got % x", expected, appended[1:])
+			}
+			if !reflect.DeepEqual(encapsulated, expected) || len(expected) != tt.encap.EncapsulatedLength(ecat.Len()) {
+				t.Errorf("Expected % x, but got % x", expected, encapsulated)
+			}
+		})
+	}
+}
+
+func TestAppendToInvalidAddresses(t *testing.T) {
+	// given
+	encap := link.Encapsulation{Transport: link.UDP, SrcMAC: srcMAC}
+
+	// when
+	result, err := encap.AppendTo([]byte{0xaa}, newFrame(1))
+
+	// then
+	if err == nil || !reflect.DeepEqual(result, []byte{0xaa}) {
+		t.Errorf("Expected an error and the buffer unchanged, but got % x, %v", result, err)
+	}
+}
+
+func TestAppendToDoesNotAllocate(t *testing.T) {
+	// given
+	encap := link.Encapsulation{Transport: link.UDP, SrcMAC: srcMAC, SrcIP: net.IPv4(192, 168, 0, 1), DstIP: net.IPv4bcast}
+	ecat := newFrame(64)
+	buffer := make([]byte, 0, encap.EncapsulatedLength(ecat.Len()))
+
+	// when
+	allocs := testing.AllocsPerRun(100, func() {
+		buffer, _ = encap.AppendTo(buffer[:0], ecat)
+	})
+
+	// then
+	if allocs != 0 {
+		t.Errorf("Expected no allocations, but got %v", allocs)
+	}
+}
+
+func BenchmarkEncapsulate(b *testing.B) {
+	encap := link.Encapsulation{Transport: link.Raw, SrcMAC: srcMAC}
+	ecat := newFrame(64)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, _ = encap.Encapsulate(ecat.Bytes())
+	}
+}
+
+func BenchmarkAppendTo(b *testing.B) {
+	encap := link.Encapsulation{Transport: link.Raw, SrcMAC: srcMAC}
+	ecat := newFrame(64)
+	buffer := make([]byte, 0, encap.EncapsulatedLength(ecat.Len()))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buffer, _ = encap.AppendTo(buffer[:0], ecat)
+	}
+}
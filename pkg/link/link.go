@@ -0,0 +1,22 @@
+// Package link provides the Ethernet level transport used to exchange EtherCAT frames.
+package link
+
+import "errors"
+
+// ErrClosed is returned by a Link after it has been closed.
+var ErrClosed = errors.New("link is closed")
+
+// Link sends and receives complete Ethernet frames.
+//
+// Send and Receive may be called concurrently from different goroutines,
+// but each of them is called by a single goroutine at a time.
+type Link interface {
+	// Send writes one Ethernet frame to the wire.
+	// The caller may reuse frame once Send returns, so it must be copied if it is kept.
+	Send(frame []byte) error
+	// Receive blocks until an Ethernet frame arrives or the link is closed.
+	// The returned slice is owned by the caller.
+	Receive() ([]byte, error)
+	// Close releases the link and unblocks pending Receive calls.
+	Close() error
+}
@@ -0,0 +1,53 @@
+package link
+
+import "sync"
+
+// pipeEnd is one end of an in-memory link created by Pipe.
+type pipeEnd struct {
+	rx     <-chan []byte
+	tx     chan<- []byte
+	done   chan struct{}
+	closer *sync.Once
+}
+
+// Pipe creates a pair of connected in-memory links.
+// A frame sent on one end is received on the other end. Closing either end closes both.
+//
+// Returns:
+//   - Link: One end of the pipe, typically used by the master
+//   - Link: The other end of the pipe, typically used by a simulated segment
+func Pipe() (Link, Link) {
+	a := make(chan []byte, 64)
+	b := make(chan []byte, 64)
+	done := make(chan struct{})
+	once := &sync.Once{}
+
+	return &pipeEnd{rx: a, tx: b, done: done, closer: once},
+		&pipeEnd{rx: b, tx: a, done: done, closer: once}
+}
+
+func (p *pipeEnd) Send(frame []byte) error {
+	buf := make([]byte, len(frame))
+	copy(buf, frame)
+
+	select {
+	case <-p.done:
+		return ErrClosed
+	case p.tx <- buf:
+		return nil
+	}
+}
+
+func (p *pipeEnd) Receive() ([]byte, error) {
+	select {
+	case <-p.done:
+		return nil, ErrClosed
+	case frame := <-p.rx:
+		return frame, nil
+	}
+}
+
+func (p *pipeEnd) Close() error {
+	p.closer.Do(func() { close(p.done) })
+	return nil
+}
@@ -0,0 +1,217 @@
+package link
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/Aruminium/goecat/pkg/ethercat"
+	"github.com/Aruminium/goecat/pkg/ethercat/datagram"
+	"github.com/Aruminium/goecat/pkg/ethercat/frame"
+	"github.com/google/gopacket/layers"
+)
+
+// Template is an Ethernet frame for cyclic exchange whose Ethernet, EtherCAT and datagram headers are
+// encoded once. Every cycle the outputs are written into the frame with Data, the frame is sent as it is
+// and the inputs are read by slicing the returned frame with Returned.
+//
+// A Template is not safe for concurrent use.
+type Template struct {
+	encap Encapsulation
+	frame []byte // Ethernet frame sent every cycle
+	ecat  int    // Offset of the EtherCAT header in frame
+	end   int    // Offset of the end of the EtherCAT frame, before the padding
+	slots []slot // Datagrams of the frame, in order
+}
+
+// slot locates a datagram relative to the EtherCAT header.
+type slot struct {
+	header int // Offset of the datagram header
+	length int // Length of the data
+}
+
+// NewTemplate encodes datagrams into a Template. The M bits are set as by ethercat.EtherCAT.AppendDatagram.
+//
+// Parameters:
+//   - e (Encapsulation): How the frame is carried
+//   - datagrams (...datagram.Datagram): Datagrams of the frame, such as an LRW of the process image
+//
+// Returns:
+//   - *Template: New Template
+//   - error: Error if there are no datagrams, a datagram is invalid or the frame cannot be encoded
+func NewTemplate(e Encapsulation, datagrams ...datagram.Datagram) (*Template, error) {
+	if len(datagrams) == 0 {
+		return nil, errors.New("template needs at least one datagram")
+	}
+
+	ecat := ethercat.NewEtherCAT()
+	t := &Template{encap: e, ecat: ethernetHeaderLength + e.Overhead()}
+	offset := 2
+	for _, d := range datagrams {
+		if err := ecat.AppendDatagram(d); err != nil {
+			return nil, err
+		}
+		t.slots = append(t.slots, slot{header: offset, length: int(d.LRCM.Len)})
+		offset += datagram.Overhead + int(d.LRCM.Len)
+	}
+
+	if length := e.Overhead() + ecat.Len(); length > frame.EthernetMTU {
+		return nil, fmt.Errorf("template of %d bytes does not fit into an Ethernet frame", length)
+	}
+
+	ethernet, err := e.AppendTo(make([]byte, 0, e.EncapsulatedLength(ecat.Len())), ecat)
+	if err != nil {
+		return nil, err
+	}
+	t.frame, t.end = ethernet, t.ecat+offset
+	return t, nil
+}
+
+// Len returns the number of datagrams in the Template.
+func (t *Template) Len() int {
+	return len(t.slots)
+}
+
+// Data returns the data of datagram i inside the frame. Writing to it changes what is sent in the next cycle.
+//
+// Parameters:
+//   - i (int): Datagram in the order given to NewTemplate
+//
+// Returns:
+//   - []byte: Data of the datagram, aliasing the frame
+func (t *Template) Data(i int) []byte {
+	start := t.ecat + t.slots[i].header + datagram.HeaderLength
+	return t.frame[start : start+t.slots[i].length : start+t.slots[i].length]
+}
+
+// Index returns the index of datagram i.
+func (t *Template) Index(i int) uint8 {
+	return t.frame[t.ecat+t.slots[i].header+1]
+}
+
+// SetIndex sets the index of datagram i, for example to one reserved from the index pool of a transceiver.
+//
+// Parameters:
+//   - i (int): Datagram in the order given to NewTemplate
+//   - index (uint8): Index of the datagram
+func (t *Template) SetIndex(i int, index uint8) {
+	t.frame[t.ecat+t.slots[i].header+1] = index
+}
+
+// Datagram decodes datagram i of the frame, as it is sent.
+//
+// Parameters:
+//   - i (int): Datagram in the order given to NewTemplate
+//
+// Returns:
+//   - datagram.Datagram: Datagram with a copy of its data
+func (t *Template) Datagram(i int) datagram.Datagram {
+	d, _, _ := datagram.Parse(t.frame[t.ecat+t.slots[i].header:])
+	return d
+}
+
+// Frame updates the UDP checksum after the data has been written and returns the Ethernet frame to send.
+// The frame is reused by the next cycle.
+//
+// Returns:
+//   - []byte: Ethernet frame
+func (t *Template) Frame() []byte {
+	if t.encap.Transport == UDP {
+		ip := t.frame[ethernetHeaderLength:t.end]
+		udp := ip[ipv4HeaderLength:]
+		udp[6], udp[7] = 0, 0
+		csum := checksum(udp, sum(ip[12:20], uint32(layers.IPProtocolUDP)+uint32(len(udp))))
+		if csum == 0 {
+			csum = 0xffff
+		}
+		binary.BigEndian.PutUint16(udp[6:], csum)
+	}
+	return t.frame
+}
+
+// Match reports whether ethernet is the return of the frame: it carries EtherCAT with the same datagram
+// commands, indices and lengths. It does not allocate.
+//
+// Parameters:
+//   - ethernet ([]byte): Received Ethernet frame
+//
+// Returns:
+//   - bool: Whether ethernet returns the frame
+func (t *Template) Match(ethernet []byte) bool {
+	return t.match(ethernet, nil)
+}
+
+// MatchIndices is Match for the frame as it was sent with other indices, such as those of an earlier cycle.
+//
+// Parameters:
+//   - ethernet ([]byte): Received Ethernet frame
+//   - indices ([]uint8): Index of every datagram, in the order given to NewTemplate
+//
+// Returns:
+//   - bool: Whether ethernet returns the frame sent with indices
+func (t *Template) MatchIndices(ethernet []byte, indices []uint8) bool {
+	return len(indices) == len(t.slots) && t.match(ethernet, indices)
+}
+
+// match compares ethernet with the frame, taking the indices from indices unless it is nil.
+func (t *Template) match(ethernet []byte, indices []uint8) bool {
+	ecat, ok := ecatOffset(ethernet)
+	if !ok {
+		return false
+	}
+	sent := t.frame[t.ecat:]
+	if len(ethernet)-ecat < t.end-t.ecat || ethernet[ecat] != sent[0] || ethernet[ecat+1] != sent[1] {
+		return false
+	}
+	for i, s := range t.slots {
+		received := ethernet[ecat+s.header:]
+		index := sent[s.header+1]
+		if indices != nil {
+			index = indices[i]
+		}
+		// Command, index and LRCM; slaves change the address of auto increment datagrams.
+		if received[0] != sent[s.header] || received[1] != index || received[6] != sent[s.header+6] || received[7] != sent[s.header+7] {
+			return false
+		}
+	}
+	return true
+}
+
+// Returned returns the data and working counter of datagram i in a frame accepted by Match.
+//
+// Parameters:
+//   - ethernet ([]byte): Returned Ethernet frame
+//   - i (int): Datagram in the order given to NewTemplate
+//
+// Returns:
+//   - []byte: Data of the datagram, aliasing ethernet
+//   - uint16: Working counter of the datagram
+func (t *Template) Returned(ethernet []byte, i int) ([]byte, uint16) {
+	ecat, _ := ecatOffset(ethernet)
+	start := ecat + t.slots[i].header + datagram.HeaderLength
+	end := start + t.slots[i].length
+	return ethernet[start:end:end], binary.LittleEndian.Uint16(ethernet[end:])
+}
+
+// ecatOffset returns the offset of the EtherCAT header in an Ethernet frame carrying EtherCAT,
+// with the same rules as Decapsulate but without decoding the frame.
+func ecatOffset(ethernet []byte) (int, bool) {
+	if len(ethernet) < ethernetHeaderLength {
+		return 0, false
+	}
+	switch layers.EthernetType(binary.BigEndian.Uint16(ethernet[12:])) {
+	case EthernetTypeEtherCAT:
+		return ethernetHeaderLength, true
+	case layers.EthernetTypeIPv4:
+		ip := ethernet[ethernetHeaderLength:]
+		if len(ip) < ipv4HeaderLength || ip[9] != byte(layers.IPProtocolUDP) {
+			return 0, false
+		}
+		udp := int(ip[0]&0x0f) * 4
+		if len(ip) < udp+8 || layers.UDPPort(binary.BigEndian.Uint16(ip[udp+2:])) != UDPPortEtherCAT {
+			return 0, false
+		}
+		return ethernetHeaderLength + udp + 8, true
+	}
+	return 0, false
+}
@@ -0,0 +1,105 @@
+package link_test
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/Aruminium/goecat/pkg/ethercat"
+	"github.com/Aruminium/goecat/pkg/ethercat/datagram"
+	"github.com/Aruminium/goecat/pkg/ethercat/payload"
+	"github.com/Aruminium/goecat/pkg/link"
+)
+
+func TestTemplate(t *testing.T) {
+	// given
+	encap := link.Encapsulation{Transport: link.UDP, SrcMAC: srcMAC, SrcIP: net.IPv4(192, 168, 0, 1), DstIP: net.IPv4bcast}
+	lrw := datagram.LRW(0x10000, payload.BasicPayload{Data: make([]byte, 4)})
+	armw := datagram.ARMW(0, 0x0910, 8)
+	tmpl, err := link.NewTemplate(encap, lrw, armw)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// when
+	tmpl.SetIndex(0, 7)
+	tmpl.SetIndex(1, 8)
+	copy(tmpl.Data(0), []byte{1, 2, 3, 4})
+	sent := append([]byte{}, tmpl.Frame()...)
+
+	// then
+	lrw.Index, lrw.Data = 7, payload.BasicPayload{Data: []byte{1, 2, 3, 4}}
+	armw.Index = 8
+	ecat := ethercat.NewEtherCAT()
+	ecat.AppendDatagram(lrw)
+	ecat.AppendDatagram(armw)
+	expected, _ := encap.AppendTo(nil, ecat)
+	if !reflect.DeepEqual(sent, expected) {
+		t.Errorf("Expected % x, but got % x", expected, sent)
+	}
+	if !tmpl.Match(sent) {
+		t.Errorf("Expected the sent frame to match")
+	}
+}
+
+func TestTemplateReturned(t *testing.T) {
+	// given
+	tmpl, _ := link.NewTemplate(link.Encapsulation{Transport: link.Raw, SrcMAC: srcMAC},
+		datagram.LRD(0, 2), datagram.APRD(0, 0x0130, 2))
+	lrd, aprd := datagram.LRD(0, 2), datagram.APRD(0, 0x0130, 2)
+	lrd.Data, lrd.WKC = payload.BasicPayload{Data: []byte{0xaa, 0xbb}}, 3
+	// The slaves increment the position of auto increment datagrams.
+	aprd.Address, aprd.WKC = datagram.NewAutoIncrementAddress(2, 0x0130), 1
+	returned := ethercat.NewEtherCAT()
+	returned.AppendDatagram(lrd)
+	returned.AppendDatagram(aprd)
+	ethernet, _ := link.Encapsulation{Transport: link.Raw, SrcMAC: srcMAC}.Encapsulate(returned.Bytes())
+	other := ethercat.NewEtherCAT()
+	other.AppendDatagram(datagram.LRD(0, 3))
+	otherEthernet, _ := link.Encapsulation{Transport: link.Raw, SrcMAC: srcMAC}.Encapsulate(other.Bytes())
+
+	// when
+	match, otherMatch := tmpl.Match(ethernet), tmpl.Match(otherEthernet)
+	data, wkc := tmpl.Returned(ethernet, 0)
+
+	// then
+	if !match || otherMatch {
+		t.Errorf("Expected only the return to match, but got %v and %v", match, otherMatch)
+	}
+	if !reflect.DeepEqual(data, []byte{0xaa, 0xbb}) || wkc != 3 {
+		t.Errorf("Expected aa bb with WKC 3, but got % x with WKC %d", data, wkc)
+	}
+}
+
+func TestTemplateMatchIndices(t *testing.T) {
+	// given
+	tmpl, _ := link.NewTemplate(link.Encapsulation{Transport: link.Raw, SrcMAC: srcMAC}, datagram.LRD(0, 2), datagram.LRD(2, 2))
+	tmpl.SetIndex(0, 1)
+	tmpl.SetIndex(1, 2)
+	earlier := append([]byte{}, tmpl.Frame()...)
+	tmpl.SetIndex(0, 3)
+	tmpl.SetIndex(1, 4)
+
+	// when
+	match := tmpl.Match(earlier)
+	earlierMatch := tmpl.MatchIndices(earlier, []uint8{1, 2})
+	otherMatch := tmpl.MatchIndices(earlier, []uint8{1, 4})
+
+	// then
+	if match || !earlierMatch || otherMatch {
+		t.Errorf("Expected the frame to match only its own indices, but got %v, %v and %v", match, earlierMatch, otherMatch)
+	}
+}
+
+func TestTemplateTooLong(t *testing.T) {
+	// given
+	lrw := datagram.LRW(0, payload.BasicPayload{Data: make([]byte, 1490)})
+
+	// when
+	_, err := link.NewTemplate(link.Encapsulation{Transport: link.Raw, SrcMAC: srcMAC}, lrw)
+
+	// then
+	if err == nil {
+		t.Errorf("Expected an error for a frame beyond the MTU")
+	}
+}
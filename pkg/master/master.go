@@ -0,0 +1,480 @@
+// Package master owns the lifecycle of an EtherCAT segment: it scans the slaves, configures
+// their SyncManagers and FMMUs from the SII, moves them through the AL states and exchanges
+// the process image cyclically.
+//
+// A typical application scans, configures, starts cyclic mode and requests OP:
+//
+//	m := master.New(l, master.Config{Encapsulation: encap})
+//	defer m.Close()
+//	if _, err := m.Scan(ctx); err != nil { ... }
+//	if err := m.ConfigureSlaves(ctx); err != nil { ... }
+//	if err := m.Start(ctx); err != nil { ... }
+//	defer m.Stop()
+//	if err := m.SetState(ctx, al.Op); err != nil { ... }
+//
+// Every slave gets its outputs and then its inputs mapped one after the other into one logical
+// process image, which is exchanged with a single LRW per cycle.
+//
+// Config.Slaves describes the expected slaves, in Go or loaded with LoadSlaveConfigs from YAML.
+// Their identities are checked, and their SyncManagers, FMMUs, PDO assignments, init commands,
+// watchdogs and SYNC signals are set up on the way to OP.
+//
+// With Config.Supervision, cyclic mode also watches the slaves: slaves that stop answering
+// are taken out of the working counter expectation, and slaves that come back are addressed,
+// configured and brought to the requested state again, see Supervision.
+package master
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Aruminium/goecat/pkg/cycle"
+	"github.com/Aruminium/goecat/pkg/ethercat/al"
+	"github.com/Aruminium/goecat/pkg/ethercat/datagram"
+	"github.com/Aruminium/goecat/pkg/ethercat/mailbox"
+	"github.com/Aruminium/goecat/pkg/ethercat/payload"
+	"github.com/Aruminium/goecat/pkg/ethercat/payload/fmmu"
+	"github.com/Aruminium/goecat/pkg/ethercat/register"
+	"github.com/Aruminium/goecat/pkg/ethercat/sii"
+	"github.com/Aruminium/goecat/pkg/ethercat/wkc"
+	"github.com/Aruminium/goecat/pkg/link"
+	"github.com/Aruminium/goecat/pkg/scan"
+	"github.com/Aruminium/goecat/pkg/topology"
+	"github.com/Aruminium/goecat/pkg/transceiver"
+)
+
+const (
+	// DefaultCycleTime is used when Config.CycleTime is zero.
+	DefaultCycleTime = time.Millisecond
+	// DefaultStateTimeout is used when Config.StateTimeout is zero.
+	DefaultStateTimeout = 5 * time.Second
+)
+
+// statePollInterval is how often AL Status is polled while waiting for a requested state.
+const statePollInterval = 10 * time.Millisecond
+
+var (
+	// ErrNotScanned is returned by methods that need the slaves before Scan succeeded.
+	ErrNotScanned = errors.New("master: segment has not been scanned")
+	// ErrNotConfigured is returned by methods that need the process image before ConfigureSlaves succeeded.
+	ErrNotConfigured = errors.New("master: slaves have not been configured")
+	// ErrRunning is returned by Start while cyclic mode is running.
+	ErrRunning = errors.New("master: cyclic mode is already running")
+	// ErrNoSlave is returned for a position without a slave.
+	ErrNoSlave = errors.New("master: no slave at this position")
+)
+
+// Config configures a Master.
+type Config struct {
+	Encapsulation link.Encapsulation      // How EtherCAT frames are carried in Ethernet frames
+	Timeout       time.Duration           // Time to wait for a datagram, transceiver.DefaultTimeout if zero
+	Retry         transceiver.RetryPolicy // Policy for timed-out acyclic datagrams, transceiver.NoRetry if nil
+	FirstStation  uint16                  // Station address of the first slave, scan.DefaultFirstStation if zero
+	// AliasAddressing lets configured address datagrams reach slaves by their station alias,
+	// see scan.Options.AliasAddressing.
+	AliasAddressing bool
+	LogicalStart    uint32        // Logical address of the process image
+	CycleTime       time.Duration // Period of cyclic mode, DefaultCycleTime if zero
+	StateTimeout    time.Duration // Time to wait for the slaves to reach a state, DefaultStateTimeout if zero
+	Slaves          []SlaveConfig // Expected slaves; slaves without a configuration are set up from their SII
+	Supervision     *Supervision  // Watches the slaves in cyclic mode, nothing if nil
+
+	// Scheduler runs cyclic mode on a real-time thread every Scheduler.Period instead of on a ticker of
+	// CycleTime, see cycle.Scheduler.
+	Scheduler *cycle.Scheduler
+
+	// OnCycle is called after every cycle of cyclic mode with the time the cycle started, how
+	// long the exchange took and its error, for example to feed metrics.Exporter.ObserveCycle.
+	OnCycle func(start time.Time, duration time.Duration, err error)
+}
+
+// Region is a part of the process image.
+type Region struct {
+	Offset int // Offset in the process image
+	Length int // Length in bytes
+}
+
+// Slave is a slave of the segment with its place in the process image.
+type Slave struct {
+	scan.Slave
+	Outputs Region       // Outputs of the slave, written by the master
+	Inputs  Region       // Inputs of the slave, read by the master
+	FMMUs   []fmmu.FMMU  // FMMUs configured by ConfigureSlaves
+	Config  *SlaveConfig // Configuration from Config.Slaves, nil if there is none
+	Group   int          // Index of the hot-connect group in Supervision.HotConnect, -1 if none
+	Lost    bool         // The slave stopped answering in cyclic mode and has not come back
+}
+
+// StateError is returned when a slave refuses or does not reach a requested state.
+type StateError struct {
+	Position  uint16
+	Requested al.State      // Requested state
+	State     al.State      // AL Status when the request failed
+	Code      al.StatusCode // AL Status Code
+	Err       error         // Context error if the slave did not answer in time, nil if it refused
+}
+
+func (e *StateError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("master: slave %d: %v not reached, still in %v: %v", e.Position, e.Requested, e.State, e.Err)
+	}
+	return fmt.Sprintf("master: slave %d: %v refused, now in %v: %v", e.Position, e.Requested, e.State, e.Code)
+}
+
+func (e *StateError) Unwrap() error {
+	return e.Err
+}
+
+// Master drives one segment. Its methods are safe for concurrent use, but Scan,
+// ConfigureSlaves and SetState are not meant to run at the same time.
+type Master struct {
+	cfg Config
+	x   *transceiver.Transceiver
+
+	// transitions serialises SetState with the supervision of cyclic mode.
+	transitions sync.Mutex
+
+	mu         sync.Mutex
+	slaves     []Slave
+	tree       *topology.Tree // Wiring found by Scan, nil if the port states were inconsistent
+	configured bool
+	mismatch   error                 // Identity errors of the last ConfigureSlaves, which refuse SAFE-OP and OP
+	writes     [][]datagram.Datagram // Configuration datagrams of every slave, written again on recovery
+	target     al.State              // State last requested by SetState
+	image      []byte                // Process image as sent in the next cycle, with the last inputs
+	expect     wkc.Expectation
+	expects    []transceiver.Expectation // expect as passed to every cycle
+	template   *link.Template            // Cyclic frame with the LRW of the image, nil if it cannot be built
+	cancel     context.CancelFunc        // Stops cyclic mode, nil while it is not running
+	done       chan struct{}             // Closed when cyclic mode has stopped
+}
+
+// New creates a Master on a link. The link is owned by the Master and closed by Close.
+//
+// Parameters:
+//   - l (link.Link): Link to the segment
+//   - cfg (Config): Encapsulation, timing and process image address
+//
+// Returns:
+//   - *Master: New master without slaves
+func New(l link.Link, cfg Config) *Master {
+	if cfg.CycleTime == 0 {
+		cfg.CycleTime = DefaultCycleTime
+	}
+	if cfg.StateTimeout == 0 {
+		cfg.StateTimeout = DefaultStateTimeout
+	}
+	x := transceiver.New(l, transceiver.Options{Encapsulation: cfg.Encapsulation, Timeout: cfg.Timeout, Retry: cfg.Retry})
+	return &Master{cfg: cfg, x: x, target: al.Init}
+}
+
+// Transceiver returns the transceiver of the segment for acyclic access, such as diag or metrics.
+func (m *Master) Transceiver() *transceiver.Transceiver {
+	return m.x
+}
+
+// Close stops cyclic mode and closes the link.
+//
+// Returns:
+//   - error: Error returned by closing the link
+func (m *Master) Close() error {
+	m.Stop()
+	return m.x.Close()
+}
+
+// Scan discovers the slaves, assigns their station addresses and reads their SII.
+// A new scan discards the configuration of the previous one. The hot-connect groups of
+// Config.Supervision are identified among the slaves; a group that is not connected is left
+// out until the next scan.
+//
+// Parameters:
+//   - ctx (context.Context): Context bounding the scan
+//
+// Returns:
+//   - []Slave: Slaves in the order of their positions
+//   - error: scan.ErrNoSlaves if the segment is empty, or an error if a slave does not answer
+func (m *Master) Scan(ctx context.Context) ([]Slave, error) {
+	scanned, err := scan.Scan(ctx, m.x, scan.Options{FirstStation: m.cfg.FirstStation, AliasAddressing: m.cfg.AliasAddressing})
+	if err != nil {
+		return nil, err
+	}
+
+	slaves := make([]Slave, len(scanned))
+	for i, s := range scanned {
+		slaves[i] = Slave{Slave: s, Group: -1}
+	}
+	if m.cfg.Supervision != nil {
+		assignGroups(slaves, m.cfg.Supervision.HotConnect)
+	}
+	tree, err := topology.Build(scanned)
+	if err != nil {
+		tree = nil
+	}
+
+	m.mu.Lock()
+	m.slaves, m.tree, m.configured, m.mismatch, m.writes = slaves, tree, false, nil, nil
+	m.image, m.expect, m.target = nil, wkc.Expectation{}, al.Init
+	if m.template != nil {
+		m.x.Release(m.template)
+		m.template = nil
+	}
+	m.mu.Unlock()
+	return m.Slaves(), nil
+}
+
+// Slaves returns the slaves found by the last Scan with their last known state.
+func (m *Master) Slaves() []Slave {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	result := make([]Slave, len(m.slaves))
+	for i, s := range m.slaves {
+		result[i] = s
+		result[i].FMMUs = append([]fmmu.FMMU(nil), s.FMMUs...)
+	}
+	return result
+}
+
+// SlaveByAlias returns a slave given relative to the first slave with a station alias, the way
+// SlaveConfig.Alias refers to it.
+//
+// Parameters:
+//   - alias (uint16): Station alias of the reference slave, 0 to count from the first slave
+//   - offset (uint16): Position of the slave after the reference slave
+//
+// Returns:
+//   - Slave: The slave
+//   - error: ErrNoSlave if no slave has the alias or the position is beyond the last slave
+func (m *Master) SlaveByAlias(alias uint16, offset uint16) (Slave, error) {
+	slaves := m.Slaves()
+	position, ok := SlaveConfig{Alias: alias, Position: offset}.find(slaves)
+	if !ok {
+		return Slave{}, fmt.Errorf("%w alias %d + %d", ErrNoSlave, alias, offset)
+	}
+	return slaves[position], nil
+}
+
+// SetAlias writes the station alias of a slave into its SII EEPROM and reloads the EEPROM, so
+// that the station alias register and Slave.Alias take it over. With Config.AliasAddressing,
+// the slave is addressed by the new alias after the next Scan.
+//
+// Parameters:
+//   - ctx (context.Context): Context bounding the EEPROM access
+//   - position (uint16): Position of the slave
+//   - alias (uint16): Station alias, 0 for none
+//
+// Returns:
+//   - error: ErrNoSlave, or an error if the EEPROM access fails
+func (m *Master) SetAlias(ctx context.Context, position uint16, alias uint16) error {
+	s, err := m.slave(position)
+	if err != nil {
+		return err
+	}
+	if err := sii.NewEEPROM(m.x, s.Station).WriteAlias(ctx, alias); err != nil {
+		return fmt.Errorf("master: slave %d: %w", position, err)
+	}
+	s.SII.Alias = alias
+	return m.refresh(ctx, &s)
+}
+
+// Mailbox returns a mailbox connection to a slave configured from its SII.
+//
+// Parameters:
+//   - position (uint16): Position of the slave
+//
+// Returns:
+//   - *mailbox.Conn: Connection to the standard mailbox
+//   - error: ErrNoSlave or mailbox.ErrNoMailbox
+func (m *Master) Mailbox(position uint16) (*mailbox.Conn, error) {
+	s, err := m.slave(position)
+	if err != nil {
+		return nil, err
+	}
+	if s.SII.StdRx.Size == 0 || s.SII.StdTx.Size == 0 {
+		return nil, fmt.Errorf("master: slave %d: %w", position, mailbox.ErrNoMailbox)
+	}
+	return mailbox.NewConn(m.x, s.Station, s.SII.StdRx, s.SII.StdTx), nil
+}
+
+// SetState brings all slaves to a state, passing the states in between: a slave in INIT goes
+// through PRE-OP and SAFE-OP to OP. BOOT is reached from INIT. Pending error indications are
+// acknowledged. Slaves need the process image to be exchanged before they accept OP, so Start
+// cyclic mode before requesting it. The configuration of a slave is applied during its
+// transitions, see SlaveConfig. Lost slaves are left out; the supervision brings them to the
+// state once they come back.
+//
+// Parameters:
+//   - ctx (context.Context): Context bounding the transitions
+//   - state (al.State): al.Init, al.PreOp, al.Bootstrap, al.SafeOp or al.Op
+//
+// Returns:
+//   - error: ErrNotScanned, ErrNotConfigured when leaving INIT unconfigured, the *IdentityError
+//     of ConfigureSlaves for SAFE-OP and OP, a *StateError, or an error applying a configuration
+func (m *Master) SetState(ctx context.Context, state al.State) error {
+	m.mu.Lock()
+	configured, mismatch, count := m.configured, m.mismatch, len(m.slaves)
+	m.mu.Unlock()
+	if count == 0 {
+		return ErrNotScanned
+	}
+	if !configured && state != al.Init && state != al.Bootstrap {
+		return ErrNotConfigured
+	}
+	if mismatch != nil && rank(state) >= rank(al.SafeOp) {
+		return mismatch
+	}
+
+	m.transitions.Lock()
+	defer m.transitions.Unlock()
+	m.mu.Lock()
+	m.target = state
+	m.mu.Unlock()
+
+	present := func(s Slave) bool { return !s.Lost }
+	for _, step := range steps(state) {
+		if state == al.Bootstrap && step == al.Bootstrap {
+			if err := m.configureBootMailboxes(ctx); err != nil {
+				return err
+			}
+		}
+		if err := m.request(ctx, step, state, present); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// request moves the included slaves that need it to step on their way to target and waits for them.
+func (m *Master) request(ctx context.Context, step al.State, target al.State, include func(Slave) bool) error {
+	slaves := m.Slaves()
+	var requested []int
+	transitions := make([]Transition, len(slaves))
+	for i, s := range slaves {
+		// A slave already in step only has its error indication acknowledged.
+		base := s.State.Base()
+		if !include(s) || base == step && !s.State.HasError() || base != step && !needs(base, step, target) {
+			continue
+		}
+		if base != step {
+			transitions[i] = transition(base, step)
+			if err := m.beforeTransition(ctx, s, transitions[i]); err != nil {
+				return err
+			}
+		}
+		request := step
+		if s.State.HasError() {
+			request |= al.Error
+		}
+		control := binary.LittleEndian.AppendUint16(nil, uint16(request))
+		if _, err := m.x.ExchangeExpect(ctx, datagram.FPWR(s.Station, register.ALControl, payload.BasicPayload{Data: control}), transceiver.ExpectWKC(1)); err != nil {
+			return fmt.Errorf("master: slave %d: %w", s.Position, err)
+		}
+		requested = append(requested, i)
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, m.cfg.StateTimeout)
+	defer cancel()
+	for _, i := range requested {
+		if err := m.wait(waitCtx, &slaves[i], step); err != nil {
+			return err
+		}
+	}
+	for _, i := range requested {
+		if err := m.afterTransition(ctx, slaves[i], transitions[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// wait polls AL Status until a slave reaches a state or indicates an error.
+func (m *Master) wait(ctx context.Context, s *Slave, state al.State) error {
+	for {
+		if err := m.refresh(ctx, s); err != nil {
+			return err
+		}
+		switch {
+		case s.State.HasError():
+			return &StateError{Position: s.Position, Requested: state, State: s.State, Code: s.StatusCode}
+		case s.State.Base() == state:
+			return nil
+		}
+
+		t := time.NewTimer(statePollInterval)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return &StateError{Position: s.Position, Requested: state, State: s.State, Code: s.StatusCode, Err: ctx.Err()}
+		case <-t.C:
+		}
+	}
+}
+
+// refresh reads the state of a slave and stores it in the slaves of the master.
+func (m *Master) refresh(ctx context.Context, s *Slave) error {
+	if err := scan.Refresh(ctx, m.x, &s.Slave); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	if int(s.Position) < len(m.slaves) {
+		m.slaves[s.Position].Slave = s.Slave
+	}
+	m.mu.Unlock()
+	return nil
+}
+
+// slave returns a copy of the slave at position.
+func (m *Master) slave(position uint16) (Slave, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if int(position) >= len(m.slaves) {
+		return Slave{}, fmt.Errorf("%w %d", ErrNoSlave, position)
+	}
+	return m.slaves[position], nil
+}
+
+// steps returns the states to pass on the way to target.
+func steps(target al.State) []al.State {
+	switch target {
+	case al.SafeOp:
+		return []al.State{al.PreOp, al.SafeOp}
+	case al.Op:
+		return []al.State{al.PreOp, al.SafeOp, al.Op}
+	case al.Bootstrap:
+		return []al.State{al.Init, al.Bootstrap}
+	default:
+		return []al.State{target}
+	}
+}
+
+// needs reports whether a slave in current has to be requested step on the way to target.
+// Intermediate steps only move slaves up; BOOT is always reached through INIT.
+func needs(current al.State, step al.State, target al.State) bool {
+	switch {
+	case current == target:
+		return false
+	case step == target || target == al.Bootstrap:
+		return true
+	default:
+		return rank(current) < rank(step)
+	}
+}
+
+// rank orders the states from INIT to OP.
+func rank(state al.State) int {
+	switch state {
+	case al.PreOp, al.Bootstrap:
+		return 1
+	case al.SafeOp:
+		return 2
+	case al.Op:
+		return 3
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,373 @@
+package master_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Aruminium/goecat/pkg/cycle"
+	"github.com/Aruminium/goecat/pkg/ethercat/al"
+	"github.com/Aruminium/goecat/pkg/ethercat/payload/syncmanager"
+	"github.com/Aruminium/goecat/pkg/ethercat/register"
+	"github.com/Aruminium/goecat/pkg/ethercat/sii"
+	"github.com/Aruminium/goecat/pkg/link"
+	"github.com/Aruminium/goecat/pkg/master"
+	"github.com/Aruminium/goecat/pkg/simulator"
+	"github.com/Aruminium/goecat/pkg/watchdog"
+)
+
+var encap = link.Encapsulation{Transport: link.Raw, SrcMAC: net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, 0x55}}
+
+const (
+	outputsAddress = register.ProcessDataRAM + 0x100
+	inputsAddress  = register.ProcessDataRAM + 0x200
+)
+
+// ioEEPROM returns the SII of a mailbox slave with one output byte on SM2 and one input byte on SM3.
+func ioEEPROM() []byte {
+	info := sii.Info{
+		Identity:        sii.Identity{VendorID: 0x0000079a, ProductCode: 0x00defede},
+		StdRx:           simulator.DefaultRxMailbox,
+		StdTx:           simulator.DefaultTxMailbox,
+		MailboxProtocol: sii.ProtocolCoE,
+	}
+	entry := []sii.PDOEntry{{Index: 0x7000, SubIndex: 1, DataType: 0x05, BitLength: 8}}
+	return info.Encode(
+		sii.SyncManagersCategory(
+			sii.SyncManager{Start: simulator.DefaultRxMailbox.Offset, Length: simulator.DefaultRxMailbox.Size, Control: 0x26, Enable: 1, Type: sii.SMMailboxOut},
+			sii.SyncManager{Start: simulator.DefaultTxMailbox.Offset, Length: simulator.DefaultTxMailbox.Size, Control: 0x22, Enable: 1, Type: sii.SMMailboxIn},
+			sii.SyncManager{Start: outputsAddress, Control: 0x64, Enable: 1, Type: sii.SMOutputs},
+			sii.SyncManager{Start: inputsAddress, Control: 0x20, Enable: 1, Type: sii.SMInputs},
+		),
+		sii.PDOsCategory(sii.CategoryRxPDO, sii.PDO{Index: 0x1600, SyncManager: 2, Entries: entry}),
+		sii.PDOsCategory(sii.CategoryTxPDO, sii.PDO{Index: 0x1a00, SyncManager: 3, Entries: entry}),
+	)
+}
+
+// newMaster returns a master on a segment of a mailbox slave that echoes its outputs to its
+// inputs, followed by a slave without process data.
+func newMaster(t *testing.T, cfg master.Config, transition func(from al.State, to al.State) al.StatusCode) *master.Master {
+	m, _ := newSegment(t, cfg, transition)
+	return m
+}
+
+// newSegment returns the master of newMaster together with the echoing slave, whose object
+// dictionary holds the PDO assignments and a parameter 0x8000:01.
+func newSegment(t *testing.T, cfg master.Config, transition func(from al.State, to al.State) al.StatusCode) (*master.Master, *simulator.MailboxSlave) {
+	echo := simulator.NewMailboxSlave(simulator.MailboxConfig{
+		Config: simulator.Config{
+			EEPROM:      ioEEPROM(),
+			Transition:  transition,
+			Application: func(e *simulator.ESC) { e.Write(inputsAddress, e.Read(outputsAddress, 1)) },
+		},
+		Dictionary: simulator.ObjectDictionary{
+			0x1c12: simulator.Record("RxPDO assign", simulator.ReadWrite, simulator.Entry{Access: simulator.ReadWrite, Value: simulator.U16(0)}),
+			0x1c13: simulator.Record("TxPDO assign", simulator.ReadWrite, simulator.Entry{Access: simulator.ReadWrite, Value: simulator.U16(0)}),
+			0x8000: simulator.Record("Settings", simulator.ReadOnly, simulator.Entry{Access: simulator.ReadWrite, Value: simulator.U16(0)}),
+		},
+	})
+	plain := simulator.NewESC(simulator.Config{EEPROM: sii.Info{}.Encode()})
+
+	cfg.Encapsulation = encap
+	m := master.New(simulator.NewRing(echo.ESC, plain).Attach(), cfg)
+	t.Cleanup(func() { m.Close() })
+	return m, echo
+}
+
+func TestLifecycle(t *testing.T) {
+	// given
+	m := newMaster(t, master.Config{}, nil)
+	ctx := context.Background()
+
+	// when
+	_, scanErr := m.Scan(ctx)
+	configureErr := m.ConfigureSlaves(ctx)
+	stateErr := m.SetState(ctx, al.Op)
+	outputsErr := m.SetOutputs(0, []byte{0x5a})
+	// The echo is applied after the frame, so the inputs arrive with the second cycle.
+	firstErr := m.Cycle(ctx)
+	secondErr := m.Cycle(ctx)
+	inputs, inputsErr := m.Inputs(0)
+
+	// then
+	for _, err := range []error{scanErr, configureErr, stateErr, outputsErr, firstErr, secondErr, inputsErr} {
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	slaves := m.Slaves()
+	if slaves[0].State != al.Op || slaves[1].State != al.Op {
+		t.Errorf("Expected both slaves in OP, but got %v and %v", slaves[0].State, slaves[1].State)
+	}
+	if slaves[0].Outputs != (master.Region{Offset: 0, Length: 1}) || slaves[0].Inputs != (master.Region{Offset: 1, Length: 1}) || slaves[1].Inputs.Length != 0 {
+		t.Errorf("Expected one output and one input byte of the first slave, but got %+v", slaves)
+	}
+	if !reflect.DeepEqual(inputs, []byte{0x5a}) {
+		t.Errorf("Expected the echoed outputs, but got % x", inputs)
+	}
+}
+
+func TestStartStop(t *testing.T) {
+	// given
+	cycles := make(chan error, 100)
+	m := newMaster(t, master.Config{CycleTime: time.Millisecond, OnCycle: func(start time.Time, duration time.Duration, err error) {
+		select {
+		case cycles <- err:
+		default:
+		}
+	}}, nil)
+	ctx := context.Background()
+	m.Scan(ctx)
+	m.ConfigureSlaves(ctx)
+
+	// when
+	startErr := m.Start(ctx)
+	againErr := m.Start(ctx)
+	stateErr := m.SetState(ctx, al.Op)
+	cycleErr := <-cycles
+	m.Stop()
+
+	// then
+	if startErr != nil || stateErr != nil || cycleErr != nil {
+		t.Fatalf("Unexpected errors: %v, %v, %v", startErr, stateErr, cycleErr)
+	}
+	if !errors.Is(againErr, master.ErrRunning) {
+		t.Errorf("Expected %v, but got %v", master.ErrRunning, againErr)
+	}
+	if err := m.Start(ctx); err != nil {
+		t.Errorf("Expected cyclic mode to start again after Stop, but got %v", err)
+	}
+}
+
+func TestStartScheduler(t *testing.T) {
+	// given
+	scheduler, _ := cycle.New(cycle.Options{Period: time.Millisecond, Spin: 100 * time.Microsecond})
+	cycles := make(chan error, 100)
+	m := newMaster(t, master.Config{Scheduler: scheduler, OnCycle: func(start time.Time, duration time.Duration, err error) {
+		select {
+		case cycles <- err:
+		default:
+		}
+	}}, nil)
+	ctx := context.Background()
+	m.Scan(ctx)
+	m.ConfigureSlaves(ctx)
+
+	// when
+	startErr := m.Start(ctx)
+	stateErr := m.SetState(ctx, al.Op)
+	cycleErr := <-cycles
+	m.Stop()
+
+	// then
+	if startErr != nil || stateErr != nil || cycleErr != nil {
+		t.Fatalf("Unexpected errors: %v, %v, %v", startErr, stateErr, cycleErr)
+	}
+	if stats := scheduler.Stats(); stats.Cycles == 0 {
+		t.Errorf("Expected the scheduler to run the cycles, but got %v", stats)
+	}
+	if err := m.Start(ctx); err != nil {
+		t.Errorf("Expected cyclic mode to start again after Stop, but got %v", err)
+	}
+}
+
+func TestSetStateRefused(t *testing.T) {
+	// given
+	refuse := func(from al.State, to al.State) al.StatusCode {
+		if to == al.SafeOp {
+			return al.InvalidOutputConfiguration
+		}
+		return al.NoError
+	}
+	m := newMaster(t, master.Config{}, refuse)
+	ctx := context.Background()
+	m.Scan(ctx)
+
+	// when
+	unconfiguredErr := m.SetState(ctx, al.PreOp)
+	m.ConfigureSlaves(ctx)
+	err := m.SetState(ctx, al.Op)
+
+	// then
+	if !errors.Is(unconfiguredErr, master.ErrNotConfigured) {
+		t.Errorf("Expected %v, but got %v", master.ErrNotConfigured, unconfiguredErr)
+	}
+	var stateErr *master.StateError
+	if !errors.As(err, &stateErr) || stateErr.Position != 0 || stateErr.Requested != al.SafeOp || stateErr.Code != al.InvalidOutputConfiguration {
+		t.Errorf("Expected slave 0 to refuse SAFE-OP, but got %v", err)
+	}
+}
+
+const slavesYAML = `
+slaves:
+  - position: 0
+    name: echo
+    identity: {vendor: 0x0000079a, product: 0x00defede}
+    syncManagers:
+      - {index: 2, start: 0x1100, control: 0x64}
+      - {index: 3, start: 0x1200, length: 2, control: 0x20}
+    fmmus: [{syncManager: 2}, {syncManager: 3}]
+    pdoAssignment: {2: [0x1600], 3: [0x1a00]}
+    initCommands:
+      - {transition: PS, index: 0x8000, subIndex: 1, data: "e8 03", comment: filter time}
+    watchdog: {pdi: 100ms, processData: 10ms}
+    dc: {assignActivate: 0x0300, sync0Cycle: 1ms}
+`
+
+func TestLoadSlaveConfigs(t *testing.T) {
+	// given
+	expected := []master.SlaveConfig{{
+		Position: 0,
+		Name:     "echo",
+		Identity: master.Identity{VendorID: 0x0000079a, ProductCode: 0x00defede},
+		SyncManagers: []master.SyncManager{
+			{Index: 2, SyncManager: syncmanager.SyncManager{Start: outputsAddress, CtrlStatus: *syncmanager.NewCtrlStatusFromUint16(0x64)}},
+			{Index: 3, SyncManager: syncmanager.SyncManager{Start: inputsAddress, Length: 2, CtrlStatus: *syncmanager.NewCtrlStatusFromUint16(0x20)}},
+		},
+		FMMUs:         []master.FMMU{{SyncManager: 2}, {SyncManager: 3}},
+		PDOAssignment: map[int][]uint16{2: {0x1600}, 3: {0x1a00}},
+		InitCommands:  []master.InitCommand{{Transition: master.TransitionPS, Index: 0x8000, SubIndex: 1, Data: master.Bytes{0xe8, 0x03}, Comment: "filter time"}},
+		Watchdog:      &watchdog.Config{PDI: 100 * time.Millisecond, ProcessData: 10 * time.Millisecond},
+		DC:            &master.DC{AssignActivate: 0x0300, Sync0Cycle: time.Millisecond},
+	}}
+
+	// when
+	configs, err := master.LoadSlaveConfigs(strings.NewReader(slavesYAML))
+	_, unknownErr := master.LoadSlaveConfigs(strings.NewReader("slaves:\n  - {position: 0, colour: red}\n"))
+	_, transitionErr := master.LoadSlaveConfigs(strings.NewReader("slaves:\n  - initCommands: [{transition: XY, index: 0x8000}]\n"))
+
+	// then
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(configs, expected) {
+		t.Errorf("Expected %+v, but got %+v", expected, configs)
+	}
+	if unknownErr == nil || transitionErr == nil {
+		t.Errorf("Expected errors for an unknown field and an unknown transition, but got %v and %v", unknownErr, transitionErr)
+	}
+}
+
+func TestSlaveConfig(t *testing.T) {
+	// given
+	configs, err := master.LoadSlaveConfigs(strings.NewReader(slavesYAML))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	m, echo := newSegment(t, master.Config{Slaves: configs}, nil)
+	ctx := context.Background()
+	m.Scan(ctx)
+
+	// when
+	configureErr := m.ConfigureSlaves(ctx)
+	stateErr := m.SetState(ctx, al.Op)
+
+	// then
+	if configureErr != nil || stateErr != nil {
+		t.Fatalf("Unexpected errors: %v, %v", configureErr, stateErr)
+	}
+	slaves := m.Slaves()
+	if slaves[0].Config == nil || slaves[0].Config.Name != "echo" || slaves[1].Config != nil {
+		t.Errorf("Expected the configuration on the first slave only, but got %+v and %+v", slaves[0].Config, slaves[1].Config)
+	}
+	if slaves[0].Outputs != (master.Region{Offset: 0, Length: 1}) || slaves[0].Inputs != (master.Region{Offset: 1, Length: 2}) {
+		t.Errorf("Expected one output byte from the assigned PDO and two configured input bytes, but got %+v and %+v", slaves[0].Outputs, slaves[0].Inputs)
+	}
+	for _, v := range []struct {
+		index    uint16
+		subIndex uint8
+		expected []byte
+	}{
+		{0x1c12, 0, []byte{1}},
+		{0x1c12, 1, []byte{0x00, 0x16}},
+		{0x1c13, 1, []byte{0x00, 0x1a}},
+		{0x8000, 1, []byte{0xe8, 0x03}},
+	} {
+		if value, _ := echo.Value(v.index, v.subIndex); !reflect.DeepEqual(value, v.expected) {
+			t.Errorf("Expected 0x%04x:%02x to be % x, but got % x", v.index, v.subIndex, v.expected, value)
+		}
+	}
+	if watchdog := echo.Read(register.WatchdogTimeProcessData, 2); !reflect.DeepEqual(watchdog, []byte{100, 0}) {
+		t.Errorf("Expected a process data watchdog of 100, but got % x", watchdog)
+	}
+	if sync := echo.Read(register.DCCyclicUnitControl, 2); !reflect.DeepEqual(sync, []byte{0x00, 0x03}) {
+		t.Errorf("Expected SYNC0 to be activated, but got % x", sync)
+	}
+	if cycle := echo.Read(register.DCSync0CycleTime, 4); !reflect.DeepEqual(cycle, []byte{0x40, 0x42, 0x0f, 0x00}) {
+		t.Errorf("Expected a SYNC0 cycle of 1 ms, but got % x", cycle)
+	}
+}
+
+func TestIdentityMismatch(t *testing.T) {
+	// given
+	configs := []master.SlaveConfig{
+		{Position: 0, Identity: master.Identity{VendorID: 0x0000079a, ProductCode: 0x12345678}},
+		{Position: 2, Identity: master.Identity{VendorID: 0x0000079a}},
+	}
+	m := newMaster(t, master.Config{Slaves: configs}, nil)
+	ctx := context.Background()
+	m.Scan(ctx)
+
+	// when
+	configureErr := m.ConfigureSlaves(ctx)
+	preOpErr := m.SetState(ctx, al.PreOp)
+	opErr := m.SetState(ctx, al.Op)
+
+	// then
+	var mismatch *master.IdentityError
+	if !errors.As(configureErr, &mismatch) || mismatch.Position != 0 || mismatch.Actual.ProductCode != 0x00defede {
+		t.Errorf("Expected slave 0 to mismatch, but got %v", configureErr)
+	}
+	if !strings.Contains(fmt.Sprint(configureErr), "slave 2: expected vendor 0x0000079a product 0x00000000 revision 0x00000000, but the slave is missing") {
+		t.Errorf("Expected slave 2 to be missing, but got %v", configureErr)
+	}
+	if preOpErr != nil {
+		t.Errorf("Expected PRE-OP to be reachable for inspection, but got %v", preOpErr)
+	}
+	if !errors.As(opErr, &mismatch) {
+		t.Errorf("Expected OP to be refused, but got %v", opErr)
+	}
+	if slaves := m.Slaves(); slaves[0].State != al.PreOp {
+		t.Errorf("Expected slave 0 to stay in PRE-OP, but got %v", slaves[0].State)
+	}
+}
+
+func TestAlias(t *testing.T) {
+	// given
+	configs, loadErr := master.LoadSlaveConfigs(strings.NewReader(`
+slaves:
+  - {alias: 100, position: 0, name: plain}
+  - {alias: 7, position: 1, identity: {vendor: 0x0000079a}}
+`))
+	m := newMaster(t, master.Config{Slaves: configs}, nil)
+	ctx := context.Background()
+	m.Scan(ctx)
+
+	// when
+	setErr := m.SetAlias(ctx, 1, 100)
+	found, foundErr := m.SlaveByAlias(100, 0)
+	_, beyondErr := m.SlaveByAlias(100, 1)
+	configureErr := m.ConfigureSlaves(ctx)
+
+	// then
+	if loadErr != nil || setErr != nil || foundErr != nil {
+		t.Fatalf("Unexpected errors: %v, %v, %v", loadErr, setErr, foundErr)
+	}
+	if found.Position != 1 || found.Alias != 100 || found.SII.Alias != 100 {
+		t.Errorf("Expected slave 1 with alias 100, but got slave %d with %d and %d", found.Position, found.Alias, found.SII.Alias)
+	}
+	if !errors.Is(beyondErr, master.ErrNoSlave) {
+		t.Errorf("Expected %v, but got %v", master.ErrNoSlave, beyondErr)
+	}
+	if slaves := m.Slaves(); slaves[1].Config == nil || slaves[1].Config.Name != "plain" {
+		t.Errorf("Expected the configuration of alias 100 on slave 1, but got %+v", slaves[1].Config)
+	}
+	if !strings.Contains(fmt.Sprint(configureErr), "slave alias 7 + 1: expected vendor 0x0000079a product 0x00000000 revision 0x00000000, but the slave is missing") {
+		t.Errorf("Expected alias 7 + 1 to be missing, but got %v", configureErr)
+	}
+}
@@ -0,0 +1,482 @@
+package master
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Aruminium/goecat/pkg/ethercat/datagram"
+	"github.com/Aruminium/goecat/pkg/ethercat/payload"
+	"github.com/Aruminium/goecat/pkg/ethercat/payload/fmmu"
+	"github.com/Aruminium/goecat/pkg/ethercat/payload/syncmanager"
+	"github.com/Aruminium/goecat/pkg/ethercat/register"
+	"github.com/Aruminium/goecat/pkg/ethercat/sii"
+	"github.com/Aruminium/goecat/pkg/ethercat/wkc"
+	"github.com/Aruminium/goecat/pkg/link"
+	"github.com/Aruminium/goecat/pkg/transceiver"
+)
+
+// Mailbox SyncManagers as configured by ConfigureSlaves.
+const (
+	smMailboxOut = 0
+	smMailboxIn  = 1
+)
+
+// ConfigureSlaves writes the mailbox and process data SyncManagers and the FMMUs of every
+// slave, as described by its configuration or its SII, and lays out the process image. The
+// slaves have to be in INIT or PRE-OP.
+//
+// A process data SyncManager is as long as the PDOs assigned to it, or as its configured or SII
+// length if no PDO is assigned; SyncManagers of length zero are left disabled.
+//
+// The identities of configured slaves are checked against their SII. On a mismatch the slaves
+// are configured anyway, so that they can be inspected in PRE-OP, but SetState refuses SAFE-OP
+// and OP until a new Scan and ConfigureSlaves succeed.
+//
+// Parameters:
+//   - ctx (context.Context): Context bounding the exchanges
+//
+// Returns:
+//   - error: ErrNotScanned, an error if a configuration is invalid or a slave does not answer,
+//     or the *IdentityError of every mismatching or missing slave
+func (m *Master) ConfigureSlaves(ctx context.Context) error {
+	slaves := m.Slaves()
+	if len(slaves) == 0 {
+		return ErrNotScanned
+	}
+	for i := range slaves {
+		slaves[i].Config = nil
+	}
+	for i, c := range m.cfg.Slaves {
+		if err := c.Validate(); err != nil {
+			return err
+		}
+		if position, ok := c.find(slaves); ok {
+			slaves[position].Config = &m.cfg.Slaves[i]
+		}
+	}
+	mismatch := checkIdentities(slaves, m.cfg.Slaves)
+
+	offset := 0
+	var sms [][]datagram.Datagram
+	for i := range slaves {
+		s := &slaves[i]
+		var writes []datagram.Datagram
+		if mailboxSMs := mailboxSyncManagers(s.SII.StdRx, s.SII.StdTx); mailboxSMs != nil {
+			writes = append(writes,
+				datagram.FPWR(s.Station, register.SM(smMailboxOut), &mailboxSMs[0]),
+				datagram.FPWR(s.Station, register.SM(smMailboxIn), &mailboxSMs[1]))
+		}
+		if s.Config != nil {
+			writes = append(writes, watchdogWrites(s.Station, s.Config.Watchdog)...)
+		}
+
+		process, err := processSyncManagers(*s, s.Config)
+		if err != nil {
+			return err
+		}
+		// FMMUs are numbered in the order of the SyncManagers, while the process image holds
+		// all outputs before the inputs.
+		s.FMMUs = nil
+		for _, sm := range process {
+			if sm.mapped {
+				s.FMMUs = append(s.FMMUs, fmmu.FMMU{})
+			}
+		}
+		s.Outputs, s.Inputs = Region{Offset: offset}, Region{}
+		for _, outputs := range []bool{true, false} {
+			if !outputs {
+				s.Inputs = Region{Offset: offset}
+			}
+			channel := -1
+			for _, sm := range process {
+				if sm.mapped {
+					channel++
+				}
+				if sm.outputs() != outputs || sm.Length == 0 {
+					continue
+				}
+
+				writes = append(writes, datagram.FPWR(s.Station, register.SM(sm.Index), &sm.SyncManager.SyncManager))
+				if !sm.mapped {
+					continue
+				}
+				f := fmmu.FMMU{
+					LogStart: m.cfg.LogicalStart + uint32(offset), LogLength: sm.Length, LogEndBit: 7,
+					PhysStart: sm.Start, IsActivate: true,
+				}
+				if outputs {
+					f.AbleUseWrite = true
+					s.Outputs.Length += int(sm.Length)
+				} else {
+					f.AbleUseRead = true
+					s.Inputs.Length += int(sm.Length)
+				}
+				writes = append(writes, datagram.FPWR(s.Station, register.FMMU(channel), f))
+				s.FMMUs[channel] = f
+				offset += int(sm.Length)
+			}
+		}
+		sms = append(sms, writes)
+	}
+
+	for i, writes := range sms {
+		if slaves[i].Lost {
+			continue
+		}
+		if err := m.configure(ctx, slaves[i], writes); err != nil {
+			return err
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.slaves {
+		m.slaves[i].Outputs, m.slaves[i].Inputs, m.slaves[i].FMMUs = slaves[i].Outputs, slaves[i].Inputs, slaves[i].FMMUs
+		m.slaves[i].Config = slaves[i].Config
+	}
+	m.image, m.configured, m.mismatch, m.writes = make([]byte, offset), true, mismatch, sms
+	m.updateExpect()
+	m.prepareTemplate()
+	return mismatch
+}
+
+// configure writes the configuration datagrams of a slave.
+func (m *Master) configure(ctx context.Context, s Slave, writes []datagram.Datagram) error {
+	for _, d := range writes {
+		if _, err := m.x.ExchangeExpect(ctx, d, transceiver.ExpectWKC(1)); err != nil {
+			return fmt.Errorf("master: slave %d: %w", s.Position, err)
+		}
+	}
+	return nil
+}
+
+// updateExpect computes the working counter of the process image for the slaves that are not
+// lost. m.mu must be held.
+func (m *Master) updateExpect() {
+	var slaves []wkc.Slave
+	for _, s := range m.slaves {
+		if !s.Lost {
+			slaves = append(slaves, wkc.Slave{Position: s.Position, Station: s.Station, FMMUs: s.FMMUs})
+		}
+	}
+	m.expect = wkc.Expect(m.lrw(), slaves)
+	m.expects = []transceiver.Expectation{m.expect}
+}
+
+// prepareTemplate builds and reserves the cyclic frame for the process image. Without a template,
+// for example because the image does not fit into a frame, Cycle builds its frame every cycle.
+// m.mu must be held.
+func (m *Master) prepareTemplate() {
+	if m.template != nil {
+		m.x.Release(m.template)
+		m.template = nil
+	}
+	tmpl, err := link.NewTemplate(m.cfg.Encapsulation, m.lrw())
+	if err != nil || m.x.Reserve(tmpl) != nil {
+		return
+	}
+	m.template = tmpl
+}
+
+// configureBootMailboxes writes the bootstrap mailbox SyncManagers of the slaves that have one.
+func (m *Master) configureBootMailboxes(ctx context.Context) error {
+	for _, s := range m.Slaves() {
+		sms := mailboxSyncManagers(s.SII.BootRx, s.SII.BootTx)
+		if sms == nil {
+			continue
+		}
+		for n, sm := range sms {
+			if _, err := m.x.ExchangeExpect(ctx, datagram.FPWR(s.Station, register.SM(n), &sm), transceiver.ExpectWKC(1)); err != nil {
+				return fmt.Errorf("master: slave %d: %w", s.Position, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Cycle exchanges the process image once: the outputs are written and the inputs are read with
+// one LRW. The inputs are only taken over if the working counter is as expected.
+//
+// The LRW frame is prepared by ConfigureSlaves, so a cycle only copies the outputs into it and the
+// inputs out of the returned frame.
+//
+// Parameters:
+//   - ctx (context.Context): Context bounding the exchange
+//
+// Returns:
+//   - error: ErrNotConfigured, an error wrapping transceiver.ErrWKCMismatch, or the exchange error
+func (m *Master) Cycle(ctx context.Context) error {
+	m.mu.Lock()
+	if !m.configured {
+		m.mu.Unlock()
+		return ErrNotConfigured
+	}
+	tmpl := m.template
+	if tmpl == nil {
+		m.mu.Unlock()
+		return m.cycleFrame(ctx)
+	}
+	copy(tmpl.Data(0), m.image)
+	expect := m.expects
+	m.mu.Unlock()
+
+	ethernet, err := m.x.CycleTemplate(ctx, tmpl, expect)
+	if err != nil {
+		return err
+	}
+	data, _ := tmpl.Returned(ethernet, 0)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.takeInputs(data)
+	return nil
+}
+
+// cycleFrame is Cycle with a frame built for this cycle.
+func (m *Master) cycleFrame(ctx context.Context) error {
+	m.mu.Lock()
+	d, expect := m.lrw(), m.expect
+	m.mu.Unlock()
+
+	returned, err := m.x.CycleExpect(ctx, []datagram.Datagram{d}, []transceiver.Expectation{expect})
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.takeInputs(returned[0].Data.Bytes())
+	return nil
+}
+
+// takeInputs copies the inputs of every slave from the returned LRW data into the image. m.mu must be held.
+func (m *Master) takeInputs(data []byte) {
+	for _, s := range m.slaves {
+		in := s.Inputs
+		if in.Length > 0 && in.Offset+in.Length <= len(data) && in.Offset+in.Length <= len(m.image) {
+			copy(m.image[in.Offset:in.Offset+in.Length], data[in.Offset:])
+		}
+	}
+}
+
+// Start runs Cycle every Config.CycleTime in its own goroutine until ctx is done or Stop is
+// called, or on Config.Scheduler every period of the scheduler. Acyclic datagrams are sent after
+// the cyclic frames meanwhile. With Config.Supervision, the slaves are supervised in another
+// goroutine.
+//
+// Parameters:
+//   - ctx (context.Context): Context stopping cyclic mode
+//
+// Returns:
+//   - error: ErrNotConfigured, ErrRunning, or the error of starting Config.Scheduler
+func (m *Master) Start(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.configured {
+		return ErrNotConfigured
+	}
+	if m.cancel != nil {
+		return ErrRunning
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	m.x.SetCyclic(true)
+
+	var wg sync.WaitGroup
+	// wake tells the supervision about a working counter mismatch without waiting for its interval.
+	wake := make(chan struct{}, 1)
+	if s := m.cfg.Scheduler; s != nil {
+		if err := s.Start(ctx, func() { m.tick(ctx, wake, s.Period()) }); err != nil {
+			cancel()
+			m.x.SetCyclic(false)
+			return err
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer m.x.SetCyclic(false)
+			s.Wait()
+		}()
+	} else {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m.run(ctx, wake)
+		}()
+	}
+	m.cancel, m.done = cancel, make(chan struct{})
+	if m.cfg.Supervision != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			newSupervisor(m, *m.cfg.Supervision).run(ctx, wake)
+		}()
+	}
+	go func(done chan struct{}) {
+		wg.Wait()
+		close(done)
+	}(m.done)
+	return nil
+}
+
+// Stop stops cyclic mode and waits for the last cycle. It does nothing if cyclic mode is not running.
+func (m *Master) Stop() {
+	m.mu.Lock()
+	cancel, done := m.cancel, m.done
+	m.cancel, m.done = nil, nil
+	m.mu.Unlock()
+	if cancel == nil {
+		return
+	}
+
+	cancel()
+	<-done
+}
+
+// run exchanges the process image every cycle until ctx is done.
+func (m *Master) run(ctx context.Context, wake chan<- struct{}) {
+	defer m.x.SetCyclic(false)
+
+	ticker := time.NewTicker(m.cfg.CycleTime)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		m.tick(ctx, wake, m.cfg.CycleTime)
+	}
+}
+
+// tick runs one cycle of cyclic mode, bounded by period, and reports it.
+func (m *Master) tick(ctx context.Context, wake chan<- struct{}, period time.Duration) {
+	start := time.Now()
+	cycleCtx, cancel := context.WithTimeout(ctx, period)
+	err := m.Cycle(cycleCtx)
+	cancel()
+	if errors.Is(err, transceiver.ErrWKCMismatch) {
+		select {
+		case wake <- struct{}{}:
+		default:
+		}
+	}
+	if m.cfg.OnCycle != nil && !errors.Is(err, context.Canceled) {
+		m.cfg.OnCycle(start, time.Since(start), err)
+	}
+}
+
+// Outputs returns a copy of the outputs of a slave as they are sent in the next cycle.
+//
+// Parameters:
+//   - position (uint16): Position of the slave
+//
+// Returns:
+//   - []byte: Outputs, empty if the slave has none
+//   - error: ErrNoSlave or ErrNotConfigured
+func (m *Master) Outputs(position uint16) ([]byte, error) {
+	return m.region(position, func(s Slave) Region { return s.Outputs })
+}
+
+// Inputs returns a copy of the inputs of a slave from the last successful cycle.
+//
+// Parameters:
+//   - position (uint16): Position of the slave
+//
+// Returns:
+//   - []byte: Inputs, empty if the slave has none
+//   - error: ErrNoSlave or ErrNotConfigured
+func (m *Master) Inputs(position uint16) ([]byte, error) {
+	return m.region(position, func(s Slave) Region { return s.Inputs })
+}
+
+// SetOutputs sets the outputs of a slave for the next cycles.
+//
+// Parameters:
+//   - position (uint16): Position of the slave
+//   - data ([]byte): Outputs, at most as long as the outputs of the slave
+//
+// Returns:
+//   - error: ErrNoSlave, ErrNotConfigured or an error if data is too long
+func (m *Master) SetOutputs(position uint16, data []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if int(position) >= len(m.slaves) {
+		return fmt.Errorf("%w %d", ErrNoSlave, position)
+	}
+	if !m.configured {
+		return ErrNotConfigured
+	}
+	out := m.slaves[position].Outputs
+	if len(data) > out.Length {
+		return fmt.Errorf("master: slave %d: %d bytes of outputs, the slave has %d", position, len(data), out.Length)
+	}
+	copy(m.image[out.Offset:], data)
+	return nil
+}
+
+// region returns a copy of a region of the process image of a slave.
+func (m *Master) region(position uint16, get func(Slave) Region) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if int(position) >= len(m.slaves) {
+		return nil, fmt.Errorf("%w %d", ErrNoSlave, position)
+	}
+	if !m.configured {
+		return nil, ErrNotConfigured
+	}
+	r := get(m.slaves[position])
+	return append([]byte{}, m.image[r.Offset:r.Offset+r.Length]...), nil
+}
+
+// lrw returns the datagram that exchanges the process image. m.mu must be held.
+func (m *Master) lrw() datagram.Datagram {
+	return datagram.LRW(m.cfg.LogicalStart, payload.BasicPayload{Data: append([]byte{}, m.image...)})
+}
+
+// mailboxSyncManagers returns SyncManager 0 and 1 for a mailbox, or nil if there is none.
+func mailboxSyncManagers(rx sii.Mailbox, tx sii.Mailbox) []syncmanager.SyncManager {
+	if rx.Size == 0 || tx.Size == 0 {
+		return nil
+	}
+	return []syncmanager.SyncManager{
+		{
+			Start: rx.Offset, Length: rx.Size,
+			CtrlStatus: syncmanager.CtrlStatus{Access: 0x1, OpMode: 0x2},
+			Enable:     syncmanager.Enable{IsEnable: true},
+		},
+		{
+			Start: tx.Offset, Length: tx.Size,
+			CtrlStatus: syncmanager.CtrlStatus{OpMode: 0x2},
+			Enable:     syncmanager.Enable{IsEnable: true},
+		},
+	}
+}
+
+// processDataLength returns the length of process data SyncManager n in bytes.
+func processDataLength(image sii.Image, n int, sm sii.SyncManager) uint16 {
+	pdos := image.RxPDOs
+	if sm.Type == sii.SMInputs {
+		pdos = image.TxPDOs
+	}
+
+	bits, assigned := 0, false
+	for _, pdo := range pdos {
+		if int(pdo.SyncManager) != n {
+			continue
+		}
+		assigned = true
+		for _, entry := range pdo.Entries {
+			bits += int(entry.BitLength)
+		}
+	}
+	if !assigned {
+		return sm.Length
+	}
+	return uint16((bits + 7) / 8)
+}
@@ -0,0 +1,549 @@
+package master
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/Aruminium/goecat/pkg/ethercat/al"
+	"github.com/Aruminium/goecat/pkg/ethercat/coe"
+	"github.com/Aruminium/goecat/pkg/ethercat/datagram"
+	"github.com/Aruminium/goecat/pkg/ethercat/payload"
+	"github.com/Aruminium/goecat/pkg/ethercat/payload/syncmanager"
+	"github.com/Aruminium/goecat/pkg/ethercat/register"
+	"github.com/Aruminium/goecat/pkg/ethercat/sii"
+	"github.com/Aruminium/goecat/pkg/scan"
+	"github.com/Aruminium/goecat/pkg/transceiver"
+	"github.com/Aruminium/goecat/pkg/watchdog"
+)
+
+// DCStartDelay is how far after the current system time the SYNC signals of a slave start.
+const DCStartDelay = 100 * time.Millisecond
+
+// Transition names an AL state transition by the first letters of its states, as in ESI init commands.
+type Transition string
+
+const (
+	TransitionIP Transition = "IP" // INIT to PRE-OP
+	TransitionPS Transition = "PS" // PRE-OP to SAFE-OP
+	TransitionSO Transition = "SO" // SAFE-OP to OP
+)
+
+// SlaveConfig describes an expected slave and how the master sets it up. Zero fields fall back
+// to what the SII of the slave describes.
+//
+// The description is applied on the way to OP:
+//   - ConfigureSlaves checks the identity and writes the watchdogs, SyncManagers and FMMUs
+//   - INIT to PRE-OP: the IP init commands are sent once the mailbox works in PRE-OP
+//   - PRE-OP to SAFE-OP: the PDO assignment is downloaded, the PS init commands are sent and
+//     the SYNC signals are started before SAFE-OP is requested
+//   - SAFE-OP to OP: the SO init commands are sent before OP is requested
+type SlaveConfig struct {
+	// Alias refers to the slave relative to the first slave with this station alias, so that
+	// the configuration keeps applying when slaves are added in front of it. Zero counts from
+	// the first slave of the segment.
+	Alias    uint16   `yaml:"alias,omitempty"`
+	Position uint16   `yaml:"position"`       // Position of the slave after the slave with Alias, or in the segment
+	Name     string   `yaml:"name,omitempty"` // Name for messages, not checked
+	Identity Identity `yaml:"identity"`       // Identity the SII has to match
+
+	// SyncManagers replaces the process data SyncManagers of the SII. Mailbox SyncManagers
+	// always come from the SII. A SyncManager of length zero is as long as the PDOs assigned
+	// to it.
+	SyncManagers []SyncManager `yaml:"syncManagers,omitempty"`
+	// FMMUs maps the listed SyncManagers into the process image with one FMMU each, in the
+	// order of the list. Without it every process data SyncManager is mapped.
+	FMMUs []FMMU `yaml:"fmmus,omitempty"`
+	// PDOAssignment lists the PDOs assigned to a SyncManager, keyed by its index. It is
+	// downloaded to object 0x1C10 plus the index and sizes the SyncManager from the SII PDOs.
+	PDOAssignment map[int][]uint16 `yaml:"pdoAssignment,omitempty"`
+
+	InitCommands []InitCommand    `yaml:"initCommands,omitempty"` // SDO downloads per transition
+	Watchdog     *watchdog.Config `yaml:"watchdog,omitempty"`     // Watchdog times, untouched if nil
+	DC           *DC              `yaml:"dc,omitempty"`           // SYNC signals, untouched if nil
+}
+
+// Identity is the expected identity of a slave. Zero fields match any value.
+type Identity struct {
+	VendorID    uint32 `yaml:"vendor"`
+	ProductCode uint32 `yaml:"product"`
+	RevisionNo  uint32 `yaml:"revision,omitempty"`
+}
+
+// Matches reports whether the identity read from the SII is the expected one.
+//
+// Parameters:
+//   - id (sii.Identity): Identity read from the SII
+//
+// Returns:
+//   - bool: Whether every non-zero field equals the one of id
+func (i Identity) Matches(id sii.Identity) bool {
+	return (i.VendorID == 0 || i.VendorID == id.VendorID) &&
+		(i.ProductCode == 0 || i.ProductCode == id.ProductCode) &&
+		(i.RevisionNo == 0 || i.RevisionNo == id.RevisionNo)
+}
+
+func (i Identity) String() string {
+	return fmt.Sprintf("vendor 0x%08x product 0x%08x revision 0x%08x", i.VendorID, i.ProductCode, i.RevisionNo)
+}
+
+// SyncManager is a process data SyncManager of a slave. The master enables it when its length is not zero.
+//
+// In YAML the control register is given as one number:
+//
+//	{index: 2, start: 0x1000, length: 4, control: 0x64}
+type SyncManager struct {
+	Index int
+	syncmanager.SyncManager
+}
+
+// UnmarshalYAML decodes a SyncManager from its index, start, length and control register.
+func (s *SyncManager) UnmarshalYAML(value *yaml.Node) error {
+	var raw struct {
+		Index   int    `yaml:"index"`
+		Start   uint16 `yaml:"start"`
+		Length  uint16 `yaml:"length"`
+		Control uint16 `yaml:"control"`
+	}
+	if err := value.Decode(&raw); err != nil {
+		return err
+	}
+	*s = SyncManager{Index: raw.Index, SyncManager: syncmanager.SyncManager{
+		Start: raw.Start, Length: raw.Length, CtrlStatus: *syncmanager.NewCtrlStatusFromUint16(raw.Control),
+	}}
+	return nil
+}
+
+// outputs reports whether the master writes the SyncManager.
+func (s SyncManager) outputs() bool {
+	return s.CtrlStatus.Access == 0x1
+}
+
+// FMMU maps a process data SyncManager into the process image.
+type FMMU struct {
+	SyncManager int `yaml:"syncManager"`
+}
+
+// InitCommand is an SDO download sent during a transition.
+type InitCommand struct {
+	Transition Transition `yaml:"transition"`
+	Index      uint16     `yaml:"index"`
+	SubIndex   uint8      `yaml:"subIndex"`
+	Data       Bytes      `yaml:"data"`
+	Comment    string     `yaml:"comment,omitempty"`
+}
+
+// Bytes is data given in YAML as hexadecimal digits, optionally separated by spaces, such as "e8 03".
+type Bytes []byte
+
+// UnmarshalYAML decodes hexadecimal digits.
+func (b *Bytes) UnmarshalYAML(value *yaml.Node) error {
+	var s string
+	if err := value.Decode(&s); err != nil {
+		return err
+	}
+	data, err := hex.DecodeString(strings.ReplaceAll(s, " ", ""))
+	if err != nil {
+		return fmt.Errorf("line %d: %w", value.Line, err)
+	}
+	*b = data
+	return nil
+}
+
+// DC configures the SYNC signals of a slave. The master does not synchronise the clocks; the
+// signals start DCStartDelay after the system time of the slave.
+type DC struct {
+	AssignActivate uint16        `yaml:"assignActivate"`       // Cyclic unit control and activation (0x0980), such as 0x0300 for SYNC0
+	Sync0Cycle     time.Duration `yaml:"sync0Cycle"`           // SYNC0 cycle time
+	Sync0Shift     time.Duration `yaml:"sync0Shift,omitempty"` // Shift of the start time
+	Sync1Cycle     time.Duration `yaml:"sync1Cycle,omitempty"` // SYNC1 cycle time
+}
+
+// IdentityError is returned when the SII of a slave does not match its configuration, or when
+// a configured slave is missing.
+type IdentityError struct {
+	Position uint16 // Position of the slave, or after the slave with Alias if it is missing
+	Alias    uint16 // Station alias of SlaveConfig.Alias if the slave is missing
+	Expected Identity
+	Actual   sii.Identity // Identity read from the SII
+	Missing  bool         // No slave at the position
+}
+
+func (e *IdentityError) Error() string {
+	if e.Missing {
+		c := SlaveConfig{Alias: e.Alias, Position: e.Position}
+		return fmt.Sprintf("master: slave %s: expected %v, but the slave is missing", c.slave(), e.Expected)
+	}
+	return fmt.Sprintf("master: slave %d: expected %v, but found %v", e.Position, e.Expected, e.Actual)
+}
+
+// LoadSlaveConfigs reads slave configurations from a YAML document with a list of slaves:
+//
+//	slaves:
+//	  - position: 0
+//	    identity: {vendor: 0x0000079a, product: 0x00defede}
+//	    syncManagers:
+//	      - {index: 2, start: 0x1000, control: 0x64}
+//	      - {index: 3, start: 0x1200, control: 0x20}
+//	    pdoAssignment: {2: [0x1600], 3: [0x1a00]}
+//	    initCommands:
+//	      - {transition: PS, index: 0x8000, subIndex: 1, data: "e8 03"}
+//	    watchdog: {pdi: 100ms, processData: 10ms}
+//	    dc: {assignActivate: 0x0300, sync0Cycle: 1ms}
+//
+// Parameters:
+//   - r (io.Reader): YAML document
+//
+// Returns:
+//   - []SlaveConfig: Slave configurations for Config.Slaves
+//   - error: Decoding error, or an error if a configuration is invalid
+func LoadSlaveConfigs(r io.Reader) ([]SlaveConfig, error) {
+	var doc struct {
+		Slaves []SlaveConfig `yaml:"slaves"`
+	}
+	d := yaml.NewDecoder(r)
+	d.KnownFields(true)
+	if err := d.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("master: slave configuration: %w", err)
+	}
+	for _, c := range doc.Slaves {
+		if err := c.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	return doc.Slaves, nil
+}
+
+// Validate checks a configuration for contradictions that do not depend on the slave.
+//
+// Returns:
+//   - error: Error naming the first problem, nil if there is none
+func (c SlaveConfig) Validate() error {
+	sms := map[int]bool{}
+	for _, sm := range c.SyncManagers {
+		switch {
+		case sm.CtrlStatus.OpMode == 0x2:
+			return fmt.Errorf("master: slave %s: SyncManager %d is a mailbox, which is configured from the SII", c.slave(), sm.Index)
+		case sms[sm.Index]:
+			return fmt.Errorf("master: slave %s: SyncManager %d configured twice", c.slave(), sm.Index)
+		}
+		sms[sm.Index] = true
+	}
+	for _, f := range c.FMMUs {
+		if len(c.SyncManagers) > 0 && !sms[f.SyncManager] {
+			return fmt.Errorf("master: slave %s: FMMU maps SyncManager %d, which is not configured", c.slave(), f.SyncManager)
+		}
+	}
+	if c.Watchdog != nil {
+		if _, _, _, err := c.Watchdog.Registers(); err != nil {
+			return fmt.Errorf("master: slave %s: %w", c.slave(), err)
+		}
+	}
+	for _, cmd := range c.InitCommands {
+		switch cmd.Transition {
+		case TransitionIP, TransitionPS, TransitionSO:
+		default:
+			return fmt.Errorf("master: slave %s: init command 0x%04x:%02x: unsupported transition %q", c.slave(), cmd.Index, cmd.SubIndex, cmd.Transition)
+		}
+	}
+	return nil
+}
+
+// slave names the slave a configuration refers to in messages.
+func (c SlaveConfig) slave() string {
+	if c.Alias != 0 {
+		return fmt.Sprintf("alias %d + %d", c.Alias, c.Position)
+	}
+	return fmt.Sprint(c.Position)
+}
+
+// find returns the position of the slave a configuration refers to.
+func (c SlaveConfig) find(slaves []Slave) (int, bool) {
+	scanned := make([]scan.Slave, len(slaves))
+	for i, s := range slaves {
+		scanned[i] = s.Slave
+	}
+	return scan.Find(scanned, c.Alias, c.Position)
+}
+
+// processSyncManager is a process data SyncManager as ConfigureSlaves writes it.
+type processSyncManager struct {
+	SyncManager
+	mapped bool // Whether an FMMU maps it
+}
+
+// processSyncManagers returns the process data SyncManagers of a slave, in the order they are
+// mapped, from its configuration or its SII.
+func processSyncManagers(s Slave, c *SlaveConfig) ([]processSyncManager, error) {
+	var sms []processSyncManager
+	if c != nil && len(c.SyncManagers) > 0 {
+		for _, sm := range c.SyncManagers {
+			sms = append(sms, processSyncManager{SyncManager: sm})
+		}
+	} else {
+		for n, sm := range s.SII.SyncManagers {
+			if sm.Type != sii.SMOutputs && sm.Type != sii.SMInputs {
+				continue
+			}
+			sms = append(sms, processSyncManager{SyncManager: SyncManager{Index: n, SyncManager: syncmanager.SyncManager{
+				Start: sm.Start, Length: processDataLength(s.SII, n, sm),
+				CtrlStatus: *syncmanager.NewCtrlStatusFromUint16(uint16(sm.Control)),
+			}}})
+		}
+	}
+
+	for i := range sms {
+		sm := &sms[i]
+		if pdos, ok := c.assignment(sm.Index); ok && (sm.Length == 0 || len(c.SyncManagers) == 0) {
+			length, err := assignedLength(s.SII, pdos, sm.outputs())
+			if err != nil {
+				return nil, fmt.Errorf("master: slave %d: SyncManager %d: %w", s.Position, sm.Index, err)
+			}
+			sm.Length = length
+		}
+		sm.Enable = syncmanager.Enable{IsEnable: sm.Length > 0}
+		sm.mapped = sm.Length > 0
+	}
+	if c == nil || len(c.FMMUs) == 0 {
+		return sms, nil
+	}
+
+	mapped := make([]processSyncManager, 0, len(sms))
+	for _, f := range c.FMMUs {
+		for _, sm := range sms {
+			if sm.Index == f.SyncManager {
+				mapped = append(mapped, sm)
+			}
+		}
+	}
+	for _, sm := range sms {
+		if !c.maps(sm.Index) {
+			sm.mapped = false
+			mapped = append(mapped, sm)
+		}
+	}
+	return mapped, nil
+}
+
+// assignment returns the PDOs assigned to SyncManager n, if the configuration assigns any.
+func (c *SlaveConfig) assignment(n int) ([]uint16, bool) {
+	if c == nil {
+		return nil, false
+	}
+	pdos, ok := c.PDOAssignment[n]
+	return pdos, ok
+}
+
+// maps reports whether an FMMU of the configuration maps SyncManager n.
+func (c *SlaveConfig) maps(n int) bool {
+	for _, f := range c.FMMUs {
+		if f.SyncManager == n {
+			return true
+		}
+	}
+	return false
+}
+
+// assignedLength returns the length in bytes of PDOs described by the SII.
+func assignedLength(image sii.Image, indexes []uint16, outputs bool) (uint16, error) {
+	pdos := image.TxPDOs
+	if outputs {
+		pdos = image.RxPDOs
+	}
+
+	bits := 0
+	for _, index := range indexes {
+		found := false
+		for _, pdo := range pdos {
+			if pdo.Index != index {
+				continue
+			}
+			found = true
+			for _, entry := range pdo.Entries {
+				bits += int(entry.BitLength)
+			}
+		}
+		if !found {
+			return 0, fmt.Errorf("PDO 0x%04x is not in the SII, configure the SyncManager length", index)
+		}
+	}
+	return uint16((bits + 7) / 8), nil
+}
+
+// watchdogWrites returns the datagrams writing the watchdog registers of a slave. The
+// configuration has been validated.
+func watchdogWrites(station uint16, cfg *watchdog.Config) []datagram.Datagram {
+	if cfg == nil {
+		return nil
+	}
+	divider, pdi, processData, _ := cfg.Registers()
+	return []datagram.Datagram{
+		datagram.FPWR(station, register.WatchdogDivider, payload.BasicPayload{Data: binary.LittleEndian.AppendUint16(nil, divider)}),
+		datagram.FPWR(station, register.WatchdogTimePDI, payload.BasicPayload{Data: binary.LittleEndian.AppendUint16(nil, pdi)}),
+		datagram.FPWR(station, register.WatchdogTimeProcessData, payload.BasicPayload{Data: binary.LittleEndian.AppendUint16(nil, processData)}),
+	}
+}
+
+// transition returns the name of the transition between two states.
+func transition(from al.State, to al.State) Transition {
+	letter := func(s al.State) string {
+		switch s {
+		case al.Init:
+			return "I"
+		case al.PreOp:
+			return "P"
+		case al.Bootstrap:
+			return "B"
+		case al.SafeOp:
+			return "S"
+		case al.Op:
+			return "O"
+		default:
+			return "?"
+		}
+	}
+	return Transition(letter(from) + letter(to))
+}
+
+// beforeTransition applies the configuration of a slave that belongs before requesting t.
+func (m *Master) beforeTransition(ctx context.Context, s Slave, t Transition) error {
+	c := s.Config
+	if c == nil || t == TransitionIP {
+		return nil
+	}
+	if t == TransitionPS {
+		if err := m.assignPDOs(ctx, s); err != nil {
+			return err
+		}
+	}
+	if err := m.initCommands(ctx, s, t); err != nil {
+		return err
+	}
+	if t == TransitionPS && c.DC != nil {
+		return m.startSync(ctx, s, c.DC)
+	}
+	return nil
+}
+
+// afterTransition applies the configuration of a slave that belongs after t succeeded.
+func (m *Master) afterTransition(ctx context.Context, s Slave, t Transition) error {
+	if s.Config == nil || t != TransitionIP {
+		return nil
+	}
+	return m.initCommands(ctx, s, t)
+}
+
+// assignPDOs downloads the PDO assignment of a slave: the count is cleared, the PDOs are
+// written and the count is set, as a slave only checks the assignment when its count changes.
+func (m *Master) assignPDOs(ctx context.Context, s Slave) error {
+	if len(s.Config.PDOAssignment) == 0 {
+		return nil
+	}
+	client, err := m.coe(s)
+	if err != nil {
+		return err
+	}
+	for n, pdos := range s.Config.PDOAssignment {
+		index := uint16(0x1c10 + n)
+		writes := []InitCommand{{Index: index, Data: Bytes{0}}}
+		for i, pdo := range pdos {
+			writes = append(writes, InitCommand{Index: index, SubIndex: uint8(i + 1), Data: binary.LittleEndian.AppendUint16(nil, pdo)})
+		}
+		writes = append(writes, InitCommand{Index: index, Data: Bytes{uint8(len(pdos))}})
+		for _, w := range writes {
+			if err := client.Download(ctx, w.Index, w.SubIndex, w.Data); err != nil {
+				return fmt.Errorf("master: slave %d: PDO assignment 0x%04x:%02x: %w", s.Position, w.Index, w.SubIndex, err)
+			}
+		}
+	}
+	return nil
+}
+
+// initCommands sends the init commands of a slave for a transition in their order.
+func (m *Master) initCommands(ctx context.Context, s Slave, t Transition) error {
+	var client *coe.Client
+	for _, cmd := range s.Config.InitCommands {
+		if cmd.Transition != t {
+			continue
+		}
+		if client == nil {
+			var err error
+			if client, err = m.coe(s); err != nil {
+				return err
+			}
+		}
+		if err := client.Download(ctx, cmd.Index, cmd.SubIndex, cmd.Data); err != nil {
+			return fmt.Errorf("master: slave %d: init command 0x%04x:%02x: %w", s.Position, cmd.Index, cmd.SubIndex, err)
+		}
+	}
+	return nil
+}
+
+// coe returns a CoE client for the mailbox of a slave.
+func (m *Master) coe(s Slave) (*coe.Client, error) {
+	conn, err := m.Mailbox(s.Position)
+	if err != nil {
+		return nil, err
+	}
+	return coe.NewClient(conn), nil
+}
+
+// startSync programs the cycle times and start time of the SYNC signals and activates them.
+func (m *Master) startSync(ctx context.Context, s Slave, dc *DC) error {
+	exchange := func(d datagram.Datagram) (datagram.Datagram, error) {
+		returned, err := m.x.ExchangeExpect(ctx, d, transceiver.ExpectWKC(1))
+		if err != nil {
+			return datagram.Datagram{}, fmt.Errorf("master: slave %d: DC: %w", s.Position, err)
+		}
+		return returned, nil
+	}
+	u32 := func(d time.Duration) payload.BasicPayload {
+		return payload.BasicPayload{Data: binary.LittleEndian.AppendUint32(nil, uint32(d.Nanoseconds()))}
+	}
+
+	// The cyclic unit is stopped while it is reprogrammed.
+	if _, err := exchange(datagram.FPWR(s.Station, register.DCCyclicUnitControl, payload.BasicPayload{Data: []byte{0, 0}})); err != nil {
+		return err
+	}
+	returned, err := exchange(datagram.FPRD(s.Station, register.DCSystemTime, 8))
+	if err != nil {
+		return err
+	}
+	now := binary.LittleEndian.Uint64(returned.Data.Bytes())
+	start := now + uint64(DCStartDelay.Nanoseconds()) + uint64(dc.Sync0Shift.Nanoseconds())
+
+	for _, d := range []datagram.Datagram{
+		datagram.FPWR(s.Station, register.DCSync0CycleTime, u32(dc.Sync0Cycle)),
+		datagram.FPWR(s.Station, register.DCSync1CycleTime, u32(dc.Sync1Cycle)),
+		datagram.FPWR(s.Station, register.DCStartTime, payload.BasicPayload{Data: binary.LittleEndian.AppendUint64(nil, start)}),
+		datagram.FPWR(s.Station, register.DCCyclicUnitControl, payload.BasicPayload{Data: binary.LittleEndian.AppendUint16(nil, dc.AssignActivate)}),
+	} {
+		if _, err := exchange(d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkIdentities compares the configured identities with the scanned slaves.
+func checkIdentities(slaves []Slave, configs []SlaveConfig) error {
+	var errs []error
+	for _, c := range configs {
+		position, ok := c.find(slaves)
+		if !ok {
+			errs = append(errs, &IdentityError{Position: c.Position, Alias: c.Alias, Expected: c.Identity, Missing: true})
+			continue
+		}
+		if actual := slaves[position].SII.Identity; !c.Identity.Matches(actual) {
+			errs = append(errs, &IdentityError{Position: uint16(position), Expected: c.Identity, Actual: actual})
+		}
+	}
+	return errors.Join(errs...)
+}
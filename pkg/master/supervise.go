@@ -0,0 +1,539 @@
+package master
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Aruminium/goecat/pkg/ethercat/al"
+	"github.com/Aruminium/goecat/pkg/ethercat/datagram"
+	"github.com/Aruminium/goecat/pkg/ethercat/payload"
+	"github.com/Aruminium/goecat/pkg/ethercat/register"
+	"github.com/Aruminium/goecat/pkg/ethercat/sii"
+	"github.com/Aruminium/goecat/pkg/scan"
+	"github.com/Aruminium/goecat/pkg/topology"
+	"github.com/Aruminium/goecat/pkg/transceiver"
+)
+
+// DefaultSupervisionInterval is used when Supervision.Interval is zero.
+const DefaultSupervisionInterval = 100 * time.Millisecond
+
+// lostAfterTimeouts is the number of checks in a row without a returned frame after which all
+// present slaves are lost.
+const lostAfterTimeouts = 3
+
+// errNotConnected is returned by reattach when a lost slave is not at the position it is looked for.
+var errNotConnected = errors.New("master: slave not connected")
+
+// Supervision configures how cyclic mode watches the slaves.
+//
+// Every Interval, and right after a cycle with a working counter mismatch, the AL Status of
+// every slave is read. A slave that does not answer is lost: it is left out of the working
+// counter expectation, and the topology found by Scan tells behind which slave and port the
+// segment broke. When no frame comes back for three checks in a row, as when the cable between
+// the master and the first slave is pulled, all present slaves are lost behind the master. A
+// slave that leaves the requested state by itself, for example when its watchdog expires, is
+// reported as well.
+//
+// When slaves outside of hot-connect groups are lost and KeepRunning is false, the remaining
+// slaves are taken to SAFE-OP, which also becomes the requested state. Hot-connect groups may
+// come and go without that.
+//
+// With Recover, lost slaves are looked for whenever more slaves answer than are present. A
+// slave that comes back gets its station address again, its identity and the identification
+// of its hot-connect group are checked, and it is configured and brought from INIT to the
+// requested state. A slave that changed its state by itself is requested the state again once.
+type Supervision struct {
+	Interval    time.Duration     // Time between checks, DefaultSupervisionInterval if zero
+	KeepRunning bool              // Keep the remaining slaves in their state when slaves are lost
+	Recover     bool              // Bring slaves that come back or changed their state to the requested state
+	HotConnect  []HotConnectGroup // Groups of slaves that may be disconnected and connected at any time
+	OnEvent     func(Event)       // Called for every event from the supervision goroutine
+}
+
+// IDSource is where the identification of a hot-connect group is read.
+type IDSource int
+
+const (
+	IDStationAlias IDSource = iota // Configured station alias register (0x0012), loaded from the SII or set by the slave application
+	IDSIIAlias                     // Configured station alias word of the SII EEPROM
+)
+
+// HotConnectGroup is a line of slaves that may be disconnected and connected again while the
+// rest of the segment runs, such as a tool changer. It is recognised by the identification of
+// its first slave, and has to be connected when Scan runs to be configured.
+type HotConnectGroup struct {
+	Name   string
+	ID     uint16   // Identification of the first slave
+	Source IDSource // Where the identification is read
+	Slaves int      // Number of slaves in the group, 1 if zero
+}
+
+// EventKind is what happened to the slaves of an Event.
+type EventKind int
+
+const (
+	SlavesLost      EventKind = iota // Slaves stopped answering
+	SlavesRecovered                  // Lost slaves came back and reached the requested state
+	StateChanged                     // A slave left the requested state by itself
+	Failed                           // Slaves could not be brought to the requested state
+)
+
+func (k EventKind) String() string {
+	switch k {
+	case SlavesLost:
+		return "lost"
+	case SlavesRecovered:
+		return "recovered"
+	case StateChanged:
+		return "state changed"
+	case Failed:
+		return "failed"
+	default:
+		return fmt.Sprintf("EventKind(%d)", int(k))
+	}
+}
+
+// Event is reported by the supervision through Supervision.OnEvent.
+type Event struct {
+	Time      time.Time
+	Kind      EventKind
+	Positions []uint16      // Slaves concerned
+	Group     int           // Hot-connect group all the slaves belong to, -1 if none
+	Parent    int           // SlavesLost: last slave before the break, topology.Master if the first slave is lost
+	Port      int           // SlavesLost: port of Parent behind which the slaves are lost, -1 if unknown
+	State     al.State      // StateChanged: AL Status of the slave
+	Code      al.StatusCode // StateChanged: AL Status Code of the slave
+	Err       error         // Failed: why
+}
+
+func (e Event) String() string {
+	subject := "slave"
+	if len(e.Positions) > 1 {
+		subject = "slaves"
+	}
+	numbers := make([]string, len(e.Positions))
+	for i, p := range e.Positions {
+		numbers[i] = fmt.Sprint(p)
+	}
+	subject += " " + strings.Join(numbers, ", ")
+	if e.Group >= 0 {
+		subject = fmt.Sprintf("hot-connect group %d (%s)", e.Group, subject)
+	}
+
+	switch e.Kind {
+	case SlavesLost:
+		behind := "the master"
+		if e.Parent != topology.Master {
+			behind = fmt.Sprintf("slave %d", e.Parent)
+			if e.Port >= 0 {
+				behind += fmt.Sprintf(" port %d", e.Port)
+			}
+		}
+		return fmt.Sprintf("%s lost behind %s", subject, behind)
+	case StateChanged:
+		return fmt.Sprintf("%s changed to %v: %v", subject, e.State, e.Code)
+	case Failed:
+		return fmt.Sprintf("%s failed: %v", subject, e.Err)
+	default:
+		return fmt.Sprintf("%s %v", subject, e.Kind)
+	}
+}
+
+// supervisor runs the supervision of cyclic mode.
+type supervisor struct {
+	m        *Master
+	sv       Supervision
+	failed   map[uint16]string // Last failure reported per slave, so that a failure is reported once
+	timeouts int               // Checks in a row whose frames did not come back
+}
+
+func newSupervisor(m *Master, sv Supervision) *supervisor {
+	if sv.Interval == 0 {
+		sv.Interval = DefaultSupervisionInterval
+	}
+	return &supervisor{m: m, sv: sv, failed: map[uint16]string{}}
+}
+
+// run checks the slaves every interval and when woken until ctx is done.
+func (s *supervisor) run(ctx context.Context, wake <-chan struct{}) {
+	ticker := time.NewTicker(s.sv.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-wake:
+		}
+		s.check(ctx)
+	}
+}
+
+// check reads the state of the present slaves, handles lost slaves and slaves that changed
+// their state, and looks for lost slaves that came back.
+func (s *supervisor) check(ctx context.Context) {
+	m := s.m
+	m.transitions.Lock()
+	defer m.transitions.Unlock()
+
+	m.mu.Lock()
+	target, configured := m.target, m.configured
+	m.mu.Unlock()
+	if !configured {
+		return
+	}
+
+	slaves := m.Slaves()
+	var lost []int
+	var changed []Slave
+	for i, slave := range slaves {
+		if slave.Lost {
+			continue
+		}
+		d, err := m.x.Exchange(ctx, datagram.FPRD(slave.Station, register.ALStatus, register.ALStatusCode+2-register.ALStatus))
+		if errors.Is(err, transceiver.ErrTimeout) {
+			// A single lost frame is retried by the next check, but without any frame coming
+			// back the segment is cut off right behind the master.
+			if s.timeouts++; s.timeouts < lostAfterTimeouts {
+				return
+			}
+			s.timeouts = 0
+			lost = lost[:0]
+			for j := range slaves {
+				if !slaves[j].Lost {
+					lost = append(lost, j)
+				}
+			}
+			changed = nil
+			break
+		}
+		if err != nil {
+			return
+		}
+		s.timeouts = 0
+		if d.WKC == 0 {
+			lost = append(lost, i)
+			continue
+		}
+
+		data := d.Data.Bytes()
+		state := al.State(binary.LittleEndian.Uint16(data))
+		code := al.StatusCode(binary.LittleEndian.Uint16(data[register.ALStatusCode-register.ALStatus:]))
+		if state == slave.State {
+			continue
+		}
+		m.mu.Lock()
+		m.slaves[i].State, m.slaves[i].StatusCode = state, code
+		m.mu.Unlock()
+		if state != target {
+			slave.State, slave.StatusCode = state, code
+			changed = append(changed, slave)
+		}
+	}
+
+	if len(lost) > 0 {
+		target = s.lose(ctx, slaves, lost, target)
+	}
+	for _, slave := range changed {
+		s.emit(Event{Kind: StateChanged, Positions: []uint16{slave.Position}, Group: slave.Group, State: slave.State, Code: slave.StatusCode})
+		if !s.sv.Recover {
+			continue
+		}
+		if err := m.restore(ctx, slave.Position, target); err != nil {
+			s.fail(slave, err)
+		}
+	}
+	if s.sv.Recover {
+		s.reconnect(ctx, target)
+	}
+}
+
+// lose takes lost slaves out of the process data exchange and reports them. It returns the
+// requested state, which is lowered to SAFE-OP unless the remaining slaves keep running.
+func (s *supervisor) lose(ctx context.Context, slaves []Slave, lost []int, target al.State) al.State {
+	m := s.m
+	m.mu.Lock()
+	for _, i := range lost {
+		m.slaves[i].Lost, slaves[i].Lost = true, true
+	}
+	m.updateExpect()
+	tree := m.tree
+	m.mu.Unlock()
+
+	grouped := true
+	for _, e := range breaks(tree, slaves, lost) {
+		s.emit(e)
+		grouped = grouped && e.Group >= 0
+	}
+	if grouped || s.sv.KeepRunning || rank(target) <= rank(al.SafeOp) {
+		return target
+	}
+
+	m.mu.Lock()
+	m.target = al.SafeOp
+	m.mu.Unlock()
+	if err := m.request(ctx, al.SafeOp, al.SafeOp, func(slave Slave) bool { return !slave.Lost }); err != nil {
+		var positions []uint16
+		for _, slave := range slaves {
+			if !slave.Lost {
+				positions = append(positions, slave.Position)
+			}
+		}
+		s.emit(Event{Kind: Failed, Positions: positions, Group: -1, Err: err})
+	}
+	return al.SafeOp
+}
+
+// reconnect looks for lost slaves when more slaves answer than are present and brings the
+// slaves it finds to the requested state.
+func (s *supervisor) reconnect(ctx context.Context, target al.State) {
+	m := s.m
+	slaves := m.Slaves()
+	var lost []Slave
+	for _, slave := range slaves {
+		if slave.Lost {
+			lost = append(lost, slave)
+		}
+	}
+	if len(lost) == 0 {
+		return
+	}
+	count, err := scan.Count(ctx, m.x)
+	if err != nil || count <= len(slaves)-len(lost) {
+		return
+	}
+
+	// The slaves behind a lost slave that is still missing have moved up by one position.
+	missing := 0
+	var recovered []uint16
+	for _, slave := range lost {
+		err := m.reattach(ctx, slave, slave.Position-uint16(missing), target)
+		switch {
+		case errors.Is(err, errNotConnected):
+			missing++
+		case err != nil:
+			s.fail(slave, err)
+		default:
+			delete(s.failed, slave.Position)
+			recovered = append(recovered, slave.Position)
+		}
+	}
+	if len(recovered) > 0 {
+		s.emit(Event{Kind: SlavesRecovered, Positions: recovered, Group: commonGroup(slaves, recovered)})
+	}
+}
+
+// emit reports an event.
+func (s *supervisor) emit(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	if s.sv.OnEvent != nil {
+		s.sv.OnEvent(e)
+	}
+}
+
+// fail reports that a slave could not be brought to the requested state, unless the same
+// failure has been reported before.
+func (s *supervisor) fail(slave Slave, err error) {
+	if s.failed[slave.Position] == err.Error() {
+		return
+	}
+	s.failed[slave.Position] = err.Error()
+	s.emit(Event{Kind: Failed, Positions: []uint16{slave.Position}, Group: slave.Group, Err: err})
+}
+
+// reattach addresses a lost slave found at position, checks that it is the slave that was
+// lost, configures it and brings it to target. It returns errNotConnected if another slave or
+// none is at the position. If the slave cannot be identified as the lost one, its station
+// address is cleared again, so that it does not answer in place of the lost slave.
+func (m *Master) reattach(ctx context.Context, s Slave, position uint16, target al.State) error {
+	d, err := m.x.Exchange(ctx, datagram.APRD(position, register.StationAddress, 2))
+	if err != nil {
+		return err
+	}
+	// A slave that was switched off has lost its station address, one that was only
+	// disconnected still has it.
+	if station := binary.LittleEndian.Uint16(d.Data.Bytes()); d.WKC == 0 || station != 0 && station != s.Station {
+		return errNotConnected
+	}
+	station := payload.BasicPayload{Data: binary.LittleEndian.AppendUint16(nil, s.Station)}
+	if _, err := m.x.ExchangeExpect(ctx, datagram.APWR(position, register.StationAddress, station), transceiver.ExpectWKC(1)); err != nil {
+		return fmt.Errorf("master: slave %d: %w", s.Position, err)
+	}
+
+	info, err := sii.NewEEPROM(m.x, s.Station).ReadInfo(ctx)
+	if err != nil {
+		return m.clearStation(ctx, position, fmt.Errorf("master: slave %d: %w", s.Position, err))
+	}
+	expected := Identity{VendorID: s.SII.Identity.VendorID, ProductCode: s.SII.Identity.ProductCode, RevisionNo: s.SII.Identity.RevisionNo}
+	if !expected.Matches(info.Identity) {
+		return m.clearStation(ctx, position, &IdentityError{Position: s.Position, Expected: expected, Actual: info.Identity})
+	}
+	if err := m.identifyGroup(ctx, s, info); err != nil {
+		return err
+	}
+
+	only := func(slave Slave) bool { return slave.Position == s.Position }
+	if err := m.refresh(ctx, &s); err != nil {
+		return err
+	}
+	if err := m.request(ctx, al.Init, al.Init, only); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	writes := m.writes[s.Position]
+	m.mu.Unlock()
+	if err := m.configure(ctx, s, writes); err != nil {
+		return err
+	}
+	if err := m.restore(ctx, s.Position, target); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	m.slaves[s.Position].Lost = false
+	m.updateExpect()
+	m.mu.Unlock()
+	return nil
+}
+
+// clearStation sets the station address of the slave at position back to zero after reattach
+// failed with err. It returns err, joined with the error of clearing the address if that fails.
+func (m *Master) clearStation(ctx context.Context, position uint16, err error) error {
+	zero := payload.BasicPayload{Data: []byte{0x00, 0x00}}
+	if _, clearErr := m.x.ExchangeExpect(ctx, datagram.APWR(position, register.StationAddress, zero), transceiver.ExpectWKC(1)); clearErr != nil {
+		return errors.Join(err, clearErr)
+	}
+	return err
+}
+
+// identifyGroup checks the identification of a slave that comes back as the first slave of
+// its hot-connect group.
+func (m *Master) identifyGroup(ctx context.Context, s Slave, info sii.Info) error {
+	if s.Group < 0 || m.cfg.Supervision == nil {
+		return nil
+	}
+	if s.Position > 0 {
+		previous, err := m.slave(s.Position - 1)
+		if err != nil {
+			return err
+		}
+		if previous.Group == s.Group {
+			return nil
+		}
+	}
+	group := m.cfg.Supervision.HotConnect[s.Group]
+	id := info.Alias
+	if group.Source == IDStationAlias {
+		d, err := m.x.ExchangeExpect(ctx, datagram.FPRD(s.Station, register.StationAlias, 2), transceiver.ExpectWKC(1))
+		if err != nil {
+			return fmt.Errorf("master: slave %d: %w", s.Position, err)
+		}
+		id = binary.LittleEndian.Uint16(d.Data.Bytes())
+	}
+	if id != group.ID {
+		return fmt.Errorf("master: slave %d: hot-connect group %d identified as 0x%04x, expected 0x%04x", s.Position, s.Group, id, group.ID)
+	}
+	return nil
+}
+
+// restore brings one slave to target.
+func (m *Master) restore(ctx context.Context, position uint16, target al.State) error {
+	only := func(slave Slave) bool { return slave.Position == position }
+	for _, step := range steps(target) {
+		if err := m.request(ctx, step, target, only); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// assignGroups marks the slaves of every hot-connect group that is connected.
+func assignGroups(slaves []Slave, groups []HotConnectGroup) {
+	for g, group := range groups {
+		for i := range slaves {
+			if slaves[i].Group >= 0 || groupID(slaves[i].Slave, group.Source) != group.ID {
+				continue
+			}
+			for j := i; j < len(slaves) && j < i+max(group.Slaves, 1); j++ {
+				slaves[j].Group = g
+			}
+			break
+		}
+	}
+}
+
+// groupID returns the identification of a scanned slave.
+func groupID(s scan.Slave, source IDSource) uint16 {
+	if source == IDSIIAlias {
+		return s.SII.Alias
+	}
+	return s.Alias
+}
+
+// breaks reports lost slaves by where the segment broke: every lost slave whose parent still
+// answers heads a lost part of the tree. Without a tree the segment is taken as a line.
+func breaks(tree *topology.Tree, slaves []Slave, lost []int) []Event {
+	isLost := make(map[int]bool, len(lost))
+	for _, i := range lost {
+		isLost[i] = true
+	}
+	positions := func(from int, to int) []uint16 {
+		var result []uint16
+		for i := from; i < to; i++ {
+			if isLost[i] {
+				result = append(result, uint16(i))
+			}
+		}
+		return result
+	}
+
+	if tree == nil || len(tree.Nodes) != len(slaves) {
+		lostPositions := positions(lost[0], len(slaves))
+		return []Event{{Kind: SlavesLost, Positions: lostPositions, Group: commonGroup(slaves, lostPositions), Parent: lost[0] - 1, Port: -1}}
+	}
+
+	var events []Event
+	for _, i := range lost {
+		n := tree.Nodes[i]
+		if n.Parent != topology.Master && isLost[n.Parent] {
+			continue
+		}
+		// The subtree of a node is the positions up to the next one that is not its descendant.
+		end := i + 1
+		for end < len(tree.Nodes) && descends(tree, end, i) {
+			end++
+		}
+		lostPositions := positions(i, end)
+		events = append(events, Event{Kind: SlavesLost, Positions: lostPositions, Group: commonGroup(slaves, lostPositions), Parent: n.Parent, Port: n.ParentPort})
+	}
+	return events
+}
+
+// descends reports whether the slave at position is in the subtree of ancestor.
+func descends(tree *topology.Tree, position int, ancestor int) bool {
+	for p := position; p != topology.Master; p = tree.Nodes[p].Parent {
+		if p == ancestor {
+			return true
+		}
+	}
+	return false
+}
+
+// commonGroup returns the hot-connect group all the slaves at positions belong to, or -1.
+func commonGroup(slaves []Slave, positions []uint16) int {
+	group := -1
+	for i, p := range positions {
+		g := slaves[p].Group
+		if g < 0 || i > 0 && g != group {
+			return -1
+		}
+		group = g
+	}
+	return group
+}
@@ -0,0 +1,205 @@
+package master_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Aruminium/goecat/pkg/ethercat/al"
+	"github.com/Aruminium/goecat/pkg/ethercat/register"
+	"github.com/Aruminium/goecat/pkg/ethercat/sii"
+	"github.com/Aruminium/goecat/pkg/master"
+	"github.com/Aruminium/goecat/pkg/simulator"
+	"github.com/Aruminium/goecat/pkg/topology"
+)
+
+// waitEvent returns the next event of a kind, skipping the others.
+func waitEvent(t *testing.T, events <-chan master.Event, kind master.EventKind) master.Event {
+	t.Helper()
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case e := <-events:
+			if e.Kind == kind {
+				return e
+			}
+		case <-timeout:
+			t.Fatalf("No %v event", kind)
+			return master.Event{}
+		}
+	}
+}
+
+func TestSupervision(t *testing.T) {
+	// given
+	echo := simulator.NewMailboxSlave(simulator.MailboxConfig{Config: simulator.Config{
+		EEPROM:      ioEEPROM(),
+		Application: func(e *simulator.ESC) { e.Write(inputsAddress, e.Read(outputsAddress, 1)) },
+	}})
+	plain := simulator.NewESC(simulator.Config{EEPROM: sii.Info{}.Encode()})
+	ring := simulator.NewRing(plain, echo.ESC)
+	events := make(chan master.Event, 10)
+	cycles := make(chan error, 1)
+	m := master.New(ring.Attach(), master.Config{
+		Encapsulation: encap,
+		CycleTime:     time.Millisecond,
+		OnCycle: func(start time.Time, duration time.Duration, err error) {
+			select {
+			case cycles <- err:
+			default:
+			}
+		},
+		Supervision: &master.Supervision{Interval: 10 * time.Millisecond, KeepRunning: true, Recover: true, OnEvent: func(e master.Event) { events <- e }},
+	})
+	t.Cleanup(func() { m.Close() })
+	ctx := context.Background()
+	m.Scan(ctx)
+	m.ConfigureSlaves(ctx)
+	m.Start(ctx)
+	if err := m.SetState(ctx, al.Op); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// when
+	ring.Disconnect(1)
+	lost := waitEvent(t, events, master.SlavesLost)
+	// Cycles that started before the slave was found lost may still fail.
+	var cycleErr error
+	for i := 0; i < 5; i++ {
+		cycleErr = <-cycles
+	}
+	echo.PowerCycle()
+	ring.Reconnect()
+	recovered := waitEvent(t, events, master.SlavesRecovered)
+
+	// then
+	if !reflect.DeepEqual(lost.Positions, []uint16{1}) || lost.Parent != 0 || lost.Port != 1 || lost.Group != -1 {
+		t.Errorf("Expected slave 1 lost behind slave 0 port 1, but got %v", lost)
+	}
+	if s := lost.String(); s != "slave 1 lost behind slave 0 port 1" {
+		t.Errorf("Unexpected event %q", s)
+	}
+	if cycleErr != nil {
+		t.Errorf("Expected the remaining slaves to keep cycling, but got %v", cycleErr)
+	}
+	if !reflect.DeepEqual(recovered.Positions, []uint16{1}) {
+		t.Errorf("Expected slave 1 to recover, but got %v", recovered)
+	}
+	slaves := m.Slaves()
+	if slaves[1].Lost || slaves[1].State != al.Op || echo.ESC.ALState() != al.Op {
+		t.Errorf("Expected slave 1 back in OP, but got %+v", slaves[1])
+	}
+}
+
+func TestSupervisionForeignSlave(t *testing.T) {
+	// given
+	echo := simulator.NewMailboxSlave(simulator.MailboxConfig{Config: simulator.Config{EEPROM: ioEEPROM()}})
+	plain := simulator.NewESC(simulator.Config{EEPROM: sii.Info{}.Encode()})
+	ring := simulator.NewRing(plain, echo.ESC)
+	events := make(chan master.Event, 10)
+	m := master.New(ring.Attach(), master.Config{
+		Encapsulation: encap,
+		CycleTime:     time.Millisecond,
+		Supervision:   &master.Supervision{Interval: 10 * time.Millisecond, KeepRunning: true, Recover: true, OnEvent: func(e master.Event) { events <- e }},
+	})
+	t.Cleanup(func() { m.Close() })
+	ctx := context.Background()
+	m.Scan(ctx)
+	m.ConfigureSlaves(ctx)
+	m.Start(ctx)
+	if err := m.SetState(ctx, al.Op); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// when
+	ring.Disconnect(1)
+	waitEvent(t, events, master.SlavesLost)
+	// Another device is plugged in place of the lost slave.
+	echo.ESC.SetEEPROM(sii.Info{Identity: sii.Identity{VendorID: 0x00000002, ProductCode: 0x044c2c52}}.Encode())
+	echo.PowerCycle()
+	ring.Reconnect()
+	failed := waitEvent(t, events, master.Failed)
+
+	// then
+	var identityErr *master.IdentityError
+	if !errors.As(failed.Err, &identityErr) || !reflect.DeepEqual(failed.Positions, []uint16{1}) {
+		t.Errorf("Expected an identity error of slave 1, but got %v", failed)
+	}
+	// Later attempts address the slave again while they read its identity.
+	deadline := time.Now().Add(time.Second)
+	for !reflect.DeepEqual(echo.ESC.Read(register.StationAddress, 2), []byte{0x00, 0x00}) {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the foreign slave to keep station address 0, but it has % x", echo.ESC.Read(register.StationAddress, 2))
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSupervisionMasterLinkCut(t *testing.T) {
+	// given
+	events := make(chan master.Event, 10)
+	echo := simulator.NewMailboxSlave(simulator.MailboxConfig{Config: simulator.Config{EEPROM: ioEEPROM()}})
+	plain := simulator.NewESC(simulator.Config{EEPROM: sii.Info{}.Encode()})
+	ring := simulator.NewRing(plain, echo.ESC)
+	m := master.New(ring.Attach(), master.Config{
+		Encapsulation: encap,
+		CycleTime:     time.Millisecond,
+		Timeout:       50 * time.Millisecond,
+		Supervision:   &master.Supervision{Interval: 10 * time.Millisecond, Recover: true, OnEvent: func(e master.Event) { events <- e }},
+	})
+	t.Cleanup(func() { m.Close() })
+	ctx := context.Background()
+	m.Scan(ctx)
+	m.ConfigureSlaves(ctx)
+	m.Start(ctx)
+	if err := m.SetState(ctx, al.Op); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// when
+	ring.Disconnect(0)
+	lost := waitEvent(t, events, master.SlavesLost)
+	ring.Reconnect()
+	recovered := waitEvent(t, events, master.SlavesRecovered)
+
+	// then
+	if !reflect.DeepEqual(lost.Positions, []uint16{0, 1}) || lost.Parent != topology.Master {
+		t.Errorf("Expected slaves 0 and 1 lost behind the master, but got %v", lost)
+	}
+	if !reflect.DeepEqual(recovered.Positions, []uint16{0, 1}) {
+		t.Errorf("Expected slaves 0 and 1 to recover, but got %v", recovered)
+	}
+	for _, slave := range m.Slaves() {
+		if slave.Lost || slave.State != al.SafeOp {
+			t.Errorf("Expected slave %d back in SAFE-OP, but got %+v", slave.Position, slave)
+		}
+	}
+}
+
+func TestSupervisionSafeOp(t *testing.T) {
+	// given
+	events := make(chan master.Event, 10)
+	m, echo := newSegment(t, master.Config{
+		CycleTime:   time.Millisecond,
+		Supervision: &master.Supervision{Interval: 10 * time.Millisecond, OnEvent: func(e master.Event) { events <- e }},
+	}, nil)
+	ctx := context.Background()
+	m.Scan(ctx)
+	m.ConfigureSlaves(ctx)
+	m.Start(ctx)
+	m.SetState(ctx, al.Op)
+
+	// when
+	echo.ESC.Write(register.ALStatus, []byte{byte(al.SafeOp | al.Error)})
+	changed := waitEvent(t, events, master.StateChanged)
+
+	// then
+	if !reflect.DeepEqual(changed.Positions, []uint16{0}) || changed.State != al.SafeOp|al.Error {
+		t.Errorf("Expected slave 0 to change to SAFE-OP with an error, but got %v", changed)
+	}
+	if state := echo.ESC.ALState(); state != al.SafeOp|al.Error {
+		t.Errorf("Expected the slave to stay in SAFE-OP without Recover, but got %v", state)
+	}
+}
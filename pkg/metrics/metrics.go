@@ -0,0 +1,407 @@
+// Package metrics exports the health of a master and its slaves in the Prometheus text
+// exposition format, so a plant monitoring system can scrape it over HTTP.
+//
+// An Exporter only holds what it was told: the application observes its cycles, and a Poller
+// reads the AL states, error counters and DC deviation of the slaves periodically. The metric
+// names below are stable; slave metrics are labelled with position, vendor, product and
+// revision, port metrics additionally with port.
+//
+//	goecat_cycle_duration_seconds              histogram  Time from sending a cyclic frame until it returned
+//	goecat_cycle_jitter_seconds                histogram  Deviation of the cycle start interval from the period
+//	goecat_frames_sent_total                   counter    Frames written to the link
+//	goecat_frames_received_total               counter    EtherCAT frames read from the link
+//	goecat_frames_lost_total                   counter    Frames of which no datagram returned
+//	goecat_frames_late_total                   counter    Frames that returned after their timeout
+//	goecat_datagram_timeouts_total             counter    Datagrams that timed out
+//	goecat_datagram_retries_total              counter    Datagrams sent again
+//	goecat_wkc_errors_total                    counter    Datagrams with an unexpected working counter
+//	goecat_poll_errors_total                   counter    Polls of the slaves that failed
+//	goecat_slave_al_state                      gauge      AL state (1 INIT, 2 PRE-OP, 3 BOOT, 4 SAFE-OP, 8 OP)
+//	goecat_slave_al_error                      gauge      1 if the AL Status error flag is set
+//	goecat_slave_al_status_code                gauge      AL Status Code
+//	goecat_port_invalid_frames_total           counter    Invalid frames received on a port
+//	goecat_port_rx_errors_total                counter    Physical layer RX errors on a port
+//	goecat_port_forwarded_rx_errors_total      counter    Frames received on a port with an error found by a previous slave
+//	goecat_port_lost_links_total               counter    Links lost on a port
+//	goecat_slave_processing_unit_errors_total  counter    ECAT processing unit errors
+//	goecat_slave_pdi_errors_total              counter    PDI errors
+//	goecat_slave_dc_deviation_seconds          gauge      DC system time difference to the reference clock
+//	goecat_mailbox_sent_total                  counter    Mailboxes sent to a slave
+//	goecat_mailbox_received_total              counter    Mailboxes received from a slave
+//	goecat_mailbox_sent_bytes_total            counter    Bytes of the mailboxes sent to a slave
+//	goecat_mailbox_received_bytes_total        counter    Bytes of the mailboxes received from a slave
+//	goecat_mailbox_error_replies_total         counter    Mailbox error replies received from a slave
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Aruminium/goecat/pkg/diag"
+	"github.com/Aruminium/goecat/pkg/ethercat/al"
+	"github.com/Aruminium/goecat/pkg/ethercat/mailbox"
+	"github.com/Aruminium/goecat/pkg/ethercat/sii"
+	"github.com/Aruminium/goecat/pkg/scan"
+	"github.com/Aruminium/goecat/pkg/topology"
+	"github.com/Aruminium/goecat/pkg/transceiver"
+)
+
+// ContentType is the content type of the text exposition format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefaultBuckets are the upper bounds in seconds of the cycle duration and jitter histograms
+// when Options.Buckets is nil, from 10 µs to 100 ms.
+var DefaultBuckets = []float64{10e-6, 25e-6, 50e-6, 100e-6, 250e-6, 500e-6, 1e-3, 2.5e-3, 5e-3, 10e-3, 25e-3, 100e-3}
+
+// Options configures an Exporter.
+type Options struct {
+	CyclePeriod time.Duration            // Nominal cycle period for the jitter, no jitter is observed if zero
+	Buckets     []float64                // Histogram upper bounds in seconds, DefaultBuckets if nil
+	Stats       func() transceiver.Stats // Frame and datagram counters, such as Transceiver.Stats; none if nil
+}
+
+// histogram counts observations into buckets.
+type histogram struct {
+	bounds []float64
+	counts []uint64 // Per bucket, not cumulative; the last one is +Inf
+	sum    float64
+	count  uint64
+}
+
+func newHistogram(bounds []float64) histogram {
+	return histogram{bounds: bounds, counts: make([]uint64, len(bounds)+1)}
+}
+
+func (h *histogram) observe(v float64) {
+	i := sort.SearchFloat64s(h.bounds, v)
+	h.counts[i]++
+	h.sum += v
+	h.count++
+}
+
+// errorTotals accumulates the increase of the ESC error counters, which saturate and are cleared.
+type errorTotals struct {
+	InvalidFrame     [topology.Ports]uint64
+	RXError          [topology.Ports]uint64
+	ForwardedRXError [topology.Ports]uint64
+	LostLink         [topology.Ports]uint64
+	ProcessingUnit   uint64
+	PDI              uint64
+}
+
+func (t *errorTotals) add(d diag.Counters) {
+	for port := 0; port < topology.Ports; port++ {
+		t.InvalidFrame[port] += uint64(d.InvalidFrame[port])
+		t.RXError[port] += uint64(d.RXError[port])
+		t.ForwardedRXError[port] += uint64(d.ForwardedRXError[port])
+		t.LostLink[port] += uint64(d.LostLink[port])
+	}
+	t.ProcessingUnit += uint64(d.ProcessingUnit)
+	t.PDI += uint64(d.PDI)
+}
+
+// slave holds the metrics of one slave.
+type slave struct {
+	identity   sii.Identity
+	hasState   bool
+	state      al.State
+	statusCode al.StatusCode
+	hasErrors  bool
+	errors     errorTotals
+	hasDC      bool
+	dc         time.Duration
+	mailbox    *mailbox.Conn
+}
+
+// Exporter collects the metrics and serves them over HTTP. It is safe for concurrent use.
+type Exporter struct {
+	opts Options
+
+	mu         sync.Mutex
+	cycle      histogram
+	jitter     histogram
+	lastStart  time.Time
+	pollErrors uint64
+	slaves     map[uint16]*slave
+}
+
+// New creates an Exporter without observations.
+//
+// Parameters:
+//   - opts (Options): Cycle period, histogram buckets and source of the frame counters
+//
+// Returns:
+//   - *Exporter: New exporter
+func New(opts Options) *Exporter {
+	if opts.Buckets == nil {
+		opts.Buckets = DefaultBuckets
+	}
+	return &Exporter{
+		opts:   opts,
+		cycle:  newHistogram(opts.Buckets),
+		jitter: newHistogram(opts.Buckets),
+		slaves: map[uint16]*slave{},
+	}
+}
+
+// ObserveCycle records one cycle. The jitter is the deviation of the time since the start of
+// the previous cycle from Options.CyclePeriod.
+//
+// Parameters:
+//   - start (time.Time): Time the cyclic frame was sent
+//   - duration (time.Duration): Time until the cyclic frame returned
+func (e *Exporter) ObserveCycle(start time.Time, duration time.Duration) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.cycle.observe(duration.Seconds())
+	if e.opts.CyclePeriod > 0 && !e.lastStart.IsZero() {
+		e.jitter.observe(math.Abs((start.Sub(e.lastStart) - e.opts.CyclePeriod).Seconds()))
+	}
+	e.lastStart = start
+}
+
+// SetSlaves updates the identity and AL state of scanned or refreshed slaves.
+//
+// Parameters:
+//   - slaves ([]scan.Slave): Slaves with their SII identity and AL Status
+func (e *Exporter) SetSlaves(slaves []scan.Slave) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, s := range slaves {
+		m := e.slave(s.Position)
+		if s.SII.Identity != (sii.Identity{}) {
+			m.identity = s.SII.Identity
+		}
+		m.hasState, m.state, m.statusCode = true, s.State, s.StatusCode
+	}
+}
+
+// ObserveErrors adds the increase of the error counters in a sample.
+//
+// Parameters:
+//   - sample (diag.Sample): Sample of a diag.Monitor
+func (e *Exporter) ObserveErrors(sample diag.Sample) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, s := range sample.Slaves {
+		m := e.slave(s.Position)
+		m.hasErrors = true
+		m.errors.add(s.Delta)
+	}
+}
+
+// SetDCDeviation updates the deviation of the system time of a slave from the reference clock.
+//
+// Parameters:
+//   - position (uint16): Position of the slave
+//   - deviation (time.Duration): Local system time minus the time received from the reference clock
+func (e *Exporter) SetDCDeviation(position uint16, deviation time.Duration) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	m := e.slave(position)
+	m.hasDC, m.dc = true, deviation
+}
+
+// AddMailbox exports the traffic of a mailbox connection, read at every scrape.
+//
+// Parameters:
+//   - position (uint16): Position of the slave
+//   - conn (*mailbox.Conn): Mailbox connection to the slave
+func (e *Exporter) AddMailbox(position uint16, conn *mailbox.Conn) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.slave(position).mailbox = conn
+}
+
+// ServeHTTP writes the metrics in the text exposition format.
+func (e *Exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", ContentType)
+	e.WriteTo(w)
+}
+
+// WriteTo writes the metrics in the text exposition format.
+//
+// Parameters:
+//   - w (io.Writer): Destination
+//
+// Returns:
+//   - int64: Number of bytes written
+//   - error: Error of w
+func (e *Exporter) WriteTo(w io.Writer) (int64, error) {
+	var stats transceiver.Stats
+	if e.opts.Stats != nil {
+		stats = e.opts.Stats()
+	}
+
+	e.mu.Lock()
+	var b strings.Builder
+	writeHistogram(&b, "goecat_cycle_duration_seconds", "Time from sending a cyclic frame until it returned.", e.cycle)
+	if e.opts.CyclePeriod > 0 {
+		writeHistogram(&b, "goecat_cycle_jitter_seconds", "Deviation of the cycle start interval from the cycle period.", e.jitter)
+	}
+	if e.opts.Stats != nil {
+		for _, c := range []struct {
+			name, help string
+			value      uint64
+		}{
+			{"goecat_frames_sent_total", "Frames written to the link.", stats.FramesSent},
+			{"goecat_frames_received_total", "EtherCAT frames read from the link.", stats.FramesReceived},
+			{"goecat_frames_lost_total", "Frames of which no datagram returned before the timeout.", stats.LostFrames},
+			{"goecat_frames_late_total", "Frames that returned after their datagrams had timed out.", stats.LateFrames},
+			{"goecat_datagram_timeouts_total", "Datagrams that timed out, including retried ones.", stats.Timeouts},
+			{"goecat_datagram_retries_total", "Datagrams sent again by the retry policy.", stats.Retries},
+			{"goecat_wkc_errors_total", "Datagrams that returned with an unexpected working counter.", stats.WKCMismatches},
+		} {
+			family(&b, c.name, "counter", c.help)
+			line(&b, c.name, "", float64(c.value))
+		}
+	}
+	family(&b, "goecat_poll_errors_total", "counter", "Polls of the slaves that failed.")
+	line(&b, "goecat_poll_errors_total", "", float64(e.pollErrors))
+	e.writeSlaves(&b)
+	e.mu.Unlock()
+
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// writeSlaves writes the metrics of the slaves, one family after the other.
+func (e *Exporter) writeSlaves(b *strings.Builder) {
+	positions := make([]uint16, 0, len(e.slaves))
+	for position := range e.slaves {
+		positions = append(positions, position)
+	}
+	sort.Slice(positions, func(i, j int) bool { return positions[i] < positions[j] })
+
+	perSlave := func(name string, kind string, help string, has func(*slave) bool, value func(*slave) float64) {
+		written := false
+		for _, position := range positions {
+			m := e.slaves[position]
+			if !has(m) {
+				continue
+			}
+			if !written {
+				family(b, name, kind, help)
+				written = true
+			}
+			line(b, name, labels(position, m.identity), value(m))
+		}
+	}
+	perPort := func(name string, help string, value func(*slave) [topology.Ports]uint64) {
+		written := false
+		for _, position := range positions {
+			m := e.slaves[position]
+			if !m.hasErrors {
+				continue
+			}
+			if !written {
+				family(b, name, "counter", help)
+				written = true
+			}
+			values := value(m)
+			for port, v := range values {
+				line(b, name, labels(position, m.identity)+fmt.Sprintf(",port=\"%d\"", port), float64(v))
+			}
+		}
+	}
+	state := func(m *slave) bool { return m.hasState }
+	errors := func(m *slave) bool { return m.hasErrors }
+	dc := func(m *slave) bool { return m.hasDC }
+	conn := func(m *slave) bool { return m.mailbox != nil }
+
+	perSlave("goecat_slave_al_state", "gauge", "AL state: 1 INIT, 2 PRE-OP, 3 BOOT, 4 SAFE-OP, 8 OP.", state,
+		func(m *slave) float64 { return float64(m.state.Base()) })
+	perSlave("goecat_slave_al_error", "gauge", "1 if the error flag of AL Status is set.", state,
+		func(m *slave) float64 { return boolValue(m.state.HasError()) })
+	perSlave("goecat_slave_al_status_code", "gauge", "AL Status Code.", state,
+		func(m *slave) float64 { return float64(m.statusCode) })
+	perPort("goecat_port_invalid_frames_total", "Invalid frames received on the port.",
+		func(m *slave) [topology.Ports]uint64 { return m.errors.InvalidFrame })
+	perPort("goecat_port_rx_errors_total", "Physical layer RX errors on the port.",
+		func(m *slave) [topology.Ports]uint64 { return m.errors.RXError })
+	perPort("goecat_port_forwarded_rx_errors_total", "Frames received on the port with an error detected by a previous slave.",
+		func(m *slave) [topology.Ports]uint64 { return m.errors.ForwardedRXError })
+	perPort("goecat_port_lost_links_total", "Links lost on the port.",
+		func(m *slave) [topology.Ports]uint64 { return m.errors.LostLink })
+	perSlave("goecat_slave_processing_unit_errors_total", "counter", "ECAT processing unit errors.", errors,
+		func(m *slave) float64 { return float64(m.errors.ProcessingUnit) })
+	perSlave("goecat_slave_pdi_errors_total", "counter", "PDI errors.", errors,
+		func(m *slave) float64 { return float64(m.errors.PDI) })
+	perSlave("goecat_slave_dc_deviation_seconds", "gauge", "System time difference of the slave to the reference clock.", dc,
+		func(m *slave) float64 { return m.dc.Seconds() })
+	perSlave("goecat_mailbox_sent_total", "counter", "Mailboxes sent to the slave.", conn,
+		func(m *slave) float64 { return float64(m.mailbox.Stats().Sent) })
+	perSlave("goecat_mailbox_received_total", "counter", "Mailboxes received from the slave.", conn,
+		func(m *slave) float64 { return float64(m.mailbox.Stats().Received) })
+	perSlave("goecat_mailbox_sent_bytes_total", "counter", "Bytes of the mailboxes sent to the slave.", conn,
+		func(m *slave) float64 { return float64(m.mailbox.Stats().SentBytes) })
+	perSlave("goecat_mailbox_received_bytes_total", "counter", "Bytes of the mailboxes received from the slave.", conn,
+		func(m *slave) float64 { return float64(m.mailbox.Stats().ReceivedBytes) })
+	perSlave("goecat_mailbox_error_replies_total", "counter", "Mailbox error replies received from the slave.", conn,
+		func(m *slave) float64 { return float64(m.mailbox.Stats().ErrorReplies) })
+}
+
+// slave returns the metrics of a slave, creating them if needed. e.mu must be held.
+func (e *Exporter) slave(position uint16) *slave {
+	m, ok := e.slaves[position]
+	if !ok {
+		m = &slave{}
+		e.slaves[position] = m
+	}
+	return m
+}
+
+// family writes the HELP and TYPE lines of a metric family.
+func family(b *strings.Builder, name string, kind string, help string) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// line writes one sample; labels are rendered without braces.
+func line(b *strings.Builder, name string, labels string, value float64) {
+	if labels != "" {
+		fmt.Fprintf(b, "%s{%s} %s\n", name, labels, formatValue(value))
+	} else {
+		fmt.Fprintf(b, "%s %s\n", name, formatValue(value))
+	}
+}
+
+func writeHistogram(b *strings.Builder, name string, help string, h histogram) {
+	family(b, name, "histogram", help)
+	var cumulative uint64
+	for i, bound := range h.bounds {
+		cumulative += h.counts[i]
+		line(b, name+"_bucket", fmt.Sprintf("le=\"%s\"", formatValue(bound)), float64(cumulative))
+	}
+	line(b, name+"_bucket", "le=\"+Inf\"", float64(h.count))
+	line(b, name+"_sum", "", h.sum)
+	line(b, name+"_count", "", float64(h.count))
+}
+
+// labels renders the labels that identify a slave.
+func labels(position uint16, id sii.Identity) string {
+	return fmt.Sprintf("position=\"%d\",vendor=\"0x%08x\",product=\"0x%08x\",revision=\"0x%08x\"",
+		position, id.VendorID, id.ProductCode, id.RevisionNo)
+}
+
+func formatValue(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,138 @@
+package metrics_test
+
+import (
+	"context"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Aruminium/goecat/pkg/diag"
+	"github.com/Aruminium/goecat/pkg/ethercat/al"
+	"github.com/Aruminium/goecat/pkg/ethercat/register"
+	"github.com/Aruminium/goecat/pkg/ethercat/sii"
+	"github.com/Aruminium/goecat/pkg/link"
+	"github.com/Aruminium/goecat/pkg/metrics"
+	"github.com/Aruminium/goecat/pkg/scan"
+	"github.com/Aruminium/goecat/pkg/simulator"
+	"github.com/Aruminium/goecat/pkg/transceiver"
+)
+
+var encap = link.Encapsulation{Transport: link.Raw, SrcMAC: net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, 0x55}}
+
+var identity = sii.Identity{VendorID: 0x0000079a, ProductCode: 0x00defede, RevisionNo: 2}
+
+const labels = `position="0",vendor="0x0000079a",product="0x00defede",revision="0x00000002"`
+
+// scrape returns the metrics served over HTTP and fails the test unless the content type is right.
+func scrape(t *testing.T, e *metrics.Exporter) string {
+	r := httptest.NewRecorder()
+	e.ServeHTTP(r, httptest.NewRequest("GET", "/metrics", nil))
+	if r.Header().Get("Content-Type") != metrics.ContentType {
+		t.Errorf("Expected content type %q, but got %q", metrics.ContentType, r.Header().Get("Content-Type"))
+	}
+	return r.Body.String()
+}
+
+// contains fails the test for every line missing in out.
+func contains(t *testing.T, out string, lines ...string) {
+	for _, line := range lines {
+		if !strings.Contains(out, line+"\n") {
+			t.Errorf("Expected %q in\n%s", line, out)
+		}
+	}
+}
+
+func TestCycles(t *testing.T) {
+	// given
+	e := metrics.New(metrics.Options{CyclePeriod: time.Millisecond, Buckets: []float64{100e-6, 1e-3}})
+	start := time.Now()
+
+	// when
+	e.ObserveCycle(start, 50*time.Microsecond)
+	e.ObserveCycle(start.Add(1200*time.Microsecond), 200*time.Microsecond)
+	e.ObserveCycle(start.Add(2200*time.Microsecond), 2*time.Millisecond)
+	out := scrape(t, e)
+
+	// then
+	contains(t, out,
+		"# TYPE goecat_cycle_duration_seconds histogram",
+		`goecat_cycle_duration_seconds_bucket{le="0.0001"} 1`,
+		`goecat_cycle_duration_seconds_bucket{le="0.001"} 2`,
+		`goecat_cycle_duration_seconds_bucket{le="+Inf"} 3`,
+		"goecat_cycle_duration_seconds_count 3",
+		`goecat_cycle_jitter_seconds_bucket{le="0.0001"} 1`,
+		`goecat_cycle_jitter_seconds_bucket{le="0.001"} 2`,
+		"goecat_cycle_jitter_seconds_count 2",
+	)
+}
+
+func TestSlaveMetrics(t *testing.T) {
+	// given
+	e := metrics.New(metrics.Options{Stats: func() transceiver.Stats {
+		return transceiver.Stats{FramesSent: 10, LostFrames: 2, WKCMismatches: 3}
+	}})
+	slaves := []scan.Slave{{Position: 0, State: al.SafeOp | al.Error, StatusCode: 0x001b, SII: sii.Image{Info: sii.Info{Identity: identity}}}}
+	delta := diag.Counters{RXError: [4]uint8{0, 4, 0, 0}, PDI: 1}
+
+	// when
+	e.SetSlaves(slaves)
+	e.ObserveErrors(diag.Sample{Slaves: []diag.SlaveCounters{{Position: 0, Delta: delta}}})
+	e.ObserveErrors(diag.Sample{Slaves: []diag.SlaveCounters{{Position: 0, Delta: delta}}})
+	e.SetDCDeviation(0, -250*time.Nanosecond)
+	out := scrape(t, e)
+
+	// then
+	contains(t, out,
+		"goecat_frames_sent_total 10",
+		"goecat_frames_lost_total 2",
+		"goecat_wkc_errors_total 3",
+		"goecat_slave_al_state{"+labels+"} 4",
+		"goecat_slave_al_error{"+labels+"} 1",
+		"goecat_slave_al_status_code{"+labels+"} 27",
+		"goecat_port_rx_errors_total{"+labels+`,port="1"} 8`,
+		"goecat_port_rx_errors_total{"+labels+`,port="0"} 0`,
+		"goecat_slave_pdi_errors_total{"+labels+"} 2",
+		"goecat_slave_dc_deviation_seconds{"+labels+"} -2.5e-07",
+	)
+	if strings.Contains(out, "goecat_cycle_jitter_seconds") || strings.Contains(out, "goecat_mailbox_") {
+		t.Errorf("Expected no jitter without a period and no mailbox traffic without a mailbox, but got\n%s", out)
+	}
+}
+
+func TestPoller(t *testing.T) {
+	// given
+	eeprom := sii.Info{Identity: identity}.Encode()
+	first, second := simulator.NewESC(simulator.Config{EEPROM: eeprom}), simulator.NewESC(simulator.Config{EEPROM: sii.Info{}.Encode()})
+	first.Write(register.ESCFeatures, []byte{0x04})
+	first.Write(register.DCSystemTimeDiff, []byte{0x64, 0x00, 0x00, 0x80})
+	second.Write(register.LostLinkCounter, []byte{3})
+	tr := transceiver.New(simulator.NewRing(first, second).Attach(), transceiver.Options{Encapsulation: encap})
+	t.Cleanup(func() { tr.Close() })
+	ctx := context.Background()
+	slaves, err := scan.Scan(ctx, tr, scan.Options{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	e := metrics.New(metrics.Options{Stats: tr.Stats})
+
+	// when
+	err = metrics.NewPoller(e, tr, slaves).Poll(ctx)
+	out := scrape(t, e)
+
+	// then
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	plain := `position="1",vendor="0x00000000",product="0x00000000",revision="0x00000000"`
+	contains(t, out,
+		"goecat_poll_errors_total 0",
+		"goecat_slave_al_state{"+labels+"} 1",
+		"goecat_port_lost_links_total{"+plain+`,port="0"} 3`,
+		"goecat_slave_dc_deviation_seconds{"+labels+"} -1e-07",
+	)
+	if strings.Contains(out, "goecat_slave_dc_deviation_seconds{"+plain) {
+		t.Errorf("Expected no DC deviation of a slave without distributed clocks, but got\n%s", out)
+	}
+}
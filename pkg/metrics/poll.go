@@ -0,0 +1,135 @@
+package metrics
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Aruminium/goecat/pkg/diag"
+	"github.com/Aruminium/goecat/pkg/ethercat/datagram"
+	"github.com/Aruminium/goecat/pkg/ethercat/register"
+	"github.com/Aruminium/goecat/pkg/scan"
+	"github.com/Aruminium/goecat/pkg/transceiver"
+)
+
+// featureDC is the bit of ESC Features (0x0008) set by ESCs with distributed clocks.
+const featureDC = 1 << 2
+
+// Poller reads the AL states, error counters and DC deviation of the slaves into an Exporter.
+// It is not safe for concurrent use.
+type Poller struct {
+	e       *Exporter
+	x       transceiver.Exchanger
+	slaves  []scan.Slave
+	monitor *diag.Monitor
+	dc      []bool // Whether each slave supports distributed clocks, nil until the first poll
+}
+
+// NewPoller creates a Poller for scanned slaves and exports their identities.
+//
+// Parameters:
+//   - e (*Exporter): Exporter to update
+//   - x (transceiver.Exchanger): Transceiver of the segment
+//   - slaves ([]scan.Slave): Slaves to poll, addressed by their station addresses
+//
+// Returns:
+//   - *Poller: New poller
+func NewPoller(e *Exporter, x transceiver.Exchanger, slaves []scan.Slave) *Poller {
+	slaves = append([]scan.Slave{}, slaves...)
+	e.SetSlaves(slaves)
+	return &Poller{e: e, x: x, slaves: slaves, monitor: diag.NewMonitor(x, slaves)}
+}
+
+// Poll reads every slave once. A failed poll is counted in goecat_poll_errors_total.
+//
+// Parameters:
+//   - ctx (context.Context): Context bounding the exchanges
+//
+// Returns:
+//   - error: Error if a slave does not answer
+func (p *Poller) Poll(ctx context.Context) error {
+	err := p.poll(ctx)
+	if err != nil {
+		p.e.mu.Lock()
+		p.e.pollErrors++
+		p.e.mu.Unlock()
+	}
+	return err
+}
+
+// Run polls every interval until ctx is done. Failed polls are counted and do not stop it.
+//
+// Parameters:
+//   - ctx (context.Context): Context stopping the poller
+//   - interval (time.Duration): Time between polls
+//
+// Returns:
+//   - error: ctx.Err() when ctx is done
+func (p *Poller) Run(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		p.Poll(ctx)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *Poller) poll(ctx context.Context) error {
+	if p.dc == nil {
+		dc := make([]bool, len(p.slaves))
+		for i, s := range p.slaves {
+			d, err := p.x.ExchangeExpect(ctx, datagram.FPRD(s.Station, register.ESCFeatures, 2), transceiver.ExpectWKC(1))
+			if err != nil {
+				return fmt.Errorf("metrics: slave %d: %w", s.Position, err)
+			}
+			dc[i] = binary.LittleEndian.Uint16(d.Data.Bytes())&featureDC != 0
+		}
+		p.dc = dc
+	}
+
+	var errs []error
+	for i := range p.slaves {
+		if err := scan.Refresh(ctx, p.x, &p.slaves[i]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	p.e.SetSlaves(p.slaves)
+
+	sample, err := p.monitor.Sample(ctx)
+	if err != nil {
+		errs = append(errs, err)
+	} else {
+		p.e.ObserveErrors(sample)
+	}
+
+	for i, s := range p.slaves {
+		if !p.dc[i] {
+			continue
+		}
+		d, err := p.x.ExchangeExpect(ctx, datagram.FPRD(s.Station, register.DCSystemTimeDiff, 4), transceiver.ExpectWKC(1))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("metrics: slave %d: %w", s.Position, err))
+			continue
+		}
+		p.e.SetDCDeviation(s.Position, systemTimeDifference(binary.LittleEndian.Uint32(d.Data.Bytes())))
+	}
+	return errors.Join(errs...)
+}
+
+// systemTimeDifference decodes System Time Difference (0x092C): bits 0-30 are the mean
+// difference in nanoseconds, bit 31 is set if the local copy of the system time is smaller
+// than the received time.
+func systemTimeDifference(value uint32) time.Duration {
+	d := time.Duration(value & 0x7fffffff)
+	if value&0x80000000 != 0 {
+		return -d
+	}
+	return d
+}
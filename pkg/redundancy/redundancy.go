@@ -0,0 +1,432 @@
+// Package redundancy implements cable redundancy: the segment is wired as a ring from the
+// primary port of the master through all slaves back to its secondary port, so that a single
+// broken cable does not cut off any slave.
+//
+// A Link sends every frame on both ports. While the ring is closed, the copy sent on the
+// primary port is processed by all slaves and arrives at the secondary port, and the copy sent
+// on the secondary port passes the slaves unprocessed and arrives at the primary port. When a
+// cable breaks, the ESCs next to the break close their loops: each copy is processed by the
+// slaves on its side and returns to the port it was sent from.
+//
+// The Link merges the two returned copies into one frame as if a closed ring had processed it,
+// so that the process data keeps flowing with the expected working counters. A copy arriving
+// at the primary port that has been processed tells that the ring is open, and the slaves each
+// copy passed tell where.
+package redundancy
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Aruminium/goecat/pkg/ethercat/command"
+	"github.com/Aruminium/goecat/pkg/ethercat/datagram"
+	"github.com/Aruminium/goecat/pkg/ethercat/register"
+	"github.com/Aruminium/goecat/pkg/link"
+	"github.com/Aruminium/goecat/pkg/transceiver"
+)
+
+// DefaultTimeout is used when Options.Timeout is zero.
+const DefaultTimeout = time.Millisecond
+
+// Indices of the ports.
+const (
+	primaryPort   = 0
+	secondaryPort = 1
+)
+
+// Options configures a Link.
+type Options struct {
+	Timeout  time.Duration // Time to wait for the second copy of a frame once the first returned
+	OnChange func(Status)  // Called when the ring opens or closes again
+}
+
+// Status is the state of the ring as seen by the last frames.
+type Status struct {
+	Broken    bool // The ring is open, or a copy of the last frame did not return
+	Primary   int  // Slaves reached through the primary port, -1 until counted
+	Secondary int  // Slaves reached only through the secondary port, -1 until counted
+}
+
+func (s Status) String() string {
+	switch {
+	case !s.Broken:
+		return "ring closed"
+	case s.Primary < 0 || s.Secondary < 0:
+		return "ring open"
+	case s.Primary == 0:
+		return "ring open at the primary port"
+	case s.Secondary == 0:
+		return fmt.Sprintf("ring open after slave %d", s.Primary-1)
+	default:
+		return fmt.Sprintf("ring open between slave %d and slave %d", s.Primary-1, s.Primary)
+	}
+}
+
+// sentFrame is a frame sent on both ports whose copies have not all returned.
+type sentFrame struct {
+	ecat   []byte    // EtherCAT frame as sent
+	copies [2][]byte // Ethernet frames returned on the primary and the secondary port
+	timer  *time.Timer
+}
+
+// Link is a link.Link over the primary and secondary port of a master with cable redundancy.
+// Frames are matched with their copies by the index of their first datagram.
+type Link struct {
+	ports    [2]link.Link
+	timeout  time.Duration
+	onChange func(Status)
+
+	mu     sync.Mutex
+	sent   map[uint8]*sentFrame
+	status Status
+
+	received  chan []byte
+	done      chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+// New creates a Link and starts receiving on both ports.
+//
+// Parameters:
+//   - primary (link.Link): Port connected to the first slave
+//   - secondary (link.Link): Port connected to the last slave
+//   - opts (Options): Timeout and change notification
+//
+// Returns:
+//   - *Link: New Link; Close it to close both ports
+func New(primary link.Link, secondary link.Link, opts Options) *Link {
+	if opts.Timeout == 0 {
+		opts.Timeout = DefaultTimeout
+	}
+	l := &Link{
+		ports:    [2]link.Link{primary, secondary},
+		timeout:  opts.Timeout,
+		onChange: opts.OnChange,
+		sent:     map[uint8]*sentFrame{},
+		status:   Status{Primary: -1, Secondary: -1},
+		received: make(chan []byte, 64),
+		done:     make(chan struct{}),
+	}
+
+	l.wg.Add(2)
+	go l.receive(primaryPort)
+	go l.receive(secondaryPort)
+	return l
+}
+
+// Send writes a frame to both ports. Frames that do not carry EtherCAT are sent on the primary
+// port only.
+func (l *Link) Send(frame []byte) error {
+	ecat, err := link.Decapsulate(frame)
+	index, ok := firstIndex(ecat)
+	if err != nil || !ok {
+		return l.ports[primaryPort].Send(frame)
+	}
+
+	l.mu.Lock()
+	if f := l.sent[index]; f != nil && f.timer != nil {
+		f.timer.Stop()
+	}
+	l.sent[index] = &sentFrame{ecat: append([]byte(nil), ecat...)}
+	l.mu.Unlock()
+
+	primaryErr := l.ports[primaryPort].Send(frame)
+	secondaryErr := l.ports[secondaryPort].Send(frame)
+	if primaryErr != nil && secondaryErr != nil {
+		l.mu.Lock()
+		delete(l.sent, index)
+		l.mu.Unlock()
+		return errors.Join(primaryErr, secondaryErr)
+	}
+	return nil
+}
+
+// Receive blocks until a merged frame is available or the link is closed.
+func (l *Link) Receive() ([]byte, error) {
+	select {
+	case frame := <-l.received:
+		return frame, nil
+	case <-l.done:
+		return nil, link.ErrClosed
+	}
+}
+
+// Close closes both ports and unblocks pending Receive calls.
+func (l *Link) Close() error {
+	var err error
+	l.closeOnce.Do(func() {
+		close(l.done)
+		err = errors.Join(l.ports[primaryPort].Close(), l.ports[secondaryPort].Close())
+		l.wg.Wait()
+	})
+	return err
+}
+
+// Status returns the state of the ring.
+func (l *Link) Status() Status {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.status
+}
+
+// Locate exchanges a broadcast read, so that the slaves on both sides of a break are counted.
+// Frames carrying only configured or logical datagrams, such as the process data, tell that
+// the ring is open but not where.
+//
+// Parameters:
+//   - ctx (context.Context): Context bounding the exchange
+//   - x (transceiver.Exchanger): Transceiver on the Link
+//
+// Returns:
+//   - Status: State of the ring after the broadcast read
+//   - error: Error if the datagram did not return
+func (l *Link) Locate(ctx context.Context, x transceiver.Exchanger) (Status, error) {
+	if _, err := x.Exchange(ctx, datagram.BRD(register.Type, 1)); err != nil {
+		return Status{}, err
+	}
+	return l.Status(), nil
+}
+
+// receive reads the frames returned on a port until the port is closed.
+func (l *Link) receive(port int) {
+	defer l.wg.Done()
+
+	for {
+		ethernet, err := l.ports[port].Receive()
+		if err != nil {
+			select {
+			case <-l.done:
+				return
+			default:
+			}
+			if errors.Is(err, link.ErrClosed) {
+				return
+			}
+			continue
+		}
+		l.arrive(port, ethernet)
+	}
+}
+
+// arrive records a copy returned on a port. The frame is merged once both copies have returned
+// or the timeout after the first one has passed. Frames that were not sent by Send are passed
+// on as they are.
+func (l *Link) arrive(port int, ethernet []byte) {
+	ecat, err := link.Decapsulate(ethernet)
+	index, ok := firstIndex(ecat)
+
+	l.mu.Lock()
+	f := l.sent[index]
+	if err != nil || !ok || f == nil || f.copies[port] != nil {
+		l.mu.Unlock()
+		l.deliver(ethernet)
+		return
+	}
+	f.copies[port] = ethernet
+	if f.copies[1-port] == nil {
+		f.timer = time.AfterFunc(l.timeout, func() { l.complete(index, f) })
+		l.mu.Unlock()
+		return
+	}
+	f.timer.Stop()
+	l.mu.Unlock()
+
+	l.complete(index, f)
+}
+
+// complete merges the returned copies of a frame, updates the status and delivers the frame.
+func (l *Link) complete(index uint8, f *sentFrame) {
+	l.mu.Lock()
+	if l.sent[index] != f {
+		// Completed by the other copy or the timeout already.
+		l.mu.Unlock()
+		return
+	}
+	delete(l.sent, index)
+	frame, status := merge(f, l.status)
+	changed := status.Broken != l.status.Broken
+	l.status = status
+	l.mu.Unlock()
+
+	if changed && l.onChange != nil {
+		l.onChange(status)
+	}
+	if frame != nil {
+		l.deliver(frame)
+	}
+}
+
+// deliver passes a frame to Receive.
+func (l *Link) deliver(frame []byte) {
+	select {
+	case l.received <- frame:
+	case <-l.done:
+	}
+}
+
+// merge combines the returned copies of a frame. Every slave processed one of them, so the data
+// changed in either copy is taken over, and the working counters and the slave counts in the
+// addresses of auto increment and broadcast datagrams add up. The status counts the slaves
+// when the frame carries such a datagram, and keeps the previous counts otherwise.
+//
+// Returns:
+//   - []byte: Merged Ethernet frame, nil if the copies do not match the frame sent
+//   - Status: State of the ring seen by the frame
+func merge(f *sentFrame, previous Status) ([]byte, Status) {
+	status := Status{Broken: true, Primary: previous.Primary, Secondary: previous.Secondary}
+	sent := split(f.ecat)
+
+	var copies [2][][]byte
+	var frame []byte
+	for port, ethernet := range f.copies {
+		if ethernet == nil {
+			continue
+		}
+		ecat, _ := link.Decapsulate(ethernet)
+		copies[port] = split(ecat)
+		if !sameLayout(sent, copies[port]) {
+			return nil, previous
+		}
+		frame = ethernet
+	}
+
+	switch {
+	case copies[primaryPort] == nil || copies[secondaryPort] == nil:
+		// A port or the cable to it is down: the copy that returned passed all the slaves it could reach.
+		port := primaryPort
+		if copies[primaryPort] == nil {
+			port = secondaryPort
+		}
+		if n, ok := passed(sent, copies[port]); ok {
+			status.Primary, status.Secondary = n, 0
+			if port == secondaryPort {
+				status.Primary, status.Secondary = 0, n
+			}
+		}
+		return frame, status
+
+	case !processed(sent, copies[primaryPort]):
+		// The ring is closed: the copy sent on the secondary port passed unprocessed.
+		status.Broken = false
+		if n, ok := passed(sent, copies[secondaryPort]); ok {
+			status.Primary, status.Secondary = n, 0
+		}
+
+	default:
+		if n, ok := passed(sent, copies[primaryPort]); ok {
+			status.Primary = n
+			status.Secondary, _ = passed(sent, copies[secondaryPort])
+		}
+	}
+
+	for i, d := range sent {
+		combine(copies[secondaryPort][i], copies[primaryPort][i], d)
+	}
+	return f.copies[secondaryPort], status
+}
+
+// combine merges the datagram other into d, both returned copies of sent.
+// The slaves of a broadcast read OR their data into the datagram, so the data of both copies is
+// ORed. Otherwise every bit is taken from the copy whose slaves changed it.
+func combine(d []byte, other []byte, sent []byte) {
+	add := func(at int) {
+		v := binary.LittleEndian.Uint16(d[at:]) + binary.LittleEndian.Uint16(other[at:]) - binary.LittleEndian.Uint16(sent[at:])
+		binary.LittleEndian.PutUint16(d[at:], v)
+	}
+
+	addressing := command.Type(sent[0]).Addressing()
+	switch addressing {
+	case command.AutoIncrement, command.Broadcast:
+		add(2)
+	}
+	d[8] |= other[8]
+	d[9] |= other[9]
+	for i := datagram.HeaderLength; i < len(d)-datagram.WKCLength; i++ {
+		if addressing == command.Broadcast {
+			d[i] |= other[i]
+			continue
+		}
+		changed := other[i] ^ sent[i]
+		d[i] = d[i]&^changed | other[i]&changed
+	}
+	add(len(d) - datagram.WKCLength)
+}
+
+// processed reports whether any slave processed a returned copy of the datagrams sent.
+func processed(sent [][]byte, returned [][]byte) bool {
+	if n, ok := passed(sent, returned); ok && n > 0 {
+		return true
+	}
+	for _, d := range returned {
+		if binary.LittleEndian.Uint16(d[len(d)-datagram.WKCLength:]) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// passed returns the number of slaves a copy passed, counted by its first auto increment or
+// broadcast datagram, and false if it has none.
+func passed(sent [][]byte, returned [][]byte) (int, bool) {
+	for i, d := range sent {
+		switch command.Type(d[0]).Addressing() {
+		case command.AutoIncrement, command.Broadcast:
+			return int(binary.LittleEndian.Uint16(returned[i][2:]) - binary.LittleEndian.Uint16(d[2:])), true
+		}
+	}
+	return 0, false
+}
+
+// split returns the datagrams of an EtherCAT frame, sharing its memory.
+func split(ecat []byte) [][]byte {
+	if len(ecat) < 2 {
+		return nil
+	}
+	length := int(binary.LittleEndian.Uint16(ecat) & 0x07ff)
+	if len(ecat) < 2+length {
+		return nil
+	}
+
+	var datagrams [][]byte
+	rest := ecat[2 : 2+length]
+	for len(rest) >= datagram.Overhead {
+		lrcm := binary.LittleEndian.Uint16(rest[6:8])
+		size := datagram.Overhead + int(lrcm&datagram.MaxDataLen)
+		if len(rest) < size {
+			return nil
+		}
+		datagrams = append(datagrams, rest[:size])
+		rest = rest[size:]
+		if lrcm&0x8000 == 0 {
+			break
+		}
+	}
+	return datagrams
+}
+
+// sameLayout reports whether returned holds the datagrams sent, each of the same command and size.
+func sameLayout(sent [][]byte, returned [][]byte) bool {
+	if len(sent) == 0 || len(sent) != len(returned) {
+		return false
+	}
+	for i := range sent {
+		if len(sent[i]) != len(returned[i]) || sent[i][0] != returned[i][0] || sent[i][1] != returned[i][1] {
+			return false
+		}
+	}
+	return true
+}
+
+// firstIndex returns the index of the first datagram of an EtherCAT frame.
+func firstIndex(ecat []byte) (uint8, bool) {
+	if len(ecat) < 2+datagram.HeaderLength {
+		return 0, false
+	}
+	return ecat[3], true
+}
@@ -0,0 +1,127 @@
+package redundancy_test
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Aruminium/goecat/pkg/ethercat/datagram"
+	"github.com/Aruminium/goecat/pkg/ethercat/payload/fmmu"
+	"github.com/Aruminium/goecat/pkg/ethercat/register"
+	"github.com/Aruminium/goecat/pkg/ethercat/sii"
+	"github.com/Aruminium/goecat/pkg/link"
+	"github.com/Aruminium/goecat/pkg/redundancy"
+	"github.com/Aruminium/goecat/pkg/simulator"
+	"github.com/Aruminium/goecat/pkg/transceiver"
+)
+
+var encap = link.Encapsulation{Transport: link.Raw, SrcMAC: net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, 0x55}}
+
+// exchange reads one input byte of each of three slaves and locates a break of the ring.
+func exchange(t *testing.T, tr *transceiver.Transceiver, l *redundancy.Link) ([]byte, redundancy.Status) {
+	t.Helper()
+	ctx := context.Background()
+	d, err := tr.ExchangeExpect(ctx, datagram.LRD(0, 3), transceiver.ExpectWKC(3))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	status, err := l.Locate(ctx, tr)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return d.Data.Bytes(), status
+}
+
+func TestRingBreakBroadcastRead(t *testing.T) {
+	// given
+	var escs []*simulator.ESC
+	for i := 0; i < 3; i++ {
+		escs = append(escs, simulator.NewESC(simulator.Config{EEPROM: sii.Info{}.Encode()}))
+	}
+	ring := simulator.NewRing(escs...)
+	primary, secondary := ring.AttachRedundant()
+	l := redundancy.New(primary, secondary, redundancy.Options{Timeout: 20 * time.Millisecond})
+	tr := transceiver.New(l, transceiver.Options{Encapsulation: encap})
+	t.Cleanup(func() { tr.Close() })
+	ctx := context.Background()
+
+	// when
+	closed, closedErr := tr.ExchangeExpect(ctx, datagram.BRD(register.ALStatus, 2), transceiver.ExpectWKC(3))
+	ring.Disconnect(1)
+	broken, brokenErr := tr.ExchangeExpect(ctx, datagram.BRD(register.ALStatus, 2), transceiver.ExpectWKC(3))
+
+	// then
+	for _, tt := range []struct {
+		d   datagram.Datagram
+		err error
+	}{{closed, closedErr}, {broken, brokenErr}} {
+		if tt.err != nil || !reflect.DeepEqual(tt.d.Data.Bytes(), []byte{0x01, 0x00}) {
+			t.Errorf("Expected INIT (01 00) from all slaves, but got % x (%v)", tt.d.Data.Bytes(), tt.err)
+		}
+	}
+	if status := l.Status(); !status.Broken {
+		t.Errorf("Expected the ring to be broken, but got %v", status)
+	}
+}
+
+func TestRingBreak(t *testing.T) {
+	// given
+	var escs []*simulator.ESC
+	for i := 0; i < 3; i++ {
+		esc := simulator.NewESC(simulator.Config{EEPROM: sii.Info{}.Encode()})
+		esc.Write(register.ProcessDataRAM, []byte{byte(i + 1)})
+		escs = append(escs, esc)
+	}
+	ring := simulator.NewRing(escs...)
+	changes := make(chan redundancy.Status, 10)
+	primary, secondary := ring.AttachRedundant()
+	l := redundancy.New(primary, secondary, redundancy.Options{Timeout: 20 * time.Millisecond, OnChange: func(s redundancy.Status) { changes <- s }})
+	tr := transceiver.New(l, transceiver.Options{Encapsulation: encap})
+	t.Cleanup(func() { tr.Close() })
+	for i := range escs {
+		inputs := &fmmu.FMMU{LogStart: uint32(i), LogLength: 1, LogEndBit: 7, PhysStart: register.ProcessDataRAM, AbleUseRead: true, IsActivate: true}
+		if _, err := tr.ExchangeExpect(context.Background(), datagram.APWR(uint16(i), register.FMMU(0), inputs), transceiver.ExpectWKC(1)); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	// when
+	closedInputs, closed := exchange(t, tr, l)
+	ring.Disconnect(1)
+	brokenInputs, broken := exchange(t, tr, l)
+	ring.Disconnect(0)
+	primaryInputs, primaryDown := exchange(t, tr, l)
+	ring.Reconnect()
+	_, reconnected := exchange(t, tr, l)
+
+	// then
+	expected := []byte{1, 2, 3}
+	for _, inputs := range [][]byte{closedInputs, brokenInputs, primaryInputs} {
+		if !reflect.DeepEqual(inputs, expected) {
+			t.Errorf("Expected the inputs of all slaves % x, but got % x", expected, inputs)
+		}
+	}
+	for _, tt := range []struct {
+		status   redundancy.Status
+		expected redundancy.Status
+		text     string
+	}{
+		{closed, redundancy.Status{Primary: 3, Secondary: 0}, "ring closed"},
+		{broken, redundancy.Status{Broken: true, Primary: 1, Secondary: 2}, "ring open between slave 0 and slave 1"},
+		{primaryDown, redundancy.Status{Broken: true, Primary: 0, Secondary: 3}, "ring open at the primary port"},
+		{reconnected, redundancy.Status{Primary: 3, Secondary: 0}, "ring closed"},
+	} {
+		if tt.status != tt.expected || tt.status.String() != tt.text {
+			t.Errorf("Expected %+v (%s), but got %+v (%s)", tt.expected, tt.text, tt.status, tt.status)
+		}
+	}
+	var opened []bool
+	for len(changes) > 0 {
+		opened = append(opened, (<-changes).Broken)
+	}
+	if !reflect.DeepEqual(opened, []bool{true, false}) {
+		t.Errorf("Expected the ring to open and close once, but got %v", opened)
+	}
+}
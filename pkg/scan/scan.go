@@ -0,0 +1,199 @@
+// Package scan discovers the slaves of a segment: it counts them, assigns configured station
+// addresses and reads their state, link status and SII EEPROM.
+package scan
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/Aruminium/goecat/pkg/ethercat/al"
+	"github.com/Aruminium/goecat/pkg/ethercat/datagram"
+	"github.com/Aruminium/goecat/pkg/ethercat/payload"
+	"github.com/Aruminium/goecat/pkg/ethercat/register"
+	"github.com/Aruminium/goecat/pkg/ethercat/sii"
+	"github.com/Aruminium/goecat/pkg/transceiver"
+)
+
+// DefaultFirstStation is the station address assigned to the first slave when
+// Options.FirstStation is zero.
+const DefaultFirstStation uint16 = 0x1001
+
+// dlControlAlias is the bit of the last DL Control byte that enables addressing by station alias.
+const dlControlAlias = 0x01
+
+// ErrNoSlaves is returned when no slave answers.
+var ErrNoSlaves = errors.New("scan: no slaves found")
+
+// Options configures a scan.
+type Options struct {
+	FirstStation uint16 // Station address of the first slave, DefaultFirstStation if zero
+	SkipSII      bool   // Do not read the SII EEPROM; Slave.SII stays empty
+	// AliasAddressing enables addressing by station alias (DL Control 0x0100 bit 24) on every
+	// slave with an alias, so that configured address datagrams such as FPRD and FPWR reach it
+	// by its alias as well as by its station address. Aliases must then differ from each other
+	// and from the station addresses.
+	AliasAddressing bool
+}
+
+// Slave is a slave found by a scan.
+type Slave struct {
+	Position   uint16        // Position in the segment, 0 is the first slave
+	Station    uint16        // Configured station address assigned by the scan
+	Alias      uint16        // Station alias register (0x0012), loaded from the EEPROM
+	State      al.State      // AL Status
+	StatusCode al.StatusCode // AL Status Code
+	DLStatus   uint16        // DL Status with the link and loop state of the ports
+	SII        sii.Image     // Decoded EEPROM image
+}
+
+// Name returns the device name from the SII, or an empty string.
+func (s Slave) Name() string {
+	return s.SII.Name()
+}
+
+// HasAlias reports whether the slave is identified by a station alias: its station alias
+// register or, if that is zero, the alias in its SII.
+//
+// Parameters:
+//   - alias (uint16): Station alias, not zero
+//
+// Returns:
+//   - bool: Whether the slave has the alias
+func (s Slave) HasAlias(alias uint16) bool {
+	if s.Alias != 0 {
+		return s.Alias == alias
+	}
+	return s.SII.Alias == alias
+}
+
+// Find returns the position of a slave given relative to the first slave with a station alias,
+// which keeps referring to the same slave when slaves are added in front of it.
+//
+// Parameters:
+//   - slaves ([]Slave): Scanned slaves
+//   - alias (uint16): Station alias of the reference slave, 0 to count from the first slave
+//   - offset (uint16): Position of the slave after the reference slave
+//
+// Returns:
+//   - int: Position of the slave
+//   - bool: False if no slave has the alias or the position is beyond the last slave
+func Find(slaves []Slave, alias uint16, offset uint16) (int, bool) {
+	base := 0
+	if alias != 0 {
+		base = slices.IndexFunc(slaves, func(s Slave) bool { return s.HasAlias(alias) })
+		if base < 0 {
+			return 0, false
+		}
+	}
+	position := base + int(offset)
+	return position, position < len(slaves)
+}
+
+// Count returns the number of slaves in the segment.
+//
+// Parameters:
+//   - ctx (context.Context): Context bounding the exchange
+//   - x (transceiver.Exchanger): Transceiver of the segment
+//
+// Returns:
+//   - int: Number of slaves that answered a broadcast read
+//   - error: Error if the exchange fails
+func Count(ctx context.Context, x transceiver.Exchanger) (int, error) {
+	d, err := x.Exchange(ctx, datagram.BRD(register.Type, 1))
+	if err != nil {
+		return 0, err
+	}
+	return int(d.WKC), nil
+}
+
+// Scan counts the slaves, assigns the station address FirstStation + position to every slave
+// and reads the station alias and the state of each slave.
+//
+// Parameters:
+//   - ctx (context.Context): Context bounding the scan
+//   - x (transceiver.Exchanger): Transceiver of the segment
+//   - opts (Options): Station addresses and what to read
+//
+// Returns:
+//   - []Slave: Slaves in the order of their positions
+//   - error: ErrNoSlaves if the segment is empty, or an error if a slave does not answer
+func Scan(ctx context.Context, x transceiver.Exchanger, opts Options) ([]Slave, error) {
+	if opts.FirstStation == 0 {
+		opts.FirstStation = DefaultFirstStation
+	}
+
+	count, err := Count(ctx, x)
+	if err != nil {
+		return nil, err
+	}
+	if count == 0 {
+		return nil, ErrNoSlaves
+	}
+
+	slaves := make([]Slave, count)
+	for i := range slaves {
+		s := &slaves[i]
+		s.Position, s.Station = uint16(i), opts.FirstStation+uint16(i)
+
+		station := binary.LittleEndian.AppendUint16(nil, s.Station)
+		if _, err := x.ExchangeExpect(ctx, datagram.APWR(s.Position, register.StationAddress, payload.BasicPayload{Data: station}), transceiver.ExpectWKC(1)); err != nil {
+			return nil, fmt.Errorf("scan: slave %d: %w", i, err)
+		}
+		if err := Refresh(ctx, x, s); err != nil {
+			return nil, err
+		}
+		if opts.AliasAddressing && s.Alias != 0 {
+			enable := payload.BasicPayload{Data: []byte{dlControlAlias}}
+			if _, err := x.ExchangeExpect(ctx, datagram.FPWR(s.Station, register.DLControl+3, enable), transceiver.ExpectWKC(1)); err != nil {
+				return nil, fmt.Errorf("scan: slave %d: %w", i, err)
+			}
+		}
+
+		if opts.SkipSII {
+			continue
+		}
+		image, err := sii.NewEEPROM(x, s.Station).ReadImage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("scan: slave %d: %w", i, err)
+		}
+		if s.SII, err = sii.ParseImage(image); err != nil {
+			return nil, fmt.Errorf("scan: slave %d: %w", i, err)
+		}
+	}
+	return slaves, nil
+}
+
+// Refresh reads the alias, the AL state and the DL status of a scanned slave again.
+//
+// Parameters:
+//   - ctx (context.Context): Context bounding the exchanges
+//   - x (transceiver.Exchanger): Transceiver of the segment
+//   - s (*Slave): Slave to update, addressed by its station address
+//
+// Returns:
+//   - error: Error if the slave does not answer
+func Refresh(ctx context.Context, x transceiver.Exchanger, s *Slave) error {
+	alias, err := x.ExchangeExpect(ctx, datagram.FPRD(s.Station, register.StationAlias, 2), transceiver.ExpectWKC(1))
+	if err != nil {
+		return fmt.Errorf("scan: slave %d: %w", s.Position, err)
+	}
+	dl, err := x.ExchangeExpect(ctx, datagram.FPRD(s.Station, register.DLStatus, 2), transceiver.ExpectWKC(1))
+	if err != nil {
+		return fmt.Errorf("scan: slave %d: %w", s.Position, err)
+	}
+	// AL Status and AL Status Code are read together.
+	status, err := x.ExchangeExpect(ctx, datagram.FPRD(s.Station, register.ALStatus, register.ALStatusCode+2-register.ALStatus), transceiver.ExpectWKC(1))
+	if err != nil {
+		return fmt.Errorf("scan: slave %d: %w", s.Position, err)
+	}
+
+	data := status.Data.Bytes()
+	s.Alias = binary.LittleEndian.Uint16(alias.Data.Bytes())
+	s.DLStatus = binary.LittleEndian.Uint16(dl.Data.Bytes())
+	s.State = al.State(binary.LittleEndian.Uint16(data))
+	s.StatusCode = al.StatusCode(binary.LittleEndian.Uint16(data[register.ALStatusCode-register.ALStatus:]))
+	return nil
+}
@@ -0,0 +1,109 @@
+package scan_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/Aruminium/goecat/pkg/ethercat/al"
+	"github.com/Aruminium/goecat/pkg/ethercat/datagram"
+	"github.com/Aruminium/goecat/pkg/ethercat/register"
+	"github.com/Aruminium/goecat/pkg/ethercat/sii"
+	"github.com/Aruminium/goecat/pkg/link"
+	"github.com/Aruminium/goecat/pkg/scan"
+	"github.com/Aruminium/goecat/pkg/simulator"
+	"github.com/Aruminium/goecat/pkg/transceiver"
+)
+
+var encap = link.Encapsulation{Transport: link.Raw, SrcMAC: net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, 0x55}}
+
+func newSegment(t *testing.T, slaves ...*simulator.ESC) *transceiver.Transceiver {
+	tr := transceiver.New(simulator.NewRing(slaves...).Attach(), transceiver.Options{Encapsulation: encap})
+	t.Cleanup(func() { tr.Close() })
+	return tr
+}
+
+func TestScan(t *testing.T) {
+	// given
+	identity := sii.Identity{VendorID: 0x0000079a, ProductCode: 0x00defede, RevisionNo: 2}
+	eeprom := sii.Info{Alias: 7, Identity: identity}.Encode(
+		sii.Strings{"Terminals", "EasyCAT"}.Category(),
+		sii.General{GroupIdx: 1, NameIdx: 2}.Category(),
+	)
+	tr := newSegment(t,
+		simulator.NewESC(simulator.Config{EEPROM: eeprom}),
+		simulator.NewESC(simulator.Config{EEPROM: sii.Info{}.Encode()}),
+	)
+
+	// when
+	slaves, err := scan.Scan(context.Background(), tr, scan.Options{FirstStation: 0x2000})
+
+	// then
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(slaves) != 2 {
+		t.Fatalf("Expected 2 slaves, but got %d", len(slaves))
+	}
+	if slaves[0].Station != 0x2000 || slaves[1].Station != 0x2001 {
+		t.Errorf("Expected stations 0x2000 and 0x2001, but got 0x%04x and 0x%04x", slaves[0].Station, slaves[1].Station)
+	}
+	if slaves[0].Alias != 7 || slaves[0].State != al.Init {
+		t.Errorf("Expected alias 7 in INIT, but got %d in %v", slaves[0].Alias, slaves[0].State)
+	}
+	if !reflect.DeepEqual(slaves[0].SII.Identity, identity) || slaves[0].Name() != "EasyCAT" {
+		t.Errorf("Expected %v named EasyCAT, but got %v named %q", identity, slaves[0].SII.Identity, slaves[0].Name())
+	}
+	if slaves[1].Name() != "" {
+		t.Errorf("Expected no name without a General category, but got %q", slaves[1].Name())
+	}
+	if slaves[0].DLStatus&0x0010 == 0 {
+		t.Errorf("Expected a link on port 0, but got DL status 0x%04x", slaves[0].DLStatus)
+	}
+}
+
+func TestScanEmptySegment(t *testing.T) {
+	// given
+	tr := newSegment(t)
+
+	// when
+	_, err := scan.Scan(context.Background(), tr, scan.Options{})
+
+	// then
+	if !errors.Is(err, scan.ErrNoSlaves) {
+		t.Errorf("Expected %v, but got %v", scan.ErrNoSlaves, err)
+	}
+}
+
+func TestAliasAddressing(t *testing.T) {
+	// given
+	tr := newSegment(t,
+		simulator.NewESC(simulator.Config{EEPROM: sii.Info{}.Encode()}),
+		simulator.NewESC(simulator.Config{EEPROM: sii.Info{Alias: 100}.Encode()}),
+		simulator.NewESC(simulator.Config{EEPROM: sii.Info{}.Encode()}),
+	)
+	ctx := context.Background()
+
+	// when
+	slaves, err := scan.Scan(ctx, tr, scan.Options{AliasAddressing: true})
+	d, readErr := tr.ExchangeExpect(ctx, datagram.FPRD(100, register.StationAddress, 2), transceiver.ExpectWKC(1))
+	found, ok := scan.Find(slaves, 100, 1)
+	_, beyond := scan.Find(slaves, 100, 2)
+	_, unknown := scan.Find(slaves, 5, 0)
+
+	// then
+	if err != nil || readErr != nil {
+		t.Fatalf("Unexpected errors: %v, %v", err, readErr)
+	}
+	if station := d.Data.Bytes(); !reflect.DeepEqual(station, []byte{0x02, 0x10}) {
+		t.Errorf("Expected the slave with alias 100 to answer with station 0x1002, but got % x", station)
+	}
+	if found != 2 || !ok {
+		t.Errorf("Expected alias 100 + 1 at position 2, but got %d, %v", found, ok)
+	}
+	if beyond || unknown {
+		t.Errorf("Expected no slave beyond the segment or with an unknown alias")
+	}
+}
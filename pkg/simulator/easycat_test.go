@@ -0,0 +1,82 @@
+package simulator_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Aruminium/goecat/pkg/ethercat/al"
+	"github.com/Aruminium/goecat/pkg/ethercat/datagram"
+	"github.com/Aruminium/goecat/pkg/ethercat/payload"
+	"github.com/Aruminium/goecat/pkg/ethercat/payload/fmmu"
+	"github.com/Aruminium/goecat/pkg/ethercat/payload/syncmanager"
+	"github.com/Aruminium/goecat/pkg/transceiver"
+)
+
+// TestEasyCATSyncAndLED replays the easycat sync and led examples against a simulated slave.
+func TestEasyCATSyncAndLED(t *testing.T) {
+	// given
+	ring, tr := newSegment(t, 1)
+	ctx := context.Background()
+	slave := ring.Slaves()[0]
+
+	clear := []datagram.Datagram{
+		datagram.BRD(0x0000, 1),
+		datagram.BWR(0x0800, payload.BasicPayload{Data: make([]byte, 32)}),
+	}
+	sync := []datagram.Datagram{
+		datagram.APWR(0, 0x0800, &syncmanager.SyncManager{
+			Start:      0x1000,
+			Length:     0x0020,
+			CtrlStatus: syncmanager.CtrlStatus{IsTriggerWatchdog: true, IsPdiIRQ: true, Access: 0x1},
+			Enable:     syncmanager.Enable{IsEnable: true},
+		}),
+		datagram.APWR(0, 0x0808, &syncmanager.SyncManager{
+			Start:      0x1100,
+			Length:     0x0020,
+			CtrlStatus: syncmanager.CtrlStatus{IsTriggerWatchdog: true, IsPdiIRQ: true},
+			Enable:     syncmanager.Enable{IsEnable: true},
+		}),
+		datagram.APWR(0, 0x0610, &fmmu.FMMU{LogLength: 0x0020, LogEndBit: 0x07, PhysStart: 0x1100, AbleUseWrite: true, IsActivate: true}),
+		datagram.APWR(0, 0x0600, &fmmu.FMMU{LogLength: 0x0020, LogEndBit: 0x07, PhysStart: 0x1000, AbleUseRead: true, AbleUseWrite: true, IsActivate: true}),
+		// The example requests OP directly, which the AL state machine only allows step by step.
+		datagram.BWR(0x0120, payload.BasicPayload{Data: []byte{0x02}}),
+		datagram.BWR(0x0120, payload.BasicPayload{Data: []byte{0x04}}),
+		datagram.BWR(0x0120, payload.BasicPayload{Data: []byte{0x08}}),
+	}
+
+	// when
+	for _, d := range append(clear, sync...) {
+		if _, err := tr.ExchangeExpect(ctx, d, transceiver.ExpectWKC(1)); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	// then
+	if slave.ALState() != al.Op {
+		t.Fatalf("Expected %v, but got %v", al.Op, slave.ALState())
+	}
+
+	for led := uint8(0); led <= 0x0f; led++ {
+		// given
+		outputs := make([]byte, 32)
+		outputs[0] = led
+
+		// when
+		if _, err := tr.ExchangeExpect(ctx, datagram.LWR(0, payload.BasicPayload{Data: outputs}), transceiver.ExpectWKC(1)); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		slave.Write(0x1000, []byte{^led})
+		read, err := tr.ExchangeExpect(ctx, datagram.LRD(0, 32), transceiver.ExpectWKC(1))
+
+		// then
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if got := slave.Read(0x1100, 1)[0]; got != led {
+			t.Errorf("Expected LED 0x%02x, but got 0x%02x", led, got)
+		}
+		if got := read.Data.Bytes()[0]; got != ^led {
+			t.Errorf("Expected input 0x%02x, but got 0x%02x", ^led, got)
+		}
+	}
+}
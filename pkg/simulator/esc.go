@@ -0,0 +1,681 @@
+// Package simulator emulates EtherCAT slaves in software, so the library can be tested without hardware.
+//
+// An ESC answers datagrams like an EtherCAT Slave Controller: it has register and process data
+// memory, an SII EEPROM, the AL state machine and FMMUs that map logical addresses onto its
+// physical memory. Several ESCs are chained into a Ring that serves a link.Link.
+//
+// The process data watchdog is emulated once its time is configured: it restarts with every
+// write to a SyncManager with the watchdog trigger, and when it expires, the ESC counts the
+// expiration and drops from OP to SAFE-OP with al.SyncManagerWatchdog like a slave application
+// would. Expirations are noticed when the ESC processes the next frame.
+package simulator
+
+import (
+	"encoding/binary"
+	"sync"
+	"time"
+
+	"github.com/Aruminium/goecat/pkg/ethercat/al"
+	"github.com/Aruminium/goecat/pkg/ethercat/command"
+	"github.com/Aruminium/goecat/pkg/ethercat/register"
+	"github.com/Aruminium/goecat/pkg/ethercat/sii"
+)
+
+const (
+	defaultFMMUs   = 8
+	defaultSMs     = 8
+	defaultRAMSize = 4 // KByte
+	escType        = 0x11
+)
+
+// SII control bits (0x0502).
+const (
+	siiWriteEnable uint16 = 0x0001
+	siiRead        uint16 = 0x0100
+	siiWrite       uint16 = 0x0200
+	siiReload      uint16 = 0x0400
+	siiCommands           = siiRead | siiWrite | siiReload
+)
+
+// SyncManager control (offset 4), status (offset 5) and activate (offset 6) bits.
+const (
+	smModeMask    uint8 = 0x03
+	smModeMailbox uint8 = 0x02
+	smDirMask     uint8 = 0x0c
+	smDirWrite    uint8 = 0x04 // Written by ECAT, read by PDI
+	smMailboxFull uint8 = 0x08
+	smEnable      uint8 = 0x01
+
+	smWatchdogTrigger uint8 = 0x40 // Writes restart the process data watchdog
+)
+
+// Config describes a virtual slave.
+type Config struct {
+	EEPROM  []byte // SII EEPROM image, for example from sii.Info.Encode
+	FMMUs   int    // Number of FMMU channels, 8 if zero
+	SMs     int    // Number of SyncManager channels, 8 if zero
+	RAMSize int    // Process data RAM in KByte, 4 if zero
+
+	// Transition is called before a valid AL state change is applied.
+	// A non-zero status code refuses the change and sets the error indication.
+	// It runs while the ESC is locked and must not call its methods.
+	Transition func(from al.State, to al.State) al.StatusCode
+
+	// Application is called after every processed frame, like the slave application that
+	// polls the ESC through the PDI. It may use the methods of the ESC.
+	Application func(e *ESC)
+}
+
+// ESC is a virtual EtherCAT Slave Controller.
+type ESC struct {
+	mu       sync.Mutex
+	cfg      Config
+	mem      []byte
+	eeprom   []byte
+	watchdog time.Time // Last restart of the process data watchdog, zero before the first
+}
+
+// NewESC creates a virtual slave in INIT.
+//
+// Parameters:
+//   - cfg (Config): Configuration of the slave
+//
+// Returns:
+//   - *ESC: New virtual slave
+func NewESC(cfg Config) *ESC {
+	if cfg.FMMUs == 0 {
+		cfg.FMMUs = defaultFMMUs
+	}
+	if cfg.SMs == 0 {
+		cfg.SMs = defaultSMs
+	}
+	if cfg.RAMSize == 0 {
+		cfg.RAMSize = defaultRAMSize
+	}
+
+	e := &ESC{cfg: cfg, eeprom: append([]byte{}, cfg.EEPROM...)}
+	e.reset()
+	e.SetLinks([4]bool{true, false, false, false})
+	return e
+}
+
+// PowerCycle restarts the slave as if its power had been switched off and on: the memory is
+// cleared, the station address is zero and the slave is in INIT. The EEPROM and the link state
+// of the ports are kept.
+func (e *ESC) PowerCycle() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	status := e.word(register.DLStatus)
+	e.reset()
+	e.putWord(register.DLStatus, status)
+}
+
+// reset initialises the memory as after power-up, without the DL status. It must be called
+// with mu held or before the ESC is shared.
+func (e *ESC) reset() {
+	e.mem = make([]byte, int(register.ProcessDataRAM)+e.cfg.RAMSize*1024)
+	e.watchdog = time.Time{}
+
+	cfg := e.cfg
+	e.mem[register.Type] = escType
+	e.mem[register.FMMUsSupported] = uint8(cfg.FMMUs)
+	e.mem[register.SMsSupported] = uint8(cfg.SMs)
+	e.mem[register.RAMSize] = uint8(cfg.RAMSize)
+	e.mem[register.PortDescriptor] = 0x0f // Port 0 and 1 are MII/RMII, port 2 and 3 are not implemented
+	e.putWord(register.ALControl, uint16(al.Init))
+	e.putWord(register.ALStatus, uint16(al.Init))
+	e.mem[register.WatchdogStatusProcessData] = 0x01 // Not expired
+	e.reloadSII()
+}
+
+// Read returns a copy of the memory at address as seen from the PDI side.
+//
+// Parameters:
+//   - address (uint16): Physical address
+//   - length (int): Number of bytes
+//
+// Returns:
+//   - []byte: Memory content
+func (e *ESC) Read(address uint16, length int) []byte {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return append([]byte{}, e.mem[address:int(address)+length]...)
+}
+
+// Write writes to memory from the PDI side, bypassing the ECAT access rules.
+//
+// Parameters:
+//   - address (uint16): Physical address
+//   - data ([]byte): Data to write
+func (e *ESC) Write(address uint16, data []byte) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	copy(e.mem[address:], data)
+}
+
+// ALState returns the AL status of the slave.
+func (e *ESC) ALState() al.State {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return al.State(e.word(register.ALStatus))
+}
+
+// EEPROM returns a copy of the SII EEPROM image.
+func (e *ESC) EEPROM() []byte {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return append([]byte{}, e.eeprom...)
+}
+
+// SetEEPROM replaces the SII EEPROM image, as if another device had been plugged in. Registers
+// loaded from the EEPROM, such as the station alias, are reloaded by the next PowerCycle.
+//
+// Parameters:
+//   - eeprom ([]byte): New EEPROM image
+func (e *ESC) SetEEPROM(eeprom []byte) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.eeprom = append([]byte{}, eeprom...)
+}
+
+// SetLinks sets the physical link of the ports in DL Status (0x0110).
+// A port without link has its loop closed, so frames are forwarded to the next open port.
+//
+// Parameters:
+//   - links ([4]bool): Link state of port 0 to 3
+func (e *ESC) SetLinks(links [4]bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	status := uint16(0x0001) // PDI operational
+	for port, link := range links {
+		if link {
+			status |= 1 << (4 + port)   // Physical link
+			status |= 1 << (9 + 2*port) // Communication established
+		} else {
+			status |= 1 << (8 + 2*port) // Loop closed
+		}
+	}
+	e.putWord(register.DLStatus, status)
+}
+
+// ReadMailbox takes the content of the receive mailbox SyncManager n from the PDI side,
+// which empties the mailbox for the next write of the master.
+//
+// Parameters:
+//   - n (int): SyncManager number, usually 0
+//
+// Returns:
+//   - []byte: Content of the mailbox buffer
+//   - bool: False if SyncManager n is not an enabled receive mailbox holding a mailbox
+func (e *ESC) ReadMailbox(n int) ([]byte, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	sm, ok := e.mailboxSM(n, true)
+	if !ok || sm[5]&smMailboxFull == 0 {
+		return nil, false
+	}
+
+	start := binary.LittleEndian.Uint16(sm[0:2])
+	size := binary.LittleEndian.Uint16(sm[2:4])
+	sm[5] &^= smMailboxFull
+	return append([]byte{}, e.mem[start:start+size]...), true
+}
+
+// WriteMailbox fills the send mailbox SyncManager n from the PDI side, so the master can read it.
+//
+// Parameters:
+//   - n (int): SyncManager number, usually 1
+//   - data ([]byte): Mailbox to send, the rest of the buffer is cleared
+//
+// Returns:
+//   - bool: False if SyncManager n is not an enabled, empty send mailbox or data does not fit
+func (e *ESC) WriteMailbox(n int, data []byte) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	sm, ok := e.mailboxSM(n, false)
+	if !ok || sm[5]&smMailboxFull != 0 {
+		return false
+	}
+
+	start := binary.LittleEndian.Uint16(sm[0:2])
+	size := binary.LittleEndian.Uint16(sm[2:4])
+	if len(data) > int(size) {
+		return false
+	}
+	buffer := e.mem[start : start+size]
+	clear(buffer[copy(buffer, data):])
+	sm[5] |= smMailboxFull
+	return true
+}
+
+// Process executes the datagrams of an EtherCAT frame (header and datagrams) in place,
+// as the frame passes through the slave, and then runs the application.
+//
+// Parameters:
+//   - ecat ([]byte): EtherCAT frame, modified in place
+func (e *ESC) Process(ecat []byte) {
+	e.process(ecat)
+	if e.cfg.Application != nil {
+		e.cfg.Application(e)
+	}
+}
+
+func (e *ESC) process(ecat []byte) {
+	if len(ecat) < 2 {
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	length := int(binary.LittleEndian.Uint16(ecat) & 0x07ff)
+	if len(ecat) < 2+length {
+		return
+	}
+
+	e.expireWatchdog(time.Now())
+	rest := ecat[2 : 2+length]
+	for len(rest) >= 12 {
+		lrcm := binary.LittleEndian.Uint16(rest[6:8])
+		size := 12 + int(lrcm&0x07ff)
+		if len(rest) < size {
+			return
+		}
+
+		e.datagram(rest[:size])
+		rest = rest[size:]
+		if lrcm&0x8000 == 0 {
+			return
+		}
+	}
+}
+
+// datagram executes one datagram. It must be called with mu held.
+func (e *ESC) datagram(d []byte) {
+	cmd := command.Type(d[0])
+	adp := binary.LittleEndian.Uint16(d[2:4])
+	ado := binary.LittleEndian.Uint16(d[4:6])
+	data := d[10 : len(d)-2]
+	wkc := binary.LittleEndian.Uint16(d[len(d)-2:])
+
+	switch cmd.Addressing() {
+	case command.AutoIncrement:
+		if cmd == command.ARMW {
+			wkc += e.multiple(adp == 0, ado, data)
+		} else if adp == 0 {
+			wkc += e.physical(cmd, ado, data)
+		}
+		binary.LittleEndian.PutUint16(d[2:4], adp+1)
+	case command.Configured:
+		addressed := adp == e.word(register.StationAddress) ||
+			e.mem[register.DLControl+3]&0x01 != 0 && adp == e.word(register.StationAlias)
+		if cmd == command.FRMW {
+			wkc += e.multiple(addressed, ado, data)
+		} else if addressed {
+			wkc += e.physical(cmd, ado, data)
+		}
+	case command.Broadcast:
+		wkc += e.physical(cmd, ado, data)
+		binary.LittleEndian.PutUint16(d[2:4], adp+1)
+	case command.Logical:
+		wkc += e.logical(cmd, binary.LittleEndian.Uint32(d[2:6]), data)
+	}
+
+	binary.LittleEndian.PutUint16(d[len(d)-2:], wkc)
+}
+
+// physical executes a physical or broadcast command on the memory at address.
+// It returns the working counter increment.
+func (e *ESC) physical(cmd command.Type, address uint16, data []byte) uint16 {
+	if int(address)+len(data) > len(e.mem) {
+		return 0
+	}
+
+	if !e.mailbox(address, uint16(len(data)), cmd.IsRead(), cmd.IsWrite()) {
+		return 0
+	}
+
+	written := append([]byte{}, data...)
+	if cmd.IsRead() {
+		if cmd.Addressing() == command.Broadcast {
+			for i := range data {
+				data[i] |= e.mem[int(address)+i]
+			}
+		} else {
+			copy(data, e.mem[address:])
+		}
+	}
+	if cmd.IsWrite() {
+		e.write(address, written)
+	}
+
+	switch {
+	case cmd.IsRead() && cmd.IsWrite():
+		return 3
+	case cmd.IsRead(), cmd.IsWrite():
+		return 1
+	default:
+		return 0
+	}
+}
+
+// multiple executes ARMW/FRMW: the addressed slave is read, all others are written.
+func (e *ESC) multiple(addressed bool, address uint16, data []byte) uint16 {
+	if int(address)+len(data) > len(e.mem) {
+		return 0
+	}
+
+	if !e.mailbox(address, uint16(len(data)), addressed, !addressed) {
+		return 0
+	}
+
+	if addressed {
+		copy(data, e.mem[address:])
+	} else {
+		e.write(address, data)
+	}
+	return 1
+}
+
+// logical executes a logical command through the active FMMUs.
+func (e *ESC) logical(cmd command.Type, logical uint32, data []byte) uint16 {
+	start := uint64(logical)
+	end := start + uint64(len(data))
+	written := append([]byte{}, data...)
+
+	read, write := false, false
+	for n := 0; n < e.cfg.FMMUs; n++ {
+		f := e.mem[register.FMMU(n) : register.FMMU(n)+register.FMMULength]
+		if f[12]&0x01 == 0 {
+			continue
+		}
+
+		fStart := uint64(binary.LittleEndian.Uint32(f[0:4]))
+		fEnd := fStart + uint64(binary.LittleEndian.Uint16(f[4:6]))
+		phys := binary.LittleEndian.Uint16(f[8:10])
+		from, to := max(start, fStart), min(end, fEnd)
+		if from >= to {
+			continue
+		}
+
+		physStart := phys + uint16(from-fStart)
+		length := uint16(to - from)
+		if int(physStart)+int(length) > len(e.mem) || !e.accessible(physStart, length) {
+			continue
+		}
+
+		frame := data[from-start : to-start]
+		if f[11]&0x01 != 0 && cmd.IsRead() {
+			copy(frame, e.mem[physStart:])
+			read = true
+		}
+		if f[11]&0x02 != 0 && cmd.IsWrite() {
+			e.write(physStart, written[from-start:to-start])
+			write = true
+		}
+	}
+
+	result := uint16(0)
+	if read {
+		result++
+	}
+	if write {
+		if cmd == command.LRW {
+			result += 2
+		} else {
+			result++
+		}
+	}
+	return result
+}
+
+// accessible reports whether no disabled SyncManager covers the memory area.
+func (e *ESC) accessible(address uint16, length uint16) bool {
+	for n := 0; n < e.cfg.SMs; n++ {
+		sm := e.sm(n)
+		start := binary.LittleEndian.Uint16(sm[0:2])
+		size := binary.LittleEndian.Uint16(sm[2:4])
+		if size == 0 || address >= start+size || start >= address+length {
+			continue
+		}
+		if sm[6]&0x01 == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// write stores data written by the master, skipping read-only registers, and applies side effects.
+func (e *ESC) write(address uint16, data []byte) {
+	for i, b := range data {
+		a := address + uint16(i)
+		switch {
+		case a >= register.RXErrorCounter && a <= register.LostLinkCounter+3:
+			e.mem[a] = 0 // Writing any value clears the error counters
+		case writable(a):
+			e.mem[a] = b
+		}
+	}
+
+	length := uint16(len(data))
+	for n := 0; n < e.cfg.SMs; n++ {
+		// Deactivating a SyncManager resets its buffer state.
+		if sm := e.sm(n); overlaps(address, length, register.SM(n), register.SMLength) && sm[6]&smEnable == 0 {
+			sm[5] &^= smMailboxFull
+		}
+	}
+	for n := 0; n < e.cfg.SMs; n++ {
+		sm := e.sm(n)
+		start := binary.LittleEndian.Uint16(sm[0:2])
+		size := binary.LittleEndian.Uint16(sm[2:4])
+		if sm[6]&smEnable != 0 && sm[4]&smWatchdogTrigger != 0 && size != 0 && overlaps(address, length, start, size) {
+			e.watchdog = time.Now()
+			e.mem[register.WatchdogStatusProcessData] |= 0x01
+		}
+	}
+	if overlaps(address, length, register.ALControl, 2) {
+		e.alControl()
+	}
+	if overlaps(address, length, register.SIIControl, 2) {
+		e.siiControl()
+	}
+}
+
+// expireWatchdog expires the process data watchdog if it is configured and has not been
+// restarted in time. It must be called with mu held.
+func (e *ESC) expireWatchdog(now time.Time) {
+	ticks := e.word(register.WatchdogTimeProcessData)
+	if ticks == 0 || e.watchdog.IsZero() || e.mem[register.WatchdogStatusProcessData]&0x01 == 0 {
+		return
+	}
+	tick := time.Duration(e.word(register.WatchdogDivider)+2) * 40 * time.Nanosecond
+	if now.Sub(e.watchdog) < time.Duration(ticks)*tick {
+		return
+	}
+
+	e.mem[register.WatchdogStatusProcessData] &^= 0x01
+	if e.mem[register.WatchdogCounterProcess] < 0xff {
+		e.mem[register.WatchdogCounterProcess]++
+	}
+	if status := al.State(e.word(register.ALStatus)); status == al.Op {
+		e.putWord(register.ALStatus, uint16(al.SafeOp|al.Error))
+		e.putWord(register.ALStatusCode, uint16(al.SyncManagerWatchdog))
+	}
+}
+
+// mailbox applies the mailbox SyncManager rules to an ECAT access and reports whether it is allowed.
+// A receive mailbox only takes writes while it is empty and becomes full when its last byte is
+// written; a send mailbox only answers reads while it is full and is emptied when its last byte is read.
+func (e *ESC) mailbox(address uint16, length uint16, read bool, write bool) bool {
+	for n := 0; n < e.cfg.SMs; n++ {
+		sm := e.sm(n)
+		start := binary.LittleEndian.Uint16(sm[0:2])
+		size := binary.LittleEndian.Uint16(sm[2:4])
+		if sm[6]&smEnable == 0 || sm[4]&smModeMask != smModeMailbox || size == 0 || !overlaps(address, length, start, size) {
+			continue
+		}
+
+		receive := sm[4]&smDirMask == smDirWrite
+		full := sm[5]&smMailboxFull != 0
+		if read == write || write != receive || full == receive {
+			return false
+		}
+		if overlaps(address, length, start+size-1, 1) {
+			sm[5] ^= smMailboxFull
+		}
+	}
+	return true
+}
+
+// mailboxSM returns the registers of SyncManager n if it is an enabled mailbox in the given direction.
+func (e *ESC) mailboxSM(n int, receive bool) ([]byte, bool) {
+	if n < 0 || n >= e.cfg.SMs {
+		return nil, false
+	}
+
+	sm := e.sm(n)
+	if sm[6]&smEnable == 0 || sm[4]&smModeMask != smModeMailbox || (sm[4]&smDirMask == smDirWrite) != receive {
+		return nil, false
+	}
+	return sm, true
+}
+
+// sm returns the registers of SyncManager n.
+func (e *ESC) sm(n int) []byte {
+	return e.mem[register.SM(n) : register.SM(n)+register.SMLength]
+}
+
+// writable reports whether the master may write the register at a.
+func writable(a uint16) bool {
+	switch {
+	case a >= register.ProcessDataRAM:
+		return true
+	case a >= register.StationAddress && a < register.StationAddress+2,
+		a >= register.DLControl && a < register.DLControl+4,
+		a >= register.ALControl && a < register.ALControl+2,
+		a >= register.ECATEventMask && a < register.ECATEventMask+2,
+		a >= register.WatchdogDivider && a < register.WatchdogDivider+2,
+		a >= register.WatchdogTimePDI && a < register.WatchdogTimePDI+2,
+		a >= register.WatchdogTimeProcessData && a < register.WatchdogTimeProcessData+2,
+		a >= register.SIIControl && a < register.SIIData+4,
+		a >= register.FMMU0 && a < register.SM0,
+		a >= register.DCReceiveTime0 && a < 0x0a00:
+		return true
+	case a >= register.SM0 && a < register.SM0+0x80:
+		// The status and PDI control bytes of a SyncManager are read-only.
+		offset := (a - register.SM0) % register.SMLength
+		return offset != 5 && offset != 7
+	default:
+		return false
+	}
+}
+
+func overlaps(address uint16, length uint16, register uint16, size uint16) bool {
+	return address < register+size && register < address+length
+}
+
+// alControl applies a state change requested through AL Control.
+func (e *ESC) alControl() {
+	requested := al.State(e.word(register.ALControl))
+	status := al.State(e.word(register.ALStatus))
+	current := status.Base()
+
+	if requested&al.Error != 0 {
+		status &^= al.Error
+	} else if status.HasError() && requested.Base() >= current {
+		// An error indication has to be acknowledged before going up again.
+		return
+	}
+
+	target := requested.Base()
+	code := al.NoError
+	switch {
+	case target != al.Init && target != al.PreOp && target != al.Bootstrap && target != al.SafeOp && target != al.Op:
+		code = al.UnknownRequestedState
+	case !validTransition(current, target):
+		code = al.InvalidRequestedStateChange
+	case target != current && e.cfg.Transition != nil:
+		code = e.cfg.Transition(current, target)
+	}
+
+	if code != al.NoError {
+		e.putWord(register.ALStatus, uint16(status|al.Error))
+		e.putWord(register.ALStatusCode, uint16(code))
+		return
+	}
+	e.putWord(register.ALStatus, uint16(target))
+	e.putWord(register.ALStatusCode, uint16(al.NoError))
+}
+
+// validTransition reports whether the AL state machine allows going from one state to another.
+func validTransition(from al.State, to al.State) bool {
+	if from == to || to == al.Init {
+		return true
+	}
+
+	switch from {
+	case al.Init:
+		return to == al.PreOp || to == al.Bootstrap
+	case al.PreOp:
+		return to == al.SafeOp
+	case al.SafeOp:
+		return to == al.PreOp || to == al.Op
+	case al.Op:
+		return to == al.PreOp || to == al.SafeOp
+	default:
+		return false
+	}
+}
+
+// siiControl executes a command written to SII Control.
+// Commands complete immediately, so the busy bit is never seen by the master.
+func (e *ESC) siiControl() {
+	control := e.word(register.SIIControl)
+	address := int(binary.LittleEndian.Uint32(e.mem[register.SIIAddress:])) * 2
+
+	switch control & siiCommands {
+	case siiRead:
+		data := e.mem[register.SIIData : register.SIIData+4]
+		for i := range data {
+			data[i] = 0
+			if address+i < len(e.eeprom) {
+				data[i] = e.eeprom[address+i]
+			}
+		}
+	case siiWrite:
+		if control&siiWriteEnable != 0 {
+			if address+2 > len(e.eeprom) {
+				e.eeprom = append(e.eeprom, make([]byte, address+2-len(e.eeprom))...)
+			}
+			copy(e.eeprom[address:address+2], e.mem[register.SIIData:register.SIIData+2])
+		}
+	case siiReload:
+		e.reloadSII()
+	}
+
+	e.putWord(register.SIIControl, control&^(siiCommands|siiWriteEnable))
+}
+
+// reloadSII loads the registers that are initialized from the EEPROM.
+func (e *ESC) reloadSII() {
+	if int(sii.StationAlias)*2+2 <= len(e.eeprom) {
+		copy(e.mem[register.StationAlias:register.StationAlias+2], e.eeprom[sii.StationAlias*2:])
+	}
+}
+
+func (e *ESC) word(address uint16) uint16 {
+	return binary.LittleEndian.Uint16(e.mem[address:])
+}
+
+func (e *ESC) putWord(address uint16, v uint16) {
+	binary.LittleEndian.PutUint16(e.mem[address:], v)
+}
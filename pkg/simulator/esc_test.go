@@ -0,0 +1,140 @@
+package simulator_test
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/Aruminium/goecat/pkg/ethercat/al"
+	"github.com/Aruminium/goecat/pkg/ethercat/datagram"
+	"github.com/Aruminium/goecat/pkg/ethercat/payload"
+	"github.com/Aruminium/goecat/pkg/ethercat/register"
+	"github.com/Aruminium/goecat/pkg/ethercat/sii"
+	"github.com/Aruminium/goecat/pkg/ethercat/wkc"
+	"github.com/Aruminium/goecat/pkg/link"
+	"github.com/Aruminium/goecat/pkg/simulator"
+	"github.com/Aruminium/goecat/pkg/transceiver"
+)
+
+var encap = link.Encapsulation{Transport: link.Raw, SrcMAC: net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, 0x55}}
+
+// newSegment creates a ring of n slaves and a transceiver attached to it.
+func newSegment(t *testing.T, n int) (*simulator.Ring, *transceiver.Transceiver) {
+	slaves := make([]*simulator.ESC, n)
+	for i := range slaves {
+		info := sii.Info{Alias: uint16(100 + i), Identity: sii.Identity{VendorID: 0x0000079a, ProductCode: 0x00defede, SerialNo: uint32(i)}}
+		slaves[i] = simulator.NewESC(simulator.Config{EEPROM: info.Encode()})
+	}
+
+	ring := simulator.NewRing(slaves...)
+	tr := transceiver.New(ring.Attach(), transceiver.Options{Encapsulation: encap})
+	t.Cleanup(func() { tr.Close() })
+	return ring, tr
+}
+
+func word(v uint16) payload.BasicPayload {
+	data := make([]byte, 2)
+	binary.LittleEndian.PutUint16(data, v)
+	return payload.BasicPayload{Data: data}
+}
+
+func TestAutoIncrementAndConfiguredAddressing(t *testing.T) {
+	// given
+	ring, tr := newSegment(t, 3)
+	ctx := context.Background()
+
+	// when
+	for i := uint16(0); i < 3; i++ {
+		if _, err := tr.ExchangeExpect(ctx, datagram.APWR(i, register.StationAddress, word(0x1001+i)), transceiver.ExpectWKC(1)); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	count, err := tr.Exchange(ctx, datagram.BRD(register.Type, 1))
+
+	// then
+	if err != nil || count.WKC != 3 {
+		t.Errorf("Expected BRD WKC 3, but got %d (%v)", count.WKC, err)
+	}
+	for i, s := range ring.Slaves() {
+		if station := binary.LittleEndian.Uint16(s.Read(register.StationAddress, 2)); station != 0x1001+uint16(i) {
+			t.Errorf("Slave %d: expected station 0x%04x, but got 0x%04x", i, 0x1001+i, station)
+		}
+	}
+	alias, err := tr.Exchange(ctx, datagram.FPRD(0x1002, register.StationAlias, 2))
+	if err != nil || !reflect.DeepEqual(alias.Data.Bytes(), []byte{101, 0}) {
+		t.Errorf("Expected alias 101 from the EEPROM, but got %v (%v)", alias.Data.Bytes(), err)
+	}
+}
+
+func TestALStateMachine(t *testing.T) {
+	// given
+	ring, tr := newSegment(t, 2)
+	ctx := context.Background()
+
+	// when
+	tr.Exchange(ctx, datagram.BWR(register.ALControl, word(uint16(al.PreOp))))
+	preOp := ring.Slaves()[1].ALState()
+	tr.Exchange(ctx, datagram.BWR(register.ALControl, word(uint16(al.Init))))
+	tr.Exchange(ctx, datagram.BWR(register.ALControl, word(uint16(al.Op))))
+	invalid := ring.Slaves()[0].ALState()
+	code, _ := tr.Exchange(ctx, datagram.APRD(0, register.ALStatusCode, 2))
+
+	// then
+	if preOp != al.PreOp {
+		t.Errorf("Expected %v, but got %v", al.PreOp, preOp)
+	}
+	if invalid != al.Init|al.Error {
+		t.Errorf("Expected %v, but got %v", al.Init|al.Error, invalid)
+	}
+	if status := al.StatusCode(binary.LittleEndian.Uint16(code.Data.Bytes())); status != al.InvalidRequestedStateChange {
+		t.Errorf("Expected status code 0x%04x, but got 0x%04x", al.InvalidRequestedStateChange, status)
+	}
+}
+
+func TestSIIRead(t *testing.T) {
+	// given
+	_, tr := newSegment(t, 1)
+	ctx := context.Background()
+	address := make([]byte, 4)
+	binary.LittleEndian.PutUint32(address, uint32(sii.VendorID))
+
+	// when
+	tr.Exchange(ctx, datagram.APWR(0, register.SIIAddress, payload.BasicPayload{Data: address}))
+	tr.Exchange(ctx, datagram.APWR(0, register.SIIControl, word(0x0100)))
+	data, err := tr.Exchange(ctx, datagram.APRD(0, register.SIIData, 4))
+
+	// then
+	if err != nil || binary.LittleEndian.Uint32(data.Data.Bytes()) != 0x0000079a {
+		t.Errorf("Expected vendor 0x0000079a, but got %v (%v)", data.Data.Bytes(), err)
+	}
+}
+
+func TestLogicalWKCMatchesExpectation(t *testing.T) {
+	// given
+	ring, tr := newSegment(t, 1)
+	ctx := context.Background()
+	slaves := []wkc.Slave{{Position: 0}}
+
+	// a slave without FMMUs does not take part in logical commands
+	d := datagram.LRW(0, payload.BasicPayload{Data: make([]byte, 4)})
+
+	// when
+	_, err := tr.ExchangeExpect(ctx, d, wkc.Expect(d, slaves))
+
+	// then
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if ring.Slaves()[0].ALState() != al.Init {
+		t.Errorf("Expected the slave to stay in INIT")
+	}
+
+	// a wrong expectation is reported
+	_, err = tr.ExchangeExpect(ctx, d, transceiver.ExpectWKC(3))
+	if !errors.Is(err, transceiver.ErrWKCMismatch) {
+		t.Errorf("Expected a WKC mismatch, but got %v", err)
+	}
+}
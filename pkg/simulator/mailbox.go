@@ -0,0 +1,527 @@
+package simulator
+
+import (
+	"encoding/binary"
+	"sync"
+	"sync/atomic"
+
+	"github.com/Aruminium/goecat/pkg/ethercat/al"
+	"github.com/Aruminium/goecat/pkg/ethercat/coe"
+	"github.com/Aruminium/goecat/pkg/ethercat/foe"
+	"github.com/Aruminium/goecat/pkg/ethercat/mailbox"
+	"github.com/Aruminium/goecat/pkg/ethercat/sii"
+)
+
+// Mailbox SyncManagers of a mailbox slave.
+const (
+	rxMailboxSM = 0
+	txMailboxSM = 1
+)
+
+// Default mailbox layout of a mailbox slave.
+var (
+	DefaultRxMailbox = sii.Mailbox{Offset: 0x1000, Size: 128}
+	DefaultTxMailbox = sii.Mailbox{Offset: 0x1080, Size: 128}
+)
+
+// MailboxConfig describes a virtual slave that runs the mailbox protocols.
+type MailboxConfig struct {
+	Config // ESC configuration; EEPROM is generated from Info when empty
+
+	// Info is encoded into the EEPROM when Config.EEPROM is empty. Zero mailboxes default to
+	// DefaultRxMailbox and DefaultTxMailbox and zero protocols to CoE and FoE.
+	Info sii.Info
+
+	// Dictionary is the CoE object dictionary. The identity object 0x1018 is added from the
+	// SII identity when it is missing.
+	Dictionary ObjectDictionary
+
+	Files       map[string][]byte // Initial FoE files
+	FoEPassword uint32            // Password FoE requests have to carry, 0 for none
+}
+
+// MailboxSlave is a virtual slave that answers CoE SDO requests from its object dictionary,
+// sends emergencies on demand and stores files written with FoE.
+// Add its ESC to a Ring.
+type MailboxSlave struct {
+	*ESC
+
+	info     sii.Info
+	password uint32
+	reset    atomic.Bool // Set when the slave went back to INIT
+
+	mu       sync.Mutex
+	od       ObjectDictionary
+	files    map[string][]byte
+	queue    [][]byte // Mailboxes waiting for the send mailbox
+	counter  uint8    // Counter of the last sent mailbox
+	received uint8    // Counter of the last received mailbox
+	sdo      *sdoTransfer
+	foe      *foeTransfer
+}
+
+// sdoTransfer is a segmented SDO transfer in progress.
+type sdoTransfer struct {
+	upload   bool
+	index    uint16
+	subIndex uint8
+	complete bool
+	data     []byte // Remaining data of an upload, received data of a download
+	size     int    // Complete size of a download
+	toggle   uint8
+}
+
+// foeTransfer is an FoE transfer in progress.
+type foeTransfer struct {
+	read   bool
+	name   string
+	data   []byte // Remaining data of a read, received data of a write
+	number uint32 // Last packet number sent or acknowledged
+	last   bool   // The last data packet of a read has been sent
+}
+
+// NewMailboxSlave creates a virtual mailbox slave in INIT.
+//
+// Parameters:
+//   - cfg (MailboxConfig): Configuration of the slave
+//
+// Returns:
+//   - *MailboxSlave: New virtual slave
+func NewMailboxSlave(cfg MailboxConfig) *MailboxSlave {
+	info := cfg.Info
+	if len(cfg.EEPROM) > 0 {
+		if decoded, err := sii.Decode(cfg.EEPROM); err == nil {
+			info = decoded
+		}
+	} else {
+		if info.StdRx.Size == 0 {
+			info.StdRx, info.BootRx = DefaultRxMailbox, DefaultRxMailbox
+		}
+		if info.StdTx.Size == 0 {
+			info.StdTx, info.BootTx = DefaultTxMailbox, DefaultTxMailbox
+		}
+		if info.MailboxProtocol == 0 {
+			info.MailboxProtocol = sii.ProtocolCoE | sii.ProtocolFoE
+		}
+		cfg.EEPROM = info.Encode()
+	}
+
+	od := cfg.Dictionary
+	if od == nil {
+		od = ObjectDictionary{}
+	}
+	if _, ok := od[0x1018]; !ok {
+		od[0x1018] = IdentityObject(info.Identity)
+	}
+	files := make(map[string][]byte, len(cfg.Files))
+	for name, data := range cfg.Files {
+		files[name] = append([]byte{}, data...)
+	}
+
+	s := &MailboxSlave{info: info, password: cfg.FoEPassword, od: od, files: files}
+
+	transition := cfg.Transition
+	cfg.Transition = func(from al.State, to al.State) al.StatusCode {
+		if code := s.transition(from, to); code != al.NoError {
+			return code
+		}
+		if transition != nil {
+			return transition(from, to)
+		}
+		return al.NoError
+	}
+	application := cfg.Application
+	cfg.Application = func(e *ESC) {
+		s.update()
+		if application != nil {
+			application(e)
+		}
+	}
+
+	s.ESC = NewESC(cfg.Config)
+	return s
+}
+
+// PowerCycle restarts the ESC like ESC.PowerCycle and drops the mailboxes in progress.
+func (s *MailboxSlave) PowerCycle() {
+	s.ESC.PowerCycle()
+	s.reset.Store(true)
+}
+
+// Emergency queues an emergency message for the master.
+//
+// Parameters:
+//   - e (coe.Emergency): Emergency to send
+func (s *MailboxSlave) Emergency(e coe.Emergency) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.send(mailbox.CoE, e.Bytes())
+}
+
+// File returns a copy of a file stored with FoE.
+//
+// Parameters:
+//   - name (string): File name
+//
+// Returns:
+//   - []byte: File content
+//   - bool: False if there is no such file
+func (s *MailboxSlave) File(name string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, ok := s.files[name]
+	return append([]byte{}, data...), ok
+}
+
+// Value returns a copy of the current value of an object dictionary entry.
+//
+// Parameters:
+//   - index (uint16): Object index
+//   - subIndex (uint8): Subindex
+//
+// Returns:
+//   - []byte: Value of the entry
+//   - bool: False if there is no such entry
+func (s *MailboxSlave) Value(index uint16, subIndex uint8) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	o, ok := s.od[index]
+	if !ok || int(subIndex) >= len(o.Entries) {
+		return nil, false
+	}
+	return append([]byte{}, o.Entries[subIndex].Value...), true
+}
+
+// transition checks the mailbox SyncManagers before leaving INIT and marks the mailbox for a
+// reset when going back to INIT. It runs while the ESC is locked, so it leaves mu alone.
+func (s *MailboxSlave) transition(from al.State, to al.State) al.StatusCode {
+	if to == al.Init {
+		s.reset.Store(true)
+		return al.NoError
+	}
+	if from != al.Init {
+		return al.NoError
+	}
+
+	rx, tx := s.info.StdRx, s.info.StdTx
+	if to == al.Bootstrap {
+		rx, tx = s.info.BootRx, s.info.BootTx
+	}
+	if !s.ESC.mailboxConfigured(rxMailboxSM, rx, true) || !s.ESC.mailboxConfigured(txMailboxSM, tx, false) {
+		return al.InvalidMailboxConfiguration
+	}
+	return al.NoError
+}
+
+// update runs the mailbox protocols after a frame: it takes a received mailbox and hands the
+// next queued mailbox to the send mailbox.
+func (s *MailboxSlave) update() {
+	if s.reset.Swap(false) {
+		s.mu.Lock()
+		s.queue, s.sdo, s.foe, s.counter, s.received = nil, nil, nil, 0, 0
+		s.mu.Unlock()
+	}
+	if state := s.ALState().Base(); state == al.Init {
+		return
+	}
+
+	if data, ok := s.ReadMailbox(rxMailboxSM); ok {
+		s.receive(data)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.queue) > 0 && s.WriteMailbox(txMailboxSM, s.queue[0]) {
+		s.queue = s.queue[1:]
+	}
+}
+
+// receive dispatches a mailbox written by the master.
+func (s *MailboxSlave) receive(data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, err := mailbox.Parse(data)
+	if err != nil {
+		s.queue = append(s.queue, s.encode(mailbox.NewError(mailbox.ErrSizeTooShort)))
+		return
+	}
+	// A mailbox with the counter of the previous one is a repetition of it.
+	if m.Counter != 0 && m.Counter == s.received {
+		return
+	}
+	s.received = m.Counter
+
+	switch {
+	case m.Type == mailbox.CoE && s.info.MailboxProtocol&sii.ProtocolCoE != 0:
+		s.coe(m.Data)
+	case m.Type == mailbox.FoE && s.info.MailboxProtocol&sii.ProtocolFoE != 0:
+		s.foePacket(m.Data)
+	default:
+		s.queue = append(s.queue, s.encode(mailbox.NewError(mailbox.ErrUnsupportedProtocol)))
+	}
+}
+
+// send queues a mailbox for the master.
+func (s *MailboxSlave) send(t mailbox.Type, data []byte) {
+	s.queue = append(s.queue, s.encode(mailbox.New(t, 0, data)))
+}
+
+// encode sets the next counter and encodes m.
+func (s *MailboxSlave) encode(m mailbox.Mailbox) []byte {
+	s.counter = mailbox.NextCounter(s.counter)
+	m.Counter = s.counter
+	return m.Bytes()
+}
+
+// coe handles a CoE message.
+func (s *MailboxSlave) coe(data []byte) {
+	h, body, err := coe.Split(data)
+	if err != nil {
+		s.queue = append(s.queue, s.encode(mailbox.NewError(mailbox.ErrSizeTooShort)))
+		return
+	}
+	if h.Service == coe.ServiceSDOInformation {
+		s.sdoInformation(body)
+		return
+	}
+	if h.Service != coe.ServiceSDORequest {
+		s.queue = append(s.queue, s.encode(mailbox.NewError(mailbox.ErrServiceNotSupported)))
+		return
+	}
+	if len(body) == 0 {
+		s.queue = append(s.queue, s.encode(mailbox.NewError(mailbox.ErrSizeTooShort)))
+		return
+	}
+
+	switch body[0] & coe.SpecifierMask {
+	case coe.InitiateUploadRequest:
+		s.initiateUpload(body)
+	case coe.UploadSegmentRequest:
+		s.uploadSegment(body)
+	case coe.InitiateDownloadRequest:
+		s.initiateDownload(body)
+	case coe.DownloadSegmentRequest:
+		s.downloadSegment(body)
+	case coe.AbortTransfer:
+		s.sdo = nil
+	default:
+		s.abort(0, 0, coe.AbortUnknownCommand)
+	}
+}
+
+func (s *MailboxSlave) initiateUpload(body []byte) {
+	req, err := coe.ParseSDO(body)
+	if err != nil {
+		s.abort(0, 0, coe.AbortLengthTooLow)
+		return
+	}
+
+	s.sdo = nil
+	complete := req.Command&coe.CompleteAccess != 0
+	data, code := s.od.upload(req.Index, req.SubIndex, complete)
+	if code != 0 {
+		s.abort(req.Index, req.SubIndex, code)
+		return
+	}
+
+	res := coe.SDO{Command: coe.InitiateUploadResponse | req.Command&coe.CompleteAccess, Index: req.Index, SubIndex: req.SubIndex}
+	if len(data) <= 4 && !complete {
+		value := make([]byte, 4)
+		copy(value, data)
+		res.Command |= coe.Expedited | coe.SizeIndicated | uint8(4-len(data))<<2
+		res.Value = binary.LittleEndian.Uint32(value)
+		s.send(mailbox.CoE, res.Bytes(coe.ServiceSDOResponse))
+		return
+	}
+
+	capacity := int(s.info.StdTx.Size) - mailbox.HeaderLength - coe.HeaderLength - coe.SDOLength
+	res.Command |= coe.SizeIndicated
+	res.Value = uint32(len(data))
+	res.Data = data[:min(capacity, len(data))]
+	if len(res.Data) < len(data) {
+		s.sdo = &sdoTransfer{upload: true, index: req.Index, subIndex: req.SubIndex, data: data[len(res.Data):]}
+	}
+	s.send(mailbox.CoE, res.Bytes(coe.ServiceSDOResponse))
+}
+
+func (s *MailboxSlave) uploadSegment(body []byte) {
+	t := s.sdo
+	if t == nil || !t.upload {
+		s.abort(0, 0, coe.AbortUnknownCommand)
+		return
+	}
+	if body[0]&coe.Toggle != t.toggle {
+		s.sdo = nil
+		s.abort(t.index, t.subIndex, coe.AbortToggleBit)
+		return
+	}
+
+	capacity := int(s.info.StdTx.Size) - mailbox.HeaderLength - coe.HeaderLength - coe.SegmentHeaderLength
+	seg := coe.Segment{Command: coe.UploadSegmentResponse | t.toggle, Data: t.data[:min(capacity, len(t.data))]}
+	t.data = t.data[len(seg.Data):]
+	t.toggle ^= coe.Toggle
+	if len(t.data) == 0 {
+		seg.Command |= coe.LastSegment
+		s.sdo = nil
+	}
+	s.send(mailbox.CoE, seg.Bytes(coe.ServiceSDOResponse))
+}
+
+func (s *MailboxSlave) initiateDownload(body []byte) {
+	req, err := coe.ParseSDO(body)
+	if err != nil {
+		s.abort(0, 0, coe.AbortLengthTooLow)
+		return
+	}
+
+	s.sdo = nil
+	complete := req.Command&coe.CompleteAccess != 0
+	var data []byte
+	switch {
+	case req.Command&coe.Expedited != 0:
+		data = binary.LittleEndian.AppendUint32(nil, req.Value)[:req.ExpeditedSize()]
+	case len(req.Data) < int(req.Value):
+		// The rest follows in segments.
+		s.sdo = &sdoTransfer{index: req.Index, subIndex: req.SubIndex, complete: complete, data: append([]byte{}, req.Data...), size: int(req.Value)}
+		s.send(mailbox.CoE, coe.SDO{Command: coe.InitiateDownloadResponse, Index: req.Index, SubIndex: req.SubIndex}.Bytes(coe.ServiceSDOResponse))
+		return
+	default:
+		data = req.Data[:req.Value]
+	}
+
+	if code := s.od.download(req.Index, req.SubIndex, complete, data); code != 0 {
+		s.abort(req.Index, req.SubIndex, code)
+		return
+	}
+	s.send(mailbox.CoE, coe.SDO{Command: coe.InitiateDownloadResponse, Index: req.Index, SubIndex: req.SubIndex}.Bytes(coe.ServiceSDOResponse))
+}
+
+func (s *MailboxSlave) downloadSegment(body []byte) {
+	t := s.sdo
+	if t == nil || t.upload {
+		s.abort(0, 0, coe.AbortUnknownCommand)
+		return
+	}
+	seg, err := coe.ParseSegment(body)
+	if err != nil {
+		s.sdo = nil
+		s.abort(t.index, t.subIndex, coe.AbortLengthTooLow)
+		return
+	}
+	if seg.Command&coe.Toggle != t.toggle {
+		s.sdo = nil
+		s.abort(t.index, t.subIndex, coe.AbortToggleBit)
+		return
+	}
+
+	t.data = append(t.data, seg.Data...)
+	t.toggle ^= coe.Toggle
+	if seg.Command&coe.LastSegment != 0 {
+		s.sdo = nil
+		if len(t.data) != t.size {
+			s.abort(t.index, t.subIndex, coe.AbortLengthMismatch)
+			return
+		}
+		if code := s.od.download(t.index, t.subIndex, t.complete, t.data); code != 0 {
+			s.abort(t.index, t.subIndex, code)
+			return
+		}
+	}
+	s.send(mailbox.CoE, coe.Segment{Command: coe.DownloadSegmentResponse | seg.Command&coe.Toggle}.Bytes(coe.ServiceSDOResponse))
+}
+
+func (s *MailboxSlave) abort(index uint16, subIndex uint8, code coe.AbortCode) {
+	s.send(mailbox.CoE, coe.Abort(index, subIndex, code).Bytes(coe.ServiceSDOResponse))
+}
+
+// foePacket handles an FoE packet.
+func (s *MailboxSlave) foePacket(data []byte) {
+	p, err := foe.Parse(data)
+	if err != nil {
+		s.queue = append(s.queue, s.encode(mailbox.NewError(mailbox.ErrSizeTooShort)))
+		return
+	}
+
+	switch p.OpCode {
+	case foe.OpRead:
+		s.foe = nil
+		if s.password != 0 && p.Value != s.password {
+			s.foeError(foe.ErrNoRights)
+			return
+		}
+		file, ok := s.files[string(p.Data)]
+		if !ok {
+			s.foeError(foe.ErrNotFound)
+			return
+		}
+		s.foe = &foeTransfer{read: true, name: string(p.Data), data: file}
+		s.foeData()
+	case foe.OpWrite:
+		s.foe = nil
+		if s.password != 0 && p.Value != s.password {
+			s.foeError(foe.ErrNoRights)
+			return
+		}
+		s.foe = &foeTransfer{name: string(p.Data), data: []byte{}}
+		s.send(mailbox.FoE, foe.Packet{OpCode: foe.OpAck}.Bytes())
+	case foe.OpAck:
+		t := s.foe
+		if t == nil || !t.read || p.Value != t.number {
+			s.foe = nil
+			s.foeError(foe.ErrPacketNumberWrong)
+			return
+		}
+		if t.last {
+			s.foe = nil
+			return
+		}
+		s.foeData()
+	case foe.OpData:
+		t := s.foe
+		if t == nil || t.read || p.Value != t.number+1 {
+			s.foe = nil
+			s.foeError(foe.ErrPacketNumberWrong)
+			return
+		}
+		t.number = p.Value
+		t.data = append(t.data, p.Data...)
+		if len(p.Data) < int(s.info.StdRx.Size)-mailbox.HeaderLength-foe.HeaderLength {
+			s.files[t.name] = t.data
+			s.foe = nil
+		}
+		s.send(mailbox.FoE, foe.Packet{OpCode: foe.OpAck, Value: p.Value}.Bytes())
+	case foe.OpError:
+		s.foe = nil
+	default:
+		s.foe = nil
+		s.foeError(foe.ErrIllegal)
+	}
+}
+
+// foeData sends the next data packet of a read.
+func (s *MailboxSlave) foeData() {
+	t := s.foe
+	segment := int(s.info.StdTx.Size) - mailbox.HeaderLength - foe.HeaderLength
+	chunk := t.data[:min(segment, len(t.data))]
+	t.data = t.data[len(chunk):]
+	t.number++
+	t.last = len(chunk) < segment
+	s.send(mailbox.FoE, foe.Packet{OpCode: foe.OpData, Value: t.number, Data: chunk}.Bytes())
+}
+
+func (s *MailboxSlave) foeError(code foe.ErrorCode) {
+	s.send(mailbox.FoE, foe.NewError(code, "").Bytes())
+}
+
+// mailboxConfigured reports whether SyncManager n is set up as a mailbox for the given area and direction.
+// It must be called with mu held.
+func (e *ESC) mailboxConfigured(n int, area sii.Mailbox, receive bool) bool {
+	sm, ok := e.mailboxSM(n, receive)
+	return ok && area.Size != 0 &&
+		binary.LittleEndian.Uint16(sm[0:2]) == area.Offset &&
+		binary.LittleEndian.Uint16(sm[2:4]) == area.Size
+}
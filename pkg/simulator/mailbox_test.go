@@ -0,0 +1,358 @@
+package simulator_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Aruminium/goecat/pkg/esi"
+	"github.com/Aruminium/goecat/pkg/ethercat/al"
+	"github.com/Aruminium/goecat/pkg/ethercat/coe"
+	"github.com/Aruminium/goecat/pkg/ethercat/datagram"
+	"github.com/Aruminium/goecat/pkg/ethercat/foe"
+	"github.com/Aruminium/goecat/pkg/ethercat/mailbox"
+	"github.com/Aruminium/goecat/pkg/ethercat/payload/syncmanager"
+	"github.com/Aruminium/goecat/pkg/ethercat/register"
+	"github.com/Aruminium/goecat/pkg/ethercat/sii"
+	"github.com/Aruminium/goecat/pkg/simulator"
+	"github.com/Aruminium/goecat/pkg/transceiver"
+)
+
+const station = 0x1001
+
+// newMailboxSegment brings a mailbox slave to PRE-OP and returns a mailbox connection to it.
+func newMailboxSegment(t *testing.T, cfg simulator.MailboxConfig) (*simulator.MailboxSlave, *mailbox.Conn) {
+	slave := simulator.NewMailboxSlave(cfg)
+	tr := transceiver.New(simulator.NewRing(slave.ESC).Attach(), transceiver.Options{Encapsulation: encap})
+	t.Cleanup(func() { tr.Close() })
+
+	ctx := context.Background()
+	rx, tx := simulator.DefaultRxMailbox, simulator.DefaultTxMailbox
+	setup := []datagram.Datagram{
+		datagram.APWR(0, register.StationAddress, word(station)),
+		datagram.FPWR(station, register.SM(0), &syncmanager.SyncManager{
+			Start: rx.Offset, Length: rx.Size,
+			CtrlStatus: syncmanager.CtrlStatus{Access: 0x1, OpMode: 0x2},
+			Enable:     syncmanager.Enable{IsEnable: true},
+		}),
+		datagram.FPWR(station, register.SM(1), &syncmanager.SyncManager{
+			Start: tx.Offset, Length: tx.Size,
+			CtrlStatus: syncmanager.CtrlStatus{OpMode: 0x2},
+			Enable:     syncmanager.Enable{IsEnable: true},
+		}),
+		datagram.FPWR(station, register.ALControl, word(uint16(al.PreOp))),
+	}
+	for _, d := range setup {
+		if _, err := tr.ExchangeExpect(ctx, d, transceiver.ExpectWKC(1)); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if slave.ALState() != al.PreOp {
+		t.Fatalf("Expected %v, but got %v", al.PreOp, slave.ALState())
+	}
+
+	return slave, mailbox.NewConn(tr, station, rx, tx)
+}
+
+func timeout(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+func TestSDOUploadDownload(t *testing.T) {
+	// given
+	name := []byte(strings.Repeat("virtual slave ", 20))
+	_, conn := newMailboxSegment(t, simulator.MailboxConfig{
+		Info: sii.Info{Identity: sii.Identity{VendorID: 0x0000079a, ProductCode: 0x00defede}},
+		Dictionary: simulator.ObjectDictionary{
+			0x1008: simulator.Var("Device name", simulator.ReadOnly, name),
+			0x2000: simulator.Var("Setpoint", simulator.ReadWrite, simulator.U32(0)),
+			0x2001: simulator.Var("Table", simulator.ReadWrite, make([]byte, 400)),
+		},
+	})
+	client := coe.NewClient(conn)
+	ctx := timeout(t)
+	table := bytes.Repeat([]byte{0x01, 0x02, 0x03}, 400/3+1)[:400]
+
+	// when
+	vendor, vendorErr := client.Upload(ctx, 0x1018, 1)
+	long, longErr := client.Upload(ctx, 0x1008, 0)
+	setErr := client.Download(ctx, 0x2000, 0, simulator.U32(0xdeadbeef))
+	setpoint, _ := client.Upload(ctx, 0x2000, 0)
+	tableErr := client.Download(ctx, 0x2001, 0, table)
+	readBack, _ := client.Upload(ctx, 0x2001, 0)
+	readOnlyErr := client.Download(ctx, 0x1008, 0, []byte{0})
+	missingErr := client.Download(ctx, 0x3000, 0, []byte{0})
+
+	// then
+	if vendorErr != nil || !reflect.DeepEqual(vendor, simulator.U32(0x0000079a)) {
+		t.Errorf("Expected vendor 0x0000079a, but got %v (%v)", vendor, vendorErr)
+	}
+	if longErr != nil || !reflect.DeepEqual(long, name) {
+		t.Errorf("Expected %q, but got %q (%v)", name, long, longErr)
+	}
+	if setErr != nil || !reflect.DeepEqual(setpoint, simulator.U32(0xdeadbeef)) {
+		t.Errorf("Expected setpoint 0xdeadbeef, but got %v (%v)", setpoint, setErr)
+	}
+	if tableErr != nil || !reflect.DeepEqual(readBack, table) {
+		t.Errorf("Expected the table to be written in segments, but got %v (%v)", readBack, tableErr)
+	}
+	if !errors.Is(readOnlyErr, coe.AbortReadOnly) {
+		t.Errorf("Expected %v, but got %v", coe.AbortReadOnly, readOnlyErr)
+	}
+	if !errors.Is(missingErr, coe.AbortNoObject) {
+		t.Errorf("Expected %v, but got %v", coe.AbortNoObject, missingErr)
+	}
+}
+
+func TestSDODownloadEmpty(t *testing.T) {
+	// given
+	_, conn := newMailboxSegment(t, simulator.MailboxConfig{
+		Dictionary: simulator.ObjectDictionary{
+			0x2000: simulator.Var("Setpoint", simulator.ReadWrite, simulator.U32(0)),
+			0x2002: simulator.Var("Empty string", simulator.ReadWrite, []byte{}),
+		},
+	})
+	client := coe.NewClient(conn)
+	ctx := timeout(t)
+
+	// when
+	emptyErr := client.Download(ctx, 0x2002, 0, nil)
+	shortErr := client.Download(ctx, 0x2000, 0, []byte{})
+
+	// then
+	if emptyErr != nil {
+		t.Errorf("Unexpected error: %v", emptyErr)
+	}
+	if !errors.Is(shortErr, coe.AbortLengthTooLow) {
+		t.Errorf("Expected %v, but got %v", coe.AbortLengthTooLow, shortErr)
+	}
+}
+
+func TestSDOCompleteAccessPDOAssignment(t *testing.T) {
+	// given
+	slave, conn := newMailboxSegment(t, simulator.MailboxConfig{
+		Dictionary: simulator.ObjectDictionary{
+			0x1c12: simulator.Record("RxPDO assign", simulator.ReadWrite,
+				simulator.Entry{Access: simulator.ReadWrite, Value: simulator.U16(0x1600)},
+				simulator.Entry{Access: simulator.ReadWrite, Value: simulator.U16(0)},
+			),
+		},
+	})
+	client := coe.NewClient(conn)
+	ctx := timeout(t)
+
+	// when
+	err := client.DownloadComplete(ctx, 0x1c12, []byte{0x02, 0x00, 0x01, 0x16, 0x02, 0x16})
+	assign, _ := client.UploadComplete(ctx, 0x1c12)
+	count, _ := slave.Value(0x1c12, 0)
+
+	// then
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(assign, []byte{0x02, 0x00, 0x01, 0x16, 0x02, 0x16}) {
+		t.Errorf("Expected the new assignment, but got % x", assign)
+	}
+	if !reflect.DeepEqual(count, []byte{0x02}) {
+		t.Errorf("Expected 2 assigned PDOs, but got %v", count)
+	}
+}
+
+func TestSDOInformation(t *testing.T) {
+	// given
+	od := simulator.ObjectDictionary{
+		0x1c12: simulator.Record("RxPDO assign", simulator.ReadWrite,
+			simulator.Entry{Name: "SubIndex 001", Access: simulator.ReadWrite, Value: simulator.U16(0x1600)},
+		),
+		0x2000: simulator.Var("Setpoint", simulator.ReadWrite, simulator.U32(0)),
+	}
+	// Enough objects to split the object list into fragments.
+	for index := uint16(0x3000); index < 0x3050; index++ {
+		od[index] = simulator.Var("Parameter", simulator.ReadOnly, simulator.U8(0))
+	}
+	_, conn := newMailboxSegment(t, simulator.MailboxConfig{Dictionary: od})
+	client := coe.NewClient(conn)
+	ctx := timeout(t)
+
+	// when
+	list, listErr := client.ObjectList(ctx, coe.ListAll)
+	object, objectErr := client.ObjectDescription(ctx, 0x2000)
+	entry, entryErr := client.EntryDescription(ctx, 0x1c12, 1)
+	_, missingErr := client.ObjectDescription(ctx, 0x4000)
+
+	// then
+	if listErr != nil || len(list) != len(od) || list[0] != 0x1018 || list[len(list)-1] != 0x304f {
+		t.Errorf("Expected %d sorted indices, but got %d (%v)", len(od), len(list), listErr)
+	}
+	expectedObject := coe.ObjectDescription{Index: 0x2000, DataType: coe.Unsigned32, ObjectCode: coe.ObjectVar, Name: "Setpoint"}
+	if objectErr != nil || !reflect.DeepEqual(object, expectedObject) {
+		t.Errorf("Expected %+v, but got %+v (%v)", expectedObject, object, objectErr)
+	}
+	expectedEntry := coe.EntryDescription{Index: 0x1c12, SubIndex: 1, DataType: coe.Unsigned16, BitLength: 16, Access: coe.ReadAll | coe.WriteAll, Name: "SubIndex 001"}
+	if entryErr != nil || !reflect.DeepEqual(entry, expectedEntry) {
+		t.Errorf("Expected %+v, but got %+v (%v)", expectedEntry, entry, entryErr)
+	}
+	if !errors.Is(missingErr, coe.AbortNoObject) {
+		t.Errorf("Expected %v, but got %v", coe.AbortNoObject, missingErr)
+	}
+}
+
+func TestEmergency(t *testing.T) {
+	// given
+	slave, conn := newMailboxSegment(t, simulator.MailboxConfig{})
+	client := coe.NewClient(conn)
+	var received []coe.Emergency
+	client.Emergency = func(e coe.Emergency) { received = append(received, e) }
+	emergency := coe.Emergency{ErrorCode: 0x8130, ErrorRegister: 0x11, Data: [5]byte{1, 2, 3, 4, 5}}
+
+	// when
+	slave.Emergency(emergency)
+	_, err := client.Upload(timeout(t), 0x1018, 0)
+
+	// then
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(received, []coe.Emergency{emergency}) {
+		t.Errorf("Expected %v, but got %v", emergency, received)
+	}
+}
+
+func TestConnStats(t *testing.T) {
+	// given
+	_, conn := newMailboxSegment(t, simulator.MailboxConfig{})
+	ctx := timeout(t)
+
+	// when
+	sendErr := conn.Send(ctx, mailbox.New(mailbox.VoE, 0, []byte{1, 2}))
+	reply, receiveErr := conn.Receive(ctx)
+
+	// then
+	if sendErr != nil || receiveErr != nil {
+		t.Fatalf("Unexpected errors: %v, %v", sendErr, receiveErr)
+	}
+	expected := mailbox.Stats{Sent: 1, Received: 1, SentBytes: 8, ReceivedBytes: uint64(mailbox.HeaderLength + len(reply.Data)), ErrorReplies: 1}
+	if conn.Stats() != expected {
+		t.Errorf("Expected %+v, but got %+v", expected, conn.Stats())
+	}
+}
+
+func TestFoEReadWrite(t *testing.T) {
+	// given
+	slave, conn := newMailboxSegment(t, simulator.MailboxConfig{
+		Files:       map[string][]byte{"version.txt": []byte("1.0.0")},
+		FoEPassword: 0x12345678,
+	})
+	client := foe.NewClient(conn)
+	ctx := timeout(t)
+	firmware := bytes.Repeat([]byte{0xca, 0xfe}, 300)
+	// A file that is a multiple of the segment size ends with an empty data packet.
+	exact := make([]byte, 2*(int(simulator.DefaultRxMailbox.Size)-mailbox.HeaderLength-foe.HeaderLength))
+
+	// when
+	writeErr := client.Write(ctx, "firmware.bin", 0x12345678, firmware)
+	exactErr := client.Write(ctx, "exact.bin", 0x12345678, exact)
+	version, readErr := client.Read(ctx, "version.txt", 0x12345678)
+	readBack, _ := client.Read(ctx, "firmware.bin", 0x12345678)
+	_, missingErr := client.Read(ctx, "missing.bin", 0x12345678)
+	_, passwordErr := client.Read(ctx, "version.txt", 0)
+
+	// then
+	if stored, _ := slave.File("firmware.bin"); writeErr != nil || !reflect.DeepEqual(stored, firmware) {
+		t.Errorf("Expected the firmware to be stored (%v)", writeErr)
+	}
+	if stored, _ := slave.File("exact.bin"); exactErr != nil || !reflect.DeepEqual(stored, exact) {
+		t.Errorf("Expected %d bytes to be stored, but got %d (%v)", len(exact), len(stored), exactErr)
+	}
+	if readErr != nil || string(version) != "1.0.0" {
+		t.Errorf("Expected 1.0.0, but got %q (%v)", version, readErr)
+	}
+	if !reflect.DeepEqual(readBack, firmware) {
+		t.Errorf("Expected to read the firmware back")
+	}
+	if !errors.Is(missingErr, foe.ErrNotFound) {
+		t.Errorf("Expected %v, but got %v", foe.ErrNotFound, missingErr)
+	}
+	if !errors.Is(passwordErr, foe.ErrNoRights) {
+		t.Errorf("Expected %v, but got %v", foe.ErrNoRights, passwordErr)
+	}
+}
+
+func TestPreOpRequiresMailboxConfiguration(t *testing.T) {
+	// given
+	slave := simulator.NewMailboxSlave(simulator.MailboxConfig{})
+	tr := transceiver.New(simulator.NewRing(slave.ESC).Attach(), transceiver.Options{Encapsulation: encap})
+	defer tr.Close()
+
+	// when
+	tr.Exchange(context.Background(), datagram.APWR(0, register.ALControl, word(uint16(al.PreOp))))
+	code := slave.Read(register.ALStatusCode, 2)
+
+	// then
+	if slave.ALState() != al.Init|al.Error {
+		t.Errorf("Expected %v, but got %v", al.Init|al.Error, slave.ALState())
+	}
+	if al.StatusCode(code[0]) != al.InvalidMailboxConfiguration {
+		t.Errorf("Expected status code 0x%04x, but got % x", al.InvalidMailboxConfiguration, code)
+	}
+}
+
+const deviceESI = `<?xml version="1.0"?>
+<EtherCATInfo>
+  <Vendor><Id>#x0000079a</Id><Name>AB&amp;T</Name></Vendor>
+  <Descriptions><Devices><Device>
+    <Type ProductCode="#x00defede" RevisionNo="#x00000001">EasyCAT</Type>
+    <Profile><Dictionary>
+      <DataTypes>
+        <DataType><Name>UDINT</Name><BitSize>32</BitSize></DataType>
+        <DataType><Name>DT1C12ARR</Name><BaseType>UINT</BaseType><BitSize>32</BitSize><ArrayInfo><LBound>1</LBound><Elements>2</Elements></ArrayInfo></DataType>
+        <DataType><Name>DT1C12</Name><BitSize>48</BitSize>
+          <SubItem><SubIdx>0</SubIdx><Name>SubIndex 000</Name><Type>USINT</Type><BitSize>8</BitSize><BitOffs>0</BitOffs><Flags><Access>rw</Access></Flags></SubItem>
+          <SubItem><Name>Elements</Name><Type>DT1C12ARR</Type><BitSize>32</BitSize><BitOffs>16</BitOffs><Flags><Access>rw</Access></Flags></SubItem>
+        </DataType>
+      </DataTypes>
+      <Objects>
+        <Object><Index>#x1000</Index><Name>Device type</Name><Type>UDINT</Type><BitSize>32</BitSize><Info><DefaultData>92010000</DefaultData></Info><Flags><Access>ro</Access></Flags></Object>
+        <Object><Index>#x1c12</Index><Name>RxPDO assign</Name><Type>DT1C12</Type><BitSize>48</BitSize>
+          <Info>
+            <SubItem><Name>SubIndex 000</Name><Info><DefaultData>01</DefaultData></Info></SubItem>
+            <SubItem><Name>SubIndex 001</Name><Info><DefaultData>0016</DefaultData></Info></SubItem>
+          </Info>
+        </Object>
+      </Objects>
+    </Dictionary></Profile>
+  </Device></Devices></Descriptions>
+</EtherCATInfo>`
+
+func TestDictionaryFromESI(t *testing.T) {
+	// given
+	info, err := esi.Decode(strings.NewReader(deviceESI))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	_, conn := newMailboxSegment(t, simulator.MailboxConfig{Dictionary: simulator.DictionaryFromESI(info.Devices[0].Dictionary)})
+	client := coe.NewClient(conn)
+	ctx := timeout(t)
+
+	// when
+	deviceType, typeErr := client.Upload(ctx, 0x1000, 0)
+	assign, assignErr := client.UploadComplete(ctx, 0x1c12)
+	writeErr := client.Download(ctx, 0x1c12, 2, simulator.U16(0x1601))
+
+	// then
+	if typeErr != nil || !reflect.DeepEqual(deviceType, []byte{0x92, 0x01, 0x00, 0x00}) {
+		t.Errorf("Expected device type 0x192, but got %v (%v)", deviceType, typeErr)
+	}
+	if assignErr != nil || !reflect.DeepEqual(assign, []byte{0x01, 0x00, 0x00, 0x16}) {
+		t.Errorf("Expected one assigned PDO, but got % x (%v)", assign, assignErr)
+	}
+	if writeErr != nil {
+		t.Errorf("Unexpected error: %v", writeErr)
+	}
+}
@@ -0,0 +1,310 @@
+package simulator
+
+import (
+	"encoding/binary"
+	"slices"
+
+	"github.com/Aruminium/goecat/pkg/esi"
+	"github.com/Aruminium/goecat/pkg/ethercat/coe"
+	"github.com/Aruminium/goecat/pkg/ethercat/sii"
+)
+
+// Access is the access right of an object dictionary entry.
+type Access uint8
+
+const (
+	ReadOnly Access = iota
+	ReadWrite
+	WriteOnly
+)
+
+// Entry is one subindex of an object.
+type Entry struct {
+	Name     string
+	Access   Access
+	Value    []byte       // Current value; its length is the size of the entry
+	DataType coe.DataType // Reported by SDO information; derived from the size of Value if zero
+}
+
+// Object is an object of the dictionary. A variable has a single entry at subindex 0.
+// Records and arrays hold the number of the following entries in subindex 0.
+type Object struct {
+	Name    string
+	Entries []Entry // Indexed by subindex
+}
+
+// ObjectDictionary is the CoE object dictionary of a simulated slave, keyed by index.
+type ObjectDictionary map[uint16]*Object
+
+// Var creates a variable object.
+//
+// Parameters:
+//   - name (string): Name of the object
+//   - access (Access): Access right
+//   - value ([]byte): Initial value, which also fixes the size
+//
+// Returns:
+//   - *Object: New object
+func Var(name string, access Access, value []byte) *Object {
+	return &Object{Name: name, Entries: []Entry{{Name: name, Access: access, Value: value}}}
+}
+
+// Record creates a record or array object; subindex 0 is added with the number of entries.
+//
+// Parameters:
+//   - name (string): Name of the object
+//   - access (Access): Access right of subindex 0; ReadWrite allows changing the number of entries, as PDO mappings do
+//   - entries (...Entry): Entries from subindex 1 on
+//
+// Returns:
+//   - *Object: New object
+func Record(name string, access Access, entries ...Entry) *Object {
+	count := Entry{Name: "SubIndex 000", Access: access, Value: []byte{uint8(len(entries))}}
+	return &Object{Name: name, Entries: append([]Entry{count}, entries...)}
+}
+
+// U8 returns the encoding of an UNSIGNED8 value.
+func U8(v uint8) []byte {
+	return []byte{v}
+}
+
+// U16 returns the little endian encoding of an UNSIGNED16 value.
+func U16(v uint16) []byte {
+	return binary.LittleEndian.AppendUint16(nil, v)
+}
+
+// U32 returns the little endian encoding of an UNSIGNED32 value.
+func U32(v uint32) []byte {
+	return binary.LittleEndian.AppendUint32(nil, v)
+}
+
+// IdentityObject returns the identity object 0x1018 for id.
+//
+// Parameters:
+//   - id (sii.Identity): Identity of the slave
+//
+// Returns:
+//   - *Object: Identity object
+func IdentityObject(id sii.Identity) *Object {
+	return Record("Identity", ReadOnly,
+		Entry{Name: "Vendor ID", Value: U32(id.VendorID)},
+		Entry{Name: "Product code", Value: U32(id.ProductCode)},
+		Entry{Name: "Revision", Value: U32(id.RevisionNo)},
+		Entry{Name: "Serial number", Value: U32(id.SerialNo)},
+	)
+}
+
+// DictionaryFromESI creates an object dictionary with the default values of an ESI dictionary.
+// Entries without a default value are zero.
+//
+// Parameters:
+//   - d (*esi.Dictionary): Dictionary of an ESI device description
+//
+// Returns:
+//   - ObjectDictionary: New object dictionary
+func DictionaryFromESI(d *esi.Dictionary) ObjectDictionary {
+	od := ObjectDictionary{}
+	names := make(map[uint16]string, len(d.Objects))
+	for _, o := range d.Objects {
+		names[uint16(o.Index)] = o.Name
+	}
+
+	for _, e := range d.Entries() {
+		o, ok := od[e.Index]
+		if !ok {
+			o = &Object{Name: names[e.Index]}
+			od[e.Index] = o
+		}
+		for len(o.Entries) <= int(e.SubIndex) {
+			o.Entries = append(o.Entries, Entry{Value: []byte{}})
+		}
+
+		value := make([]byte, (e.BitSize+7)/8)
+		copy(value, e.Default)
+		o.Entries[e.SubIndex] = Entry{Name: e.Name, Access: accessFromESI(e.Access), Value: value}
+	}
+	return od
+}
+
+func accessFromESI(access string) Access {
+	switch access {
+	case "rw":
+		return ReadWrite
+	case "wo":
+		return WriteOnly
+	default:
+		return ReadOnly
+	}
+}
+
+// upload returns the value of a subindex, or of the whole object for complete access.
+func (od ObjectDictionary) upload(index uint16, subIndex uint8, complete bool) ([]byte, coe.AbortCode) {
+	o, ok := od[index]
+	if !ok {
+		return nil, coe.AbortNoObject
+	}
+	if !complete {
+		if int(subIndex) >= len(o.Entries) {
+			return nil, coe.AbortNoSubIndex
+		}
+		if o.Entries[subIndex].Access == WriteOnly {
+			return nil, coe.AbortWriteOnly
+		}
+		return append([]byte{}, o.Entries[subIndex].Value...), 0
+	}
+
+	if len(o.Entries) < 2 || len(o.Entries[0].Value) != 1 || subIndex > 1 {
+		return nil, coe.AbortUnsupportedAccess
+	}
+	var data []byte
+	if subIndex == 0 {
+		// Subindex 0 is transferred as 16 bits with complete access.
+		data = append(data, o.Entries[0].Value[0], 0)
+	}
+	for _, e := range o.Entries[1:o.count()] {
+		data = append(data, e.Value...)
+	}
+	return data, 0
+}
+
+// download writes a subindex, or the whole object for complete access.
+func (od ObjectDictionary) download(index uint16, subIndex uint8, complete bool, data []byte) coe.AbortCode {
+	o, ok := od[index]
+	if !ok {
+		return coe.AbortNoObject
+	}
+	if !complete {
+		if int(subIndex) >= len(o.Entries) {
+			return coe.AbortNoSubIndex
+		}
+		return o.write(subIndex, data)
+	}
+
+	if len(o.Entries) < 2 || len(o.Entries[0].Value) != 1 || subIndex > 1 {
+		return coe.AbortUnsupportedAccess
+	}
+	count := o.Entries[0].Value
+	if subIndex == 0 {
+		if len(data) < 2 {
+			return coe.AbortLengthTooLow
+		}
+		count, data = data[:1], data[2:]
+	}
+	if int(count[0]) >= len(o.Entries) {
+		return coe.AbortValueTooHigh
+	}
+
+	size := 0
+	for _, e := range o.Entries[1 : int(count[0])+1] {
+		size += len(e.Value)
+	}
+	switch {
+	case len(data) < size:
+		return coe.AbortLengthTooLow
+	case len(data) > size:
+		return coe.AbortLengthTooHigh
+	}
+
+	for n := 1; n <= int(count[0]); n++ {
+		if code := o.write(uint8(n), data[:len(o.Entries[n].Value)]); code != 0 {
+			return code
+		}
+		data = data[len(o.Entries[n].Value):]
+	}
+	if subIndex == 0 {
+		return o.write(0, count)
+	}
+	return 0
+}
+
+// count returns the number of entries including subindex 0 that are currently valid.
+func (o *Object) count() int {
+	return min(int(o.Entries[0].Value[0])+1, len(o.Entries))
+}
+
+func (o *Object) write(subIndex uint8, data []byte) coe.AbortCode {
+	e := &o.Entries[subIndex]
+	switch {
+	case e.Access == ReadOnly:
+		return coe.AbortReadOnly
+	case len(data) < len(e.Value):
+		return coe.AbortLengthTooLow
+	case len(data) > len(e.Value):
+		return coe.AbortLengthTooHigh
+	case subIndex == 0 && len(o.Entries) > 1 && int(data[0]) >= len(o.Entries):
+		return coe.AbortValueTooHigh
+	}
+
+	copy(e.Value, data)
+	return 0
+}
+
+// indices returns the indices of all objects in ascending order.
+func (od ObjectDictionary) indices() []uint16 {
+	result := make([]uint16, 0, len(od))
+	for index := range od {
+		result = append(result, index)
+	}
+	slices.Sort(result)
+	return result
+}
+
+// describe returns the SDO information description of an object.
+func (od ObjectDictionary) describe(index uint16) (coe.ObjectDescription, coe.AbortCode) {
+	o, ok := od[index]
+	if !ok {
+		return coe.ObjectDescription{}, coe.AbortNoObject
+	}
+
+	desc := coe.ObjectDescription{Index: index, MaxSubIndex: uint8(len(o.Entries) - 1), ObjectCode: coe.ObjectRecord, Name: o.Name}
+	if len(o.Entries) == 1 {
+		desc.ObjectCode, desc.DataType = coe.ObjectVar, o.Entries[0].dataType()
+	}
+	return desc, 0
+}
+
+// describeEntry returns the SDO information description of an entry.
+func (od ObjectDictionary) describeEntry(index uint16, subIndex uint8) (coe.EntryDescription, coe.AbortCode) {
+	o, ok := od[index]
+	if !ok {
+		return coe.EntryDescription{}, coe.AbortNoObject
+	}
+	if int(subIndex) >= len(o.Entries) {
+		return coe.EntryDescription{}, coe.AbortNoSubIndex
+	}
+
+	e := o.Entries[subIndex]
+	access := coe.ReadAll
+	switch e.Access {
+	case ReadWrite:
+		access |= coe.WriteAll
+	case WriteOnly:
+		access = coe.WriteAll
+	}
+	return coe.EntryDescription{
+		Index:     index,
+		SubIndex:  subIndex,
+		DataType:  e.dataType(),
+		BitLength: uint16(8 * len(e.Value)),
+		Access:    access,
+		Name:      e.Name,
+	}, 0
+}
+
+func (e Entry) dataType() coe.DataType {
+	if e.DataType != 0 {
+		return e.DataType
+	}
+	switch len(e.Value) {
+	case 1:
+		return coe.Unsigned8
+	case 2:
+		return coe.Unsigned16
+	case 4:
+		return coe.Unsigned32
+	case 8:
+		return coe.Unsigned64
+	default:
+		return coe.OctetString
+	}
+}
@@ -0,0 +1,235 @@
+package simulator
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/Aruminium/goecat/pkg/link"
+)
+
+// Ring is a line of virtual slaves that frames pass through in order before returning to the master.
+type Ring struct {
+	slaves []*ESC
+
+	mu        sync.Mutex
+	cut       int  // Position of the slave in front of which the cable is pulled, -1 if none
+	redundant bool // The last slave is connected back to the secondary port of the master
+}
+
+// NewRing chains slaves into a segment; slaves[0] is connected to the master.
+// The link state of the ports is set accordingly: port 0 faces the master and port 1 the next slave.
+//
+// Parameters:
+//   - slaves (...*ESC): Virtual slaves in wiring order
+//
+// Returns:
+//   - *Ring: New segment
+func NewRing(slaves ...*ESC) *Ring {
+	r := &Ring{slaves: slaves, cut: -1}
+	r.relink()
+	return r
+}
+
+// Disconnect pulls the cable in front of the slave at position: frames sent by the master no
+// longer reach it or the slaves after it, and both ends of the cable lose their link. With
+// cable redundancy the slaves behind the break are reached from the secondary port, and
+// position len(Slaves()) pulls the cable back to the secondary port.
+//
+// Parameters:
+//   - position (int): Position of the first slave cut off
+func (r *Ring) Disconnect(position int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.cut = min(max(position, 0), len(r.slaves))
+	r.relink()
+}
+
+// Reconnect plugs the cable pulled by Disconnect back in, so that frames reach all slaves again.
+func (r *Ring) Reconnect() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.cut = -1
+	r.relink()
+}
+
+// relink sets the link state of the ports from the wiring. It must be called with mu held or
+// before the ring is shared.
+func (r *Ring) relink() {
+	for i, s := range r.slaves {
+		out := i < len(r.slaves)-1 || r.redundant
+		s.SetLinks([4]bool{i != r.cut, out && i+1 != r.cut, false, false})
+	}
+}
+
+// reached returns the slaves that frames sent from the primary port pass through.
+func (r *Ring) reached() []*ESC {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.cut < 0 {
+		return r.slaves
+	}
+	return r.slaves[:r.cut]
+}
+
+// Slaves returns the slaves of the segment in wiring order.
+func (r *Ring) Slaves() []*ESC {
+	return r.slaves
+}
+
+// Process passes an Ethernet frame through all slaves and returns the frame as it reaches the master again.
+// Frames that do not carry EtherCAT are returned unchanged.
+//
+// Parameters:
+//   - ethernet ([]byte): Ethernet frame sent by the master, modified in place
+//
+// Returns:
+//   - []byte: Returned Ethernet frame, nil if the cable to the first slave is pulled
+func (r *Ring) Process(ethernet []byte) []byte {
+	ecat, err := link.Decapsulate(ethernet)
+	if err != nil {
+		return ethernet
+	}
+
+	reached := r.reached()
+	if len(reached) == 0 && len(r.slaves) > 0 {
+		return nil
+	}
+	r.pass(ethernet, ecat, reached)
+	return ethernet
+}
+
+// pass processes an EtherCAT frame by slaves in order.
+func (r *Ring) pass(ethernet []byte, ecat []byte, slaves []*ESC) {
+	for _, s := range slaves {
+		s.Process(ecat)
+	}
+	// The first slave sets the locally administered bit of the source MAC address,
+	// which lets a master tell returned frames from its own.
+	if len(r.slaves) > 0 && len(ethernet) >= 12 {
+		ethernet[6] |= 0x02
+	}
+}
+
+// ProcessRedundant passes an Ethernet frame sent on one port of a master with cable redundancy
+// through the ring. While the ring is closed, a frame from the primary port is processed by all
+// slaves and arrives at the secondary port, and a frame from the secondary port passes the
+// slaves unprocessed and arrives at the primary port. Once a cable is pulled, each frame is
+// processed by the slaves on its side of the break and returns to the port it was sent from.
+// Frames that do not carry EtherCAT are returned unchanged.
+//
+// Parameters:
+//   - ethernet ([]byte): Ethernet frame sent by the master, modified in place
+//   - secondary (bool): Whether the frame was sent on the secondary port
+//
+// Returns:
+//   - []byte: Returned Ethernet frame, nil if the port of the master has no link
+//   - bool: Whether the frame arrives at the secondary port
+func (r *Ring) ProcessRedundant(ethernet []byte, secondary bool) ([]byte, bool) {
+	r.mu.Lock()
+	cut := r.cut
+	r.mu.Unlock()
+
+	ecat, err := link.Decapsulate(ethernet)
+	switch {
+	case err != nil:
+		return ethernet, secondary
+	case cut < 0:
+		if !secondary {
+			r.pass(ethernet, ecat, r.slaves)
+		}
+		return ethernet, !secondary
+	case !secondary && cut == 0, secondary && cut == len(r.slaves):
+		return nil, secondary
+	case !secondary:
+		r.pass(ethernet, ecat, r.slaves[:cut])
+	default:
+		// The frame passes the slaves behind the break to the open port and is processed on
+		// its way back.
+		r.pass(ethernet, ecat, r.slaves[cut:])
+	}
+	return ethernet, secondary
+}
+
+// Serve answers the frames received on l until l is closed.
+//
+// Parameters:
+//   - l (link.Link): Segment side of a link, such as one end of link.Pipe
+//
+// Returns:
+//   - error: Error other than link.ErrClosed that stopped serving
+func (r *Ring) Serve(l link.Link) error {
+	for {
+		ethernet, err := l.Receive()
+		if errors.Is(err, link.ErrClosed) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		out := r.Process(ethernet)
+		if out == nil {
+			continue
+		}
+		if err := l.Send(out); err != nil {
+			if errors.Is(err, link.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// AttachRedundant connects both ends of the segment to new in-memory links, as the primary and
+// secondary port of a master with cable redundancy, and serves them in the background with
+// ProcessRedundant. Closing a returned link stops serving it.
+//
+// Returns:
+//   - link.Link: Primary port side of the link to slaves[0]
+//   - link.Link: Secondary port side of the link to the last slave
+func (r *Ring) AttachRedundant() (link.Link, link.Link) {
+	r.mu.Lock()
+	r.redundant = true
+	r.relink()
+	r.mu.Unlock()
+
+	primary, primarySegment := link.Pipe()
+	secondary, secondarySegment := link.Pipe()
+	ports := [2]link.Link{primarySegment, secondarySegment}
+	for i, l := range ports {
+		go func(l link.Link, secondary bool) {
+			for {
+				ethernet, err := l.Receive()
+				if err != nil {
+					return
+				}
+				out, toSecondary := r.ProcessRedundant(ethernet, secondary)
+				if out == nil {
+					continue
+				}
+				port := ports[0]
+				if toSecondary {
+					port = ports[1]
+				}
+				if err := port.Send(out); err != nil {
+					return
+				}
+			}
+		}(l, i == 1)
+	}
+	return primary, secondary
+}
+
+// Attach connects the segment to a new in-memory link and serves it in the background.
+// Closing the returned link stops serving.
+//
+// Returns:
+//   - link.Link: Master side of the link
+func (r *Ring) Attach() link.Link {
+	master, segment := link.Pipe()
+	go r.Serve(segment)
+	return master
+}
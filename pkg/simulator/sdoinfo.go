@@ -0,0 +1,57 @@
+package simulator
+
+import (
+	"encoding/binary"
+
+	"github.com/Aruminium/goecat/pkg/ethercat/coe"
+	"github.com/Aruminium/goecat/pkg/ethercat/mailbox"
+)
+
+// sdoInformation answers an SDO information request. Responses that do not fit into the send
+// mailbox are split into fragments, which are all queued at once.
+func (s *MailboxSlave) sdoInformation(body []byte) {
+	req, err := coe.ParseInfo(body)
+	if err != nil {
+		s.queue = append(s.queue, s.encode(mailbox.NewError(mailbox.ErrSizeTooShort)))
+		return
+	}
+
+	var data []byte
+	var code coe.AbortCode
+	var response coe.InfoOpCode
+	switch {
+	case req.OpCode == coe.GetODListRequest && len(req.Data) >= 2:
+		listType := binary.LittleEndian.Uint16(req.Data)
+		if listType != coe.ListAll {
+			code = coe.AbortUnsupportedAccess
+			break
+		}
+		response, data = coe.GetODListResponse, binary.LittleEndian.AppendUint16(nil, listType)
+		for _, index := range s.od.indices() {
+			data = binary.LittleEndian.AppendUint16(data, index)
+		}
+	case req.OpCode == coe.GetODRequest && len(req.Data) >= 2:
+		var desc coe.ObjectDescription
+		desc, code = s.od.describe(binary.LittleEndian.Uint16(req.Data))
+		response, data = coe.GetODResponse, desc.Bytes()
+	case req.OpCode == coe.GetEDRequest && len(req.Data) >= 3:
+		var desc coe.EntryDescription
+		desc, code = s.od.describeEntry(binary.LittleEndian.Uint16(req.Data), req.Data[2])
+		response, data = coe.GetEDResponse, desc.Bytes()
+	default:
+		code = coe.AbortUnknownCommand
+	}
+
+	if code != 0 {
+		s.send(mailbox.CoE, coe.Info{OpCode: coe.InfoErrorRequest, Data: binary.LittleEndian.AppendUint32(nil, uint32(code))}.Bytes())
+		return
+	}
+
+	capacity := int(s.info.StdTx.Size) - mailbox.HeaderLength - coe.HeaderLength - coe.InfoHeaderLength
+	fragments := (len(data) + capacity - 1) / capacity
+	for n := 1; n <= fragments; n++ {
+		fragment := data[:min(capacity, len(data))]
+		data = data[len(fragment):]
+		s.send(mailbox.CoE, coe.Info{OpCode: response, Incomplete: n < fragments, FragmentsLeft: uint16(fragments - n), Data: fragment}.Bytes())
+	}
+}
@@ -0,0 +1,280 @@
+// Package topology derives how the slaves of a segment are wired from the port states in their
+// DL Status registers (0x0110).
+//
+// A frame enters a slave on one port and leaves it through the other open ports in the
+// processing order 0, 3, 1, 2 before it returns through the entry port. The positions of the
+// slaves follow the same order, so walking the open ports of every slave in processing order
+// rebuilds the tree: the slave after a slave is the first child behind its first open port,
+// and so on depth-first.
+package topology
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Aruminium/goecat/pkg/scan"
+)
+
+// Ports is the number of ports of an ESC.
+const Ports = 4
+
+// Master is the Parent of the first slave.
+const Master = -1
+
+// ErrInconsistent is returned when the port states do not describe a tree of the scanned slaves.
+var ErrInconsistent = errors.New("topology: port states do not match the slave count")
+
+// processingOrder is the order in which an ESC forwards a frame through its ports.
+var processingOrder = [Ports]int{0, 3, 1, 2}
+
+// Port is the state of one port from DL Status.
+type Port struct {
+	Link          bool // Physical link detected
+	Closed        bool // Loop closed: frames are not forwarded through the port
+	Communication bool // Communication established
+}
+
+// Open reports whether frames are forwarded through the port.
+func (p Port) Open() bool {
+	return !p.Closed
+}
+
+// PortsFromDLStatus decodes the port states of DL Status.
+//
+// Parameters:
+//   - status (uint16): Value of DL Status (0x0110)
+//
+// Returns:
+//   - [Ports]Port: State of port 0 to 3
+func PortsFromDLStatus(status uint16) [Ports]Port {
+	var ports [Ports]Port
+	for n := range ports {
+		ports[n] = Port{
+			Link:          status&(1<<(4+n)) != 0,
+			Closed:        status&(1<<(8+2*n)) != 0,
+			Communication: status&(1<<(9+2*n)) != 0,
+		}
+	}
+	return ports
+}
+
+// Node is a slave in the tree.
+type Node struct {
+	Slave      scan.Slave
+	Ports      [Ports]Port
+	EntryPort  int        // Port the frames from the master arrive on
+	Parent     int        // Position of the parent slave, Master for the first slave
+	ParentPort int        // Port of the parent the slave is connected to, -1 for the first slave
+	Children   [Ports]int // Position of the slave behind each port, -1 if none
+	OpenPorts  []int      // Open ports other than the entry port without a slave behind them
+}
+
+// Junction reports whether more than one slave is connected behind the node.
+func (n Node) Junction() bool {
+	count := 0
+	for _, child := range n.Children {
+		if child >= 0 {
+			count++
+		}
+	}
+	return count > 1
+}
+
+// Tree is the wiring of a segment, with one node per slave in the order of their positions.
+type Tree struct {
+	Nodes []Node
+}
+
+// Build derives the tree from the DL Status of the scanned slaves.
+//
+// Parameters:
+//   - slaves ([]scan.Slave): All slaves of the segment in the order of their positions
+//
+// Returns:
+//   - *Tree: Tree of the slaves
+//   - error: ErrInconsistent if the open ports lead to more or fewer slaves than were scanned
+func Build(slaves []scan.Slave) (*Tree, error) {
+	t := &Tree{Nodes: make([]Node, len(slaves))}
+	for i, s := range slaves {
+		n := &t.Nodes[i]
+		n.Slave, n.Ports = s, PortsFromDLStatus(s.DLStatus)
+		n.EntryPort, n.Parent, n.ParentPort = entryPort(n.Ports), Master, -1
+		n.Children = [Ports]int{-1, -1, -1, -1}
+	}
+	if len(slaves) == 0 {
+		return t, nil
+	}
+
+	if next := t.attach(0, len(slaves)); next != len(slaves) {
+		return t, fmt.Errorf("%w: the open ports lead to %d slaves, but %d answered", ErrInconsistent, next, len(slaves))
+	}
+	return t, nil
+}
+
+// attach assigns the slaves following position to the open ports of the slave at position
+// and returns the position after the last slave of its subtree.
+func (t *Tree) attach(position int, count int) int {
+	n := &t.Nodes[position]
+	next := position + 1
+	for _, port := range forwardPorts(n.EntryPort) {
+		if !n.Ports[port].Open() {
+			continue
+		}
+		if next >= count || !n.Ports[port].Link {
+			n.OpenPorts = append(n.OpenPorts, port)
+			continue
+		}
+
+		child := &t.Nodes[next]
+		child.Parent, child.ParentPort = position, port
+		n.Children[port] = next
+
+		next = t.attach(next, count)
+	}
+	return next
+}
+
+// Roots returns the positions of the slaves connected to the master, which is only the first
+// slave of a tree built without errors.
+func (t *Tree) Roots() []int {
+	var result []int
+	for i, n := range t.Nodes {
+		if n.Parent == Master {
+			result = append(result, i)
+		}
+	}
+	return result
+}
+
+// Junctions returns the positions of the slaves with more than one slave connected behind them.
+func (t *Tree) Junctions() []int {
+	var result []int
+	for i, n := range t.Nodes {
+		if n.Junction() {
+			result = append(result, i)
+		}
+	}
+	return result
+}
+
+// Text renders the tree with one slave per line, indented below its parent. Every line
+// shows the port of the parent the slave is connected to, its position, station address
+// and name, and the ports left open.
+//
+// Returns:
+//   - string: Rendered tree, each line ending with a newline
+func (t *Tree) Text() string {
+	var b strings.Builder
+	b.WriteString("master\n")
+	roots := t.Roots()
+	for i, root := range roots {
+		t.text(&b, root, "", i == len(roots)-1)
+	}
+	return b.String()
+}
+
+func (t *Tree) text(b *strings.Builder, position int, indent string, last bool) {
+	n := t.Nodes[position]
+	branch, more := "├── ", "│   "
+	if last {
+		branch, more = "└── ", "    "
+	}
+
+	b.WriteString(indent + branch)
+	if n.ParentPort >= 0 {
+		fmt.Fprintf(b, "[%d] ", n.ParentPort)
+	}
+	fmt.Fprintf(b, "%d 0x%04x", n.Slave.Position, n.Slave.Station)
+	if name := n.Slave.Name(); name != "" {
+		fmt.Fprintf(b, " %s", name)
+	}
+	if len(n.OpenPorts) > 0 {
+		fmt.Fprintf(b, " (open ports %s)", joinPorts(n.OpenPorts))
+	}
+	b.WriteByte('\n')
+
+	children := t.children(n)
+	for i, child := range children {
+		t.text(b, child, indent+more, i == len(children)-1)
+	}
+}
+
+// DOT renders the tree as a Graphviz graph. Edges are labelled with the ports they connect;
+// open ports without a slave behind them are drawn as dashed edges to empty points.
+//
+// Returns:
+//   - string: Graph in the DOT language
+func (t *Tree) DOT() string {
+	var b strings.Builder
+	b.WriteString("digraph topology {\n")
+	b.WriteString("  rankdir=LR;\n")
+	b.WriteString("  master [shape=box];\n")
+	for i, n := range t.Nodes {
+		label := fmt.Sprintf("%d 0x%04x", n.Slave.Position, n.Slave.Station)
+		if name := n.Slave.Name(); name != "" {
+			label += `\n` + strings.ReplaceAll(name, `"`, `\"`)
+		}
+		fmt.Fprintf(&b, "  slave%d [label=\"%s\"];\n", i, label)
+	}
+	for i, n := range t.Nodes {
+		if n.Parent == Master {
+			fmt.Fprintf(&b, "  master -> slave%d [headlabel=\"%d\"];\n", i, n.EntryPort)
+		} else {
+			fmt.Fprintf(&b, "  slave%d -> slave%d [taillabel=\"%d\", headlabel=\"%d\"];\n", n.Parent, i, n.ParentPort, n.EntryPort)
+		}
+		for _, port := range n.OpenPorts {
+			fmt.Fprintf(&b, "  open%d_%d [shape=point];\n", i, port)
+			fmt.Fprintf(&b, "  slave%d -> open%d_%d [taillabel=\"%d\", style=dashed];\n", i, i, port, port)
+		}
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// children returns the positions of the slaves behind a node in processing order.
+func (t *Tree) children(n Node) []int {
+	var result []int
+	for _, port := range forwardPorts(n.EntryPort) {
+		if child := n.Children[port]; child >= 0 {
+			result = append(result, child)
+		}
+	}
+	return result
+}
+
+// entryPort returns the first port with communication in processing order. Frames from
+// the master arrive on it, which is port 0 unless the slave is wired the wrong way round.
+func entryPort(ports [Ports]Port) int {
+	for _, port := range processingOrder {
+		if ports[port].Communication && ports[port].Open() {
+			return port
+		}
+	}
+	return 0
+}
+
+// forwardPorts returns the ports a frame passes after arriving on the entry port, in
+// processing order.
+func forwardPorts(entry int) []int {
+	start := 0
+	for i, port := range processingOrder {
+		if port == entry {
+			start = i
+		}
+	}
+
+	result := make([]int, 0, Ports-1)
+	for i := 1; i < Ports; i++ {
+		result = append(result, processingOrder[(start+i)%Ports])
+	}
+	return result
+}
+
+func joinPorts(ports []int) string {
+	names := make([]string, len(ports))
+	for i, port := range ports {
+		names[i] = fmt.Sprint(port)
+	}
+	return strings.Join(names, " ")
+}
@@ -0,0 +1,136 @@
+package topology_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/Aruminium/goecat/pkg/scan"
+	"github.com/Aruminium/goecat/pkg/topology"
+)
+
+// dlStatus returns DL Status with link and communication on the given ports and the other
+// ports closed.
+func dlStatus(ports ...int) uint16 {
+	status := uint16(0x5500) // All loops closed
+	for _, port := range ports {
+		status |= 1 << (4 + port)
+		status |= 1 << (9 + 2*port)
+		status &^= 1 << (8 + 2*port)
+	}
+	return status
+}
+
+func slaves(status ...uint16) []scan.Slave {
+	result := make([]scan.Slave, len(status))
+	for i, s := range status {
+		result[i] = scan.Slave{Position: uint16(i), Station: 0x1001 + uint16(i), DLStatus: s}
+	}
+	return result
+}
+
+func TestBuildLine(t *testing.T) {
+	// given
+	line := slaves(dlStatus(0, 1), dlStatus(0, 1), dlStatus(0))
+
+	// when
+	tree, err := topology.Build(line)
+
+	// then
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	parents := []int{tree.Nodes[0].Parent, tree.Nodes[1].Parent, tree.Nodes[2].Parent}
+	if !reflect.DeepEqual(parents, []int{topology.Master, 0, 1}) {
+		t.Errorf("Expected parents [-1 0 1], but got %v", parents)
+	}
+	if tree.Nodes[2].ParentPort != 1 || len(tree.Junctions()) != 0 {
+		t.Errorf("Expected a line connected on port 1, but got port %d and junctions %v", tree.Nodes[2].ParentPort, tree.Junctions())
+	}
+}
+
+func TestBuildJunction(t *testing.T) {
+	// given
+	// A coupler with a branch on port 3 (slave 1 and 2) processed before the line on port 1 (slave 3).
+	segment := slaves(dlStatus(0, 1, 3), dlStatus(0, 1), dlStatus(0), dlStatus(0))
+
+	// when
+	tree, err := topology.Build(segment)
+
+	// then
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := [topology.Ports]int{-1, 3, -1, 1}
+	if tree.Nodes[0].Children != expected {
+		t.Errorf("Expected children %v, but got %v", expected, tree.Nodes[0].Children)
+	}
+	if tree.Nodes[2].Parent != 1 || tree.Nodes[3].Parent != 0 || tree.Nodes[3].ParentPort != 1 {
+		t.Errorf("Expected slave 2 behind slave 1 and slave 3 on port 1 of slave 0, but got %+v and %+v", tree.Nodes[2], tree.Nodes[3])
+	}
+	if !reflect.DeepEqual(tree.Junctions(), []int{0}) {
+		t.Errorf("Expected a junction at slave 0, but got %v", tree.Junctions())
+	}
+
+	text := "master\n" +
+		"└── 0 0x1001\n" +
+		"    ├── [3] 1 0x1002\n" +
+		"    │   └── [1] 2 0x1003\n" +
+		"    └── [1] 3 0x1004\n"
+	if tree.Text() != text {
+		t.Errorf("Expected\n%s\nbut got\n%s", text, tree.Text())
+	}
+}
+
+func TestBuildOpenPort(t *testing.T) {
+	// given
+	// Port 1 of the last slave is open without link, so frames are lost behind it.
+	status := dlStatus(0) &^ (1 << 10)
+	segment := slaves(dlStatus(0, 1), status)
+
+	// when
+	tree, err := topology.Build(segment)
+
+	// then
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(tree.Nodes[1].OpenPorts, []int{1}) {
+		t.Errorf("Expected open port 1, but got %v", tree.Nodes[1].OpenPorts)
+	}
+}
+
+func TestBuildInconsistent(t *testing.T) {
+	// given
+	// The first slave claims to be the end of the line, but a second slave answered.
+	segment := slaves(dlStatus(0), dlStatus(0))
+
+	// when
+	_, err := topology.Build(segment)
+
+	// then
+	if !errors.Is(err, topology.ErrInconsistent) {
+		t.Errorf("Expected %v, but got %v", topology.ErrInconsistent, err)
+	}
+}
+
+func TestDOT(t *testing.T) {
+	// given
+	tree, _ := topology.Build(slaves(dlStatus(0, 1), dlStatus(0)))
+
+	// when
+	dot := tree.DOT()
+
+	// then
+	expected := "digraph topology {\n" +
+		"  rankdir=LR;\n" +
+		"  master [shape=box];\n" +
+		"  slave0 [label=\"0 0x1001\"];\n" +
+		"  slave1 [label=\"1 0x1002\"];\n" +
+		"  master -> slave0 [headlabel=\"0\"];\n" +
+		"  slave0 -> slave1 [taillabel=\"1\", headlabel=\"0\"];\n" +
+		"}\n"
+	if dot != expected {
+		t.Errorf("Expected\n%s\nbut got\n%s", expected, dot)
+	}
+}
@@ -0,0 +1,73 @@
+package transceiver
+
+import (
+	"context"
+	"time"
+
+	"github.com/Aruminium/goecat/pkg/ethercat/datagram"
+)
+
+// withoutRetry is the context key set by WithoutRetry.
+type withoutRetry struct{}
+
+// WithoutRetry returns a context whose exchanges fail on their first timeout regardless of the
+// RetryPolicy. It is meant for reads with side effects, such as reading a send mailbox, which
+// empties it: a retry after a lost reply would read the emptied mailbox.
+//
+// Parameters:
+//   - ctx (context.Context): Parent context
+//
+// Returns:
+//   - context.Context: Context passed to Exchange or ExchangeExpect
+func WithoutRetry(ctx context.Context) context.Context {
+	return context.WithValue(ctx, withoutRetry{}, true)
+}
+
+// RetryPolicy decides whether a timed-out acyclic datagram is sent again.
+// Cyclic datagrams are never retried; the next cycle sends them anyway.
+type RetryPolicy interface {
+	// Retry returns whether d should be sent again after attempts failed attempts,
+	// and how long to wait before queueing it.
+	Retry(d datagram.Datagram, attempts int) (bool, time.Duration)
+}
+
+// NoRetry fails a datagram on its first timeout.
+type NoRetry struct{}
+
+func (NoRetry) Retry(datagram.Datagram, int) (bool, time.Duration) {
+	return false, 0
+}
+
+// FixedRetry retries a datagram up to Max times, waiting Delay before each retry.
+type FixedRetry struct {
+	Max      int           // Number of retries after the first attempt
+	Delay    time.Duration // Delay before a retry is queued
+	ReadOnly bool          // Only retry commands that do not write, because a lost write may have been applied
+}
+
+func (r FixedRetry) Retry(d datagram.Datagram, attempts int) (bool, time.Duration) {
+	if r.ReadOnly && d.Command.IsWrite() {
+		return false, 0
+	}
+	return attempts <= r.Max, r.Delay
+}
+
+// BackoffRetry retries a datagram up to Max times, doubling the delay after each retry.
+type BackoffRetry struct {
+	Max      int           // Number of retries after the first attempt
+	Initial  time.Duration // Delay before the first retry
+	Limit    time.Duration // Upper bound of the delay, no bound if zero
+	ReadOnly bool          // Only retry commands that do not write, because a lost write may have been applied
+}
+
+func (r BackoffRetry) Retry(d datagram.Datagram, attempts int) (bool, time.Duration) {
+	if r.ReadOnly && d.Command.IsWrite() {
+		return false, 0
+	}
+
+	delay := r.Initial << (attempts - 1)
+	if r.Limit > 0 && delay > r.Limit {
+		delay = r.Limit
+	}
+	return attempts <= r.Max, delay
+}
@@ -0,0 +1,46 @@
+package transceiver
+
+import (
+	"github.com/Aruminium/goecat/pkg/ethercat/datagram"
+	"github.com/Aruminium/goecat/pkg/ethercat/wkc"
+)
+
+// ErrWKCMismatch is wrapped by the errors of datagrams that return with an unexpected working counter.
+var ErrWKCMismatch = wkc.ErrMismatch
+
+// Stats counts frame and datagram level events, so field issues can be told apart.
+type Stats struct {
+	FramesSent      uint64 // Frames written to the link
+	FramesReceived  uint64 // EtherCAT frames read from the link
+	LostFrames      uint64 // Frames of which no datagram returned before the timeout
+	LateFrames      uint64 // Frames that returned after their datagrams had timed out
+	DuplicateFrames uint64 // Frames whose datagrams had already returned
+	Timeouts        uint64 // Datagrams that timed out, including those retried afterwards
+	Retries         uint64 // Datagrams sent again by the RetryPolicy
+	WKCMismatches   uint64 // Datagrams whose working counter failed their Expectation
+}
+
+// Expectation checks a returned datagram, typically its working counter.
+// wkc.Expectation implements it with the slaves that take part in a datagram.
+type Expectation interface {
+	// Check returns an error wrapping ErrWKCMismatch if d did not return as expected.
+	Check(d datagram.Datagram) error
+}
+
+// expectWKC expects an exact working counter without knowing the slaves.
+type expectWKC uint16
+
+func (e expectWKC) Check(d datagram.Datagram) error {
+	return wkc.Expectation{WKC: uint16(e)}.Check(d)
+}
+
+// ExpectWKC returns an Expectation that a datagram returns with exactly wkc.
+//
+// Parameters:
+//   - wkc (uint16): Expected working counter
+//
+// Returns:
+//   - Expectation: Expectation of the working counter
+func ExpectWKC(wkc uint16) Expectation {
+	return expectWKC(wkc)
+}
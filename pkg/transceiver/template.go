@@ -0,0 +1,236 @@
+package transceiver
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Aruminium/goecat/pkg/ethercat/datagram"
+	"github.com/Aruminium/goecat/pkg/ethercat/frame"
+	"github.com/Aruminium/goecat/pkg/link"
+)
+
+// ErrNotReserved is returned by CycleTemplate for a Template that has not been reserved.
+var ErrNotReserved = errors.New("template is not reserved")
+
+// reservation is the Template reserved for cyclic exchange.
+//
+// Consecutive cycles send the frame with alternate index sets, so that the late return of a cycle that
+// timed out is counted as late instead of being taken for the return of the next cycle.
+type reservation struct {
+	template *link.Template
+	indices  [2][]uint8          // Index sets of the datagrams, used in alternate cycles
+	set      int                 // Index set of the last frame sent
+	sent     []datagram.Datagram // Datagrams of the template, whose WKC is set to check Expectations
+	returned chan []byte         // Return of the frame in flight
+	pending  bool                // Whether the frame is in flight and its return is awaited
+	timer    *time.Timer
+}
+
+// Reserve reserves two indices for every datagram of tmpl, so that tmpl can be exchanged with
+// CycleTemplate, which writes them into tmpl alternately. The indices are not handed out to other
+// datagrams until Release.
+// Reserving a Template releases the one reserved before.
+//
+// Parameters:
+//   - tmpl (*link.Template): Template of the cyclic frame
+//
+// Returns:
+//   - error: ErrClosed, or frame.ErrNoIndex if not enough indices are free
+func (t *Transceiver) Reserve(tmpl *link.Template) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return ErrClosed
+	}
+	t.release()
+
+	indices := make([]uint8, 0, 2*tmpl.Len())
+	for i := 0; i < 2*tmpl.Len(); i++ {
+		index, ok := t.pool.Allocate()
+		if !ok {
+			for _, index := range indices {
+				t.pool.Expire(index)
+			}
+			return frame.ErrNoIndex
+		}
+		indices = append(indices, index)
+	}
+
+	r := &reservation{
+		template: tmpl,
+		indices:  [2][]uint8{indices[:tmpl.Len()], indices[tmpl.Len():]},
+		set:      1,
+		returned: make(chan []byte, 1),
+		timer:    time.NewTimer(t.timeout),
+	}
+	stopTimer(r.timer)
+	for i, index := range r.indices[0] {
+		tmpl.SetIndex(i, index)
+		r.sent = append(r.sent, tmpl.Datagram(i))
+	}
+	t.reserved = r
+	return nil
+}
+
+// Release frees the indices of tmpl. It does nothing if tmpl is not reserved.
+//
+// Parameters:
+//   - tmpl (*link.Template): Reserved Template
+func (t *Transceiver) Release(tmpl *link.Template) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.reserved != nil && t.reserved.template == tmpl {
+		t.release()
+	}
+}
+
+// release frees the indices of the reserved Template. It must be called with mu held.
+func (t *Transceiver) release() {
+	if t.reserved == nil {
+		return
+	}
+	for _, indices := range t.reserved.indices {
+		for _, index := range indices {
+			t.pool.Expire(index)
+		}
+	}
+	t.reserved = nil
+}
+
+// CycleTemplate sends the frame of a reserved Template as it is and waits for its return. Queued acyclic
+// datagrams are sent in their own frames afterwards.
+// Unlike Cycle, the frame is neither rebuilt nor parsed: the returned datagrams are read by slicing the
+// returned frame with link.Template.Returned. Once tmpl is reserved and no acyclic datagrams are queued,
+// a cycle does not allocate.
+// CycleTemplate must not be called concurrently with itself.
+//
+// Parameters:
+//   - ctx (context.Context): Context to cancel waiting
+//   - tmpl (*link.Template): Reserved Template, with the outputs written into its data
+//   - expect ([]Expectation): Expectation of each datagram, nil or shorter than the datagrams to skip checks
+//
+// Returns:
+//   - []byte: Returned Ethernet frame, valid until the next CycleTemplate
+//   - error: ErrNotReserved, ErrTimeout, an error if the frame could not be sent, or the joined
+//     Expectation errors together with the returned frame
+func (t *Transceiver) CycleTemplate(ctx context.Context, tmpl *link.Template, expect []Expectation) ([]byte, error) {
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		return nil, ErrClosed
+	}
+	r := t.reserved
+	if r == nil || r.template != tmpl {
+		t.mu.Unlock()
+		return nil, ErrNotReserved
+	}
+	// A return of an earlier cycle that came in after it had given up.
+	select {
+	case <-r.returned:
+	default:
+	}
+	r.set = 1 - r.set
+	for i, index := range r.indices[r.set] {
+		tmpl.SetIndex(i, index)
+	}
+	r.pending = true
+	rest := t.flush()
+	t.mu.Unlock()
+
+	if err := t.send(tmpl.Frame()); err != nil {
+		t.abandon(r, false)
+		return nil, err
+	}
+	t.sendFrames(rest)
+
+	r.timer.Reset(t.timeout)
+	defer stopTimer(r.timer)
+	select {
+	case ethernet := <-r.returned:
+		return ethernet, t.check(r, ethernet, expect)
+	case <-r.timer.C:
+		t.abandon(r, true)
+		return nil, ErrTimeout
+	case <-ctx.Done():
+		t.abandon(r, false)
+		return nil, ctx.Err()
+	case <-t.done:
+		return nil, ErrClosed
+	}
+}
+
+// check checks the returned datagrams of a Template against their Expectations.
+func (t *Transceiver) check(r *reservation, ethernet []byte, expect []Expectation) error {
+	var errs []error
+	for i, e := range expect {
+		if e == nil || i >= len(r.sent) {
+			continue
+		}
+		d := r.sent[i]
+		_, d.WKC = r.template.Returned(ethernet, i)
+		if err := e.Check(d); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+
+	t.mu.Lock()
+	for _, err := range errs {
+		if errors.Is(err, ErrWKCMismatch) {
+			t.stats.WKCMismatches++
+		}
+	}
+	t.mu.Unlock()
+	return errors.Join(errs...)
+}
+
+// abandon stops waiting for the frame of a Template, counting it as lost if it timed out.
+func (t *Transceiver) abandon(r *reservation, timedOut bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	r.pending = false
+	if timedOut {
+		t.stats.Timeouts += uint64(len(r.sent))
+		t.stats.LostFrames++
+	}
+}
+
+// returnTemplate delivers ethernet if it is the return of the reserved Template.
+// It reports whether ethernet was the return, including late ones of this or the previous cycle,
+// which are counted and dropped.
+func (t *Transceiver) returnTemplate(ethernet []byte) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	r := t.reserved
+	if r == nil {
+		return false
+	}
+	current := r.template.MatchIndices(ethernet, r.indices[r.set])
+	if !current && !r.template.MatchIndices(ethernet, r.indices[1-r.set]) {
+		return false
+	}
+	t.stats.FramesReceived++
+	if !current || !r.pending {
+		t.stats.LateFrames++
+		return true
+	}
+	r.pending = false
+	r.returned <- ethernet
+	return true
+}
+
+// stopTimer stops timer and drains its channel, so that it can be Reset.
+func stopTimer(timer *time.Timer) {
+	if !timer.Stop() {
+		select {
+		case <-timer.C:
+		default:
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package transceiver_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Aruminium/goecat/pkg/ethercat/datagram"
+	"github.com/Aruminium/goecat/pkg/ethercat/payload"
+	"github.com/Aruminium/goecat/pkg/link"
+	"github.com/Aruminium/goecat/pkg/transceiver"
+)
+
+// loopback returns every frame unchanged without allocating, alternating between two buffers.
+type loopback struct {
+	buffers [2][]byte
+	next    int
+	frames  chan []byte
+	done    chan struct{}
+}
+
+func newLoopback() *loopback {
+	return &loopback{frames: make(chan []byte, 1), done: make(chan struct{})}
+}
+
+func (l *loopback) Send(frame []byte) error {
+	buffer := append(l.buffers[l.next][:0], frame...)
+	l.buffers[l.next], l.next = buffer, 1-l.next
+	l.frames <- buffer
+	return nil
+}
+
+func (l *loopback) Receive() ([]byte, error) {
+	select {
+	case frame := <-l.frames:
+		return frame, nil
+	case <-l.done:
+		return nil, link.ErrClosed
+	}
+}
+
+func (l *loopback) Close() error {
+	close(l.done)
+	return nil
+}
+
+func TestCycleTemplate(t *testing.T) {
+	// given
+	master, segment := link.Pipe()
+	go echo(t, segment, nil)
+	tr := transceiver.New(master, transceiver.Options{Encapsulation: encap})
+	defer tr.Close()
+	tmpl, err := link.NewTemplate(encap, datagram.LRW(0x10000, payload.BasicPayload{Data: make([]byte, 4)}))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := tr.Reserve(tmpl); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	tr.SetCyclic(true)
+
+	// when
+	copy(tmpl.Data(0), []byte{1, 2, 3, 4})
+	acyclic := tr.Submit(datagram.FPRD(0x1001, 0x0130, 2))
+	ethernet, cycleErr := tr.CycleTemplate(context.Background(), tmpl, []transceiver.Expectation{transceiver.ExpectWKC(1)})
+	data, wkc := tmpl.Returned(ethernet, 0)
+	result := <-acyclic
+	_, mismatchErr := tr.CycleTemplate(context.Background(), tmpl, []transceiver.Expectation{transceiver.ExpectWKC(3)})
+
+	// then
+	if cycleErr != nil || result.Err != nil {
+		t.Fatalf("Unexpected errors: %v, %v", cycleErr, result.Err)
+	}
+	if !reflect.DeepEqual(data, []byte{1, 2, 3, 4}) || wkc != 1 {
+		t.Errorf("Expected the outputs back with WKC 1, but got %v with WKC %d", data, wkc)
+	}
+	if result.Datagram.Index == tmpl.Index(0) {
+		t.Errorf("Expected the acyclic datagram not to use the reserved index %d", tmpl.Index(0))
+	}
+	if !errors.Is(mismatchErr, transceiver.ErrWKCMismatch) {
+		t.Errorf("Expected a WKC mismatch, but got %v", mismatchErr)
+	}
+	if stats := tr.Stats(); stats.FramesSent != 3 || stats.FramesReceived != 3 || stats.WKCMismatches != 1 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+}
+
+// delayFirst returns every frame unchanged, but holds the first one back until the second is sent.
+type delayFirst struct {
+	held   []byte
+	sent   int
+	frames chan []byte
+	done   chan struct{}
+}
+
+func (l *delayFirst) Send(frame []byte) error {
+	frame = append([]byte{}, frame...)
+	l.sent++
+	switch l.sent {
+	case 1:
+		l.held = frame
+		return nil
+	case 2:
+		l.frames <- l.held
+	}
+	l.frames <- frame
+	return nil
+}
+
+func (l *delayFirst) Receive() ([]byte, error) {
+	select {
+	case frame := <-l.frames:
+		return frame, nil
+	case <-l.done:
+		return nil, link.ErrClosed
+	}
+}
+
+func (l *delayFirst) Close() error {
+	close(l.done)
+	return nil
+}
+
+func TestCycleTemplateLateReturn(t *testing.T) {
+	// given
+	tr := transceiver.New(&delayFirst{frames: make(chan []byte, 2), done: make(chan struct{})}, transceiver.Options{
+		Encapsulation: encap,
+		Timeout:       20 * time.Millisecond,
+	})
+	defer tr.Close()
+	tmpl, _ := link.NewTemplate(encap, datagram.LRW(0, payload.BasicPayload{Data: make([]byte, 1)}))
+	tr.Reserve(tmpl)
+	tr.SetCyclic(true)
+	ctx := context.Background()
+
+	// when
+	tmpl.Data(0)[0] = 1
+	_, lateErr := tr.CycleTemplate(ctx, tmpl, nil)
+	tmpl.Data(0)[0] = 2
+	ethernet, err := tr.CycleTemplate(ctx, tmpl, nil)
+
+	// then
+	if !errors.Is(lateErr, transceiver.ErrTimeout) {
+		t.Errorf("Expected %v, but got %v", transceiver.ErrTimeout, lateErr)
+	}
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if data, _ := tmpl.Returned(ethernet, 0); !reflect.DeepEqual(data, []byte{2}) {
+		t.Errorf("Expected the outputs of the second cycle back, but got % x", data)
+	}
+	if stats := tr.Stats(); stats.LateFrames != 1 || stats.LostFrames != 1 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+}
+
+func TestCycleTemplateNotReserved(t *testing.T) {
+	// given
+	tr := transceiver.New(newLoopback(), transceiver.Options{Encapsulation: encap})
+	defer tr.Close()
+	tmpl, _ := link.NewTemplate(encap, datagram.LRW(0, payload.BasicPayload{Data: make([]byte, 4)}))
+	tr.Reserve(tmpl)
+	tr.Release(tmpl)
+
+	// when
+	_, err := tr.CycleTemplate(context.Background(), tmpl, nil)
+
+	// then
+	if !errors.Is(err, transceiver.ErrNotReserved) {
+		t.Errorf("Expected ErrNotReserved, but got %v", err)
+	}
+}
+
+func TestCycleTemplateDoesNotAllocate(t *testing.T) {
+	// given
+	tr := transceiver.New(newLoopback(), transceiver.Options{Encapsulation: encap})
+	defer tr.Close()
+	tmpl, _ := link.NewTemplate(encap, datagram.LRW(0, payload.BasicPayload{Data: make([]byte, 64)}), datagram.ARMW(0, 0x0910, 8))
+	tr.Reserve(tmpl)
+	tr.SetCyclic(true)
+	expect := []transceiver.Expectation{transceiver.ExpectWKC(0), transceiver.ExpectWKC(0)}
+	ctx := context.Background()
+	var err error
+
+	// when
+	allocs := testing.AllocsPerRun(100, func() {
+		tmpl.Data(0)[0]++
+		_, err = tr.CycleTemplate(ctx, tmpl, expect)
+	})
+
+	// then
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if allocs != 0 {
+		t.Errorf("Expected no allocations per cycle, but got %v", allocs)
+	}
+}
+
+func BenchmarkCycle(b *testing.B) {
+	tr := transceiver.New(newLoopback(), transceiver.Options{Encapsulation: encap})
+	defer tr.Close()
+	tr.SetCyclic(true)
+	datagrams := []datagram.Datagram{datagram.LRW(0, payload.BasicPayload{Data: make([]byte, 64)}), datagram.ARMW(0, 0x0910, 8)}
+	ctx := context.Background()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := tr.Cycle(ctx, datagrams); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkCycleTemplate(b *testing.B) {
+	tr := transceiver.New(newLoopback(), transceiver.Options{Encapsulation: encap})
+	defer tr.Close()
+	tmpl, _ := link.NewTemplate(encap, datagram.LRW(0, payload.BasicPayload{Data: make([]byte, 64)}), datagram.ARMW(0, 0x0910, 8))
+	tr.Reserve(tmpl)
+	tr.SetCyclic(true)
+	ctx := context.Background()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := tr.CycleTemplate(ctx, tmpl, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
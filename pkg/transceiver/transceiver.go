@@ -0,0 +1,627 @@
+// Package transceiver exchanges EtherCAT datagrams over a link.Link and is safe for concurrent use.
+//
+// Acyclic datagrams are submitted from any goroutine and their results are delivered on a channel.
+// While cyclic mode is on, queued acyclic datagrams are piggybacked onto the cyclic frame when
+// there is room; the rest, and all datagrams outside cyclic mode, are sent in their own frames.
+//
+// Datagram indices come from a frame.IndexPool, so an index is not reused while its datagram is
+// in flight and duplicate or late returns are detected and counted in Stats.
+package transceiver
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/Aruminium/goecat/pkg/ethercat"
+	"github.com/Aruminium/goecat/pkg/ethercat/command"
+	"github.com/Aruminium/goecat/pkg/ethercat/datagram"
+	"github.com/Aruminium/goecat/pkg/ethercat/frame"
+	"github.com/Aruminium/goecat/pkg/link"
+)
+
+var (
+	ErrClosed  = errors.New("transceiver is closed")
+	ErrTimeout = errors.New("datagram was not returned in time")
+)
+
+// DefaultTimeout is used when Options.Timeout is zero.
+const DefaultTimeout = 100 * time.Millisecond
+
+// Options configures a Transceiver.
+type Options struct {
+	Encapsulation link.Encapsulation // How EtherCAT frames are carried in Ethernet frames
+	Timeout       time.Duration      // Time to wait for a sent datagram to return
+	Retry         RetryPolicy        // Policy for timed-out acyclic datagrams, NoRetry if nil
+}
+
+// Result is the outcome of a submitted datagram.
+type Result struct {
+	Datagram datagram.Datagram // Returned datagram with the data and WKC filled in by the slaves
+	Err      error             // Error if the datagram could not be exchanged or failed its Expectation
+}
+
+// request is a datagram waiting to be sent or returned.
+type request struct {
+	d         datagram.Datagram
+	expect    Expectation
+	cyclic    bool
+	noRetry   bool // Fail on the first timeout, set by WithoutRetry
+	cancelled bool // The caller gave up waiting; neither sent again nor retried
+	attempts  int
+	result    chan Result
+}
+
+// sentFrame tracks how many datagrams of a frame have returned, to detect lost frames.
+type sentFrame struct {
+	returned int
+}
+
+// flight is a datagram in flight.
+type flight struct {
+	req   *request
+	frame *sentFrame
+}
+
+// Exchanger sends a datagram and returns it as it came back from the segment.
+// Transceiver implements it; the packages that talk to the slaves depend on it instead.
+type Exchanger interface {
+	Exchange(ctx context.Context, d datagram.Datagram) (datagram.Datagram, error)
+	ExchangeExpect(ctx context.Context, d datagram.Datagram, expect Expectation) (datagram.Datagram, error)
+}
+
+// Transceiver sends datagrams over a link and matches the returned datagrams by index.
+type Transceiver struct {
+	link    link.Link
+	encap   link.Encapsulation
+	timeout time.Duration
+	retry   RetryPolicy
+
+	mu        sync.Mutex
+	pool      *frame.IndexPool
+	scheduler *frame.Scheduler
+	queue     []*request // Requests in the same order as the datagrams queued in scheduler
+	inflight  map[uint8]flight
+	cyclic    bool
+	closed    bool
+	stats     Stats
+
+	reserved *reservation // Template reserved for CycleTemplate, nil if none
+
+	sendMu sync.Mutex // Serializes Send on the link and guards buffer
+	buffer []byte     // Reused for the Ethernet frame of every write
+
+	kick chan struct{}
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// New creates a Transceiver on l and starts its receive and send goroutines.
+//
+// Parameters:
+//   - l (link.Link): Link to exchange Ethernet frames on
+//   - opts (Options): Encapsulation, timeout and retry policy
+//
+// Returns:
+//   - *Transceiver: New Transceiver; Close it to stop the goroutines
+func New(l link.Link, opts Options) *Transceiver {
+	if opts.Timeout == 0 {
+		opts.Timeout = DefaultTimeout
+	}
+	if opts.Retry == nil {
+		opts.Retry = NoRetry{}
+	}
+
+	pool := frame.NewIndexPool()
+	t := &Transceiver{
+		link:      l,
+		encap:     opts.Encapsulation,
+		timeout:   opts.Timeout,
+		retry:     opts.Retry,
+		pool:      pool,
+		scheduler: frame.NewSchedulerWithIndices(opts.Encapsulation.Overhead(), pool),
+		inflight:  map[uint8]flight{},
+		kick:      make(chan struct{}, 1),
+		done:      make(chan struct{}),
+	}
+
+	t.wg.Add(2)
+	go t.receiveLoop()
+	go t.sendLoop()
+	return t
+}
+
+// Submit queues an acyclic datagram and returns a channel that receives its result.
+// The Index of d is assigned by the Transceiver.
+//
+// Parameters:
+//   - d (datagram.Datagram): Datagram to exchange
+//
+// Returns:
+//   - <-chan Result: Channel that receives exactly one Result
+func (t *Transceiver) Submit(d datagram.Datagram) <-chan Result {
+	return t.SubmitExpect(d, nil)
+}
+
+// SubmitExpect queues an acyclic datagram that must meet expect when it returns.
+//
+// Parameters:
+//   - d (datagram.Datagram): Datagram to exchange
+//   - expect (Expectation): Check of the returned datagram, or nil
+//
+// Returns:
+//   - <-chan Result: Channel that receives exactly one Result
+func (t *Transceiver) SubmitExpect(d datagram.Datagram, expect Expectation) <-chan Result {
+	return t.submit(&request{d: d, expect: expect, result: make(chan Result, 1)})
+}
+
+// submit queues an acyclic request.
+func (t *Transceiver) submit(req *request) <-chan Result {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		req.result <- Result{Err: ErrClosed}
+		return req.result
+	}
+	if err := t.enqueue(req); err != nil {
+		req.result <- Result{Err: err}
+	}
+	return req.result
+}
+
+// Exchange submits an acyclic datagram and waits for its result.
+//
+// Parameters:
+//   - ctx (context.Context): Context to cancel waiting
+//   - d (datagram.Datagram): Datagram to exchange
+//
+// Returns:
+//   - datagram.Datagram: Returned datagram
+//   - error: Error if the datagram timed out, the transceiver was closed or ctx was done
+func (t *Transceiver) Exchange(ctx context.Context, d datagram.Datagram) (datagram.Datagram, error) {
+	return t.ExchangeExpect(ctx, d, nil)
+}
+
+// ExchangeExpect submits an acyclic datagram that must meet expect and waits for its result.
+// If the datagram returns but fails expect, both the datagram and the error are returned.
+// A context from WithoutRetry fails the datagram on its first timeout.
+// When ctx is done, a datagram that is still queued is never sent and one in flight is not retried.
+// A datagram in flight may still have reached the slaves and taken effect.
+//
+// Parameters:
+//   - ctx (context.Context): Context to cancel waiting
+//   - d (datagram.Datagram): Datagram to exchange
+//   - expect (Expectation): Check of the returned datagram, or nil
+//
+// Returns:
+//   - datagram.Datagram: Returned datagram
+//   - error: Error if the datagram failed, the transceiver was closed or ctx was done
+func (t *Transceiver) ExchangeExpect(ctx context.Context, d datagram.Datagram, expect Expectation) (datagram.Datagram, error) {
+	req := &request{d: d, expect: expect, noRetry: ctx.Value(withoutRetry{}) != nil, result: make(chan Result, 1)}
+	select {
+	case r := <-t.submit(req):
+		return r.Datagram, r.Err
+	case <-ctx.Done():
+		t.cancel(req)
+		return datagram.Datagram{}, ctx.Err()
+	}
+}
+
+// cancel removes req from the queue if it has not been sent yet, and keeps it from being retried otherwise.
+func (t *Transceiver) cancel(req *request) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	req.cancelled = true
+	for i, queued := range t.queue {
+		if queued == req {
+			t.queue = append(t.queue[:i:i], t.queue[i+1:]...)
+			t.scheduler.Remove(i)
+			return
+		}
+	}
+}
+
+// SetCyclic turns cyclic mode on or off.
+// In cyclic mode queued acyclic datagrams wait for the next Cycle instead of being sent immediately.
+//
+// Parameters:
+//   - on (bool): Whether cyclic mode is on
+func (t *Transceiver) SetCyclic(on bool) {
+	t.mu.Lock()
+	t.cyclic = on
+	t.mu.Unlock()
+
+	if !on {
+		t.wake()
+	}
+}
+
+// Cycle sends the cyclic datagrams in one frame, piggybacking queued acyclic datagrams when
+// there is room, and waits for the cyclic datagrams to return.
+// Acyclic datagrams that did not fit are sent in their own frames afterwards.
+// Only the encoding of the frame reuses a buffer: every cycle still allocates its requests and parses
+// the returned frame into new datagrams. Use Reserve and CycleTemplate for a cycle that does not allocate.
+//
+// Parameters:
+//   - ctx (context.Context): Context to cancel waiting
+//   - datagrams ([]datagram.Datagram): Cyclic datagrams, such as LRW process data
+//
+// Returns:
+//   - []datagram.Datagram: Returned cyclic datagrams in the same order
+//   - error: Error if the frame could not be sent or a datagram did not return
+func (t *Transceiver) Cycle(ctx context.Context, datagrams []datagram.Datagram) ([]datagram.Datagram, error) {
+	return t.CycleExpect(ctx, datagrams, nil)
+}
+
+// CycleExpect is Cycle with an Expectation per cyclic datagram.
+// If datagrams return but fail their Expectation, the datagrams are returned together with the errors.
+//
+// Parameters:
+//   - ctx (context.Context): Context to cancel waiting
+//   - datagrams ([]datagram.Datagram): Cyclic datagrams, such as LRW process data
+//   - expect ([]Expectation): Expectation of each datagram, nil or shorter than datagrams to skip checks
+//
+// Returns:
+//   - []datagram.Datagram: Returned cyclic datagrams in the same order
+//   - error: Error if a datagram did not return, or the joined Expectation errors
+func (t *Transceiver) CycleExpect(ctx context.Context, datagrams []datagram.Datagram, expect []Expectation) ([]datagram.Datagram, error) {
+	cyclic := make([]*request, len(datagrams))
+	for i, d := range datagrams {
+		cyclic[i] = &request{d: d, cyclic: true, result: make(chan Result, 1)}
+		if i < len(expect) {
+			cyclic[i].expect = expect[i]
+		}
+	}
+
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		return nil, ErrClosed
+	}
+	f, err := t.scheduler.NextWith(datagrams...)
+	if err != nil {
+		for _, index := range f.Indices {
+			t.pool.Expire(index)
+		}
+		t.mu.Unlock()
+		return nil, err
+	}
+	if len(f.Indices) > 0 {
+		t.register(f, append(cyclic, t.dequeue(len(f.Indices)-len(cyclic))...))
+	}
+	rest := t.flush()
+	t.mu.Unlock()
+
+	if len(f.Indices) > 0 {
+		if err := t.write(f); err != nil {
+			return nil, err
+		}
+	}
+	t.sendFrames(rest)
+
+	result := make([]datagram.Datagram, len(cyclic))
+	var errs []error
+	for i, req := range cyclic {
+		select {
+		case r := <-req.result:
+			if r.Err != nil && !errors.Is(r.Err, ErrWKCMismatch) {
+				return nil, r.Err
+			}
+			result[i] = r.Datagram
+			errs = append(errs, r.Err)
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return result, errors.Join(errs...)
+}
+
+// Stats returns a snapshot of the counters.
+func (t *Transceiver) Stats() Stats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.stats
+}
+
+// Close stops the Transceiver and the underlying link.
+// Pending datagrams receive ErrClosed.
+//
+// Returns:
+//   - error: Error returned by closing the link
+func (t *Transceiver) Close() error {
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		return nil
+	}
+	t.closed = true
+	close(t.done)
+
+	pending := t.queue
+	t.queue = nil
+	for index, f := range t.inflight {
+		pending = append(pending, f.req)
+		delete(t.inflight, index)
+	}
+	t.mu.Unlock()
+
+	for _, req := range pending {
+		req.result <- Result{Err: ErrClosed}
+	}
+
+	err := t.link.Close()
+	t.wg.Wait()
+	return err
+}
+
+// wake signals the send goroutine that there may be datagrams to send.
+func (t *Transceiver) wake() {
+	select {
+	case t.kick <- struct{}{}:
+	default:
+	}
+}
+
+// enqueue adds req to the acyclic queue. It must be called with mu held.
+func (t *Transceiver) enqueue(req *request) error {
+	if err := t.scheduler.Enqueue(req.d); err != nil {
+		return err
+	}
+	t.queue = append(t.queue, req)
+	t.wake()
+	return nil
+}
+
+// dequeue removes the first n requests from the queue. It must be called with mu held.
+func (t *Transceiver) dequeue(n int) []*request {
+	reqs := t.queue[:n:n]
+	t.queue = t.queue[n:]
+	return reqs
+}
+
+// flush packs queued datagrams into frames and registers them as in flight.
+// It must be called with mu held; the returned frames are sent by sendFrames without mu.
+func (t *Transceiver) flush() []frame.Frame {
+	frames := t.scheduler.Flush()
+	for _, f := range frames {
+		t.register(f, t.dequeue(len(f.Indices)))
+	}
+	return frames
+}
+
+// register marks the datagrams of f as in flight and arms their timeout. It must be called with mu held.
+func (t *Transceiver) register(f frame.Frame, reqs []*request) {
+	sent := &sentFrame{}
+	for i, index := range f.Indices {
+		reqs[i].attempts++
+		t.inflight[index] = flight{req: reqs[i], frame: sent}
+	}
+
+	indices := f.Indices
+	time.AfterFunc(t.timeout, func() { t.expire(indices, reqs, sent) })
+}
+
+// sendFrames writes frames that have been registered by flush.
+// Write errors are reported when the datagrams time out.
+func (t *Transceiver) sendFrames(frames []frame.Frame) {
+	for _, f := range frames {
+		_ = t.write(f)
+	}
+}
+
+// write encodes f into the reusable buffer and sends it, so encoding does not allocate once the buffer has
+// grown to the largest frame. Building f and parsing its return still allocate; see CycleTemplate.
+func (t *Transceiver) write(f frame.Frame) error {
+	t.sendMu.Lock()
+	defer t.sendMu.Unlock()
+
+	ethernet, err := t.encap.AppendTo(t.buffer[:0], f.Ecat)
+	if err != nil {
+		return err
+	}
+	t.buffer = ethernet
+	return t.sendLocked(ethernet)
+}
+
+// send sends an encoded Ethernet frame.
+func (t *Transceiver) send(ethernet []byte) error {
+	t.sendMu.Lock()
+	defer t.sendMu.Unlock()
+
+	return t.sendLocked(ethernet)
+}
+
+// sendLocked sends an Ethernet frame and counts it. It must be called with sendMu held.
+func (t *Transceiver) sendLocked(ethernet []byte) error {
+	if err := t.link.Send(ethernet); err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	t.stats.FramesSent++
+	t.mu.Unlock()
+	return nil
+}
+
+// expire fails or retries the datagrams of a frame that are still in flight after the timeout.
+func (t *Transceiver) expire(indices []uint8, reqs []*request, sent *sentFrame) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	expired := 0
+	for i, index := range indices {
+		f, ok := t.inflight[index]
+		if !ok || f.req != reqs[i] {
+			continue
+		}
+		delete(t.inflight, index)
+		t.pool.Expire(index)
+		t.stats.Timeouts++
+		expired++
+
+		t.retryOrFail(reqs[i])
+	}
+
+	if expired > 0 && sent.returned == 0 {
+		t.stats.LostFrames++
+	}
+	if expired > 0 {
+		t.wake()
+	}
+}
+
+// retryOrFail queues req again if the RetryPolicy allows it, otherwise fails it with ErrTimeout.
+// It must be called with mu held.
+func (t *Transceiver) retryOrFail(req *request) {
+	if req.cyclic || req.noRetry || req.cancelled || t.closed {
+		req.result <- Result{Err: ErrTimeout}
+		return
+	}
+
+	retry, delay := t.retry.Retry(req.d, req.attempts)
+	if !retry {
+		req.result <- Result{Err: ErrTimeout}
+		return
+	}
+
+	t.stats.Retries++
+	time.AfterFunc(delay, func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+
+		if t.closed {
+			req.result <- Result{Err: ErrClosed}
+			return
+		}
+		if req.cancelled {
+			return
+		}
+		if err := t.enqueue(req); err != nil {
+			req.result <- Result{Err: err}
+		}
+	})
+}
+
+// sendLoop sends queued acyclic datagrams in their own frames while cyclic mode is off.
+func (t *Transceiver) sendLoop() {
+	defer t.wg.Done()
+
+	for {
+		select {
+		case <-t.done:
+			return
+		case <-t.kick:
+		}
+
+		t.mu.Lock()
+		var frames []frame.Frame
+		if !t.cyclic && !t.closed {
+			frames = t.flush()
+		}
+		t.mu.Unlock()
+
+		t.sendFrames(frames)
+	}
+}
+
+// receiveLoop reads frames from the link and delivers the returned datagrams.
+func (t *Transceiver) receiveLoop() {
+	defer t.wg.Done()
+
+	for {
+		ethernet, err := t.link.Receive()
+		if err != nil {
+			select {
+			case <-t.done:
+				return
+			default:
+			}
+			if errors.Is(err, link.ErrClosed) {
+				return
+			}
+			continue
+		}
+		if t.returnTemplate(ethernet) {
+			continue
+		}
+
+		payload, err := link.Decapsulate(ethernet)
+		if err != nil {
+			continue
+		}
+		ecat, err := ethercat.Parse(payload)
+		if err != nil {
+			continue
+		}
+		t.deliver(ecat.Datagrams())
+	}
+}
+
+// deliver hands returned datagrams to the requests waiting for their index.
+func (t *Transceiver) deliver(datagrams []datagram.Datagram) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.stats.FramesReceived++
+	late, duplicate, returned := false, false, false
+	for _, d := range datagrams {
+		f, ok := t.inflight[d.Index]
+		if !ok {
+			switch t.pool.State(d.Index) {
+			case frame.Expired:
+				late = true
+			case frame.Returned:
+				duplicate = true
+			}
+			continue
+		}
+		if !sameDatagram(f.req.d, d) {
+			// A late return of an older datagram whose index has been reused.
+			late = true
+			continue
+		}
+
+		delete(t.inflight, d.Index)
+		t.pool.Return(d.Index)
+		f.frame.returned++
+		returned = true
+
+		var err error
+		if f.req.expect != nil {
+			err = f.req.expect.Check(d)
+		}
+		if errors.Is(err, ErrWKCMismatch) {
+			t.stats.WKCMismatches++
+		}
+		f.req.result <- Result{Datagram: d, Err: err}
+	}
+
+	if late {
+		t.stats.LateFrames++
+	}
+	if duplicate {
+		t.stats.DuplicateFrames++
+	}
+	if returned {
+		t.wake()
+	}
+}
+
+// sameDatagram reports whether returned can be the return of sent.
+// Slaves increment ADP of auto increment and broadcast datagrams, so only ADO is compared for them.
+func sameDatagram(sent datagram.Datagram, returned datagram.Datagram) bool {
+	if sent.Command != returned.Command || sent.LRCM.Len != returned.LRCM.Len {
+		return false
+	}
+
+	switch sent.Addressing() {
+	case command.AutoIncrement, command.Broadcast:
+		return sent.ADO() == returned.ADO()
+	default:
+		return sent.Address == returned.Address
+	}
+}
@@ -0,0 +1,206 @@
+package transceiver_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Aruminium/goecat/pkg/ethercat"
+	"github.com/Aruminium/goecat/pkg/ethercat/datagram"
+	"github.com/Aruminium/goecat/pkg/ethercat/payload"
+	"github.com/Aruminium/goecat/pkg/link"
+	"github.com/Aruminium/goecat/pkg/transceiver"
+)
+
+var encap = link.Encapsulation{Transport: link.Raw, SrcMAC: net.HardwareAddr{0x02, 0, 0, 0, 0, 1}}
+
+// echo returns every frame with the WKC of each datagram incremented and counts the frames.
+func echo(t *testing.T, l link.Link, frames chan<- int) {
+	for {
+		ethernet, err := l.Receive()
+		if err != nil {
+			return
+		}
+		data, err := link.Decapsulate(ethernet)
+		if err != nil {
+			t.Errorf("Unexpected error: %v", err)
+			return
+		}
+		ecat, err := ethercat.Parse(data)
+		if err != nil {
+			t.Errorf("Unexpected error: %v", err)
+			return
+		}
+
+		response := ethercat.NewEtherCAT()
+		for _, d := range ecat.Datagrams() {
+			d.WKC++
+			response.AppendDatagram(d)
+		}
+		ethernet, _ = encap.Encapsulate(response.Bytes())
+		l.Send(ethernet)
+
+		if frames != nil {
+			frames <- len(ecat.Datagrams())
+		}
+	}
+}
+
+func TestConcurrentExchange(t *testing.T) {
+	// given
+	master, segment := link.Pipe()
+	go echo(t, segment, nil)
+	tr := transceiver.New(master, transceiver.Options{Encapsulation: encap})
+	defer tr.Close()
+
+	// when
+	var wg sync.WaitGroup
+	for i := 0; i < 32; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			d, err := tr.Exchange(context.Background(), datagram.FPRD(uint16(0x1000+i), 0x0130, 2))
+
+			// then
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+				return
+			}
+			if d.WKC != 1 || d.Station() != uint16(0x1000+i) {
+				t.Errorf("Unexpected datagram returned: %+v", d)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestCyclePiggybacksAcyclic(t *testing.T) {
+	// given
+	master, segment := link.Pipe()
+	frames := make(chan int, 8)
+	go echo(t, segment, frames)
+	tr := transceiver.New(master, transceiver.Options{Encapsulation: encap})
+	defer tr.Close()
+	tr.SetCyclic(true)
+
+	acyclic := tr.Submit(datagram.BRD(0x0130, 2))
+
+	// when
+	result, err := tr.Cycle(context.Background(), []datagram.Datagram{
+		datagram.LRW(0, payload.BasicPayload{Data: make([]byte, 32)}),
+	})
+
+	// then
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(result) != 1 || result[0].WKC != 1 {
+		t.Errorf("Unexpected cyclic result: %+v", result)
+	}
+	if r := <-acyclic; r.Err != nil || r.Datagram.WKC != 1 {
+		t.Errorf("Unexpected acyclic result: %+v", r)
+	}
+	if n := <-frames; n != 2 {
+		t.Errorf("Expected both datagrams in one frame, but got %d", n)
+	}
+}
+
+func TestCancelledExchangeIsNotSent(t *testing.T) {
+	// given
+	master, segment := link.Pipe()
+	frames := make(chan int, 8)
+	go echo(t, segment, frames)
+	tr := transceiver.New(master, transceiver.Options{Encapsulation: encap})
+	defer tr.Close()
+	tr.SetCyclic(true)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := tr.Exchange(ctx, datagram.FPWR(0x1001, 0x0120, payload.BasicPayload{Data: []byte{0x02, 0x00}}))
+
+	// when
+	_, cycleErr := tr.Cycle(context.Background(), []datagram.Datagram{
+		datagram.LRW(0, payload.BasicPayload{Data: make([]byte, 32)}),
+	})
+
+	// then
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected %v, but got %v", context.DeadlineExceeded, err)
+	}
+	if cycleErr != nil {
+		t.Fatalf("Unexpected error: %v", cycleErr)
+	}
+	if n := <-frames; n != 1 {
+		t.Errorf("Expected only the cyclic datagram in the frame, but got %d datagrams", n)
+	}
+	select {
+	case n := <-frames:
+		t.Errorf("Expected no further frame, but got one with %d datagrams", n)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestWithoutRetry(t *testing.T) {
+	// given
+	master, segment := link.Pipe()
+	go func() {
+		// drop the first frame, answer the rest
+		if _, err := segment.Receive(); err != nil {
+			return
+		}
+		echo(t, segment, nil)
+	}()
+	tr := transceiver.New(master, transceiver.Options{
+		Encapsulation: encap,
+		Timeout:       20 * time.Millisecond,
+		Retry:         transceiver.FixedRetry{Max: 2, ReadOnly: true},
+	})
+	defer tr.Close()
+
+	// when
+	_, err := tr.Exchange(transceiver.WithoutRetry(context.Background()), datagram.FPRD(0x1001, 0x1080, 128))
+
+	// then
+	if !errors.Is(err, transceiver.ErrTimeout) {
+		t.Errorf("Expected %v, but got %v", transceiver.ErrTimeout, err)
+	}
+	if stats := tr.Stats(); stats.Retries != 0 || stats.LostFrames != 1 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+}
+
+func TestRetryAndLostFrames(t *testing.T) {
+	// given
+	master, segment := link.Pipe()
+	dropped := false
+	go func() {
+		// drop the first frame, answer the rest
+		ethernet, err := segment.Receive()
+		if err != nil {
+			return
+		}
+		dropped = len(ethernet) > 0
+		echo(t, segment, nil)
+	}()
+	tr := transceiver.New(master, transceiver.Options{
+		Encapsulation: encap,
+		Timeout:       20 * time.Millisecond,
+		Retry:         transceiver.FixedRetry{Max: 2, ReadOnly: true},
+	})
+	defer tr.Close()
+
+	// when
+	d, err := tr.ExchangeExpect(context.Background(), datagram.BRD(0x0000, 1), transceiver.ExpectWKC(2))
+
+	// then
+	if !errors.Is(err, transceiver.ErrWKCMismatch) || d.WKC != 1 {
+		t.Errorf("Expected a WKC mismatch after the retry, but got %v (WKC %d)", err, d.WKC)
+	}
+	stats := tr.Stats()
+	if !dropped || stats.LostFrames != 1 || stats.Retries != 1 || stats.WKCMismatches != 1 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+}
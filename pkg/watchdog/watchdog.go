@@ -0,0 +1,296 @@
+// Package watchdog configures the PDI and process data watchdogs of the ESCs (0x0400-0x0443)
+// and reports their expirations.
+//
+// An ESC counts watchdog time in ticks of (divider + 2) * 40 ns. The process data watchdog
+// restarts whenever the master writes a SyncManager with the watchdog trigger enabled
+// (syncmanager.CtrlStatus.IsTriggerWatchdog), such as the outputs exchanged every cycle. When it
+// expires, the ESC disables the outputs and the slave usually drops to SAFE-OP with
+// al.SyncManagerWatchdog. The PDI watchdog restarts on every access of the slave application.
+//
+// Both watchdogs count their expirations, saturating at 255. A Monitor reads the counters
+// periodically and reports every expiration as an Event.
+package watchdog
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/Aruminium/goecat/pkg/ethercat/datagram"
+	"github.com/Aruminium/goecat/pkg/ethercat/payload"
+	"github.com/Aruminium/goecat/pkg/ethercat/register"
+	"github.com/Aruminium/goecat/pkg/scan"
+	"github.com/Aruminium/goecat/pkg/transceiver"
+)
+
+const (
+	// DefaultTick is the tick of the ESC default divider 2498, used when Config.Tick is zero.
+	DefaultTick = 100 * time.Microsecond
+
+	// unit is the clock period the divider counts.
+	unit = 40 * time.Nanosecond
+)
+
+// statusLength is the size of the register area from the process data watchdog status to the PDI watchdog counter.
+const statusLength = register.WatchdogCounterPDI + 1 - register.WatchdogStatusProcessData
+
+// Config configures the watchdogs of a slave.
+type Config struct {
+	Tick        time.Duration `yaml:"tick,omitempty"`        // Resolution, from 80 ns to 2.6 ms in 40 ns steps; DefaultTick if zero
+	PDI         time.Duration `yaml:"pdi,omitempty"`         // PDI watchdog time, disabled if zero
+	ProcessData time.Duration `yaml:"processData,omitempty"` // Process data watchdog time, disabled if zero
+}
+
+// Registers returns the register values of a configuration. Watchdog times are rounded up to
+// whole ticks.
+//
+// Returns:
+//   - uint16: Watchdog divider (0x0400)
+//   - uint16: PDI watchdog time (0x0410)
+//   - uint16: Process data watchdog time (0x0420)
+//   - error: Error if the tick or a time is out of range
+func (c Config) Registers() (uint16, uint16, uint16, error) {
+	tick := c.Tick
+	if tick == 0 {
+		tick = DefaultTick
+	}
+	divider := tick/unit - 2
+	if divider < 0 || divider > 0xffff {
+		return 0, 0, 0, fmt.Errorf("watchdog: tick %v out of range", tick)
+	}
+	tick = (divider + 2) * unit
+
+	ticks := func(name string, d time.Duration) (uint16, error) {
+		n := (d + tick - 1) / tick
+		if n < 0 || n > 0xffff {
+			return 0, fmt.Errorf("watchdog: %s time %v out of range for a tick of %v", name, d, tick)
+		}
+		return uint16(n), nil
+	}
+	pdi, err := ticks("PDI", c.PDI)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	processData, err := ticks("process data", c.ProcessData)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	return uint16(divider), pdi, processData, nil
+}
+
+// Configure writes the watchdog registers of a slave. The slave should be in INIT or PRE-OP,
+// as the new times apply from the next restart of a watchdog.
+//
+// Parameters:
+//   - ctx (context.Context): Context bounding the exchanges
+//   - x (transceiver.Exchanger): Transceiver of the segment
+//   - station (uint16): Configured station address of the slave
+//   - cfg (Config): Tick and watchdog times
+//
+// Returns:
+//   - error: Error if the configuration is out of range or the slave does not answer
+func Configure(ctx context.Context, x transceiver.Exchanger, station uint16, cfg Config) error {
+	divider, pdi, processData, err := cfg.Registers()
+	if err != nil {
+		return err
+	}
+	for _, w := range []struct {
+		address uint16
+		value   uint16
+	}{
+		{register.WatchdogDivider, divider},
+		{register.WatchdogTimePDI, pdi},
+		{register.WatchdogTimeProcessData, processData},
+	} {
+		data := payload.BasicPayload{Data: binary.LittleEndian.AppendUint16(nil, w.value)}
+		if _, err := x.ExchangeExpect(ctx, datagram.FPWR(station, w.address, data), transceiver.ExpectWKC(1)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Status holds the watchdog status and counters of one ESC.
+type Status struct {
+	ProcessDataExpired bool  // The process data watchdog has expired and the outputs are disabled (0x0440 bit 0 clear)
+	ProcessDataCount   uint8 // Process data watchdog expirations (0x0442)
+	PDICount           uint8 // PDI watchdog expirations (0x0443)
+}
+
+// ParseStatus decodes the watchdog status registers.
+//
+// Parameters:
+//   - data ([]byte): Registers 0x0440 to 0x0443
+//
+// Returns:
+//   - Status: Decoded status
+//   - error: Error if data is too short
+func ParseStatus(data []byte) (Status, error) {
+	if len(data) < int(statusLength) {
+		return Status{}, fmt.Errorf("watchdog: %d bytes of status, expected %d", len(data), statusLength)
+	}
+	return Status{
+		ProcessDataExpired: data[0]&0x01 == 0,
+		ProcessDataCount:   data[register.WatchdogCounterProcess-register.WatchdogStatusProcessData],
+		PDICount:           data[register.WatchdogCounterPDI-register.WatchdogStatusProcessData],
+	}, nil
+}
+
+// Read reads the watchdog status of a slave.
+//
+// Parameters:
+//   - ctx (context.Context): Context bounding the exchange
+//   - x (transceiver.Exchanger): Transceiver of the segment
+//   - station (uint16): Configured station address of the slave
+//
+// Returns:
+//   - Status: Watchdog status and counters
+//   - error: Error if the slave does not answer
+func Read(ctx context.Context, x transceiver.Exchanger, station uint16) (Status, error) {
+	d, err := x.ExchangeExpect(ctx, datagram.FPRD(station, register.WatchdogStatusProcessData, statusLength), transceiver.ExpectWKC(1))
+	if err != nil {
+		return Status{}, err
+	}
+	return ParseStatus(d.Data.Bytes())
+}
+
+// Kind is the watchdog that expired.
+type Kind int
+
+const (
+	ProcessData Kind = iota // Process data watchdog; the outputs are disabled
+	PDI                     // PDI watchdog; the slave application stopped accessing the ESC
+)
+
+func (k Kind) String() string {
+	switch k {
+	case ProcessData:
+		return "process data watchdog"
+	case PDI:
+		return "PDI watchdog"
+	default:
+		return fmt.Sprintf("Kind(%d)", int(k))
+	}
+}
+
+// Event reports expirations of a watchdog of a slave.
+type Event struct {
+	Time     time.Time // When the expirations were noticed
+	Position uint16
+	Station  uint16
+	Kind     Kind
+	Count    int // Expirations since the previous poll, at least 1
+}
+
+func (e Event) String() string {
+	s := fmt.Sprintf("slave %d: %v expired", e.Position, e.Kind)
+	if e.Count > 1 {
+		s += fmt.Sprintf(" %d times", e.Count)
+	}
+	if e.Kind == ProcessData {
+		s += ", outputs disabled"
+	}
+	return s
+}
+
+// Monitor polls the watchdog status of the slaves of a segment and turns new expirations into
+// events. It is not safe for concurrent use.
+type Monitor struct {
+	x      transceiver.Exchanger
+	slaves []scan.Slave
+	last   []Status // Status of the previous poll, nil before the first
+}
+
+// NewMonitor creates a Monitor for scanned slaves.
+//
+// Parameters:
+//   - x (transceiver.Exchanger): Transceiver of the segment
+//   - slaves ([]scan.Slave): Slaves to monitor, addressed by their station addresses
+//
+// Returns:
+//   - *Monitor: New monitor; the first Poll reports the expirations since power-up
+func NewMonitor(x transceiver.Exchanger, slaves []scan.Slave) *Monitor {
+	return &Monitor{x: x, slaves: slaves}
+}
+
+// Poll reads the watchdog status of every slave.
+//
+// An expiration is noticed by its counter or, once the counter saturated, by the process data
+// watchdog status changing to expired.
+//
+// Parameters:
+//   - ctx (context.Context): Context bounding the exchanges
+//
+// Returns:
+//   - []Event: Expirations since the previous poll, in the order of the slaves
+//   - error: Error if a slave does not answer
+func (m *Monitor) Poll(ctx context.Context) ([]Event, error) {
+	now := time.Now()
+	statuses := make([]Status, len(m.slaves))
+	var events []Event
+	for i, s := range m.slaves {
+		status, err := Read(ctx, m.x, s.Station)
+		if err != nil {
+			return nil, fmt.Errorf("watchdog: slave %d: %w", s.Position, err)
+		}
+		statuses[i] = status
+
+		var previous Status
+		if m.last != nil {
+			previous = m.last[i]
+		}
+		event := func(kind Kind, count int) {
+			events = append(events, Event{Time: now, Position: s.Position, Station: s.Station, Kind: kind, Count: count})
+		}
+		switch count := delta(status.ProcessDataCount, previous.ProcessDataCount); {
+		case count > 0:
+			event(ProcessData, count)
+		case status.ProcessDataExpired && !previous.ProcessDataExpired:
+			event(ProcessData, 1)
+		}
+		if count := delta(status.PDICount, previous.PDICount); count > 0 {
+			event(PDI, count)
+		}
+	}
+	m.last = statuses
+	return events, nil
+}
+
+// Run polls every interval and passes each event to report until ctx is done.
+//
+// Parameters:
+//   - ctx (context.Context): Context stopping the monitor
+//   - interval (time.Duration): Time between polls
+//   - report (func(Event)): Called with every event
+//
+// Returns:
+//   - error: ctx.Err() when ctx is done, or the error of a failed poll
+func (m *Monitor) Run(ctx context.Context, interval time.Duration, report func(Event)) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		events, err := m.Poll(ctx)
+		if err != nil {
+			return err
+		}
+		for _, e := range events {
+			report(e)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// delta returns the increase of a counter. A counter lower than before has been cleared in
+// between, so its increase is its current value.
+func delta(now uint8, before uint8) int {
+	if now < before {
+		return int(now)
+	}
+	return int(now - before)
+}
@@ -0,0 +1,140 @@
+package watchdog_test
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Aruminium/goecat/pkg/ethercat/al"
+	"github.com/Aruminium/goecat/pkg/ethercat/datagram"
+	"github.com/Aruminium/goecat/pkg/ethercat/payload"
+	"github.com/Aruminium/goecat/pkg/ethercat/payload/syncmanager"
+	"github.com/Aruminium/goecat/pkg/ethercat/register"
+	"github.com/Aruminium/goecat/pkg/ethercat/sii"
+	"github.com/Aruminium/goecat/pkg/link"
+	"github.com/Aruminium/goecat/pkg/scan"
+	"github.com/Aruminium/goecat/pkg/simulator"
+	"github.com/Aruminium/goecat/pkg/transceiver"
+	"github.com/Aruminium/goecat/pkg/watchdog"
+)
+
+var encap = link.Encapsulation{Transport: link.Raw, SrcMAC: net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, 0x55}}
+
+func TestRegisters(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		cfg      watchdog.Config
+		expected [3]uint16
+		err      bool
+	}{
+		{name: "default tick", cfg: watchdog.Config{PDI: 100 * time.Millisecond, ProcessData: 10 * time.Millisecond}, expected: [3]uint16{2498, 1000, 100}},
+		{name: "rounded up", cfg: watchdog.Config{Tick: time.Microsecond, ProcessData: 1500 * time.Nanosecond}, expected: [3]uint16{23, 0, 2}},
+		{name: "tick too short", cfg: watchdog.Config{Tick: 40 * time.Nanosecond}, err: true},
+		{name: "time too long", cfg: watchdog.Config{ProcessData: 7 * time.Second}, err: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			// when
+			divider, pdi, processData, err := tt.cfg.Registers()
+
+			// then
+			if tt.err {
+				if err == nil {
+					t.Errorf("Expected an error, but got %d, %d, %d", divider, pdi, processData)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if actual := [3]uint16{divider, pdi, processData}; actual != tt.expected {
+				t.Errorf("Expected %v, but got %v", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestParseStatus(t *testing.T) {
+	// given
+	data := []byte{0xfe, 0x00, 0x03, 0x01}
+
+	// when
+	status, err := watchdog.ParseStatus(data)
+	_, shortErr := watchdog.ParseStatus(data[:3])
+
+	// then
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if expected := (watchdog.Status{ProcessDataExpired: true, ProcessDataCount: 3, PDICount: 1}); status != expected {
+		t.Errorf("Expected %+v, but got %+v", expected, status)
+	}
+	if shortErr == nil {
+		t.Errorf("Expected an error for a short status")
+	}
+}
+
+func TestMonitor(t *testing.T) {
+	// given
+	esc := simulator.NewESC(simulator.Config{EEPROM: sii.Info{}.Encode()})
+	tr := transceiver.New(simulator.NewRing(esc).Attach(), transceiver.Options{Encapsulation: encap})
+	t.Cleanup(func() { tr.Close() })
+	ctx := context.Background()
+	slaves, err := scan.Scan(ctx, tr, scan.Options{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	station := slaves[0].Station
+	outputs := &syncmanager.SyncManager{
+		Start: register.ProcessDataRAM, Length: 1,
+		CtrlStatus: syncmanager.CtrlStatus{IsTriggerWatchdog: true, Access: 0x1},
+		Enable:     syncmanager.Enable{IsEnable: true},
+	}
+	for _, d := range []datagram.Datagram{
+		datagram.FPWR(station, register.SM(2), outputs),
+		datagram.FPWR(station, register.ALControl, payload.BasicPayload{Data: []byte{byte(al.PreOp), 0}}),
+		datagram.FPWR(station, register.ALControl, payload.BasicPayload{Data: []byte{byte(al.SafeOp), 0}}),
+		datagram.FPWR(station, register.ALControl, payload.BasicPayload{Data: []byte{byte(al.Op), 0}}),
+	} {
+		if _, err := tr.ExchangeExpect(ctx, d, transceiver.ExpectWKC(1)); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	configureErr := watchdog.Configure(ctx, tr, station, watchdog.Config{ProcessData: time.Millisecond})
+	m := watchdog.NewMonitor(tr, slaves)
+
+	// when
+	tr.Exchange(ctx, datagram.FPWR(station, register.ProcessDataRAM, payload.BasicPayload{Data: []byte{0x01}}))
+	before, beforeErr := m.Poll(ctx)
+	time.Sleep(5 * time.Millisecond)
+	esc.Write(register.WatchdogCounterPDI, []byte{2})
+	after, afterErr := m.Poll(ctx)
+	again, _ := m.Poll(ctx)
+
+	// then
+	for _, err := range []error{configureErr, beforeErr, afterErr} {
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if len(before) != 0 || len(again) != 0 {
+		t.Errorf("Expected no events while the watchdog runs and after it was reported, but got %v and %v", before, again)
+	}
+	kinds := make([]watchdog.Kind, len(after))
+	for i, e := range after {
+		kinds[i] = e.Kind
+	}
+	if !reflect.DeepEqual(kinds, []watchdog.Kind{watchdog.ProcessData, watchdog.PDI}) {
+		t.Fatalf("Expected a process data and a PDI expiration, but got %v", after)
+	}
+	if s := after[0].String(); s != "slave 0: process data watchdog expired, outputs disabled" {
+		t.Errorf("Unexpected event %q", s)
+	}
+	if s := after[1].String(); s != "slave 0: PDI watchdog expired 2 times" {
+		t.Errorf("Unexpected event %q", s)
+	}
+	if state := esc.ALState(); state != al.SafeOp|al.Error {
+		t.Errorf("Expected the slave to drop to SAFE-OP with an error, but got %v", state)
+	}
+}
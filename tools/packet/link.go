@@ -0,0 +1,98 @@
+package packet
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/Aruminium/goecat/pkg/link"
+	"github.com/Aruminium/goecat/tools/network"
+	"github.com/google/gopacket/pcap"
+)
+
+const (
+	snapshotLength int32         = 1600
+	readTimeout    time.Duration = 10 * time.Millisecond
+)
+
+// PcapLink adapts a pcap handle to link.Link so it can be shared through a transceiver.
+type PcapLink struct {
+	handle *pcap.Handle
+	closed atomic.Bool
+}
+
+// NewPcapLink creates a link.Link on an opened pcap handle.
+// Only incoming frames are captured, so the master does not read back its own frames.
+//
+// Parameters:
+//   - handle (*pcap.Handle): Handle opened with pcap.OpenLive
+//
+// Returns:
+//   - *PcapLink: New link owning the handle
+//   - error: Error if the capture direction cannot be set
+func NewPcapLink(handle *pcap.Handle) (*PcapLink, error) {
+	if err := handle.SetDirection(pcap.DirectionIn); err != nil {
+		return nil, err
+	}
+	return &PcapLink{handle: handle}, nil
+}
+
+// Open opens a network interface with pcap and returns the link together with the
+// encapsulation that addresses frames from the interface.
+//
+// Parameters:
+//   - device (string): Network interface connected to the segment
+//   - transport (link.Transport): link.Raw or link.UDP
+//
+// Returns:
+//   - *PcapLink: New link on the interface
+//   - link.Encapsulation: Encapsulation with the MAC and IPv4 addresses of the interface
+//   - error: Error if the interface cannot be opened
+func Open(device string, transport link.Transport) (*PcapLink, link.Encapsulation, error) {
+	mac, ip, broadcast, err := network.AskNetworkInfo(device)
+	if err != nil {
+		return nil, link.Encapsulation{}, err
+	}
+	encap := link.Encapsulation{Transport: transport, SrcMAC: mac, SrcIP: ip, DstIP: broadcast}
+
+	handle, err := pcap.OpenLive(device, snapshotLength, true, readTimeout)
+	if err != nil {
+		return nil, link.Encapsulation{}, err
+	}
+	l, err := NewPcapLink(handle)
+	if err != nil {
+		handle.Close()
+		return nil, link.Encapsulation{}, err
+	}
+	return l, encap, nil
+}
+
+func (p *PcapLink) Send(frame []byte) error {
+	if p.closed.Load() {
+		return link.ErrClosed
+	}
+	return p.handle.WritePacketData(frame)
+}
+
+func (p *PcapLink) Receive() ([]byte, error) {
+	for {
+		if p.closed.Load() {
+			return nil, link.ErrClosed
+		}
+
+		data, _, err := p.handle.ReadPacketData()
+		if err == pcap.NextErrorTimeoutExpired {
+			continue
+		}
+		if err != nil && p.closed.Load() {
+			return nil, link.ErrClosed
+		}
+		return data, err
+	}
+}
+
+func (p *PcapLink) Close() error {
+	if p.closed.CompareAndSwap(false, true) {
+		p.handle.Close()
+	}
+	return nil
+}
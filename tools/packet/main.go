@@ -4,12 +4,16 @@ import (
 	"net"
 
 	"github.com/Aruminium/goecat/pkg/ethercat"
+	"github.com/Aruminium/goecat/pkg/layer"
 	"github.com/Aruminium/goecat/tools/network"
 	"github.com/google/gopacket"
 	"github.com/google/gopacket/layers"
 	"github.com/google/gopacket/pcap"
 )
 
+// EtherCATPacket builds and sends a single EtherCAT frame over UDP.
+// It is not safe for concurrent use because Send replaces Ecat; share the wire
+// between goroutines with a transceiver on a PcapLink instead.
 type EtherCATPacket struct {
 	Ethernet *layers.Ethernet
 	IPv4     *layers.IPv4
@@ -55,7 +59,7 @@ func (p *EtherCATPacket) Send(handle *pcap.Handle, options gopacket.SerializeOpt
 		p.Ethernet,
 		p.IPv4,
 		p.UDP,
-		gopacket.Payload(p.Ecat.Bytes()),
+		&layer.EtherCAT{Frame: p.Ecat},
 	)
 
 	data := buffer.Bytes()